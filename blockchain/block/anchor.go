@@ -0,0 +1,107 @@
+package block
+
+import (
+	"blockchain/merkle"
+	"bytes"
+	"errors"
+)
+
+// 数据锚定
+// 交易的数据输出携带文档哈希等摘要 交易被打包后 区块的时间戳证明数据在该时间之前已经存在
+// 锚定证明包含区块头和交易的Merkle证明 验证方由证明算出Merkle根 再检查区块哈希和工作量证明
+
+var (
+	ErrTooManyDataOutputs = errors.New("transaction has more than one data output")
+	ErrAnchorNotFound     = errors.New("data is not anchored on the chain")
+	ErrInvalidAnchorProof = errors.New("anchor proof does not match the block")
+)
+
+// 检查数据输出 每笔交易最多一个 数据不超过上限
+func (tx *Transaction) checkDataOutputs() error {
+	found := false
+	for _, vout := range tx.Vouts {
+		if !vout.IsUnspendable() {
+			continue
+		}
+		if found {
+			return ErrTooManyDataOutputs
+		}
+		found = true
+		if _, err := vout.Data(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AnchorProof 数据已被打包的证明
+type AnchorProof struct {
+	Data          []byte
+	Tx            *Transaction // 携带数据的交易
+	BlockHash     []byte
+	PrevBlockHash []byte
+	Height        int64
+	TimeStamp     int64
+	Nonce         int64
+	Proof         *merkle.Proof // 交易在区块中的Merkle证明
+}
+
+// FindAnchor 从最新区块开始查找携带data的数据输出 返回锚定证明
+func (c *Chain) FindAnchor(data []byte) (*AnchorProof, error) {
+	it := c.NewIterator()
+	for {
+		block := it.Next()
+		for index, tx := range block.Txs {
+			if !tx.hasData(data) {
+				continue
+			}
+			var txHashes [][]byte
+			for _, t := range block.Txs {
+				txHashes = append(txHashes, t.TxHash)
+			}
+			proof, err := merkle.NewProof(txHashes, index)
+			if err != nil {
+				return nil, err
+			}
+			return &AnchorProof{
+				Data:          data,
+				Tx:            tx,
+				BlockHash:     block.Hash,
+				PrevBlockHash: block.PrevBlockHash,
+				Height:        block.Height,
+				TimeStamp:     block.TimeStamp,
+				Nonce:         block.Nonce,
+				Proof:         proof,
+			}, nil
+		}
+		if isBreakLoop(block.PrevBlockHash) {
+			return nil, ErrAnchorNotFound
+		}
+	}
+}
+
+// 交易是否有携带data的数据输出
+func (tx *Transaction) hasData(data []byte) bool {
+	for _, vout := range tx.Vouts {
+		if vout.IsUnspendable() {
+			if d, err := vout.Data(); err == nil && bytes.Equal(d, data) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Verify 检查交易携带数据且为证明的叶节点 由Merkle证明和区块头算出的哈希等于区块哈希且满足难度要求
+// 交易哈希生成时加入了时间戳 不能由交易内容重新计算 证明只说明该哈希的交易在区块中 交易内容由本地区块链提供
+// 不检查区块是否在主链上 由调用方确认
+func (p *AnchorProof) Verify() error {
+	if p.Tx == nil || p.Proof == nil || !p.Tx.hasData(p.Data) || !bytes.Equal(p.Proof.Leaf, p.Tx.TxHash) {
+		return ErrInvalidAnchorProof
+	}
+	pow := NewProofOfWork(&Block{Height: p.Height, TimeStamp: p.TimeStamp, PrevBlockHash: p.PrevBlockHash, Hash: p.BlockHash, Nonce: p.Nonce})
+	if !pow.validateHeader(p.Proof.Root()) {
+		return ErrInvalidAnchorProof
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package block
+
+import (
+	"blockchain/script"
+	"blockchain/wallet"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+// 携带文档哈希的交易被打包后 锚定证明可以由区块头独立验证
+func TestAnchor(t *testing.T) {
+	tc := newTestChain(t, 0)
+	utxoSet := &UTXOSet{Chain: tc.Chain}
+	digest := sha256.Sum256([]byte("document"))
+	payee := string(wallet.NewWallet().GetAddress())
+	opts := &SendOptions{Selector: DefaultCoinSelector, Dust: -1}
+	builder := NewTxBuilder(tc.Chain, nil).From(tc.address()).AddOutput(payee, 3).AddData(digest[:]).Options(opts)
+	tx, _, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Sign(tx, wallet.NewMemoryWallets(tc.owner)); err != nil {
+		t.Fatal(err)
+	}
+	last := tx.Vouts[len(tx.Vouts)-1]
+	if data, err := last.Data(); !last.IsUnspendable() || last.Value != 0 || !bytes.Equal(data, digest[:]) || err != nil {
+		t.Fatalf("last output = %d with data %x, %v, want the data output", last.Value, data, err)
+	}
+	if last.UnLockScriptPubkeyWithAddress(tc.address()) {
+		t.Fatal("the data output belongs to an address")
+	}
+	tc.MineBlock([]*Transaction{tx}, tc.address())
+	utxoSet.UpdateUTXOSet()
+	// 数据输出之前的输出仍可花费 之后的区块不再包含锚定交易
+	change := tc.spend(tx, 1, tx.Vouts[1].Value)
+	tc.MineBlock([]*Transaction{change}, tc.address())
+	utxoSet.UpdateUTXOSet()
+	updated := utxoSet.Digest()
+	utxoSet.ResetUTXOSet()
+	if !bytes.Equal(updated, utxoSet.Digest()) {
+		t.Fatal("updated UTXO set differs from the rebuilt one")
+	}
+	if balance := utxoSet.GetBalance(payee); balance != 3 {
+		t.Fatalf("balance of payee = %d, want 3", balance)
+	}
+
+	proof, err := tc.FindAnchor(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proof.Tx.TxHash, tx.TxHash) {
+		t.Fatalf("anchor transaction = %x, want %x", proof.Tx.TxHash, tx.TxHash)
+	}
+	if err := proof.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	tampers := map[string]func(p *AnchorProof){
+		"data":       func(p *AnchorProof) { p.Data = []byte("other document") },
+		"time stamp": func(p *AnchorProof) { p.TimeStamp++ },
+		"height":     func(p *AnchorProof) { p.Height++ },
+		"leaf":       func(p *AnchorProof) { p.Proof.Leaf = change.TxHash },
+	}
+	for name, tamper := range tampers {
+		p, err := tc.FindAnchor(digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		tamper(p)
+		if err := p.Verify(); !errors.Is(err, ErrInvalidAnchorProof) {
+			t.Fatalf("Verify() with modified %s = %v, want %v", name, err, ErrInvalidAnchorProof)
+		}
+	}
+	if _, err := tc.FindAnchor([]byte("unknown")); !errors.Is(err, ErrAnchorNotFound) {
+		t.Fatalf("FindAnchor(unknown) = %v, want %v", err, ErrAnchorNotFound)
+	}
+}
+
+func TestDataOutputs(t *testing.T) {
+	tc := newTestChain(t, 0)
+	prev := tc.genesis.Txs[0]
+	if _, err := NewDataOutput(make([]byte, script.MaxDataCarrierSize+1)); err == nil {
+		t.Fatal("NewDataOutput() accepted data larger than the limit")
+	}
+	if _, _, err := NewTxBuilder(tc.Chain, nil).From(tc.address()).AddData(make([]byte, script.MaxDataCarrierSize+1)).Build(); err == nil {
+		t.Fatal("Build() accepted data larger than the limit")
+	}
+	tx := tc.spend(prev, 0, BlockSubsidy)
+	for i := 0; i < 2; i++ {
+		out, err := NewDataOutput([]byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Vouts = append(tx.Vouts, out)
+	}
+	if err := tx.CheckValues(); err != nil {
+		t.Fatalf("CheckValues() with zero-value data outputs = %v", err)
+	}
+	if err := tx.VerifyScripts([]*TxOutput{prev.Vouts[0]}, 1); !errors.Is(err, ErrTooManyDataOutputs) {
+		t.Fatalf("VerifyScripts() = %v, want %v", err, ErrTooManyDataOutputs)
+	}
+}
@@ -4,6 +4,7 @@ package block
 
 import (
 	"blockchain/merkle"
+	"blockchain/script"
 	"blockchain/utils"
 	"bytes"
 	"crypto/sha256"
@@ -75,12 +76,22 @@ func (b *Block) Serialize() []byte {
 
 // DeserializeBlock 区块数据反序列化
 func DeserializeBlock(blockBytes []byte) *Block {
+	block, err := DecodeBlock(blockBytes)
+	if err != nil {
+		log.Panicf("decode block error:%v", err)
+	}
+	return block
+}
+
+// DecodeBlock 区块数据反序列化 解析失败时返回错误
+// 用于处理来自其他节点的不可信数据
+func DecodeBlock(blockBytes []byte) (*Block, error) {
 	var block Block
 	decoder := gob.NewDecoder(bytes.NewReader(blockBytes)) // 创建解码对象
 	if err := decoder.Decode(&block); err != nil {
-		log.Panicf("decode block error:%v", err)
+		return nil, err
 	}
-	return &block
+	return &block, nil
 }
 
 // PrintBlock 打印区块信息
@@ -94,28 +105,45 @@ func (b *Block) PrintBlock() {
 
 	for _, tx := range b.Txs {
 		fmt.Printf("\ttx-hash: %x\n", tx.TxHash)
+		fmt.Printf("\ttx-version: %d\n", tx.Version)
+		if tx.LockTime != 0 {
+			fmt.Printf("\ttx-locktime: %d\n", tx.LockTime)
+		}
 		fmt.Printf("\tinput...\n")
 		for _, vin := range tx.Vins {
 			fmt.Printf("\t\tvin-txHash: %x\n", vin.TxHash)
 			fmt.Printf("\t\tvin-vout: %v\n", vin.Vout)
 			fmt.Printf("\t\tvin-PublicKey: %x\n", vin.PublicKey)
 			fmt.Printf("\t\tvin-Signature: %x\n", vin.Signature)
+			if vin.Script != nil {
+				fmt.Printf("\t\tvin-Script: %s\n", script.Disasm(vin.Script))
+			}
+			if vin.Sequence != 0 {
+				fmt.Printf("\t\tvin-Sequence: %#x\n", vin.Sequence)
+			}
 		}
 		fmt.Printf("\toutput...\n")
 		for _, vout := range tx.Vouts {
 			fmt.Printf("\t\tvout-value: %d\n", vout.Value)
 			fmt.Printf("\t\tvout-Ripemd160Hash: %x\n", vout.Ripemd160Hash)
+			if vout.Script != nil {
+				fmt.Printf("\t\tvout-Script: %s\n", script.Disasm(vout.Script))
+			}
 		}
 	}
 }
 
 // HashTransaction 将指定区块交易结构序列化
 func (b *Block) HashTransaction() []byte {
-	var txHashes [][]byte
+	return b.MerkleTree().Root.Data
+}
+
+// MerkleTree 以区块中交易哈希为叶节点的Merkle树
+func (b *Block) MerkleTree() *merkle.Tree {
+	txHashes := make([][]byte, 0, len(b.Txs))
 	// 将指定区块中所有交易哈希进行拼接
 	for _, tx := range b.Txs {
 		txHashes = append(txHashes, tx.TxHash)
 	}
-	tree := merkle.NewTree(txHashes) // 使用Merkle树计算哈希值
-	return tree.Root.Data
+	return merkle.NewTree(txHashes) // 使用Merkle树计算哈希值
 }
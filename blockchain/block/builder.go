@@ -0,0 +1,145 @@
+package block
+
+import (
+	"blockchain/wallet"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+)
+
+// 交易构造器
+// 一笔交易可以包含多个收款输出 由钱包中的一个或多个地址出资 只生成一个找零输出和一份手续费
+// 输入从UTXOSource中选择 完整节点使用区块链 轻节点使用钱包跟踪的输出
+
+var (
+	ErrNoOutputs     = errors.New("transaction has no outputs")
+	ErrNoFunding     = errors.New("transaction has no funding address")
+	ErrInvalidAmount = errors.New("amount must be positive")
+)
+
+// UTXOSource 交易构造器选择输入和查找引用交易的数据来源
+type UTXOSource interface {
+	// SelectCoins 从地址列表from的未花费输出中选择支付amount的输入 txs为尚未打包的交易
+	SelectCoins(from []string, amount int, outputs int, txs []*Transaction, opts *SendOptions) (*CoinSelection, error)
+	// LookupTransaction 查找输入引用的交易
+	LookupTransaction(txHash []byte) (*Transaction, bool)
+}
+
+// TxBuilder 交易构造器
+type TxBuilder struct {
+	source  UTXOSource
+	txs     []*Transaction // 同一区块中尚未打包的交易
+	from    []string       // 出资地址
+	outputs []*TxOutput
+	data    []byte // 数据输出携带的数据 为nil时不生成数据输出
+	change  string // 找零地址 为空时使用第一个出资地址
+	opts    *SendOptions
+}
+
+// NewTxBuilder 创建交易构造器 source通常为区块链 txs为同一区块中尚未打包的交易
+func NewTxBuilder(source UTXOSource, txs []*Transaction) *TxBuilder {
+	return &TxBuilder{source: source, txs: txs, opts: DefaultSendOptions()}
+}
+
+// From 添加出资地址
+func (b *TxBuilder) From(addresses ...string) *TxBuilder {
+	b.from = append(b.from, addresses...)
+	return b
+}
+
+// AddOutput 添加收款输出
+func (b *TxBuilder) AddOutput(address string, amount int) *TxBuilder {
+	b.outputs = append(b.outputs, NewTxOutput(amount, address))
+	return b
+}
+
+// AddData 添加数据输出 数据输出放在找零之后 交易中最多一个
+func (b *TxBuilder) AddData(data []byte) *TxBuilder {
+	b.data = append([]byte{}, data...)
+	return b
+}
+
+// Change 设置找零地址
+func (b *TxBuilder) Change(address string) *TxBuilder {
+	b.change = address
+	return b
+}
+
+// Options 设置选币参数
+func (b *TxBuilder) Options(opts *SendOptions) *TxBuilder {
+	b.opts = opts
+	return b
+}
+
+// Build 选择输入并生成未签名的交易
+// 没有收款输出时须手动指定输入 输入扣除手续费后全部转入找零地址
+func (b *TxBuilder) Build() (*Transaction, *CoinSelection, error) {
+	if len(b.outputs) == 0 && b.data == nil && len(b.opts.Inputs) == 0 {
+		return nil, nil, ErrNoOutputs
+	}
+	if len(b.from) == 0 {
+		return nil, nil, ErrNoFunding
+	}
+	amount := 0
+	for _, out := range b.outputs {
+		if out.Value <= 0 {
+			return nil, nil, ErrInvalidAmount
+		}
+		amount += out.Value
+	}
+	outputs := len(b.outputs)
+	var dataOutput *TxOutput
+	if b.data != nil {
+		var err error
+		if dataOutput, err = NewDataOutput(b.data); err != nil {
+			return nil, nil, err
+		}
+		outputs++
+	}
+	selection, err := b.source.SelectCoins(b.from, amount, outputs, b.txs, b.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx := &Transaction{Vouts: append([]*TxOutput(nil), b.outputs...), Version: TxVersion, LockTime: b.opts.LockTime}
+	for _, utxo := range selection.Inputs {
+		tx.Vins = append(tx.Vins, &TxInput{TxHash: utxo.TxHash, Vout: utxo.Index, Sequence: b.opts.sequence()})
+	}
+	if selection.Change > 0 {
+		change := b.change
+		if change == "" {
+			change = b.from[0]
+		}
+		tx.Vouts = append(tx.Vouts, NewTxOutput(selection.Change, change))
+	}
+	if dataOutput != nil {
+		tx.Vouts = append(tx.Vouts, dataOutput)
+	}
+	if len(tx.Vouts) == 0 {
+		return nil, nil, ErrInsufficientFunds
+	}
+	return tx, selection, nil
+}
+
+// Sign 使用钱包中输入所属地址的私钥签名
+func (b *TxBuilder) Sign(tx *Transaction, wallets *wallet.Wallets) error {
+	prevTxs := make(map[string]Transaction)
+	keys := make([]ecdsa.PrivateKey, len(tx.Vins))
+	for i, vin := range tx.Vins {
+		prevTx, ok := b.lookup(vin.TxHash)
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vouts) || prevTx.Vouts[vin.Vout] == nil {
+			return fmt.Errorf("previous transaction[%x] not found", vin.TxHash)
+		}
+		prevTxs[fmt.Sprintf("%x", prevTx.TxHash)] = *prevTx
+		address := prevTx.Vouts[vin.Vout].Address()
+		w, err := wallets.GetWallet(address)
+		if err != nil {
+			return fmt.Errorf("cannot sign for address[%s]: %w", address, err)
+		}
+		vin.PublicKey = w.PublicKey
+		keys[i] = w.PrivateKey
+	}
+	tx.HashTransaction()
+	tx.SignInputs(keys, prevTxs)
+	return nil
+}
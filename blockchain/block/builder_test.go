@@ -0,0 +1,79 @@
+package block
+
+import (
+	"blockchain/wallet"
+	"errors"
+	"testing"
+)
+
+// 一笔交易向多个地址付款 由两个地址出资 只生成一个找零输出
+func TestTxBuilderBatch(t *testing.T) {
+	tc := newTestChain(t, 0)
+	second := wallet.NewWallet()
+	tc.MineBlock(nil, string(second.GetAddress()))
+	wallets := wallet.NewMemoryWallets(tc.owner, second)
+	recipients := []string{
+		string(wallet.NewWallet().GetAddress()),
+		string(wallet.NewWallet().GetAddress()),
+		string(wallet.NewWallet().GetAddress()),
+	}
+	change := string(wallet.NewWallet().GetAddress())
+
+	builder := NewTxBuilder(tc.Chain, nil).From(tc.address(), string(second.GetAddress())).Change(change)
+	amounts := []int{8, 7, 1}
+	for i, address := range recipients {
+		builder.AddOutput(address, amounts[i])
+	}
+	tx, selection, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.Vins) != 2 || selection.Change != 2*BlockSubsidy-16 {
+		t.Fatalf("%d inputs and change %d, want both coinbases and change %d", len(tx.Vins), selection.Change, 2*BlockSubsidy-16)
+	}
+	if len(tx.Vouts) != len(recipients)+1 {
+		t.Fatalf("%d outputs, want %d payments and the change", len(tx.Vouts), len(recipients))
+	}
+	for i, address := range append(recipients, change) {
+		if got := tx.Vouts[i].Address(); got != address {
+			t.Fatalf("output %d pays %s, want %s", i, got, address)
+		}
+	}
+	if err := builder.Sign(tx, wallets); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.ValidateBlock(tc.block(tc.GetLatestBlock(), tx)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 缺少出资地址的私钥时不能签名
+	unsigned, _, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := builder.Sign(unsigned, wallet.NewMemoryWallets(tc.owner)); !errors.Is(err, wallet.ErrWalletNotFound) {
+		t.Fatalf("Sign() without the second key = %v, want %v", err, wallet.ErrWalletNotFound)
+	}
+}
+
+func TestTxBuilderErrors(t *testing.T) {
+	tc := newTestChain(t, 0)
+	payee := string(wallet.NewWallet().GetAddress())
+	tests := []struct {
+		name    string
+		builder *TxBuilder
+		err     error
+	}{
+		{"no outputs", NewTxBuilder(tc.Chain, nil).From(tc.address()), ErrNoOutputs},
+		{"no funding address", NewTxBuilder(tc.Chain, nil).AddOutput(payee, 1), ErrNoFunding},
+		{"zero amount", NewTxBuilder(tc.Chain, nil).From(tc.address()).AddOutput(payee, 1).AddOutput(payee, 0), ErrInvalidAmount},
+		{"insufficient funds", NewTxBuilder(tc.Chain, nil).From(tc.address()).AddOutput(payee, 6).AddOutput(payee, BlockSubsidy-5), ErrInsufficientFunds},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := test.builder.Build(); !errors.Is(err, test.err) {
+				t.Fatalf("Build() = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package block
+
+import (
+	"blockchain/gcs"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"log"
+)
+
+// 区块过滤器
+// 每个区块的过滤器是输出公钥哈希和非coinbase输入花费的输出位置组成的Golomb编码集合 以区块哈希为密钥
+// 轻节点下载过滤器在本地匹配钱包地址和输出 只请求匹配的完整区块 不向完整节点透露地址
+// 过滤器头由过滤器哈希和父区块的过滤器头计算 形成与区块链对应的链 轻节点用其检查对方提供的过滤器
+
+const cfilterTableName = "cfilters" // 区块过滤器表
+
+var ErrFilterRange = errors.New("invalid filter range")
+
+// CFilter 区块过滤器及其过滤器头
+type CFilter struct {
+	Filter []byte // 序列化的Golomb编码集合
+	Header []byte // 过滤器头
+}
+
+// OutPointElement 输出位置在过滤器中的元素 交易哈希之后为4字节的输出索引
+func OutPointElement(txHash []byte, index int) []byte {
+	element := make([]byte, len(txHash)+4)
+	copy(element, txHash)
+	binary.BigEndian.PutUint32(element[len(txHash):], uint32(index))
+	return element
+}
+
+// FilterKey 区块过滤器的密钥 区块哈希的前16字节
+func FilterKey(blockHash []byte) [gcs.KeySize]byte {
+	var key [gcs.KeySize]byte
+	copy(key[:], blockHash)
+	return key
+}
+
+// FilterElements 区块过滤器的元素 所有输出的公钥(脚本)哈希和非coinbase交易花费的输出位置
+func FilterElements(b *Block) [][]byte {
+	var elements [][]byte
+	for _, tx := range b.Txs {
+		for _, vout := range tx.Vouts {
+			if len(vout.Ripemd160Hash) != 0 {
+				elements = append(elements, vout.Ripemd160Hash)
+			}
+		}
+		if tx.IsCoinbaseTransaction() {
+			continue
+		}
+		for _, vin := range tx.Vins {
+			elements = append(elements, OutPointElement(vin.TxHash, vin.Vout))
+		}
+	}
+	return elements
+}
+
+// NewBlockFilter 构造区块过滤器
+func NewBlockFilter(b *Block) *gcs.Filter {
+	return gcs.Build(FilterKey(b.Hash), FilterElements(b))
+}
+
+func doubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// FilterHash 序列化过滤器的哈希
+func FilterHash(filter []byte) []byte {
+	return doubleSha256(filter)
+}
+
+// FilterHeader 由过滤器哈希和父区块的过滤器头计算过滤器头 创世区块的父过滤器头为全零
+func FilterHeader(filterHash []byte, prevHeader []byte) []byte {
+	return doubleSha256(append(append([]byte{}, filterHash...), prevHeader...))
+}
+
+// ZeroFilterHeader 创世区块之前的过滤器头
+func ZeroFilterHeader() []byte {
+	return make([]byte, sha256.Size)
+}
+
+// 读取已保存的区块过滤器
+func (c *Chain) loadCFilter(hash []byte) *CFilter {
+	var filter *CFilter
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cfilterTableName))
+		if b == nil {
+			return nil
+		}
+		data := b.Get(hash)
+		if data == nil {
+			return nil
+		}
+		filter = &CFilter{}
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(filter)
+	})
+	if err != nil {
+		log.Panicf("load the filter of block[%x] failed: %v\n", hash, err)
+	}
+	return filter
+}
+
+// GetCFilter 获取区块的过滤器 未保存时由最近的已保存祖先(或创世区块)开始依次计算并保存
+// 区块可以在分叉上 过滤器头沿区块的祖先计算
+func (c *Chain) GetCFilter(hash []byte) (*CFilter, error) {
+	if filter := c.loadCFilter(hash); filter != nil {
+		return filter, nil
+	}
+	var blocks []*Block // 缺少过滤器的区块 从新到旧
+	prevHeader := ZeroFilterHeader()
+	for current := hash; ; {
+		blockBytes := c.GetBlock(current)
+		if blockBytes == nil {
+			return nil, fmt.Errorf("block[%x] not found", current)
+		}
+		b := DeserializeBlock(blockBytes)
+		blocks = append(blocks, b)
+		if isBreakLoop(b.PrevBlockHash) {
+			break
+		}
+		if prev := c.loadCFilter(b.PrevBlockHash); prev != nil {
+			prevHeader = prev.Header
+			break
+		}
+		current = b.PrevBlockHash
+	}
+
+	var filter *CFilter
+	err := c.DB.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(cfilterTableName))
+		if err != nil {
+			return err
+		}
+		for i := len(blocks) - 1; i >= 0; i-- {
+			data := NewBlockFilter(blocks[i]).Bytes()
+			filter = &CFilter{Filter: data, Header: FilterHeader(FilterHash(data), prevHeader)}
+			var result bytes.Buffer
+			if err := gob.NewEncoder(&result).Encode(filter); err != nil {
+				return err
+			}
+			if err := bucket.Put(blocks[i].Hash, result.Bytes()); err != nil {
+				return err
+			}
+			prevHeader = filter.Header
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panicf("save the block filters failed: %v\n", err)
+	}
+	return filter, nil
+}
+
+// 以stopHash结束的分支上从startHeight开始的区块 按高度排列 最多max个
+func (c *Chain) filterRange(startHeight int64, stopHash []byte, max int) ([]*Block, error) {
+	blockBytes := c.GetBlock(stopHash)
+	if blockBytes == nil {
+		return nil, fmt.Errorf("block[%x] not found", stopHash)
+	}
+	stop := DeserializeBlock(blockBytes)
+	if startHeight < 1 || startHeight > stop.Height || stop.Height-startHeight >= int64(max) {
+		return nil, fmt.Errorf("%w: heights %d to %d", ErrFilterRange, startHeight, stop.Height)
+	}
+	blocks := make([]*Block, stop.Height-startHeight+1)
+	blocks[len(blocks)-1] = stop
+	for i := len(blocks) - 2; i >= 0; i-- {
+		blockBytes := c.GetBlock(blocks[i+1].PrevBlockHash)
+		if blockBytes == nil {
+			return nil, fmt.Errorf("block[%x] not found", blocks[i+1].PrevBlockHash)
+		}
+		blocks[i] = DeserializeBlock(blockBytes)
+	}
+	return blocks, nil
+}
+
+// CFHeaders 以stopHash结束的分支上从startHeight开始的过滤器哈希 以及其前一个区块的过滤器头
+func (c *Chain) CFHeaders(startHeight int64, stopHash []byte, max int) ([]byte, [][]byte, error) {
+	blocks, err := c.filterRange(startHeight, stopHash, max)
+	if err != nil {
+		return nil, nil, err
+	}
+	prevHeader := ZeroFilterHeader()
+	if !isBreakLoop(blocks[0].PrevBlockHash) {
+		prev, err := c.GetCFilter(blocks[0].PrevBlockHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		prevHeader = prev.Header
+	}
+	var filterHashes [][]byte
+	for _, b := range blocks {
+		filter, err := c.GetCFilter(b.Hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		filterHashes = append(filterHashes, FilterHash(filter.Filter))
+	}
+	return prevHeader, filterHashes, nil
+}
+
+// CFilters 以stopHash结束的分支上从startHeight开始的区块哈希和过滤器
+func (c *Chain) CFilters(startHeight int64, stopHash []byte, max int) ([][]byte, []*CFilter, error) {
+	blocks, err := c.filterRange(startHeight, stopHash, max)
+	if err != nil {
+		return nil, nil, err
+	}
+	var hashes [][]byte
+	var filters []*CFilter
+	for _, b := range blocks {
+		filter, err := c.GetCFilter(b.Hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		hashes = append(hashes, b.Hash)
+		filters = append(filters, filter)
+	}
+	return hashes, filters, nil
+}
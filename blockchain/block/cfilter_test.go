@@ -0,0 +1,132 @@
+package block
+
+import (
+	"blockchain/gcs"
+	"blockchain/wallet"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// 过滤器包含所有输出的公钥哈希和非coinbase交易花费的输出位置
+func TestBlockFilter(t *testing.T) {
+	tc := newTestChain(t, 0)
+	coinbase := tc.genesis.Txs[0]
+	miner := wallet.NewWallet()
+	tx := tc.spend(coinbase, 0, 4, BlockSubsidy-4)
+	b := tc.MineBlock([]*Transaction{tx}, string(miner.GetAddress()))
+
+	if elements := FilterElements(b); len(elements) != 4 {
+		t.Fatalf("%d filter elements, want 3 outputs and 1 spent output", len(elements))
+	}
+	filter, err := gcs.FromBytes(NewBlockFilter(b).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		element []byte
+		match   bool
+	}{
+		{"payee", wallet.StringToHash160(tc.address()), true},
+		{"miner", wallet.StringToHash160(string(miner.GetAddress())), true},
+		{"spent output", OutPointElement(coinbase.TxHash, 0), true},
+		{"unspent output", OutPointElement(tx.TxHash, 0), false},
+		{"coinbase input", OutPointElement(b.Txs[0].Vins[0].TxHash, b.Txs[0].Vins[0].Vout), false},
+		{"other address", wallet.StringToHash160(string(wallet.NewWallet().GetAddress())), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if ok, err := filter.Match(FilterKey(b.Hash), test.element); ok != test.match || err != nil {
+				t.Fatalf("Match() = %v, %v, want %v", ok, err, test.match)
+			}
+		})
+	}
+	// 过滤器以区块哈希为密钥
+	if ok, _ := filter.Match(FilterKey(tc.genesis.Hash), wallet.StringToHash160(string(miner.GetAddress()))); ok {
+		t.Fatal("the filter matches with the key of another block")
+	}
+}
+
+// 过滤器头由过滤器哈希和父区块的过滤器头依次计算 与过滤器范围请求的结果一致
+func TestCFilterHeaders(t *testing.T) {
+	tc := newTestChain(t, 0)
+	blocks := []*Block{tc.genesis}
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, tc.MineBlock(nil, tc.address()))
+	}
+	tip := blocks[len(blocks)-1]
+	// 先获取最新区块的过滤器 祖先的过滤器随之计算
+	if _, err := tc.GetCFilter(tip.Hash); err != nil {
+		t.Fatal(err)
+	}
+	headers := [][]byte{ZeroFilterHeader()}
+	for _, b := range blocks {
+		filter, err := tc.GetCFilter(b.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(filter.Filter, NewBlockFilter(b).Bytes()) {
+			t.Fatalf("filter of block %d differs from NewBlockFilter", b.Height)
+		}
+		if header := FilterHeader(FilterHash(filter.Filter), headers[len(headers)-1]); !bytes.Equal(filter.Header, header) {
+			t.Fatalf("filter header of block %d does not follow its parent", b.Height)
+		}
+		headers = append(headers, filter.Header)
+	}
+
+	prevHeader, filterHashes, err := tc.CFHeaders(2, tip.Hash, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(prevHeader, headers[1]) || len(filterHashes) != 3 {
+		t.Fatalf("CFHeaders(2) = %x and %d hashes, want the header of block 1 and 3 hashes", prevHeader, len(filterHashes))
+	}
+	hashes, filters, err := tc.CFilters(1, tip.Hash, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range blocks {
+		if !bytes.Equal(hashes[i], b.Hash) || !bytes.Equal(filters[i].Header, headers[i+1]) {
+			t.Fatalf("CFilters(1) result %d is not block %d", i, b.Height)
+		}
+		if i > 0 && !bytes.Equal(FilterHash(filters[i].Filter), filterHashes[i-1]) {
+			t.Fatalf("filter hash of block %d differs from CFHeaders", b.Height)
+		}
+	}
+}
+
+func TestFilterRange(t *testing.T) {
+	tc := newTestChain(t, 0)
+	for i := 0; i < 3; i++ {
+		tc.MineBlock(nil, tc.address())
+	}
+	tip := tc.GetLatestBlock()
+	tests := []struct {
+		name        string
+		startHeight int64
+		stopHash    []byte
+		max         int
+		err         error
+	}{
+		{"whole chain", 1, tip.Hash, 4, nil},
+		{"single block", 4, tip.Hash, 1, nil},
+		{"start before genesis", 0, tip.Hash, 4, ErrFilterRange},
+		{"start after stop", 5, tip.Hash, 4, ErrFilterRange},
+		{"too many blocks", 1, tip.Hash, 3, ErrFilterRange},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, err := tc.CFHeaders(test.startHeight, test.stopHash, test.max); !errors.Is(err, test.err) {
+				t.Fatalf("CFHeaders() = %v, want %v", err, test.err)
+			}
+			if _, _, err := tc.CFilters(test.startHeight, test.stopHash, test.max); !errors.Is(err, test.err) {
+				t.Fatalf("CFilters() = %v, want %v", err, test.err)
+			}
+		})
+	}
+	// 未知的区块不是无效范围 可能在本节点没有的分叉上
+	if _, _, err := tc.CFHeaders(1, []byte("unknown block"), 4); err == nil || errors.Is(err, ErrFilterRange) {
+		t.Fatalf("CFHeaders(unknown block) = %v, want a missing block error", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/boltdb/bolt"
 	"log"
@@ -24,8 +25,9 @@ const (
 
 // Chain 区块链的基本结构
 type Chain struct {
-	DB  *bolt.DB // 数据库连接
-	Tip []byte   // 最新区块的哈希
+	DB       *bolt.DB // 数据库连接
+	Tip      []byte   // 最新区块的哈希
+	Maturity int64    // 挖矿奖励可以花费前需要的确认数
 }
 
 func IsDBExists(nodeId string) bool {
@@ -41,27 +43,51 @@ func GetBlockChainObject(nodeId string) *Chain {
 		os.Exit(1)
 	}
 
-	name := fmt.Sprintf(dbName, nodeId)
-	db, err := bolt.Open(name, 0600, nil)
+	chain, err := OpenChain(fmt.Sprintf(dbName, nodeId))
+	if errors.Is(err, ErrDBVersion) {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Panicf("get the blockchain object failed %v\n", err)
+	}
+	return chain
+}
+
+// OpenChain 打开指定数据库文件中的区块链 格式版本不符时返回ErrDBVersion
+func OpenChain(path string) (*Chain, error) {
+	db, err := bolt.Open(path, 0600, nil)
 	if err != nil {
-		log.Panicf("open the db [%s] failed %v\n", dbName, err)
+		return nil, err
 	}
 	var tip []byte
+	var maturity int64
 	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blockTableName))
-		if b != nil {
-			tip = b.Get([]byte("l"))
+		if b == nil {
+			return nil
 		}
+		if e := checkDBVersion(b, path); e != nil {
+			return e
+		}
+		tip = append([]byte{}, b.Get([]byte("l"))...)
+		maturity = getMaturity(b)
 		return nil
 	})
 	if err != nil {
-		log.Panicf("get the blockchain object failed %v\n", err)
+		db.Close()
+		return nil, err
+	}
+	chain := &Chain{db, tip, maturity}
+	if err := chain.upgradeDB(); err != nil {
+		db.Close()
+		return nil, err
 	}
-	return &Chain{db, tip}
+	return chain, nil
 }
 
-// CreateBlockChainWithGenesisBlock 创建区块链
-func CreateBlockChainWithGenesisBlock(address string, nodeId string) *Chain {
+// CreateBlockChainWithGenesisBlock 创建区块链 挖矿奖励须经过maturity个确认才能花费
+func CreateBlockChainWithGenesisBlock(address string, maturity int64, nodeId string) *Chain {
 	if IsDBExists(nodeId) {
 		fmt.Println("GenesisBlock Exists")
 		os.Exit(1)
@@ -95,13 +121,55 @@ func CreateBlockChainWithGenesisBlock(address string, nodeId string) *Chain {
 			if e != nil {
 				log.Panicf("put latest block error: %v", e)
 			}
+			if e = putMaturity(bucket, maturity); e != nil {
+				log.Panicf("put coinbase maturity error: %v", e)
+			}
+			if e = putDBVersion(bucket); e != nil {
+				log.Panicf("put db version error: %v", e)
+			}
 		}
 		return nil
 	})
 	if err != nil {
 		log.Panicf("boltdb update error: %v", err)
 	}
-	return &Chain{DB: db, Tip: blockHash}
+	return &Chain{DB: db, Tip: blockHash, Maturity: maturity}
+}
+
+// NewChainWithGenesis 在指定的数据库文件中以给定的创世区块创建区块链
+// 多个节点使用同一个创世区块和成熟度时处于同一网络
+func NewChainWithGenesis(path string, genesis *Block, maturity int64) (*Chain, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bucket, e := tx.CreateBucketIfNotExists([]byte(blockTableName))
+		if e != nil {
+			return e
+		}
+		if bucket.Get([]byte("l")) != nil {
+			return fmt.Errorf("blockchain in [%s] already exists", path)
+		}
+		if e = bucket.Put(genesis.Hash, genesis.Serialize()); e != nil {
+			return e
+		}
+		if e = putMaturity(bucket, maturity); e != nil {
+			return e
+		}
+		if e = putDBVersion(bucket); e != nil {
+			return e
+		}
+		return bucket.Put([]byte("l"), genesis.Hash)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	chain := &Chain{DB: db, Tip: genesis.Hash, Maturity: maturity}
+	utxoSet := UTXOSet{Chain: chain}
+	utxoSet.ResetUTXOSet()
+	return chain, nil
 }
 
 // AddBlock 添加区块到区块链
@@ -185,25 +253,28 @@ func (c *Chain) GetLatestBlock() *Block {
 }
 
 // MineNewBlock 挖掘一个新区块
-func (c *Chain) MineNewBlock(from, to, amount []string, nodeId string) {
+// opts为各笔转账交易的选币参数
+func (c *Chain) MineNewBlock(from, to, amount []string, nodeId string, opts *SendOptions) {
 	var txs []*Transaction
 	var block *Block
 
 	// 遍历交易参与者
 	for index, address := range from {
 		value, _ := strconv.Atoi(amount[index])
-		tx := NewSimpleTransaction(address, to[index], value, c, txs, nodeId)
+		tx := NewSimpleTransaction(address, to[index], value, c, txs, nodeId, opts)
 		txs = append(txs, tx) // 追加到交易列表
-
-		// 给予交易发起者(矿工)奖励
-		tx = NewCoinbaseTransaction(address)
-		txs = append(txs, tx)
 	}
+	// 给予第一个交易发起者(矿工)奖励 每个区块只有一笔coinbase交易 排在第一位
+	txs = append([]*Transaction{NewCoinbaseTransaction(from[0])}, txs...)
 
 	// 对txs中每笔交易进行验证
 	for _, tx := range txs {
 		// 验证签名 只要有一笔签名的验证失败
 		c.VerifyTransaction(tx)
+		if err := c.CheckLocks(tx, c.NextBlock()); err != nil {
+			fmt.Printf("transaction[%x] cannot be mined yet: %v\n", tx.TxHash, err)
+			os.Exit(1)
+		}
 	}
 	latestBlock := c.GetLatestBlock()
 	block = NewBlock(latestBlock.Height+1, latestBlock.Hash, txs)
@@ -211,6 +282,23 @@ func (c *Chain) MineNewBlock(from, to, amount []string, nodeId string) {
 	c.AddBlock(block)
 }
 
+// MineBlock 将给矿工的coinbase交易和交易打包成新区块 交易可以花费之前交易的输出
+func (c *Chain) MineBlock(txs []*Transaction, miner string) *Block {
+	txs = append([]*Transaction{NewCoinbaseTransaction(miner)}, txs...)
+	for i, tx := range txs {
+		if !c.verifyTransaction(tx, txs[:i]) {
+			log.Panicf("transaction[%x] failed verification\n", tx.TxHash)
+		}
+		if err := c.CheckLocks(tx, c.NextBlock()); err != nil {
+			log.Panicf("transaction[%x] cannot be mined: %v\n", tx.TxHash, err)
+		}
+	}
+	latestBlock := c.GetLatestBlock()
+	block := NewBlock(latestBlock.Height+1, latestBlock.Hash, txs)
+	c.AddBlock(block)
+	return block
+}
+
 // SpentOutputs 获取该地址已花费输出
 func (c *Chain) SpentOutputs(address string) map[string][]int {
 	// 遍历区块链中区块 查找与地址匹配的交易输入
@@ -288,19 +376,19 @@ func (c *Chain) UnUTXOS(address string, txs []*Transaction) []*UTXO {
 							}
 							// 输出未被引用 放入UTXO集
 							if isSpentUTXO == false {
-								utxo := &UTXO{tx.TxHash, index, vout}
+								utxo := &UTXO{TxHash: tx.TxHash, Index: index, Output: vout}
 								unUTXOS = append(unUTXOS, utxo)
 							}
 						}
 					}
 					if isUtxoTx == false {
 						// 此交易不存在输出被引用 直接将输出添加到UTXO集合
-						utxo := &UTXO{tx.TxHash, index, vout}
+						utxo := &UTXO{TxHash: tx.TxHash, Index: index, Output: vout}
 						unUTXOS = append(unUTXOS, utxo)
 					}
 				} else {
 					// 该情况下 所有交易输出都属于UTXO
-					utxo := &UTXO{tx.TxHash, index, vout}
+					utxo := &UTXO{TxHash: tx.TxHash, Index: index, Output: vout}
 					unUTXOS = append(unUTXOS, utxo)
 				}
 			}
@@ -334,12 +422,12 @@ func (c *Chain) UnUTXOS(address string, txs []*Transaction) []*UTXO {
 						}
 						// 检查标志 未被引用则添加到结果
 						if spent == false {
-							utxo := &UTXO{tx.TxHash, index, vout}
+							utxo := &UTXO{TxHash: tx.TxHash, Index: index, Output: vout, Height: block.Height, Coinbase: tx.IsCoinbaseTransaction()}
 							unUTXOS = append(unUTXOS, utxo)
 						}
 					} else {
 						// 已花费输出为空 将当前地址所有输出添加到结果
-						utxo := &UTXO{tx.TxHash, index, vout}
+						utxo := &UTXO{TxHash: tx.TxHash, Index: index, Output: vout, Height: block.Height, Coinbase: tx.IsCoinbaseTransaction()}
 						unUTXOS = append(unUTXOS, utxo)
 					}
 				}
@@ -374,6 +462,30 @@ func (c *Chain) FindAllSpentOutputs() map[string][]*TxInput {
 	return spentTXOutputs
 }
 
+// UsedPubKeyHashes 查找链上出现过的所有公钥哈希(十六进制)
+// 包括交易输出锁定的公钥哈希和交易输入中公钥的哈希 用于恢复钱包时判断地址是否被使用过
+func (c *Chain) UsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
+	it := c.NewIterator()
+	for {
+		block := it.Next()
+		for _, tx := range block.Txs {
+			if !tx.IsCoinbaseTransaction() {
+				for _, vin := range tx.Vins {
+					used[hex.EncodeToString(crypto.Ripemd160Hash(vin.PublicKey))] = true
+				}
+			}
+			for _, vout := range tx.Vouts {
+				used[hex.EncodeToString(vout.Ripemd160Hash)] = true
+			}
+		}
+		if isBreakLoop(block.PrevBlockHash) {
+			break
+		}
+	}
+	return used
+}
+
 // 判断是否遍历完整个区块链
 func isBreakLoop(prevBlockHash []byte) bool {
 	var hashInt big.Int
@@ -394,31 +506,33 @@ func (c *Chain) FindUTXOMap() map[string]*TxOutputs {
 		block := it.Next()
 		// 遍历区块中每一条交易
 		for _, tx := range block.Txs {
-			txOutputs := &TxOutputs{[]*TxOutput{}}
+			txOutputs := &TxOutputs{Set: []*TxOutput{}, Coinbase: tx.IsCoinbaseTransaction(), Height: block.Height}
 			txHash := hex.EncodeToString(tx.TxHash)
 		LOOP:
 			for index, vout := range tx.Vouts {
+				// 数据输出不可花费 不属于UTXO
+				if vout.IsUnspendable() {
+					continue
+				}
 				// 获取指定交易输入
 				txInputs := spentTXOutputs[txHash]
 				if len(txInputs) > 0 {
 					spent := false
 					for _, in := range txInputs {
-						outPubkey := vout.Ripemd160Hash
-						inPubkey := in.PublicKey
-						// 将input的公钥与交易输出的公钥哈希进行比对
-						if bytes.Compare(outPubkey, crypto.Ripemd160Hash(inPubkey)) == 0 {
-							if index == in.Vout {
-								spent = true
-								continue LOOP
-							}
+						// 输入引用的输出位置相同即为已花费 脚本锁定的输出没有公钥哈希可以比对
+						if index == in.Vout {
+							spent = true
+							continue LOOP
 						}
 					}
 					if spent == false {
 						txOutputs.Set = append(txOutputs.Set, vout)
+						txOutputs.Indexes = append(txOutputs.Indexes, index)
 					}
 				} else {
 					// 没有input引用该交易输出 代表当前交易所有输出为UTXO
 					txOutputs.Set = append(txOutputs.Set, vout)
+					txOutputs.Indexes = append(txOutputs.Indexes, index)
 				}
 			}
 			utxoMaps[txHash] = txOutputs
@@ -458,31 +572,6 @@ func (c *Chain) FindTransaction(ID []byte) Transaction {
 	return Transaction{}
 }
 
-// FindSpendableUTXO 查找指定地址的可用UTXO
-func (c *Chain) FindSpendableUTXO(from string,
-	amount int, txs []*Transaction) (int, map[string][]int) {
-	// txs: 缓存交易列表 用于多笔交易处理
-	spendableUTXO := make(map[string][]int)
-	var value int
-	utxos := c.UnUTXOS(from, txs)
-	// 遍历UTXO
-	for _, utxo := range utxos {
-		value += utxo.Output.Value
-		hash := hex.EncodeToString(utxo.TxHash)
-		spendableUTXO[hash] = append(spendableUTXO[hash], utxo.Index)
-		if value >= amount {
-			break
-		}
-	}
-	// UTXO金额总和小与amount
-	if value < amount {
-		fmt.Printf("insufficient balance of address[%s] "+
-			"current balance[%d] transfer amount[%d]\n", from, value, amount)
-		os.Exit(1)
-	}
-	return value, spendableUTXO
-}
-
 // ECDSA数字签名 有3种用途:
 // 1.证明私钥的所有者已经授权支出这笔资金
 // 2.授权证明不可否认
@@ -494,29 +583,59 @@ func (c *Chain) SignTransaction(tx *Transaction, priKey ecdsa.PrivateKey) {
 	if tx.IsCoinbaseTransaction() {
 		return
 	}
+	tx.Sign(priKey, c.prevTransactions(tx))
+}
+
+// SignTransactionInputs 使用各输入对应的私钥签名 用于花费多个地址的交易
+func (c *Chain) SignTransactionInputs(tx *Transaction, keys []ecdsa.PrivateKey) {
+	tx.SignInputs(keys, c.prevTransactions(tx))
+}
+
+// 查找交易中输入所引用的vout所属交易(查找发送者)
+func (c *Chain) prevTransactions(tx *Transaction) map[string]Transaction {
 	prevTxs := make(map[string]Transaction)
-	// 处理交易输入 查找交易中输入所引用的vout所属交易(查找发送者)
-	// 对花费的每一笔UTXO进行签名
 	for _, vin := range tx.Vins {
 		// 查找当前交易输入所引用的交易
 		foundTx := c.FindTransaction(vin.TxHash)
 		prevTxs[hex.EncodeToString(foundTx.TxHash)] = foundTx
 	}
-	tx.Sign(priKey, prevTxs)
+	return prevTxs
 }
 
 // VerifyTransaction 验证交易
 func (c *Chain) VerifyTransaction(tx *Transaction) bool {
+	return c.verifyTransaction(tx, nil)
+}
+
+// 验证交易 引用的交易可以是同一区块中之前的交易txs
+func (c *Chain) verifyTransaction(tx *Transaction, txs []*Transaction) bool {
 	if tx.IsCoinbaseTransaction() {
 		return true
 	}
 	prevTxs := make(map[string]Transaction)
+	for _, cached := range txs {
+		prevTxs[hex.EncodeToString(cached.TxHash)] = *cached
+	}
 	// 查找输入引用的交易
 	for _, vin := range tx.Vins {
+		if _, ok := prevTxs[hex.EncodeToString(vin.TxHash)]; ok {
+			continue
+		}
 		foundTx := c.FindTransaction(vin.TxHash)
 		prevTxs[hex.EncodeToString(foundTx.TxHash)] = foundTx
 	}
-	return tx.Verify(prevTxs)
+	return tx.Verify(prevTxs, c.GetHeight()+1)
+}
+
+// GetGenesisHash 获取创世区块哈希 用于标识区块链网络
+func (c *Chain) GetGenesisHash() []byte {
+	it := c.NewIterator()
+	for {
+		block := it.Next()
+		if isBreakLoop(block.PrevBlockHash) {
+			return block.Hash
+		}
+	}
 }
 
 // GetHeight 获取当前区块高度
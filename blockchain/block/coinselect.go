@@ -0,0 +1,383 @@
+package block
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 选币策略
+// 从地址的UTXO中选择交易输入 手续费按估算的交易大小计算 随输入数量增加
+// 找零低于粉尘阈值时不生成找零输出 直接并入手续费
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrNoExactMatch      = errors.New("no combination of inputs matches the amount without change")
+	ErrUnknownSelector   = errors.New("unknown coin selection strategy")
+	ErrInputNotFound     = errors.New("input is not an unspent output of the sender")
+	ErrInvalidOutPoint   = errors.New("invalid input, expected txid:vout")
+)
+
+// 估算交易大小使用的字节数 取gob编码的实际大小
+const (
+	txBaseSize   = 336 // 类型描述、交易哈希、版本和时间锁
+	txInputSize  = 152 // 每个输入 包括签名、压缩公钥和序号
+	txOutputSize = 30  // 每个输出
+)
+
+// 分支定界搜索的最大尝试次数
+const bnbMaxTries = 100000
+
+// EstimateTxSize 估算交易序列化后的字节数
+func EstimateTxSize(inputs, outputs int) int {
+	return txBaseSize + inputs*txInputSize + outputs*txOutputSize
+}
+
+// FeeForSize 按每千字节的手续费率计算手续费 向上取整
+func FeeForSize(size int, feeRate int) int {
+	return (size*feeRate + 999) / 1000
+}
+
+// DustLimit 粉尘阈值 低于创建并花费一个输出所需手续费的三倍时不值得花费
+func DustLimit(feeRate int) int {
+	return 3 * FeeForSize(txInputSize+txOutputSize, feeRate)
+}
+
+// OutPoint 交易输出的位置
+type OutPoint struct {
+	TxHash []byte
+	Index  int
+}
+
+func (op OutPoint) String() string {
+	return fmt.Sprintf("%x:%d", op.TxHash, op.Index)
+}
+
+// ParseOutPoints 解析逗号分隔的txid:vout列表
+func ParseOutPoints(s string) ([]OutPoint, error) {
+	var outpoints []OutPoint
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) != 2 {
+			return nil, ErrInvalidOutPoint
+		}
+		hash, err := hex.DecodeString(parts[0])
+		if err != nil || len(hash) == 0 {
+			return nil, ErrInvalidOutPoint
+		}
+		index, err := strconv.Atoi(parts[1])
+		if err != nil || index < 0 {
+			return nil, ErrInvalidOutPoint
+		}
+		outpoints = append(outpoints, OutPoint{TxHash: hash, Index: index})
+	}
+	return outpoints, nil
+}
+
+// CoinTarget 选币目标
+type CoinTarget struct {
+	Amount  int // 输出总额 不含找零
+	Outputs int // 输出数量 不含找零
+	FeeRate int // 每千字节的手续费
+	Dust    int // 找零低于该值时并入手续费
+}
+
+// 指定输入数量时的手续费
+func (t *CoinTarget) fee(inputs int, change bool) int {
+	outputs := t.Outputs
+	if change {
+		outputs++
+	}
+	return FeeForSize(EstimateTxSize(inputs, outputs), t.FeeRate)
+}
+
+// 不找零时输入需要达到的金额
+func (t *CoinTarget) needed(inputs int) int {
+	return t.Amount + t.fee(inputs, false)
+}
+
+// 生成找零的额外成本 包括找零输出的手续费和将来花费它的手续费
+func (t *CoinTarget) costOfChange() int {
+	return FeeForSize(txOutputSize+txInputSize, t.FeeRate)
+}
+
+// CoinSelection 选币结果
+type CoinSelection struct {
+	Inputs []*UTXO
+	Total  int // 输入总额
+	Fee    int
+	Change int // 找零 为0时不生成找零输出
+}
+
+// 由选中的输入计算手续费和找零
+func newCoinSelection(inputs []*UTXO, target *CoinTarget) (*CoinSelection, error) {
+	s := &CoinSelection{Inputs: inputs}
+	for _, utxo := range inputs {
+		s.Total += utxo.Output.Value
+	}
+	if len(inputs) == 0 || s.Total < target.needed(len(inputs)) {
+		return nil, ErrInsufficientFunds
+	}
+	change := s.Total - target.Amount - target.fee(len(inputs), true)
+	if change > 0 && change >= target.Dust {
+		s.Change = change
+		s.Fee = target.fee(len(inputs), true)
+		return s, nil
+	}
+	s.Fee = s.Total - target.Amount
+	return s, nil
+}
+
+// CoinSelector 选币策略
+type CoinSelector interface {
+	Name() string
+	Select(utxos []*UTXO, target *CoinTarget) (*CoinSelection, error)
+}
+
+// 按顺序累加输入直到足够支付金额和手续费
+func accumulate(utxos []*UTXO, target *CoinTarget) (*CoinSelection, error) {
+	total := 0
+	for i, utxo := range utxos {
+		total += utxo.Output.Value
+		if total >= target.needed(i+1) {
+			return newCoinSelection(utxos[:i+1], target)
+		}
+	}
+	return nil, ErrInsufficientFunds
+}
+
+func copyUTXOs(utxos []*UTXO) []*UTXO {
+	return append([]*UTXO(nil), utxos...)
+}
+
+// 按金额排序后累加
+type orderedSelector struct {
+	name    string
+	largest bool
+}
+
+func (s *orderedSelector) Name() string {
+	return s.name
+}
+
+func (s *orderedSelector) Select(utxos []*UTXO, target *CoinTarget) (*CoinSelection, error) {
+	sorted := copyUTXOs(utxos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if s.largest {
+			return sorted[i].Output.Value > sorted[j].Output.Value
+		}
+		return sorted[i].Output.Value < sorted[j].Output.Value
+	})
+	return accumulate(sorted, target)
+}
+
+// 随机顺序累加 避免输入组合暴露地址之间的关联
+type randomSelector struct{}
+
+func (randomSelector) Name() string {
+	return "random"
+}
+
+func (randomSelector) Select(utxos []*UTXO, target *CoinTarget) (*CoinSelection, error) {
+	shuffled := copyUTXOs(utxos)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return accumulate(shuffled, target)
+}
+
+// 分支定界 查找输入总额恰好支付金额和手续费的组合 不生成找零
+// 允许超出不多于生成找零的成本 超出部分并入手续费
+// 手续费与newCoinSelection相同 按选中输入的数量由估算的交易大小计算
+type bnbSelector struct{}
+
+func (bnbSelector) Name() string {
+	return "bnb"
+}
+
+func (bnbSelector) Select(utxos []*UTXO, target *CoinTarget) (*CoinSelection, error) {
+	// 跳过不足以支付自身手续费的输入
+	inputFee := FeeForSize(txInputSize, target.FeeRate)
+	var candidates []*UTXO
+	for _, utxo := range utxos {
+		if utxo.Output.Value > inputFee {
+			candidates = append(candidates, utxo)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Output.Value > candidates[j].Output.Value
+	})
+	remaining := make([]int, len(candidates)+1) // 第i个及之后候选的金额之和
+	for i := len(candidates) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + candidates[i].Output.Value
+	}
+
+	selected := make([]bool, len(candidates))
+	tries := 0
+	var search func(i int, count int, value int) bool
+	search = func(i int, count int, value int) bool {
+		tries++
+		if count > 0 && value >= target.needed(count) {
+			return value <= target.needed(count)+target.costOfChange()
+		}
+		// 手续费随输入数量增加 剩余候选全部选中也不够时剪枝
+		if i == len(candidates) || value+remaining[i] < target.needed(count+1) || tries > bnbMaxTries {
+			return false
+		}
+		selected[i] = true
+		if search(i+1, count+1, value+candidates[i].Output.Value) {
+			return true
+		}
+		selected[i] = false
+		return search(i+1, count, value)
+	}
+	if !search(0, 0, 0) {
+		return nil, ErrNoExactMatch
+	}
+	var inputs []*UTXO
+	for i, ok := range selected {
+		if ok {
+			inputs = append(inputs, candidates[i])
+		}
+	}
+	// 超出部分不生成找零
+	exact := *target
+	exact.Dust = target.needed(len(inputs)) + target.costOfChange() + 1
+	return newCoinSelection(inputs, &exact)
+}
+
+// 依次尝试多个策略
+type fallbackSelector struct {
+	name      string
+	selectors []CoinSelector
+}
+
+func (s *fallbackSelector) Name() string {
+	return s.name
+}
+
+func (s *fallbackSelector) Select(utxos []*UTXO, target *CoinTarget) (*CoinSelection, error) {
+	var err error
+	for _, selector := range s.selectors {
+		var selection *CoinSelection
+		if selection, err = selector.Select(utxos, target); err == nil {
+			return selection, nil
+		}
+	}
+	return nil, err
+}
+
+var (
+	LargestFirst   CoinSelector = &orderedSelector{name: "largest", largest: true}
+	SmallestFirst  CoinSelector = &orderedSelector{name: "smallest"}
+	BranchAndBound CoinSelector = bnbSelector{}
+	RandomSelector CoinSelector = randomSelector{}
+	// DefaultCoinSelector 优先查找无需找零的组合 找不到时从大额输出开始累加
+	DefaultCoinSelector CoinSelector = &fallbackSelector{name: "auto", selectors: []CoinSelector{BranchAndBound, LargestFirst}}
+)
+
+var coinSelectors = []CoinSelector{DefaultCoinSelector, LargestFirst, SmallestFirst, BranchAndBound, RandomSelector}
+
+// CoinSelectorByName 按名称获取选币策略
+func CoinSelectorByName(name string) (CoinSelector, error) {
+	for _, selector := range coinSelectors {
+		if selector.Name() == name {
+			return selector, nil
+		}
+	}
+	return nil, ErrUnknownSelector
+}
+
+// CoinSelectorNames 所有选币策略的名称
+func CoinSelectorNames() []string {
+	var names []string
+	for _, selector := range coinSelectors {
+		names = append(names, selector.Name())
+	}
+	return names
+}
+
+// SelectManual 使用手动指定的输入 输入须为发送方的UTXO
+func SelectManual(utxos []*UTXO, outpoints []OutPoint, target *CoinTarget) (*CoinSelection, error) {
+	available := make(map[string]*UTXO)
+	for _, utxo := range utxos {
+		available[OutPoint{TxHash: utxo.TxHash, Index: utxo.Index}.String()] = utxo
+	}
+	var inputs []*UTXO
+	used := make(map[string]bool)
+	for _, op := range outpoints {
+		utxo, ok := available[op.String()]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInputNotFound, op)
+		}
+		if !used[op.String()] {
+			used[op.String()] = true
+			inputs = append(inputs, utxo)
+		}
+	}
+	return newCoinSelection(inputs, target)
+}
+
+// SendOptions 转账交易的选币参数
+type SendOptions struct {
+	Selector    CoinSelector
+	FeeRate     int        // 每千字节的手续费
+	Dust        int        // 粉尘阈值 小于0时按手续费率计算
+	Inputs      []OutPoint // 手动指定的输入 为空时由Selector选择
+	LockTime    int64      // 交易的时间锁 0表示不限制
+	Sequence    uint32     // 各输入的序号 可表示相对时间锁
+	Replaceable bool       // 输入是否带有替换标记 允许确认前被手续费更高的交易替换
+}
+
+// 输入的序号 允许替换时加上替换标记
+func (opts *SendOptions) sequence() uint32 {
+	if opts.Replaceable {
+		return opts.Sequence | SequenceReplaceable
+	}
+	return opts.Sequence
+}
+
+// DefaultSendOptions 默认选币参数 不收取手续费
+func DefaultSendOptions() *SendOptions {
+	return &SendOptions{Selector: DefaultCoinSelector, Dust: -1}
+}
+
+// SelectUTXOs 按选币参数从候选输出utxos中选择支付amount的输入 manual为手动指定输入时的全部候选
+// 自动选币只使用utxos 调用方须从中排除尚不能花费的挖矿奖励
+func SelectUTXOs(utxos []*UTXO, manual []*UTXO, amount int, outputs int, opts *SendOptions) (*CoinSelection, error) {
+	target := &CoinTarget{Amount: amount, Outputs: outputs, FeeRate: opts.FeeRate, Dust: opts.Dust}
+	if target.Dust < 0 {
+		target.Dust = DustLimit(opts.FeeRate)
+	}
+	if len(opts.Inputs) > 0 {
+		return SelectManual(manual, opts.Inputs, target)
+	}
+	return opts.Selector.Select(utxos, target)
+}
+
+// SelectCoins 从地址列表from的UTXO中选择支付amount的输入 txs为同一区块中尚未打包的交易
+func (c *Chain) SelectCoins(from []string, amount int, outputs int, txs []*Transaction, opts *SendOptions) (*CoinSelection, error) {
+	var utxos []*UTXO
+	seen := make(map[string]bool)
+	for _, address := range from {
+		if !seen[address] {
+			seen[address] = true
+			utxos = append(utxos, c.UnUTXOS(address, txs)...)
+		}
+	}
+	// 自动选币时跳过在下一个区块中尚不能花费的挖矿奖励 手动指定时由打包前的检查报告
+	next := c.GetHeight() + 1
+	var mature []*UTXO
+	for _, utxo := range utxos {
+		if !utxo.Coinbase || c.IsMature(utxo.Height, next) {
+			mature = append(mature, utxo)
+		}
+	}
+	return SelectUTXOs(mature, utxos, amount, outputs, opts)
+}
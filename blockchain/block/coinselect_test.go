@@ -0,0 +1,82 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func testUTXOs(values ...int) []*UTXO {
+	var utxos []*UTXO
+	for i, value := range values {
+		utxos = append(utxos, &UTXO{
+			TxHash: []byte(fmt.Sprintf("tx%d", i)),
+			Output: &TxOutput{Value: value},
+		})
+	}
+	return utxos
+}
+
+func TestBranchAndBound(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		target CoinTarget
+		inputs int
+		fee    int
+		err    error
+	}{
+		// 每个输入单独取整的手续费为1 整笔交易的手续费也为1
+		{"exact match with a rounded fee", []int{101}, CoinTarget{Amount: 100, Outputs: 1, FeeRate: 1}, 1, 1, nil},
+		{"exact match of two inputs", []int{70, 31, 500}, CoinTarget{Amount: 100, Outputs: 1, FeeRate: 1}, 2, 1, nil},
+		{"excess within the cost of change", []int{102}, CoinTarget{Amount: 100, Outputs: 1, FeeRate: 1}, 1, 2, nil},
+		{"excess over the cost of change", []int{103}, CoinTarget{Amount: 100, Outputs: 1, FeeRate: 1}, 0, 0, ErrNoExactMatch},
+		{"short by one", []int{100}, CoinTarget{Amount: 100, Outputs: 1, FeeRate: 1}, 0, 0, ErrNoExactMatch},
+		{"zero fee rate", []int{60, 40, 30}, CoinTarget{Amount: 100, Outputs: 1}, 2, 0, nil},
+		{"fee of larger transactions", []int{600, 470}, CoinTarget{Amount: 1000, Outputs: 2, FeeRate: 100}, 2, 70, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selection, err := BranchAndBound.Select(testUTXOs(test.values...), &test.target)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Select() = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if len(selection.Inputs) != test.inputs || selection.Fee != test.fee || selection.Change != 0 {
+				t.Fatalf("Select() = %d inputs, fee %d, change %d, want %d inputs, fee %d",
+					len(selection.Inputs), selection.Fee, selection.Change, test.inputs, test.fee)
+			}
+			if selection.Fee < test.target.fee(len(selection.Inputs), false) {
+				t.Fatalf("fee %d is lower than the estimate", selection.Fee)
+			}
+		})
+	}
+}
+
+// 分支定界找到的组合与newCoinSelection的手续费一致 任何金额都不会因取整被拒绝
+func TestBranchAndBoundFeeConsistent(t *testing.T) {
+	for feeRate := 0; feeRate <= 3000; feeRate += 7 {
+		target := CoinTarget{Amount: 1000, Outputs: 1, FeeRate: feeRate}
+		for inputs := 1; inputs <= 3; inputs++ {
+			values := make([]int, inputs)
+			total := target.needed(inputs)
+			for i := range values {
+				values[i] = total / inputs
+			}
+			values[0] += total % inputs
+			selection, err := BranchAndBound.Select(testUTXOs(values...), &target)
+			if err != nil {
+				// 输入不足以支付自身手续费时被跳过
+				if values[inputs-1] <= FeeForSize(txInputSize, feeRate) {
+					continue
+				}
+				t.Fatalf("fee rate %d, %d inputs %v: %v", feeRate, inputs, values, err)
+			}
+			if selection.Total != total || selection.Fee != total-target.Amount {
+				t.Fatalf("fee rate %d: total %d fee %d, want total %d", feeRate, selection.Total, selection.Fee, total)
+			}
+		}
+	}
+}
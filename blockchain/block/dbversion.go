@@ -0,0 +1,67 @@
+package block
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 数据库格式版本
+// 区块哈希由Merkle根计算 Merkle树的构建方式改变后 早期数据库中的区块哈希无法通过工作量证明验证
+// 哈希改变使区块之间的引用全部失效 无法原地迁移 打开早期数据库时报错 须删除后重新创建或同步区块链
+// 版本1为没有保存版本的早期数据库
+// 版本2的UTXO表没有记录输出在交易中的位置 打开时由区块重建UTXO表 原地升级到当前版本
+
+const (
+	DBVersion           = 3         // 当前数据库格式版本 UTXO表记录输出在交易中的位置
+	upgradableDBVersion = 2         // 可以原地升级的版本 Merkle叶节点为交易哈希 逐层补齐并检测篡改
+	dbVersionKey        = "version" // 区块表中保存格式版本的键
+)
+
+var ErrDBVersion = errors.New("the block database format is not supported")
+
+// 将当前格式版本保存到区块表
+func putDBVersion(bucket *bolt.Bucket) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, DBVersion)
+	return bucket.Put([]byte(dbVersionKey), value)
+}
+
+// 从区块表读取格式版本 没有保存时为1
+func getDBVersion(bucket *bolt.Bucket) uint64 {
+	value := bucket.Get([]byte(dbVersionKey))
+	if len(value) != 8 {
+		return 1
+	}
+	return binary.BigEndian.Uint64(value)
+}
+
+// 检查区块表的格式版本 可以原地升级的版本同样通过
+func checkDBVersion(bucket *bolt.Bucket, path string) error {
+	if version := getDBVersion(bucket); version != DBVersion && version != upgradableDBVersion {
+		return fmt.Errorf("%w: [%s] has version %d, version %d is required, remove it and create or sync the blockchain again",
+			ErrDBVersion, path, version, DBVersion)
+	}
+	return nil
+}
+
+// 将可以原地升级的数据库升级到当前版本 重建UTXO表
+func (c *Chain) upgradeDB() error {
+	upgrade := false
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(blockTableName)); b != nil {
+			upgrade = getDBVersion(b) == upgradableDBVersion
+		}
+		return nil
+	})
+	if err != nil || !upgrade {
+		return err
+	}
+	utxoSet := UTXOSet{Chain: c}
+	utxoSet.ResetUTXOSet()
+	return c.DB.Update(func(tx *bolt.Tx) error {
+		return putDBVersion(tx.Bucket([]byte(blockTableName)))
+	})
+}
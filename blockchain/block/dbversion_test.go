@@ -0,0 +1,82 @@
+package block
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestOpenChainVersion(t *testing.T) {
+	owner := newTestChain(t, 0).owner
+	genesis := CreateGenesisBlock([]*Transaction{NewCoinbaseTransaction(string(owner.GetAddress()))})
+	path := filepath.Join(t.TempDir(), "block.db")
+	chain, err := NewChainWithGenesis(path, genesis, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.DB.Close()
+
+	tests := []struct {
+		name    string
+		version []byte // nil时删除版本 模拟早期数据库
+		err     error
+	}{
+		{"current version", nil, nil},
+		{"upgradable version", []byte{0, 0, 0, 0, 0, 0, 0, upgradableDBVersion}, nil},
+		{"early database without a version", nil, ErrDBVersion},
+		{"newer version", []byte{0, 0, 0, 0, 0, 0, 0, DBVersion + 1}, ErrDBVersion},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if i > 0 {
+				db, err := bolt.Open(path, 0600, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = db.Update(func(tx *bolt.Tx) error {
+					// 升级时重建UTXO表并重新记录对应的区块
+					if err := tx.DeleteBucket([]byte(utxoTableName)); err != nil && err != bolt.ErrBucketNotFound {
+						return err
+					}
+					b := tx.Bucket([]byte(blockTableName))
+					if err := b.Delete([]byte(utxoTipKey)); err != nil {
+						return err
+					}
+					if test.version == nil {
+						return b.Delete([]byte(dbVersionKey))
+					}
+					return b.Put([]byte(dbVersionKey), test.version)
+				})
+				db.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			chain, err := OpenChain(path)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("OpenChain() = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			defer chain.DB.Close()
+			if chain.Maturity != 3 || string(chain.Tip) != string(genesis.Hash) {
+				t.Fatalf("OpenChain() = tip %x maturity %d", chain.Tip, chain.Maturity)
+			}
+			var version uint64
+			chain.DB.View(func(tx *bolt.Tx) error {
+				version = getDBVersion(tx.Bucket([]byte(blockTableName)))
+				return nil
+			})
+			if version != DBVersion || !bytes.Equal(chain.utxoTip(), genesis.Hash) {
+				t.Fatalf("OpenChain() = version %d utxo tip %x", version, chain.utxoTip())
+			}
+			if unspent, _ := chain.isUnspentOutput(genesis.Txs[0].TxHash, 0); !unspent {
+				t.Fatal("the genesis output is missing from the utxo table")
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package block
+
+import (
+	"blockchain/crypto"
+	"blockchain/script"
+	"blockchain/wallet"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// 哈希时间锁合约的资金和花费
+// 合约脚本作为赎回脚本 资金交易将金额支付到合约的脚本哈希地址
+// 收款方出示秘密值取款 时间锁之后退款方取回 取款交易的解锁脚本中公开了秘密值
+
+var (
+	ErrContractNotFound = errors.New("contract output not found in the transaction")
+	ErrSecretMismatch   = errors.New("secret does not match the secret hash of the contract")
+	ErrSecretNotFound   = errors.New("secret not found in the transaction")
+	ErrNotParticipant   = errors.New("wallet is not a participant of the contract")
+)
+
+// NewHTLC 生成哈希时间锁合约 收款方和退款方须为公钥哈希地址
+func NewHTLC(secretHash []byte, recipient, refund string, lockTime int64) (*script.HTLC, error) {
+	for _, address := range []string{recipient, refund} {
+		if !wallet.IsValidAddress([]byte(address)) || wallet.IsScriptHashAddress(address) {
+			return nil, fmt.Errorf("%w: %s", wallet.ErrInvalidAddress, address)
+		}
+	}
+	h := &script.HTLC{
+		SecretHash: secretHash,
+		Recipient:  wallet.StringToHash160(recipient),
+		Refund:     wallet.StringToHash160(refund),
+		LockTime:   lockTime,
+	}
+	if _, err := h.Script(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// ContractAddress 合约的脚本哈希地址
+func ContractAddress(contract []byte) string {
+	return string(wallet.ScriptHashToAddress(crypto.Ripemd160Hash(contract)))
+}
+
+// FindContractOutput 资金交易中支付到合约的输出
+func FindContractOutput(tx *Transaction, contract []byte) (int, error) {
+	address := ContractAddress(contract)
+	for index, vout := range tx.Vouts {
+		if vout.Address() == address {
+			return index, nil
+		}
+	}
+	return 0, ErrContractNotFound
+}
+
+// SpendHTLC 使用钱包w花费合约输出 全部金额扣除手续费后支付给地址to
+// secret非空时作为收款方取款 否则作为退款方在时间锁之后取回 退款交易的时间锁与合约相同
+func SpendHTLC(contractTx *Transaction, contract []byte, w *wallet.Wallet, secret []byte, to string, feeRate int) (*Transaction, error) {
+	h, err := script.ParseHTLC(contract)
+	if err != nil {
+		return nil, err
+	}
+	index, err := FindContractOutput(contractTx, contract)
+	if err != nil {
+		return nil, err
+	}
+	party := h.Refund
+	if secret != nil {
+		if hash := sha256.Sum256(secret); !bytes.Equal(hash[:], h.SecretHash) {
+			return nil, ErrSecretMismatch
+		}
+		party = h.Recipient
+	}
+	if !bytes.Equal(crypto.Ripemd160Hash(w.PublicKey), party) {
+		return nil, ErrNotParticipant
+	}
+
+	prevOut := contractTx.Vouts[index]
+	tx := &Transaction{
+		Vins:    []*TxInput{{TxHash: contractTx.TxHash, Vout: index}},
+		Vouts:   []*TxOutput{NewTxOutput(prevOut.Value, to)},
+		Version: TxVersion,
+	}
+	if secret == nil {
+		tx.LockTime = h.LockTime
+	}
+	tx.HashTransaction()
+	sign := func() error {
+		sig, err := crypto.Sign(&w.PrivateKey, tx.SignatureHash(0, contract, []*TxOutput{prevOut}))
+		if err != nil {
+			return err
+		}
+		if secret != nil {
+			tx.Vins[0].Script, err = script.HTLCRedeemScript(sig, w.PublicKey, secret, contract)
+		} else {
+			tx.Vins[0].Script, err = script.HTLCRefundScript(sig, w.PublicKey, contract)
+		}
+		return err
+	}
+	// 先签名得到交易大小 扣除手续费后重新签名
+	if err := sign(); err != nil {
+		return nil, err
+	}
+	fee := FeeForSize(len(tx.Serialize()), feeRate)
+	if fee >= prevOut.Value {
+		return nil, ErrInsufficientFunds
+	}
+	tx.Vouts[0].Value -= fee
+	if err := sign(); err != nil {
+		return nil, err
+	}
+	// 时间锁由打包时检查
+	if err := tx.VerifyScripts([]*TxOutput{prevOut}, math.MaxInt64); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// ExtractSecret 从取款交易的解锁脚本中找出哈希为secretHash的秘密值
+func ExtractSecret(tx *Transaction, secretHash []byte) ([]byte, error) {
+	for _, vin := range tx.Vins {
+		data, err := script.PushedData(vin.Script)
+		if err != nil {
+			continue
+		}
+		for _, item := range data {
+			if hash := sha256.Sum256(item); len(item) == script.SecretSize && bytes.Equal(hash[:], secretHash) {
+				return item, nil
+			}
+		}
+	}
+	return nil, ErrSecretNotFound
+}
+
+// FindSpendingTx 查找花费指定输出的交易 返回交易和所在区块高度
+func (c *Chain) FindSpendingTx(txHash []byte, index int) (*Transaction, int64, bool) {
+	it := c.NewIterator()
+	for {
+		block := it.Next()
+		for _, tx := range block.Txs {
+			if tx.IsCoinbaseTransaction() {
+				continue
+			}
+			for _, vin := range tx.Vins {
+				if bytes.Equal(vin.TxHash, txHash) && vin.Vout == index {
+					return tx, block.Height, true
+				}
+			}
+		}
+		if isBreakLoop(block.PrevBlockHash) {
+			return nil, 0, false
+		}
+	}
+}
+
+// TxHeight 交易所在区块的高度
+func (c *Chain) TxHeight(txHash []byte) (int64, bool) {
+	latest := c.GetLatestBlock()
+	if latest == nil {
+		return 0, false
+	}
+	_, b, ok := c.findTxBlockFrom(latest, txHash)
+	if !ok {
+		return 0, false
+	}
+	return b.Height, true
+}
@@ -0,0 +1,72 @@
+// Package block 早期交易(版本0)的签名数据
+//
+// 早期交易的签名数据是交易副本gob编码的哈希 gob编码包含类型描述(类型名、字段列表和类型编号)
+// 交易结构增加字段后编码随之改变 这里保留早期的交易结构用于计算签名数据
+// 包名必须与区块链模块相同 gob的类型描述中包含"[]*block.TxInput"这样带包名的类型名
+//
+// gob的类型编号由进程中首次编码的顺序决定 包初始化时先编码一次
+// 使签名数据与首次编码交易的进程一致 不再受之前编码过的其他类型影响
+package block
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"log"
+)
+
+// Transaction 早期交易结构
+type Transaction struct {
+	TxHash []byte
+	Vins   []*TxInput
+	Vouts  []*TxOutput
+}
+
+// TxInput 早期交易输入结构
+type TxInput struct {
+	TxHash    []byte
+	Vout      int
+	Signature []byte
+	PublicKey []byte
+}
+
+// TxOutput 早期交易输出结构
+type TxOutput struct {
+	Value         int
+	Ripemd160Hash []byte
+}
+
+func init() {
+	(&Transaction{}).hash()
+}
+
+// 与早期版本的Transaction.Hash相同 清空交易哈希后计算gob编码的哈希
+func (tx *Transaction) hash() []byte {
+	tx.TxHash = []byte{}
+	var result bytes.Buffer
+	if err := gob.NewEncoder(&result).Encode(tx); err != nil {
+		log.Panicf("serialize the legacy transaction failed: %v\n", err)
+	}
+	hash := sha256.Sum256(result.Bytes())
+	return hash[:]
+}
+
+// SignatureHashes 计算每个输入需要签名的数据 prevHashes[i]为第i个输入引用输出的公钥哈希
+// 签名副本中依次填入引用输出的公钥哈希 第i个输入的签名数据包含前i个输入的引用输出
+// 每次计算后签名副本的交易哈希替换为计算结果
+func SignatureHashes(tx *Transaction, prevHashes [][]byte) [][]byte {
+	txCopy := &Transaction{TxHash: tx.TxHash}
+	for _, vin := range tx.Vins {
+		txCopy.Vins = append(txCopy.Vins, &TxInput{TxHash: vin.TxHash, Vout: vin.Vout})
+	}
+	for _, vout := range tx.Vouts {
+		txCopy.Vouts = append(txCopy.Vouts, &TxOutput{Value: vout.Value, Ripemd160Hash: vout.Ripemd160Hash})
+	}
+	hashes := make([][]byte, len(tx.Vins))
+	for id := range txCopy.Vins {
+		txCopy.Vins[id].PublicKey = prevHashes[id]
+		txCopy.TxHash = txCopy.hash()
+		hashes[id] = txCopy.TxHash
+	}
+	return hashes
+}
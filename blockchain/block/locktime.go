@@ -0,0 +1,138 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 时间锁
+// 交易的LockTime小于LockTimeThreshold时为区块高度 否则为Unix时间
+// 按时间的锁与父区块之前最近若干区块时间戳的中位数比较 不受单个矿工设置的时间戳影响
+// 版本2起输入的序号表示相对时间锁: 引用的输出被打包后 须再经过指定的区块数或时间才能花费
+
+const (
+	LockTimeThreshold = 500000000 // 小于该值的时间锁为区块高度
+
+	SequenceLockTimeDisabled    = 1 << 31 // 设置后序号不表示相对时间锁
+	SequenceLockTimeIsSeconds   = 1 << 22 // 设置后相对时间锁以时间计 否则以区块数计
+	SequenceLockTimeMask        = 0xffff  // 相对时间锁的数值
+	SequenceLockTimeGranularity = 9       // 以时间计时的单位为2^9=512秒
+
+	medianTimeBlocks = 11 // 计算中位时间的区块数
+)
+
+var (
+	ErrLockTime     = errors.New("transaction lock time has not been reached")
+	ErrSequenceLock = errors.New("relative lock time of the input has not been reached")
+	ErrRelativeLock = errors.New("invalid relative lock, expected blocks or seconds with an s suffix")
+)
+
+// IsFinal 交易能否打包进指定高度的区块 medianTime为父区块的中位时间
+func (tx *Transaction) IsFinal(height, medianTime int64) bool {
+	if tx.LockTime == 0 {
+		return true
+	}
+	if tx.LockTime < LockTimeThreshold {
+		return height >= tx.LockTime
+	}
+	return medianTime >= tx.LockTime
+}
+
+// MedianTimePast 以hash为最新区块的最近11个区块时间戳的中位数 hash为创世区块的前区块时返回0
+func (c *Chain) MedianTimePast(hash []byte) int64 {
+	var stamps []int64
+	for len(stamps) < medianTimeBlocks && !isBreakLoop(hash) {
+		blockBytes := c.GetBlock(hash)
+		if blockBytes == nil {
+			break
+		}
+		current := DeserializeBlock(blockBytes)
+		stamps = append(stamps, current.TimeStamp)
+		hash = current.PrevBlockHash
+	}
+	if len(stamps) == 0 {
+		return 0
+	}
+	sort.Slice(stamps, func(i, j int) bool {
+		return stamps[i] < stamps[j]
+	})
+	return stamps[len(stamps)/2]
+}
+
+// NextBlock 用于检查时间锁的下一个区块 只包含高度和父区块
+func (c *Chain) NextBlock() *Block {
+	latest := c.GetLatestBlock()
+	return &Block{Height: latest.Height + 1, PrevBlockHash: latest.Hash}
+}
+
+// CheckLocks 检查交易的时间锁、输入的相对时间锁和花费的挖矿奖励的成熟度能否在区块b中满足
+// 引用的交易在b或其之前的区块中查找 找不到时视为将与交易打包进同一区块(交易池中的交易)
+func (c *Chain) CheckLocks(tx *Transaction, b *Block) error {
+	if tx.IsCoinbaseTransaction() {
+		return nil
+	}
+	medianTime := c.MedianTimePast(b.PrevBlockHash)
+	if !tx.IsFinal(b.Height, medianTime) {
+		return fmt.Errorf("%w: %d", ErrLockTime, tx.LockTime)
+	}
+	if err := c.checkMaturity(tx, b); err != nil {
+		return err
+	}
+	if tx.Version < TxVersionLockTime {
+		return nil
+	}
+	for id, vin := range tx.Vins {
+		value := int64(vin.Sequence & SequenceLockTimeMask)
+		if vin.Sequence&SequenceLockTimeDisabled != 0 || value == 0 {
+			continue
+		}
+		prevHeight, prevTime := b.Height, medianTime
+		if _, prevBlock, ok := c.findTxBlockFrom(b, vin.TxHash); ok {
+			prevHeight, prevTime = prevBlock.Height, c.MedianTimePast(prevBlock.PrevBlockHash)
+		}
+		if vin.Sequence&SequenceLockTimeIsSeconds != 0 {
+			if medianTime < prevTime+value<<SequenceLockTimeGranularity {
+				return fmt.Errorf("input %d: %w", id, ErrSequenceLock)
+			}
+		} else if b.Height < prevHeight+value {
+			return fmt.Errorf("input %d: %w", id, ErrSequenceLock)
+		}
+	}
+	return nil
+}
+
+// RelativeHeightLock 引用的输出打包后经过blocks个区块才能花费的序号
+func RelativeHeightLock(blocks int64) (uint32, error) {
+	if blocks < 0 || blocks > SequenceLockTimeMask {
+		return 0, ErrRelativeLock
+	}
+	return uint32(blocks), nil
+}
+
+// RelativeTimeLock 引用的输出打包后经过seconds秒才能花费的序号 向上取整到512秒
+func RelativeTimeLock(seconds int64) (uint32, error) {
+	units := (seconds + 1<<SequenceLockTimeGranularity - 1) >> SequenceLockTimeGranularity
+	if seconds < 0 || units > SequenceLockTimeMask {
+		return 0, ErrRelativeLock
+	}
+	return SequenceLockTimeIsSeconds | uint32(units), nil
+}
+
+// ParseRelativeLock 解析相对时间锁 数字表示区块数 以s结尾表示秒数
+func ParseRelativeLock(s string) (uint32, error) {
+	if strings.HasSuffix(s, "s") {
+		seconds, err := strconv.ParseInt(strings.TrimSuffix(s, "s"), 10, 64)
+		if err != nil {
+			return 0, ErrRelativeLock
+		}
+		return RelativeTimeLock(seconds)
+	}
+	blocks, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, ErrRelativeLock
+	}
+	return RelativeHeightLock(blocks)
+}
@@ -0,0 +1,137 @@
+package block
+
+import (
+	"blockchain/wallet"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 由owner签名 带有时间锁和序号的交易 花费prev的第index个输出
+func (tc *testChain) spendLocked(prev *Transaction, index int, lockTime int64, sequence uint32) *Transaction {
+	tx := &Transaction{
+		Vins:     []*TxInput{{TxHash: prev.TxHash, Vout: index, PublicKey: tc.owner.PublicKey, Sequence: sequence}},
+		Vouts:    []*TxOutput{NewTxOutput(prev.Vouts[index].Value, tc.address())},
+		Version:  TxVersion,
+		LockTime: lockTime,
+	}
+	tx.HashTransaction()
+	prevTxs := map[string]Transaction{hex.EncodeToString(prev.TxHash): *prev}
+	tx.SignInputs([]ecdsa.PrivateKey{tc.owner.PrivateKey}, prevTxs)
+	return tx
+}
+
+func TestIsFinal(t *testing.T) {
+	tests := []struct {
+		lockTime   int64
+		height     int64
+		medianTime int64
+		final      bool
+	}{
+		{0, 1, 0, true},
+		{10, 9, LockTimeThreshold + 100, false},
+		{10, 10, 0, true},
+		{LockTimeThreshold + 100, 1000, LockTimeThreshold + 99, false},
+		{LockTimeThreshold + 100, 0, LockTimeThreshold + 100, true},
+	}
+	for _, test := range tests {
+		tx := &Transaction{LockTime: test.lockTime}
+		if final := tx.IsFinal(test.height, test.medianTime); final != test.final {
+			t.Fatalf("IsFinal(%d, %d) with lock time %d = %v, want %v", test.height, test.medianTime, test.lockTime, final, test.final)
+		}
+	}
+}
+
+func TestParseRelativeLock(t *testing.T) {
+	tests := []struct {
+		s        string
+		sequence uint32
+		err      error
+	}{
+		{"0", 0, nil},
+		{"144", 144, nil},
+		{"65535", SequenceLockTimeMask, nil},
+		{"65536", 0, ErrRelativeLock},
+		{"-1", 0, ErrRelativeLock},
+		{"512s", SequenceLockTimeIsSeconds | 1, nil},
+		{"513s", SequenceLockTimeIsSeconds | 2, nil},
+		{"1s", SequenceLockTimeIsSeconds | 1, nil},
+		{"33554432s", 0, ErrRelativeLock},
+		{"ten", 0, ErrRelativeLock},
+		{"s", 0, ErrRelativeLock},
+	}
+	for _, test := range tests {
+		sequence, err := ParseRelativeLock(test.s)
+		if sequence != test.sequence || !errors.Is(err, test.err) {
+			t.Fatalf("ParseRelativeLock(%q) = %#x, %v, want %#x, %v", test.s, sequence, err, test.sequence, test.err)
+		}
+	}
+}
+
+func TestCheckLocks(t *testing.T) {
+	tc := newTestChain(t, 0)
+	next := tc.NextBlock()
+	prev := tc.genesis.Txs[0]
+	now := time.Now().Unix()
+	tests := []struct {
+		name     string
+		lockTime int64
+		sequence uint32
+		err      error
+	}{
+		{"height lock reached", next.Height, 0, nil},
+		{"height lock not reached", next.Height + 1, 0, ErrLockTime},
+		{"time lock reached", now - 3600, 0, nil},
+		{"time lock not reached", now + 3600, 0, ErrLockTime},
+		{"relative height lock reached", 0, uint32(next.Height - tc.genesis.Height), nil},
+		{"relative height lock not reached", 0, uint32(next.Height - tc.genesis.Height + 1), ErrSequenceLock},
+		{"relative lock disabled", 0, SequenceLockTimeDisabled | SequenceLockTimeMask, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx := tc.spendLocked(prev, 0, test.lockTime, test.sequence)
+			if err := tc.CheckLocks(tx, next); !errors.Is(err, test.err) {
+				t.Fatalf("CheckLocks() = %v, want %v", err, test.err)
+			}
+			// 区块验证与交易池使用相同的检查
+			if err := tc.ValidateBlock(tc.block(tc.GetLatestBlock(), tx)); (err == nil) != (test.err == nil) {
+				t.Fatalf("ValidateBlock() = %v, want %v", err, test.err)
+			}
+		})
+	}
+
+	// 按时间的相对时间锁从引用的输出所在区块的中位时间起算
+	miner := tc.MineBlock(nil, tc.address())
+	locked := tc.spendLocked(miner.Txs[0], 0, 0, SequenceLockTimeIsSeconds|1)
+	if err := tc.CheckLocks(locked, tc.NextBlock()); !errors.Is(err, ErrSequenceLock) {
+		t.Fatalf("CheckLocks() with a relative time lock = %v, want %v", err, ErrSequenceLock)
+	}
+	if mtp := tc.MedianTimePast(miner.Hash); mtp < tc.genesis.TimeStamp || mtp > miner.TimeStamp {
+		t.Fatalf("MedianTimePast() = %d, want between %d and %d", mtp, tc.genesis.TimeStamp, miner.TimeStamp)
+	}
+	if mtp := tc.MedianTimePast(tc.genesis.PrevBlockHash); mtp != 0 {
+		t.Fatalf("MedianTimePast() before the genesis block = %d, want 0", mtp)
+	}
+}
+
+// 版本2之前的交易签名不包含时间锁和序号
+func TestLockTimeVersion(t *testing.T) {
+	tc := newTestChain(t, 0)
+	prev := tc.genesis.Txs[0]
+	for _, tx := range []*Transaction{tc.spendLocked(prev, 0, 1, 0), tc.spendLocked(prev, 0, 0, 1)} {
+		tx.Version = TxVersionScript
+		if err := tx.VerifyScripts([]*TxOutput{prev.Vouts[0]}, 1); !errors.Is(err, ErrLockTimeVersion) {
+			t.Fatalf("VerifyScripts() = %v, want %v", err, ErrLockTimeVersion)
+		}
+	}
+	payee := string(wallet.NewWallet().GetAddress())
+	tx, _, err := NewTxBuilder(tc.Chain, nil).From(tc.address()).AddOutput(payee, 1).Options(&SendOptions{Selector: DefaultCoinSelector, LockTime: 7, Dust: -1}).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.LockTime != 7 || tx.Version != TxVersion {
+		t.Fatalf("Build() = version %d with lock time %d", tx.Version, tx.LockTime)
+	}
+}
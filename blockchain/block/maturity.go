@@ -0,0 +1,60 @@
+package block
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+// 挖矿奖励成熟度
+// coinbase交易的输出须经过一定数量的确认才能花费 区块链重组丢弃挖矿奖励时 不会连带使已花费它的交易失效
+// 成熟度在创建区块链时确定并保存在数据库中 同一网络的节点使用相同的值 0表示不作限制 须在创建时明确指定
+// 早期创建的区块链没有保存成熟度 不作限制 已有区块仍然有效
+// 需要成熟度的节点从区块链读取 轻节点使用完整节点在version中声明的值
+
+const (
+	CoinbaseMaturity = 100              // 挖矿奖励可以花费前需要的确认数
+	DefaultMaturity  = CoinbaseMaturity // createchain默认的成熟度
+)
+
+const maturityKey = "maturity" // 区块表中保存成熟度的键
+
+var ErrImmatureSpend = errors.New("coinbase output is not mature yet")
+
+// IsMature 高度为height的挖矿奖励能否在高度为spendHeight的区块中花费
+func (c *Chain) IsMature(height, spendHeight int64) bool {
+	return spendHeight-height >= c.Maturity
+}
+
+// 检查交易花费的挖矿奖励在区块b中是否已经成熟
+// 引用的交易不在b或其之前的区块中时不是挖矿奖励 coinbase交易不会进入交易池
+func (c *Chain) checkMaturity(tx *Transaction, b *Block) error {
+	if c.Maturity <= 0 {
+		return nil
+	}
+	for id, vin := range tx.Vins {
+		prevTx, prevBlock, ok := c.findTxBlockFrom(b, vin.TxHash)
+		if ok && prevTx.IsCoinbaseTransaction() && !c.IsMature(prevBlock.Height, b.Height) {
+			return fmt.Errorf("input %d: %w, %d of %d confirmations", id, ErrImmatureSpend, b.Height-prevBlock.Height, c.Maturity)
+		}
+	}
+	return nil
+}
+
+// 将成熟度保存到区块表
+func putMaturity(bucket *bolt.Bucket, maturity int64) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(maturity))
+	return bucket.Put([]byte(maturityKey), value)
+}
+
+// 从区块表读取成熟度 没有保存时为0
+func getMaturity(bucket *bolt.Bucket) int64 {
+	value := bucket.Get([]byte(maturityKey))
+	if len(value) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(value))
+}
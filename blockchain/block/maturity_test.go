@@ -0,0 +1,57 @@
+package block
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCoinbaseMaturity(t *testing.T) {
+	tests := []struct {
+		name     string
+		maturity int64
+		height   int64 // 花费创世区块挖矿奖励的区块高度
+		err      error
+	}{
+		{"default maturity", DefaultMaturity, 2, ErrImmatureSpend},
+		{"no maturity", 0, 2, nil},
+		{"immature", 2, 2, ErrImmatureSpend},
+		{"mature", 2, 3, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tc := newTestChain(t, test.maturity)
+			parent := tc.genesis
+			for parent.Height+1 < test.height {
+				next := tc.block(parent)
+				tc.AddBlock(next)
+				parent = next
+			}
+			b := tc.block(parent, tc.spend(tc.genesis.Txs[0], 0, BlockSubsidy))
+			if err := tc.ValidateBlock(b); !errors.Is(err, test.err) {
+				t.Fatalf("ValidateBlock() = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+// 成熟度保存在数据库中 重新打开区块链时读取
+func TestMaturityStoredInChain(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tc := newTestChain(t, 0)
+	chain := CreateBlockChainWithGenesisBlock(tc.address(), 5, "test")
+	chain.DB.Close()
+	chain = GetBlockChainObject("test")
+	defer chain.DB.Close()
+	if chain.Maturity != 5 {
+		t.Fatalf("maturity = %d, want 5", chain.Maturity)
+	}
+}
@@ -0,0 +1,107 @@
+package block
+
+import (
+	"blockchain/crypto"
+	"blockchain/script"
+	"blockchain/wallet"
+	"errors"
+	"testing"
+)
+
+// 向2-of-3多重签名地址付款 两方分别离线签名后花费
+func TestMultiSigSpend(t *testing.T) {
+	tc := newTestChain(t, 0)
+	signers := []*wallet.Wallet{wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()}
+	var pubKeys [][]byte
+	for _, w := range signers {
+		pubKeys = append(pubKeys, w.PublicKey)
+	}
+	redeemScript, err := script.MultiSig(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	multiSig := string(wallet.ScriptHashToAddress(crypto.Ripemd160Hash(redeemScript)))
+	opts := &SendOptions{Selector: DefaultCoinSelector, Dust: -1}
+
+	// 由owner签名的普通交易向脚本地址付款
+	fund, _, err := NewTxBuilder(tc.Chain, nil).From(tc.address()).AddOutput(multiSig, 6).Options(opts).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fund.HashTransaction()
+	p, err := tc.NewPartialTx(fund)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Sign(wallet.NewMemoryWallets(tc.owner)); err != nil {
+		t.Fatal(err)
+	}
+	if fund, err = p.Finalize(); err != nil {
+		t.Fatal(err)
+	}
+	tc.MineBlock([]*Transaction{fund}, tc.address())
+	if balance := tc.GetBalance(multiSig); balance != 6 {
+		t.Fatalf("balance of %s = %d, want 6", multiSig, balance)
+	}
+
+	payee := string(wallet.NewWallet().GetAddress())
+	spend, _, err := NewTxBuilder(tc.Chain, nil).From(multiSig).AddOutput(payee, 6).Options(opts).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend.HashTransaction()
+	if p, err = tc.NewPartialTx(spend); err != nil {
+		t.Fatal(err)
+	}
+	// 没有赎回脚本的钱包无法签名
+	if signed, err := p.Sign(wallet.NewMemoryWallets(signers[0])); signed != 0 || err != nil {
+		t.Fatalf("Sign() without the redeem script = %d, %v, want no signatures", signed, err)
+	}
+	p.Inputs[0].RedeemScript = redeemScript
+
+	// 签名按公钥顺序组装 与签名的先后无关
+	data := p.Serialize()
+	for i, w := range []*wallet.Wallet{signers[2], signers[0]} {
+		if p, err = DecodePartialTx(data); err != nil {
+			t.Fatal(err)
+		}
+		if signed, err := p.Sign(wallet.NewMemoryWallets(w)); signed != 1 || err != nil {
+			t.Fatalf("Sign() by signer %d = %d, %v, want 1 signature", i, signed, err)
+		}
+		if signed, err := p.Sign(wallet.NewMemoryWallets(w)); signed != 0 || err != nil {
+			t.Fatalf("Sign() again by signer %d = %d, %v, want no signatures", i, signed, err)
+		}
+		if complete := p.IsComplete(); complete != (i == 1) {
+			t.Fatalf("IsComplete() after signer %d = %v", i, complete)
+		}
+		if i == 0 {
+			if _, err := p.Finalize(); !errors.Is(err, ErrIncomplete) {
+				t.Fatalf("Finalize() = %v, want %v", err, ErrIncomplete)
+			}
+		}
+		data = p.Serialize()
+	}
+	final, err := p.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.CheckUnspent(final); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.ValidateBlock(tc.block(tc.GetLatestBlock(), final)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 一方的签名替换为另一笔交易的签名
+	forged, err := DecodePartialTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := range forged.Inputs[0].Sigs {
+		forged.Inputs[0].Sigs[key] = final.Vins[0].Script[:10]
+		break
+	}
+	if _, err := forged.Finalize(); err == nil {
+		t.Fatal("Finalize() accepted an invalid signature")
+	}
+}
@@ -48,19 +48,35 @@ func (p *ProofOfWork) Run() ([]byte, int) {
 	return hash[:], nonce
 }
 
+// Validate 验证区块哈希是否由区块数据和nonce计算得出且满足难度要求
+func (p *ProofOfWork) Validate() bool {
+	return p.validateHeader(p.Block.HashTransaction())
+}
+
+// 由区块头和交易的Merkle根验证区块哈希 不需要区块中的交易
+func (p *ProofOfWork) validateHeader(merkleRoot []byte) bool {
+	var hashInt big.Int
+	hash := sha256.Sum256(headerData(p.Block.Height, p.Block.TimeStamp, p.Block.PrevBlockHash, merkleRoot, p.Block.Nonce))
+	if !bytes.Equal(hash[:], p.Block.Hash) {
+		return false
+	}
+	hashInt.SetBytes(hash[:])
+	return p.Target.Cmp(&hashInt) == 1
+}
+
 // 生成准备数据
 func (p *ProofOfWork) prepareData(nonce int64) []byte {
-	// 拼接区块属性
-	timeStampBytes := utils.IntToHex(p.Block.TimeStamp)
-	heightBytes := utils.IntToHex(p.Block.Height)
-	// 拼接区块数据 用于后续做哈希计算
-	// 将区块高度 时间戳 前区块哈希 序列化交易数据 目标难度值 碰撞次数拼接
-	data := bytes.Join([][]byte{
-		heightBytes, timeStampBytes,
-		p.Block.PrevBlockHash,
-		p.Block.HashTransaction(),
+	return headerData(p.Block.Height, p.Block.TimeStamp, p.Block.PrevBlockHash, p.Block.HashTransaction(), nonce)
+}
+
+// 拼接区块属性 用于后续做哈希计算
+// 将区块高度 时间戳 前区块哈希 交易的Merkle根 目标难度值 碰撞次数拼接
+// 交易只以Merkle根参与 持有Merkle证明即可验证区块哈希
+func headerData(height, timeStamp int64, prevBlockHash, merkleRoot []byte, nonce int64) []byte {
+	return bytes.Join([][]byte{
+		utils.IntToHex(height), utils.IntToHex(timeStamp),
+		prevBlockHash,
+		merkleRoot,
 		utils.IntToHex(targetBit), utils.IntToHex(nonce),
 	}, []byte{})
-
-	return data
 }
@@ -0,0 +1,275 @@
+package block
+
+import (
+	"blockchain/crypto"
+	"blockchain/script"
+	"blockchain/wallet"
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+// 部分签名交易
+// 联网节点生成未签名交易 并附带各输入引用的输出 离线节点只需钱包即可计算签名数据并签名
+// 所有输入签名后在联网节点完成交易 验证签名后打包
+// 多重签名(P2SH)输入的签名分别记录 各方依次签名 达到所需数量后完成时组装解锁脚本
+// 离线节点无法核对附带的输出 只为签名数据包含输出金额的交易版本签名 金额被篡改时签名在链上无效
+
+const partialTxMagic = "ptx\xff" // 与交易的gob编码区分
+
+var (
+	ErrNotPartialTx = errors.New("data is not a partially signed transaction")
+	ErrIncomplete   = errors.New("transaction is not fully signed")
+	ErrBadPrevOuts  = errors.New("previous outputs do not match the inputs")
+	ErrPrevValues   = errors.New("transaction version does not commit to the previous output values")
+)
+
+// PartialTx 部分签名交易
+type PartialTx struct {
+	Tx       *Transaction // 签名过程中逐步填入各输入的公钥和签名
+	PrevOuts []*TxOutput  // 各输入引用的输出
+	Inputs   []*PartialInput
+}
+
+// PartialInput 脚本哈希输入的赎回脚本和已有的签名
+type PartialInput struct {
+	RedeemScript []byte
+	Sigs         map[string][]byte // 公钥(十六进制)->签名
+}
+
+// NewPartialTx 由未签名交易生成部分签名交易 从区块链中查找输入引用的输出
+func (c *Chain) NewPartialTx(tx *Transaction) (*PartialTx, error) {
+	p := &PartialTx{Tx: tx}
+	for _, vin := range tx.Vins {
+		p.Inputs = append(p.Inputs, &PartialInput{})
+		prevTx, ok := c.LookupTransaction(vin.TxHash)
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vouts) {
+			return nil, fmt.Errorf("%w: %x:%d", ErrInputNotFound, vin.TxHash, vin.Vout)
+		}
+		p.PrevOuts = append(p.PrevOuts, prevTx.Vouts[vin.Vout])
+	}
+	return p, nil
+}
+
+// Serialize 部分签名交易序列化
+func (p *PartialTx) Serialize() []byte {
+	var result bytes.Buffer
+	result.WriteString(partialTxMagic)
+	if err := gob.NewEncoder(&result).Encode(p); err != nil {
+		log.Panicf("serialize the partial transaction failed: %v\n", err)
+	}
+	return result.Bytes()
+}
+
+// IsPartialTx 数据是否为部分签名交易
+func IsPartialTx(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(partialTxMagic))
+}
+
+// DecodePartialTx 部分签名交易反序列化
+func DecodePartialTx(data []byte) (*PartialTx, error) {
+	if !IsPartialTx(data) {
+		return nil, ErrNotPartialTx
+	}
+	var p PartialTx
+	if err := gob.NewDecoder(bytes.NewReader(data[len(partialTxMagic):])).Decode(&p); err != nil {
+		return nil, err
+	}
+	if p.Tx == nil || len(p.Tx.Vins) == 0 || len(p.PrevOuts) != len(p.Tx.Vins) {
+		return nil, ErrBadPrevOuts
+	}
+	for _, out := range p.PrevOuts {
+		if out == nil {
+			return nil, ErrBadPrevOuts
+		}
+	}
+	// 早期的部分签名交易没有输入信息
+	if len(p.Inputs) != len(p.Tx.Vins) {
+		p.Inputs = make([]*PartialInput, len(p.Tx.Vins))
+	}
+	for i := range p.Inputs {
+		if p.Inputs[i] == nil {
+			p.Inputs[i] = &PartialInput{}
+		}
+	}
+	return &p, nil
+}
+
+// Fee 输入总额与输出总额之差
+func (p *PartialTx) Fee() int {
+	fee := 0
+	for _, out := range p.PrevOuts {
+		fee += out.Value
+	}
+	for _, out := range p.Tx.Vouts {
+		fee -= out.Value
+	}
+	return fee
+}
+
+// InputAddress 第i个输入引用的输出所属地址
+func (p *PartialTx) InputAddress(i int) string {
+	return p.PrevOuts[i].Address()
+}
+
+// AddRedeemScripts 从钱包中补充脚本哈希输入的赎回脚本 签名方可以不保存赎回脚本
+func (p *PartialTx) AddRedeemScripts(wallets *wallet.Wallets) {
+	for i, in := range p.Inputs {
+		if in.RedeemScript == nil && script.ExtractScriptHash(p.PrevOuts[i].LockingScript()) != nil {
+			in.RedeemScript, _ = wallets.RedeemScript(p.InputAddress(i))
+		}
+	}
+}
+
+// Sign 使用钱包中的私钥为属于钱包的输入签名 返回本次添加的签名数量
+// 钱包中没有私钥的输入保持原样 由其他钱包继续签名
+func (p *PartialTx) Sign(wallets *wallet.Wallets) (int, error) {
+	if p.Tx.Version < TxVersionPrevValues {
+		return 0, fmt.Errorf("%w: version %d", ErrPrevValues, p.Tx.Version)
+	}
+	p.AddRedeemScripts(wallets)
+	hashes := p.Tx.SignatureHashes(p.PrevOuts)
+	signed := 0
+	for i, vin := range p.Tx.Vins {
+		if script.ExtractScriptHash(p.PrevOuts[i].LockingScript()) != nil {
+			n, err := p.signMultiSig(i, wallets)
+			if err != nil {
+				return signed, err
+			}
+			signed += n
+			continue
+		}
+		w, err := wallets.GetWallet(p.InputAddress(i))
+		if errors.Is(err, wallet.ErrWalletNotFound) {
+			continue
+		}
+		if err != nil {
+			return signed, err
+		}
+		sign, err := crypto.Sign(&w.PrivateKey, hashes[i])
+		if err != nil {
+			return signed, err
+		}
+		vin.PublicKey = w.PublicKey
+		vin.Signature = sign
+		signed++
+	}
+	return signed, nil
+}
+
+// 使用钱包中赎回脚本公钥对应的私钥为多重签名输入签名 返回新增的签名数量
+func (p *PartialTx) signMultiSig(i int, wallets *wallet.Wallets) (int, error) {
+	in := p.Inputs[i]
+	if in.RedeemScript == nil {
+		return 0, nil
+	}
+	_, pubKeys, ok := script.ParseMultiSig(in.RedeemScript)
+	if !ok {
+		return 0, fmt.Errorf("redeem script of input %d is not a multisig script", i)
+	}
+	hash := p.Tx.SignatureHash(i, in.RedeemScript, p.PrevOuts)
+	signed := 0
+	for _, pubKey := range pubKeys {
+		key := hex.EncodeToString(pubKey)
+		if in.Sigs[key] != nil {
+			continue
+		}
+		w, err := wallets.GetWalletByPublicKey(pubKey)
+		if errors.Is(err, wallet.ErrWalletNotFound) {
+			continue
+		}
+		if err != nil {
+			return signed, err
+		}
+		sign, err := crypto.Sign(&w.PrivateKey, hash)
+		if err != nil {
+			return signed, err
+		}
+		if in.Sigs == nil {
+			in.Sigs = make(map[string][]byte)
+		}
+		in.Sigs[key] = sign
+		signed++
+	}
+	return signed, nil
+}
+
+// 多重签名输入按公钥顺序排列的签名 最多取所需数量
+func (in *PartialInput) orderedSigs() (int, [][]byte) {
+	m, pubKeys, ok := script.ParseMultiSig(in.RedeemScript)
+	if !ok {
+		return 0, nil
+	}
+	var sigs [][]byte
+	for _, pubKey := range pubKeys {
+		if sig := in.Sigs[hex.EncodeToString(pubKey)]; sig != nil && len(sigs) < m {
+			sigs = append(sigs, sig)
+		}
+	}
+	return m, sigs
+}
+
+// IsComplete 是否所有输入都已签名 多重签名输入须达到所需的签名数量
+func (p *PartialTx) IsComplete() bool {
+	for i, vin := range p.Tx.Vins {
+		if script.ExtractScriptHash(p.PrevOuts[i].LockingScript()) != nil {
+			if m, sigs := p.Inputs[i].orderedSigs(); m == 0 || len(sigs) < m {
+				return false
+			}
+			continue
+		}
+		if len(vin.Signature) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Finalize 组装多重签名输入的解锁脚本 执行所有输入的脚本 检查公钥和签名 返回可以广播的交易
+// 离线时不知道区块高度 时间锁在广播时检查
+func (p *PartialTx) Finalize() (*Transaction, error) {
+	if !p.IsComplete() {
+		return nil, ErrIncomplete
+	}
+	for i, vin := range p.Tx.Vins {
+		if script.ExtractScriptHash(p.PrevOuts[i].LockingScript()) == nil {
+			continue
+		}
+		_, sigs := p.Inputs[i].orderedSigs()
+		unlocking, err := script.MultiSigScript(sigs, p.Inputs[i].RedeemScript)
+		if err != nil {
+			return nil, err
+		}
+		vin.Script = unlocking
+	}
+	if err := p.Tx.VerifyScripts(p.PrevOuts, math.MaxInt64); err != nil {
+		return nil, err
+	}
+	return p.Tx, nil
+}
+
+// CheckUnspent 检查交易的输入都是区块链上未花费的输出
+func (c *Chain) CheckUnspent(tx *Transaction) error {
+	for _, vin := range tx.Vins {
+		prevTx, ok := c.LookupTransaction(vin.TxHash)
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vouts) {
+			return fmt.Errorf("%w: %x:%d", ErrInputNotFound, vin.TxHash, vin.Vout)
+		}
+		address := prevTx.Vouts[vin.Vout].Address()
+		unspent := false
+		for _, utxo := range c.UnUTXOS(address, nil) {
+			if bytes.Equal(utxo.TxHash, vin.TxHash) && utxo.Index == vin.Vout {
+				unspent = true
+				break
+			}
+		}
+		if !unspent {
+			return fmt.Errorf("input %x:%d is already spent", vin.TxHash, vin.Vout)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package block
+
+import (
+	"blockchain/wallet"
+	"errors"
+	"testing"
+)
+
+// 由两个钱包出资的交易 在两个离线钱包中依次签名后完成
+func TestPartialTxSign(t *testing.T) {
+	tc := newTestChain(t, 0)
+	second := wallet.NewWallet()
+	tc.MineBlock(nil, string(second.GetAddress()))
+	payee := string(wallet.NewWallet().GetAddress())
+	opts := &SendOptions{Selector: DefaultCoinSelector, FeeRate: 5, Dust: -1}
+	builder := NewTxBuilder(tc.Chain, nil).From(tc.address(), string(second.GetAddress())).AddOutput(payee, BlockSubsidy+2)
+	tx, selection, err := builder.Options(opts).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.HashTransaction()
+	p, err := tc.NewPartialTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Fee() != selection.Fee || p.Fee() == 0 {
+		t.Fatalf("Fee() = %d, want %d", p.Fee(), selection.Fee)
+	}
+
+	// 每个钱包只签名属于自己的输入 签名在序列化后保留
+	data := p.Serialize()
+	for i, w := range []*wallet.Wallet{tc.owner, second} {
+		if p, err = DecodePartialTx(data); err != nil {
+			t.Fatal(err)
+		}
+		if signed, err := p.Sign(wallet.NewMemoryWallets(w)); signed != 1 || err != nil {
+			t.Fatalf("Sign() by wallet %d = %d, %v, want 1 signature", i, signed, err)
+		}
+		if complete := p.IsComplete(); complete != (i == 1) {
+			t.Fatalf("IsComplete() after wallet %d = %v", i, complete)
+		}
+		if i == 0 {
+			if _, err := p.Finalize(); !errors.Is(err, ErrIncomplete) {
+				t.Fatalf("Finalize() = %v, want %v", err, ErrIncomplete)
+			}
+		}
+		data = p.Serialize()
+	}
+	final, err := p.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.CheckUnspent(final); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.ValidateBlock(tc.block(tc.GetLatestBlock(), final)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 签名后修改输出 签名不再有效
+	tampered, err := DecodePartialTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered.Tx.Vouts[0].Value--
+	if _, err := tampered.Finalize(); err == nil {
+		t.Fatal("Finalize() accepted a transaction modified after signing")
+	}
+}
+
+// 联网节点篡改输入引用的输出金额 离线签名得到的交易在链上无效 不包含输出金额的交易版本拒绝签名
+func TestPartialTxTamperedPrevOut(t *testing.T) {
+	tc := newTestChain(t, 0)
+	payee := string(wallet.NewWallet().GetAddress())
+	opts := &SendOptions{Selector: DefaultCoinSelector, FeeRate: 5, Dust: -1}
+	tx, _, err := NewTxBuilder(tc.Chain, nil).From(tc.address()).AddOutput(payee, 1).Options(opts).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.HashTransaction()
+	p, err := tc.NewPartialTx(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Serialize()
+
+	// 虚报更小的输入金额 隐瞒实际的手续费
+	tampered, err := DecodePartialTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered.PrevOuts[0].Value -= 5
+	if signed, err := tampered.Sign(wallet.NewMemoryWallets(tc.owner)); signed != 1 || err != nil {
+		t.Fatalf("Sign() = %d, %v, want 1 signature", signed, err)
+	}
+	final, err := tampered.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.ValidateBlock(tc.block(tc.genesis, final)); err == nil {
+		t.Fatal("ValidateBlock() accepted a transaction signed over a tampered previous output")
+	}
+
+	downgraded, err := DecodePartialTx(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downgraded.Tx.Version = TxVersionLockTime
+	if signed, err := downgraded.Sign(wallet.NewMemoryWallets(tc.owner)); signed != 0 || !errors.Is(err, ErrPrevValues) {
+		t.Fatalf("Sign() of version %d = %d, %v, want %v", TxVersionLockTime, signed, err, ErrPrevValues)
+	}
+}
+
+func TestDecodePartialTx(t *testing.T) {
+	tc := newTestChain(t, 0)
+	tx := tc.spend(tc.genesis.Txs[0], 0, BlockSubsidy)
+	if _, err := DecodePartialTx(tx.Serialize()); !errors.Is(err, ErrNotPartialTx) {
+		t.Fatalf("DecodePartialTx(transaction) = %v, want %v", err, ErrNotPartialTx)
+	}
+	missing := &PartialTx{Tx: tx}
+	if _, err := DecodePartialTx(missing.Serialize()); !errors.Is(err, ErrBadPrevOuts) {
+		t.Fatalf("DecodePartialTx() without previous outputs = %v, want %v", err, ErrBadPrevOuts)
+	}
+	unknown := tc.spend(tc.genesis.Txs[0], 0, BlockSubsidy)
+	unknown.Vins[0].TxHash = []byte("unknown transaction")
+	if _, err := tc.NewPartialTx(unknown); !errors.Is(err, ErrInputNotFound) {
+		t.Fatalf("NewPartialTx() with an unknown input = %v, want %v", err, ErrInputNotFound)
+	}
+}
@@ -0,0 +1,118 @@
+package block
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 交易替换和子交易代付
+// 输入序号带有替换标记的交易在确认前可以被手续费更高的冲突交易替换 交易池的替换规则由节点实现
+// 替换标记与相对时间锁使用不同的位 版本2的签名数据包含序号 标记不能被他人修改
+// 父交易手续费过低时 收款方可以花费它的输出并支付更高的手续费 矿工按父子交易合计的手续费率选择交易
+
+// SequenceReplaceable 输入序号的替换标记
+const SequenceReplaceable = 1 << 30
+
+// IncrementalRelayFeeRate 替换交易在被替换交易的手续费之外 须按该费率(每千字节)为自身的传播另外支付手续费
+const IncrementalRelayFeeRate = 1
+
+var ErrPrevTxNotFound = errors.New("previous transaction of the input not found")
+
+// SignalsReplacement 交易是否允许被替换 任一输入带有替换标记即可
+func (tx *Transaction) SignalsReplacement() bool {
+	if tx.IsCoinbaseTransaction() {
+		return false
+	}
+	for _, vin := range tx.Vins {
+		if vin.Sequence&SequenceReplaceable != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Fee 交易的手续费 prevTxs为输入引用的交易
+func (tx *Transaction) Fee(prevTxs map[string]Transaction) (int, error) {
+	fee := 0
+	for id, vin := range tx.Vins {
+		prevTx, ok := prevTxs[hex.EncodeToString(vin.TxHash)]
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vouts) {
+			return 0, fmt.Errorf("input %d: %w", id, ErrPrevTxNotFound)
+		}
+		fee += prevTx.Vouts[vin.Vout].Value
+	}
+	for _, vout := range tx.Vouts {
+		fee -= vout.Value
+	}
+	return fee, nil
+}
+
+// MinReplacementFee 替换交易的最低手续费 replacedFees为被移除交易的手续费之和 size为替换交易的字节数
+func MinReplacementFee(replacedFees int, size int) int {
+	return replacedFees + FeeForSize(size, IncrementalRelayFeeRate)
+}
+
+// FeeRate 每千字节的手续费率
+func FeeRate(fee int, size int) int {
+	if size <= 0 {
+		return 0
+	}
+	return fee * 1000 / size
+}
+
+// ChildFeeRate 子交易的手续费率 使父子交易合计的手续费率达到feeRate
+// parentFee和parentSize为父交易的手续费和字节数 childSize为子交易的估算字节数
+func ChildFeeRate(parentFee, parentSize, childSize, feeRate int) int {
+	fee := FeeForSize(parentSize+childSize, feeRate) - parentFee
+	if fee <= 0 || childSize <= 0 {
+		return 0
+	}
+	return (fee*1000 + childSize - 1) / childSize
+}
+
+// Replace 以未确认的交易original为模板生成替换交易 花费原交易的全部输入并保留找零之外的输出
+// change为原交易找零输出的索引 小于0表示没有找零 替换交易的找零返回原找零地址 增加的手续费由找零支付
+// 须在Options之后调用 替换交易沿用原交易的时间锁和相对时间锁 并带有替换标记
+func (b *TxBuilder) Replace(original *Transaction, change int) *TxBuilder {
+	opts := *b.opts
+	opts.Inputs = nil
+	opts.LockTime = original.LockTime
+	opts.Replaceable = true
+	if len(original.Vins) > 0 {
+		opts.Sequence = original.Vins[0].Sequence &^ SequenceReplaceable
+	}
+	for _, vin := range original.Vins {
+		opts.Inputs = append(opts.Inputs, OutPoint{TxHash: vin.TxHash, Index: vin.Vout})
+		if prevTx, ok := b.lookup(vin.TxHash); ok && vin.Vout >= 0 && vin.Vout < len(prevTx.Vouts) {
+			b.from = append(b.from, prevTx.Vouts[vin.Vout].Address())
+		}
+	}
+	b.opts = &opts
+	for index, vout := range original.Vouts {
+		switch {
+		case index == change:
+			b.change = vout.Address()
+		case vout.IsUnspendable():
+			b.data, _ = vout.Data()
+			if b.data == nil {
+				b.data = []byte{}
+			}
+		default:
+			out := *vout
+			b.outputs = append(b.outputs, &out)
+		}
+	}
+	return b
+}
+
+// 在尚未打包的交易和区块链中查找交易
+func (b *TxBuilder) lookup(txHash []byte) (*Transaction, bool) {
+	for _, tx := range b.txs {
+		if bytes.Equal(tx.TxHash, txHash) {
+			return tx, true
+		}
+	}
+	return b.source.LookupTransaction(txHash)
+}
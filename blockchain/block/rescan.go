@@ -0,0 +1,101 @@
+package block
+
+import (
+	"blockchain/wallet"
+	"bytes"
+	"encoding/hex"
+)
+
+// 钱包交易记录与区块链同步
+
+// WalletTxView 转换为钱包使用的交易内容
+func WalletTxView(tx *Transaction) *wallet.TxView {
+	view := &wallet.TxView{Hash: tx.TxHash, Coinbase: tx.IsCoinbaseTransaction()}
+	for _, vin := range tx.Vins {
+		view.Inputs = append(view.Inputs, wallet.OutPoint{TxHash: vin.TxHash, Index: vin.Vout})
+	}
+	for _, vout := range tx.Vouts {
+		view.Outputs = append(view.Outputs, wallet.TxOut{
+			Address: vout.Address(),
+			Value:   vout.Value,
+		})
+	}
+	return view
+}
+
+func walletBlockRef(b *Block) wallet.BlockRef {
+	return wallet.BlockRef{Hash: b.Hash, PrevHash: b.PrevBlockHash, Height: b.Height, Time: b.TimeStamp}
+}
+
+func walletTxViews(b *Block) []*wallet.TxView {
+	var views []*wallet.TxView
+	for _, tx := range b.Txs {
+		views = append(views, WalletTxView(tx))
+	}
+	return views
+}
+
+// SyncWallet 将钱包交易记录同步到主链最新区块
+// 钱包最后同步的区块已不在主链上时 先断开分叉上的区块 再连接主链上的新区块
+func (c *Chain) SyncWallet(wallets *wallet.Wallets, nodeId string) {
+	synced, _ := wallets.SyncedTip()
+	var blocks []*Block                // 钱包尚未连接的主链区块 从新到旧
+	mainChain := make(map[string]bool) // 遍历过的主链区块
+	found := false
+	it := c.NewIterator()
+	for {
+		b := it.Next()
+		if b == nil {
+			break
+		}
+		if bytes.Equal(b.Hash, synced) {
+			found = true
+			break
+		}
+		mainChain[hex.EncodeToString(b.Hash)] = true
+		blocks = append(blocks, b)
+		if isBreakLoop(b.PrevBlockHash) {
+			break
+		}
+	}
+
+	var forkHeight int64 // 分叉点高度 此高度以上的主链区块需要连接
+	if !found && synced != nil {
+		forkHeight = c.disconnectWallet(wallets, synced, mainChain)
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if blocks[i].Height > forkHeight {
+			wallets.ConnectBlock(walletBlockRef(blocks[i]), walletTxViews(blocks[i]))
+		}
+	}
+	wallets.SaveWallets(nodeId)
+}
+
+// 从钱包最后同步的区块开始断开分叉上的区块 返回分叉点高度
+// 找不到分叉点时钱包记录属于其他区块链 清除后从创世区块重新同步
+func (c *Chain) disconnectWallet(wallets *wallet.Wallets, synced []byte, mainChain map[string]bool) int64 {
+	hash := synced
+	for {
+		blockBytes := c.GetBlock(hash)
+		if blockBytes == nil {
+			break
+		}
+		b := DeserializeBlock(blockBytes)
+		if mainChain[hex.EncodeToString(b.Hash)] {
+			return b.Height
+		}
+		wallets.DisconnectBlock(walletBlockRef(b))
+		if isBreakLoop(b.PrevBlockHash) {
+			break
+		}
+		hash = b.PrevBlockHash
+	}
+	wallets.ResetHistory()
+	return 0
+}
+
+// RescanWallet 清除钱包交易记录并从创世区块重新同步
+func (c *Chain) RescanWallet(wallets *wallet.Wallets, nodeId string) {
+	wallets.ResetHistory()
+	c.SyncWallet(wallets, nodeId)
+}
@@ -0,0 +1,116 @@
+package block
+
+import (
+	"blockchain/crypto"
+	"blockchain/script"
+	"errors"
+	"fmt"
+)
+
+// 交易脚本验证
+// 每个输入的解锁脚本与引用输出的锁定脚本一起执行 没有脚本的输入输出按P2PKH模板执行
+
+var (
+	ErrUnknownTxVersion = errors.New("unknown transaction version")
+	ErrLegacyScript     = errors.New("legacy transaction cannot carry scripts")
+	ErrLockTimeVersion  = errors.New("transaction version does not support lock times")
+)
+
+// 脚本中依赖交易的检查
+type txChecker struct {
+	tx         *Transaction
+	prevOuts   []*TxOutput // 各输入引用的输出
+	index      int         // 正在验证的输入
+	height     int64       // 交易所在区块的高度
+	legacyHash []byte      // 早期交易的签名数据 与执行的脚本无关
+}
+
+func (c *txChecker) CheckSig(sig, pubKey, scriptCode []byte) bool {
+	hash := c.legacyHash
+	if hash == nil {
+		hash = c.tx.SignatureHash(c.index, scriptCode, c.prevOuts)
+	}
+	// 签名方案由公钥格式决定 兼容早期的P-256交易
+	return crypto.Verify(pubKey, hash, sig)
+}
+
+// 版本2之前检查交易所在区块的高度 之后与交易的时间锁比较 交易的时间锁由区块验证保证已达到
+func (c *txChecker) CheckLockTime(lockTime int64) bool {
+	if c.tx.Version < TxVersionLockTime {
+		return c.height >= lockTime
+	}
+	if (lockTime < LockTimeThreshold) != (c.tx.LockTime < LockTimeThreshold) {
+		return false
+	}
+	return lockTime <= c.tx.LockTime
+}
+
+// 与输入的序号比较 两者须为同一类型 输入的相对时间锁由区块验证保证已达到
+func (c *txChecker) CheckSequence(sequence int64) bool {
+	if c.tx.Version < TxVersionLockTime {
+		return false
+	}
+	txSequence := int64(c.tx.Vins[c.index].Sequence)
+	if txSequence&SequenceLockTimeDisabled != 0 {
+		return false
+	}
+	if sequence&SequenceLockTimeIsSeconds != txSequence&SequenceLockTimeIsSeconds {
+		return false
+	}
+	return sequence&SequenceLockTimeMask <= txSequence&SequenceLockTimeMask
+}
+
+// VerifyScripts 执行每个输入的解锁脚本和引用输出的锁定脚本
+// prevOuts[i]为第i个输入引用的输出 height为交易所在(或将要打包进)的区块高度
+func (tx *Transaction) VerifyScripts(prevOuts []*TxOutput, height int64) error {
+	var legacyHashes [][]byte
+	switch tx.Version {
+	case TxVersionLegacy:
+		for _, vin := range tx.Vins {
+			if vin.Script != nil {
+				return ErrLegacyScript
+			}
+		}
+		for _, vout := range tx.Vouts {
+			if vout.Script != nil {
+				return ErrLegacyScript
+			}
+		}
+		// 早期的签名数据只包含公钥哈希 不能花费由脚本锁定的输出
+		for _, out := range prevOuts {
+			if out.Script != nil {
+				return ErrLegacyScript
+			}
+		}
+		legacyHashes = tx.legacySignatureHashes(prevOuts)
+	case TxVersionScript:
+	case TxVersionLockTime:
+	case TxVersionPrevValues:
+	default:
+		return fmt.Errorf("%w: %d", ErrUnknownTxVersion, tx.Version)
+	}
+	// 版本2之前签名数据不包含时间锁和序号
+	if tx.Version < TxVersionLockTime {
+		if tx.LockTime != 0 {
+			return ErrLockTimeVersion
+		}
+		for _, vin := range tx.Vins {
+			if vin.Sequence != 0 {
+				return ErrLockTimeVersion
+			}
+		}
+	}
+	if err := tx.checkDataOutputs(); err != nil {
+		return err
+	}
+	for id, vin := range tx.Vins {
+		checker := &txChecker{tx: tx, prevOuts: prevOuts, index: id, height: height}
+		if legacyHashes != nil {
+			checker.legacyHash = legacyHashes[id]
+		}
+		if err := script.Verify(vin.UnlockingScript(), prevOuts[id].LockingScript(), checker); err != nil {
+			return fmt.Errorf("input %d: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package block
+
+import (
+	legacy "blockchain/block/legacy"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// 签名数据
+// 早期交易(版本0)的签名数据是交易副本gob编码的哈希 依赖结构的字段列表和gob的类型编号
+// 版本1起按固定格式序列化: 版本 输入(引用的输出和脚本) 输出(金额和锁定脚本)
+// 被签名输入的位置填入正在执行的锁定脚本 其他输入的脚本为空 各输入的签名互不依赖
+// 版本2起在版本之后加入交易的时间锁 每个输入加入序号
+// 版本3起每个输入加入引用输出的金额 签名方提供的输出金额与链上不符时签名无效
+
+// SignatureHashes 计算每个输入需要签名的数据 prevOuts[i]为第i个输入引用的输出
+func (tx *Transaction) SignatureHashes(prevOuts []*TxOutput) [][]byte {
+	if tx.Version == TxVersionLegacy {
+		return tx.legacySignatureHashes(prevOuts)
+	}
+	hashes := make([][]byte, len(tx.Vins))
+	for id := range tx.Vins {
+		hashes[id] = tx.SignatureHash(id, prevOuts[id].LockingScript(), prevOuts)
+	}
+	return hashes
+}
+
+// SignatureHash 第index个输入的签名数据 scriptCode为该输入执行的锁定脚本 prevOuts[i]为第i个输入引用的输出
+func (tx *Transaction) SignatureHash(index int, scriptCode []byte, prevOuts []*TxOutput) []byte {
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(tx.Version))
+	if tx.Version >= TxVersionLockTime {
+		writeUvarint(&buf, uint64(tx.LockTime))
+	}
+	writeUvarint(&buf, uint64(len(tx.Vins)))
+	for id, vin := range tx.Vins {
+		writeBytes(&buf, vin.TxHash)
+		writeUvarint(&buf, uint64(vin.Vout))
+		if tx.Version >= TxVersionLockTime {
+			writeUvarint(&buf, uint64(vin.Sequence))
+		}
+		if tx.Version >= TxVersionPrevValues {
+			writeUvarint(&buf, uint64(prevOuts[id].Value))
+		}
+		if id == index {
+			writeBytes(&buf, scriptCode)
+		} else {
+			writeBytes(&buf, nil)
+		}
+	}
+	writeUvarint(&buf, uint64(len(tx.Vouts)))
+	for _, vout := range tx.Vouts {
+		writeUvarint(&buf, uint64(vout.Value))
+		writeBytes(&buf, vout.LockingScript())
+	}
+	hash := sha256.Sum256(buf.Bytes())
+	return hash[:]
+}
+
+func writeUvarint(buf *bytes.Buffer, n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	buf.Write(b[:binary.PutUvarint(b[:], n)])
+}
+
+// 带长度前缀的字节序列
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	writeUvarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+// 早期交易的签名数据 由保留的早期交易结构计算
+func (tx *Transaction) legacySignatureHashes(prevOuts []*TxOutput) [][]byte {
+	txCopy := &legacy.Transaction{TxHash: tx.TxHash}
+	for _, vin := range tx.Vins {
+		txCopy.Vins = append(txCopy.Vins, &legacy.TxInput{TxHash: vin.TxHash, Vout: vin.Vout})
+	}
+	for _, vout := range tx.Vouts {
+		txCopy.Vouts = append(txCopy.Vouts, &legacy.TxOutput{Value: vout.Value, Ripemd160Hash: vout.Ripemd160Hash})
+	}
+	prevHashes := make([][]byte, len(prevOuts))
+	for id, out := range prevOuts {
+		prevHashes[id] = out.Ripemd160Hash
+	}
+	return legacy.SignatureHashes(txCopy, prevHashes)
+}
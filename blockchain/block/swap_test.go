@@ -0,0 +1,219 @@
+package block
+
+import (
+	"blockchain/script"
+	"blockchain/wallet"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// 原子交换
+// 两条创世区块不同的区块链 Alice在链X上有币 Bob在链Y上有币
+// Alice生成秘密值并在链X上创建合约 Bob审核后在链Y上以同一秘密哈希创建时间锁更短的合约
+// Alice在链Y上取款时公开秘密值 Bob从该交易中提取秘密值后在链X上取款
+// 一方不响应时 发起方在时间锁之后取回资金
+
+const swapMaturity = 3 // 挖矿奖励的成熟度 创建区块链后先挖出若干区块 使创世奖励可以花费
+
+// 交换使用的区块链 挖矿奖励属于miner 不影响双方余额
+type swapChain struct {
+	*Chain
+	miner string
+}
+
+func newSwapChain(t *testing.T, owner *wallet.Wallet) *swapChain {
+	t.Helper()
+	genesis := CreateGenesisBlock([]*Transaction{NewCoinbaseTransaction(string(owner.GetAddress()))})
+	chain, err := NewChainWithGenesis(filepath.Join(t.TempDir(), "block.db"), genesis, swapMaturity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.DB.Close() })
+	sc := &swapChain{Chain: chain, miner: string(wallet.NewWallet().GetAddress())}
+	for !sc.IsMature(genesis.Height, sc.GetHeight()+1) {
+		sc.MineBlock(nil, sc.miner)
+	}
+	return sc
+}
+
+// 使用钱包w创建合约 返回资金交易和合约脚本
+func (sc *swapChain) fund(t *testing.T, w *wallet.Wallet, h *script.HTLC, amount int) (*Transaction, []byte) {
+	t.Helper()
+	contract, err := h.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, _, err := NewTxBuilder(sc.Chain, nil).From(string(w.GetAddress())).AddOutput(ContractAddress(contract), amount).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.HashTransaction()
+	keys := make([]ecdsa.PrivateKey, len(tx.Vins))
+	for i, vin := range tx.Vins {
+		vin.PublicKey = w.PublicKey
+		keys[i] = w.PrivateKey
+	}
+	sc.SignTransactionInputs(tx, keys)
+	if err := sc.mine(tx); err != nil {
+		t.Fatalf("fund the contract: %v", err)
+	}
+	return tx, contract
+}
+
+// 检查时间锁和签名后打包交易
+func (sc *swapChain) mine(tx *Transaction) error {
+	if err := sc.CheckLocks(tx, sc.NextBlock()); err != nil {
+		return err
+	}
+	if !sc.VerifyTransaction(tx) {
+		return errors.New("transaction failed verification")
+	}
+	sc.MineBlock([]*Transaction{tx}, sc.miner)
+	return nil
+}
+
+// 检查合约及其资金输出 确认收款方、金额和秘密哈希
+func auditContract(t *testing.T, contractTx *Transaction, contract []byte, recipient string, amount int, secretHash []byte) {
+	t.Helper()
+	h, err := script.ParseHTLC(contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := FindContractOutput(contractTx, contract)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.Recipient, wallet.StringToHash160(recipient)) || !bytes.Equal(h.SecretHash, secretHash) {
+		t.Fatal("contract does not pay the recipient with the agreed secret hash")
+	}
+	if value := contractTx.Vouts[index].Value; value != amount {
+		t.Fatalf("contract holds %d, want %d", value, amount)
+	}
+}
+
+func newSecret(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	secret := make([]byte, script.SecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(secret)
+	return secret, hash[:]
+}
+
+// 双方按秘密值取款 余额互换
+func TestSwapClaim(t *testing.T) {
+	const amountX, amountY = 5, 7
+	aliceWallet, bobWallet := wallet.NewWallet(), wallet.NewWallet()
+	alice, bob := string(aliceWallet.GetAddress()), string(bobWallet.GetAddress())
+	x, y := newSwapChain(t, aliceWallet), newSwapChain(t, bobWallet)
+	if bytes.Equal(x.GetGenesisHash(), y.GetGenesisHash()) {
+		t.Fatal("both chains have the same genesis block")
+	}
+	secret, secretHash := newSecret(t)
+
+	// Alice发起 Bob审核后参与 时间锁更短 保证Alice公开秘密值后Bob有时间取款
+	hX, err := NewHTLC(secretHash, bob, alice, x.GetHeight()+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txX, contractX := x.fund(t, aliceWallet, hX, amountX)
+	auditContract(t, txX, contractX, bob, amountX, secretHash)
+	hY, err := NewHTLC(secretHash, alice, bob, y.GetHeight()+5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txY, contractY := y.fund(t, bobWallet, hY, amountY)
+	auditContract(t, txY, contractY, alice, amountY, secretHash)
+
+	// 错误的秘密值和非收款方不能取款
+	if _, err := SpendHTLC(txY, contractY, aliceWallet, make([]byte, script.SecretSize), alice, 0); !errors.Is(err, ErrSecretMismatch) {
+		t.Fatalf("redeem with a wrong secret: %v, want %v", err, ErrSecretMismatch)
+	}
+	if _, err := SpendHTLC(txY, contractY, bobWallet, secret, bob, 0); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("redeem by the refund party: %v, want %v", err, ErrNotParticipant)
+	}
+	redeemY, err := SpendHTLC(txY, contractY, aliceWallet, secret, alice, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := y.mine(redeemY); err != nil {
+		t.Fatalf("alice redeems on Y: %v", err)
+	}
+
+	// Bob在链Y上找到取款交易 提取秘密值后在链X上取款
+	indexY, err := FindContractOutput(txY, contractY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spender, _, ok := y.FindSpendingTx(txY.TxHash, indexY)
+	if !ok {
+		t.Fatal("the redemption on Y is not found")
+	}
+	extracted, err := ExtractSecret(spender, secretHash)
+	if err != nil || !bytes.Equal(extracted, secret) {
+		t.Fatalf("ExtractSecret() = %x, %v", extracted, err)
+	}
+	redeemX, err := SpendHTLC(txX, contractX, bobWallet, extracted, bob, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.mine(redeemX); err != nil {
+		t.Fatalf("bob redeems on X: %v", err)
+	}
+
+	if balance := y.GetBalance(alice); balance != amountY {
+		t.Fatalf("alice has %d on Y, want %d", balance, amountY)
+	}
+	if balance := x.GetBalance(bob); balance != amountX {
+		t.Fatalf("bob has %d on X, want %d", balance, amountX)
+	}
+	if balance := x.GetBalance(alice); balance != BlockSubsidy-amountX {
+		t.Fatalf("alice has %d on X, want %d", balance, BlockSubsidy-amountX)
+	}
+}
+
+// Bob不参与时 Alice在时间锁之前不能退款 之后取回全部资金
+func TestSwapRefund(t *testing.T) {
+	const amount = 5
+	aliceWallet, bobWallet := wallet.NewWallet(), wallet.NewWallet()
+	alice, bob := string(aliceWallet.GetAddress()), string(bobWallet.GetAddress())
+	x := newSwapChain(t, aliceWallet)
+	_, secretHash := newSecret(t)
+
+	before := x.GetBalance(alice)
+	refundHeight := x.GetHeight() + 3
+	h, err := NewHTLC(secretHash, bob, alice, refundHeight)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, contract := x.fund(t, aliceWallet, h, amount)
+	if balance := x.GetBalance(alice); balance != before-amount {
+		t.Fatalf("alice has %d after funding, want %d", balance, before-amount)
+	}
+
+	if _, err := SpendHTLC(tx, contract, bobWallet, nil, bob, 0); !errors.Is(err, ErrNotParticipant) {
+		t.Fatalf("refund by the recipient: %v, want %v", err, ErrNotParticipant)
+	}
+	refund, err := SpendHTLC(tx, contract, aliceWallet, nil, alice, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.mine(refund); !errors.Is(err, ErrLockTime) {
+		t.Fatalf("refund before the lock time: %v, want %v", err, ErrLockTime)
+	}
+	for x.GetHeight()+1 < refundHeight {
+		x.MineBlock(nil, x.miner)
+	}
+	if err := x.mine(refund); err != nil {
+		t.Fatalf("refund after the lock time: %v", err)
+	}
+	if balance := x.GetBalance(alice); balance != before {
+		t.Fatalf("alice has %d after the refund, want %d", balance, before)
+	}
+}
@@ -1,18 +1,17 @@
 package block
 
 import (
+	"blockchain/crypto"
 	"blockchain/utils"
 	"blockchain/wallet"
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
 	"log"
-	"math/big"
+	"os"
 	"time"
 )
 
@@ -30,23 +29,35 @@ import (
 
 // Transaction 交易结构
 type Transaction struct {
-	TxHash []byte      // 交易哈希
-	Vins   []*TxInput  // 输入列表
-	Vouts  []*TxOutput // 输出列表
+	TxHash   []byte      // 交易哈希
+	Vins     []*TxInput  // 输入列表
+	Vouts    []*TxOutput // 输出列表
+	Version  int         // 交易版本 决定签名数据的计算方式
+	LockTime int64       // 交易最早可以打包的区块高度或时间 0表示不限制
 }
 
+// 交易版本
+const (
+	TxVersionLegacy     = 0                   // 早期交易 签名数据由交易副本的gob编码计算 输入输出不能携带脚本
+	TxVersionScript     = 1                   // 签名数据按固定格式序列化 输入输出可以携带脚本
+	TxVersionLockTime   = 2                   // 签名数据包含交易的时间锁和输入的序号 支持相对时间锁
+	TxVersionPrevValues = 3                   // 签名数据包含各输入引用的输出金额 离线签名时手续费不能被隐瞒
+	TxVersion           = TxVersionPrevValues // 新建交易使用的版本
+)
+
+// BlockSubsidy 每个区块的挖矿奖励 coinbase交易可以另外收取区块中交易的手续费
+const BlockSubsidy = 10
+
 // NewCoinbaseTransaction 创建Coinbase交易
 // Coinbase Transaction: 币基交易
 // 每个区块的第一笔交易 由挖矿奖励产生 比特币由此在挖矿中被创造
 func NewCoinbaseTransaction(address string) *Transaction {
 	var txCoinbase *Transaction
-	txInput := &TxInput{
-		[]byte{}, -1, nil, nil,
-	}
-	txOutput := NewTxOutput(10, address) // 挖矿奖励
+	txInput := &TxInput{TxHash: []byte{}, Vout: -1}
+	txOutput := NewTxOutput(BlockSubsidy, address) // 挖矿奖励
 	// 组装奖励
 	txCoinbase = &Transaction{
-		nil, []*TxInput{txInput}, []*TxOutput{txOutput},
+		Vins: []*TxInput{txInput}, Vouts: []*TxOutput{txOutput}, Version: TxVersion,
 	}
 	txCoinbase.HashTransaction()
 	return txCoinbase
@@ -69,30 +80,31 @@ func (tx *Transaction) HashTransaction() {
 }
 
 // NewSimpleTransaction 普通转账交易
+// 输入由opts中的选币策略选择 找零返回转账者
 func NewSimpleTransaction(from string, to string, amount int,
-	chain *Chain, txs []*Transaction, nodeId string) *Transaction {
+	chain *Chain, txs []*Transaction, nodeId string, opts *SendOptions) *Transaction {
 	var txInputs []*TxInput   // 输入列表
 	var txOutputs []*TxOutput // 输出列表
 
-	// 查找转账者的UTXO
-	money, spendableUTXO := chain.FindSpendableUTXO(from, amount, txs)
-	fmt.Printf("money: %v\n", money)
+	// 选择转账者的UTXO
+	selection, err := chain.SelectCoins([]string{from}, amount, 1, txs, opts)
+	if err != nil {
+		fmt.Printf("select inputs of address[%s] failed: %v\n", from, err)
+		os.Exit(1)
+	}
+	fmt.Printf("money: %d, fee: %d, change: %d\n", selection.Total, selection.Fee, selection.Change)
 
 	// 获取钱包集合对象
 	wallets := wallet.NewWallets(nodeId)
-	w := wallets.Wallets[from] // 获取转账者钱包对象
+	w, err := wallets.GetWallet(from) // 获取转账者钱包对象
+	if err != nil {
+		log.Panicf("get wallet of address[%s] failed: %v\n", from, err)
+	}
 
-	// 遍历spendableUTXO中的交易输出
-	for txHash, indexArray := range spendableUTXO {
-		txHashesBytes, err := hex.DecodeString(txHash)
-		if err != nil {
-			log.Panicf("decode string to bytes failed %v\n", err)
-		}
-		// 遍历索引列表 将交易输出索引拼接到当前交易输入列表中
-		for _, index := range indexArray {
-			txInput := &TxInput{txHashesBytes, index, nil, w.PublicKey}
-			txInputs = append(txInputs, txInput)
-		}
+	// 将选中的UTXO作为交易输入
+	for _, utxo := range selection.Inputs {
+		txInput := &TxInput{TxHash: utxo.TxHash, Vout: utxo.Index, PublicKey: w.PublicKey, Sequence: opts.sequence()}
+		txInputs = append(txInputs, txInput)
 	}
 
 	// 生成一笔交易输出 所属于转账目标
@@ -100,14 +112,12 @@ func NewSimpleTransaction(from string, to string, amount int,
 	txOutputs = append(txOutputs, txOutput)
 
 	// 找零会生成一笔交易输出 所属于转账者
-	if money > amount {
-		txOutput = NewTxOutput(money-amount, from)
+	if selection.Change > 0 {
+		txOutput = NewTxOutput(selection.Change, from)
 		txOutputs = append(txOutputs, txOutput)
-	} else {
-		log.Panicf("insufficient balance...")
 	}
 
-	tx := Transaction{nil, txInputs, txOutputs}
+	tx := Transaction{Vins: txInputs, Vouts: txOutputs, Version: TxVersion, LockTime: opts.LockTime}
 	tx.HashTransaction()
 
 	// 使用私钥对交易进行签名
@@ -121,8 +131,17 @@ func (tx *Transaction) IsCoinbaseTransaction() bool {
 	return tx.Vins[0].Vout == -1 && len(tx.Vins[0].TxHash) == 0
 }
 
-// Sign 对交易进行签名
+// Sign 使用同一私钥对交易的所有输入签名
 func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, prevTxs map[string]Transaction) {
+	keys := make([]ecdsa.PrivateKey, len(tx.Vins))
+	for i := range keys {
+		keys[i] = privateKey
+	}
+	tx.SignInputs(keys, prevTxs)
+}
+
+// SignInputs 对交易进行签名 keys[i]为第i个输入引用的输出所属地址的私钥
+func (tx *Transaction) SignInputs(keys []ecdsa.PrivateKey, prevTxs map[string]Transaction) {
 	// 检查tx中每一个输入所引用的交易哈希是否包含在prevTxs中
 	// 如果没有包含 表明该交易被人篡改
 	for _, vin := range tx.Vins {
@@ -132,41 +151,23 @@ func (tx *Transaction) Sign(privateKey ecdsa.PrivateKey, prevTxs map[string]Tran
 	}
 
 	// 提取要签名的属性
-	txCopy := tx.TrimmedCopy()
-	for id, vin := range txCopy.Vins {
-		prevTx := prevTxs[hex.EncodeToString(vin.TxHash)]
-		txCopy.Vins[id].PublicKey = prevTx.Vouts[vin.Vout].Ripemd160Hash
-		txCopy.TxHash = txCopy.Hash()
-		r, s, err := ecdsa.Sign(rand.Reader, &privateKey, txCopy.TxHash) // 调用核心函数
+	hashes := tx.SignatureHashes(prevOutputs(tx, prevTxs))
+	for id := range tx.Vins {
+		sign, err := crypto.Sign(&keys[id], hashes[id]) // 按私钥的签名方案签名
 		if err != nil {
 			log.Panicf("sign to transaction[%x] failed: %v", tx.TxHash, err)
 		}
-		sign := append(r.Bytes(), s.Bytes()...)
 		tx.Vins[id].Signature = sign // 将签名赋值
 	}
 }
 
-// TrimmedCopy 拷贝交易 生成一个专门用于交易签名的副本
-func (tx *Transaction) TrimmedCopy() Transaction {
-	var inputs []*TxInput
-	var outputs []*TxOutput
-
-	for _, vin := range tx.Vins {
-		inputs = append(inputs, &TxInput{vin.TxHash, vin.Vout, nil, nil})
-	}
-	for _, vout := range tx.Vouts {
-		outputs = append(outputs, &TxOutput{vout.Value, vout.Ripemd160Hash})
+// 各输入引用的输出 调用方须确认引用的交易和输出存在
+func prevOutputs(tx *Transaction, prevTxs map[string]Transaction) []*TxOutput {
+	prevOuts := make([]*TxOutput, len(tx.Vins))
+	for id, vin := range tx.Vins {
+		prevOuts[id] = prevTxs[hex.EncodeToString(vin.TxHash)].Vouts[vin.Vout]
 	}
-	txCopy := Transaction{tx.TxHash, inputs, outputs}
-	return txCopy
-}
-
-// Hash 生成交易哈希
-func (tx *Transaction) Hash() []byte {
-	txCopy := tx
-	txCopy.TxHash = []byte{}
-	hash := sha256.Sum256(txCopy.Serialize())
-	return hash[:]
+	return prevOuts
 }
 
 // Serialize 交易序列化
@@ -179,39 +180,25 @@ func (tx *Transaction) Serialize() []byte {
 	return result.Bytes()
 }
 
-// Verify 验证交易
-func (tx *Transaction) Verify(prevTxs map[string]Transaction) bool {
-	// 检查能否查找到交易哈希
-	for _, vin := range tx.Vins {
-		if prevTxs[hex.EncodeToString(vin.TxHash)].TxHash == nil {
-			log.Panicf("verify transaction failed\n")
-		}
+// DecodeTransaction 交易反序列化 解析失败时返回错误
+func DecodeTransaction(txBytes []byte) (*Transaction, error) {
+	var tx Transaction
+	decoder := gob.NewDecoder(bytes.NewReader(txBytes))
+	if err := decoder.Decode(&tx); err != nil {
+		return nil, err
 	}
-	// 提取相同交易签名
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
+	return &tx, nil
+}
 
-	// 遍历交易输入 对每笔输入所引用的输出进行验证
-	for id, vin := range tx.Vins {
+// Verify 验证交易 height为交易所在(或将要打包进)的区块高度
+func (tx *Transaction) Verify(prevTxs map[string]Transaction, height int64) bool {
+	// 检查能否查找到交易哈希 以及引用的输出是否存在
+	for _, vin := range tx.Vins {
 		prevTx := prevTxs[hex.EncodeToString(vin.TxHash)]
-		txCopy.Vins[id].PublicKey = prevTx.Vouts[vin.Vout].Ripemd160Hash
-		// 由要验证的数据生成的交易哈希 须与签名完全一致
-		txCopy.TxHash = txCopy.Hash()
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:sigLen/2])
-		s.SetBytes(vin.Signature[sigLen/2:])
-
-		x := big.Int{}
-		y := big.Int{}
-		pubKeyLen := len(vin.PublicKey)
-		x.SetBytes(vin.PublicKey[:pubKeyLen/2])
-		y.SetBytes(vin.PublicKey[pubKeyLen/2:])
-		rawPublicKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if !ecdsa.Verify(&rawPublicKey, txCopy.TxHash, &r, &s) {
+		if prevTx.TxHash == nil || vin.Vout < 0 || vin.Vout >= len(prevTx.Vouts) {
 			return false
 		}
 	}
-	return true
+	// 执行每个输入的解锁脚本和引用输出的锁定脚本
+	return tx.VerifyScripts(prevOutputs(tx, prevTxs), height) == nil
 }
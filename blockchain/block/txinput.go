@@ -2,6 +2,7 @@ package block
 
 import (
 	"blockchain/crypto"
+	"blockchain/script"
 	"bytes"
 )
 
@@ -15,10 +16,28 @@ type TxInput struct {
 	Vout      int    // 输出索引 引用上一笔交易的输出索引号
 	Signature []byte // 数字签名
 	PublicKey []byte // 公钥
+	Script    []byte // 解锁脚本 为空时由签名和公钥组成
+	Sequence  uint32 // 序号 未设置禁用标志时表示相对时间锁
 }
 
 // UnLockRipemd160Hash 解锁账户
+// 没有解锁脚本时比较公钥的哈希 否则比较最后压入的数据(P2SH的赎回脚本)的哈希
 func (txInput *TxInput) UnLockRipemd160Hash(ripemd160Hash []byte) bool {
 	inputRipemd160Hash := crypto.Ripemd160Hash(txInput.PublicKey)
+	if txInput.Script != nil {
+		data, err := script.PushedData(txInput.Script)
+		if err != nil || len(data) == 0 {
+			return false
+		}
+		inputRipemd160Hash = crypto.Ripemd160Hash(data[len(data)-1])
+	}
 	return bytes.Compare(inputRipemd160Hash, ripemd160Hash) == 0
 }
+
+// UnlockingScript 输入的解锁脚本 没有脚本的输入为P2PKH解锁脚本<签名> <公钥>
+func (txInput *TxInput) UnlockingScript() []byte {
+	if txInput.Script != nil {
+		return txInput.Script
+	}
+	return script.SignatureScript(txInput.Signature, txInput.PublicKey)
+}
@@ -1,6 +1,7 @@
 package block
 
 import (
+	"blockchain/script"
 	"blockchain/wallet"
 	"bytes"
 	"encoding/gob"
@@ -14,29 +15,83 @@ import (
 
 // TxOutput 交易输出
 type TxOutput struct {
-	Value         int // 金额
-	Ripemd160Hash []byte
+	Value         int    // 金额
+	Ripemd160Hash []byte // 公钥哈希 没有锁定脚本时按P2PKH模板锁定到该哈希
+	Script        []byte // 锁定脚本
 }
 
+// TxOutputs 一笔交易在UTXO表中的未花费输出
 type TxOutputs struct {
-	Set []*TxOutput
+	Set      []*TxOutput
+	Indexes  []int // Set中各输出在交易输出列表中的位置
+	Coinbase bool  // 是否为挖矿奖励
+	Height   int64 // 交易所在区块高度 用于判断挖矿奖励是否成熟
 }
 
-// UnLockScriptPubkeyWithAddress 解锁账户
+// UnLockScriptPubkeyWithAddress 解锁账户 不可花费的输出不属于任何地址
 func (txOutput *TxOutput) UnLockScriptPubkeyWithAddress(address string) bool {
-	hash160 := wallet.StringToHash160(address) // 将地址转换为哈希字节序列
-	return bytes.Compare(hash160, txOutput.Ripemd160Hash) == 0
+	return !txOutput.IsUnspendable() && txOutput.Address() == address
 }
 
-// NewTxOutput 创建交易输出
+// Address 输出所属的地址 P2PKH输出为公钥哈希地址 P2SH输出为脚本哈希地址 其他脚本没有地址
+func (txOutput *TxOutput) Address() string {
+	if txOutput.Script == nil {
+		return string(wallet.Hash160ToAddress(txOutput.Ripemd160Hash))
+	}
+	if hash := script.ExtractScriptHash(txOutput.Script); hash != nil {
+		return string(wallet.ScriptHashToAddress(hash))
+	}
+	return ""
+}
+
+// NewTxOutput 创建交易输出 脚本哈希地址使用P2SH锁定脚本
 func NewTxOutput(value int, address string) *TxOutput {
 	txOutput := &TxOutput{}
 	hash160 := wallet.StringToHash160(address)
 	txOutput.Value = value
 	txOutput.Ripemd160Hash = hash160
+	if wallet.IsScriptHashAddress(address) {
+		txOutput.Script = script.PayToScriptHash(hash160)
+	}
 	return txOutput
 }
 
+// NewScriptOutput 创建由锁定脚本锁定的交易输出
+// P2PKH脚本只保存公钥哈希 与早期的输出格式相同 P2SH输出同时保存脚本哈希
+func NewScriptOutput(value int, lockingScript []byte) *TxOutput {
+	if hash := script.ExtractPubKeyHash(lockingScript); hash != nil {
+		return &TxOutput{Value: value, Ripemd160Hash: hash}
+	}
+	return &TxOutput{Value: value, Ripemd160Hash: script.ExtractScriptHash(lockingScript), Script: lockingScript}
+}
+
+// NewDataOutput 创建携带数据的不可花费输出 金额为0
+func NewDataOutput(data []byte) (*TxOutput, error) {
+	nullData, err := script.NullData(data)
+	if err != nil {
+		return nil, err
+	}
+	return &TxOutput{Script: nullData}, nil
+}
+
+// IsUnspendable 输出是否不可花费 不可花费的输出不放入UTXO集
+func (txOutput *TxOutput) IsUnspendable() bool {
+	return script.IsUnspendable(txOutput.Script)
+}
+
+// Data 数据输出携带的数据
+func (txOutput *TxOutput) Data() ([]byte, error) {
+	return script.ExtractNullData(txOutput.Script)
+}
+
+// LockingScript 输出的锁定脚本 没有脚本的输出使用公钥哈希的P2PKH模板
+func (txOutput *TxOutput) LockingScript() []byte {
+	if txOutput.Script != nil {
+		return txOutput.Script
+	}
+	return script.PayToPubKeyHash(txOutput.Ripemd160Hash)
+}
+
 // Serialize 交易输出序列化
 func (set *TxOutputs) Serialize() []byte {
 	var result bytes.Buffer
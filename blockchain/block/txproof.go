@@ -0,0 +1,222 @@
+package block
+
+import (
+	"blockchain/merkle"
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 交易包含证明
+// 区块头只以Merkle根代表区块中的交易 交易的Merkle证明由兄弟节点哈希和路径方向组成
+// 验证方持有一条区块头链即可确认交易被打包 以及之后的确认数 不必下载完整区块
+
+var (
+	ErrTxNotInChain     = errors.New("transaction is not in the chain")
+	ErrInvalidHeader    = errors.New("invalid block header")
+	ErrBrokenHeaders    = errors.New("block headers are not linked")
+	ErrInvalidTxProof   = errors.New("transaction proof does not match the block header")
+	ErrHeaderNotInChain = errors.New("block of the proof is not in the header chain")
+)
+
+// BlockHeader 区块头 交易由Merkle根代替
+type BlockHeader struct {
+	Height        int64
+	TimeStamp     int64
+	PrevBlockHash []byte
+	MerkleRoot    []byte
+	Nonce         int64
+	Hash          []byte
+}
+
+// Header 区块的区块头
+func (b *Block) Header() *BlockHeader {
+	return &BlockHeader{
+		Height:        b.Height,
+		TimeStamp:     b.TimeStamp,
+		PrevBlockHash: b.PrevBlockHash,
+		MerkleRoot:    b.HashTransaction(),
+		Nonce:         b.Nonce,
+		Hash:          b.Hash,
+	}
+}
+
+// Validate 区块哈希由区块头计算得出且满足难度要求
+func (h *BlockHeader) Validate() bool {
+	pow := NewProofOfWork(&Block{Height: h.Height, TimeStamp: h.TimeStamp, PrevBlockHash: h.PrevBlockHash, Hash: h.Hash, Nonce: h.Nonce})
+	return pow.validateHeader(h.MerkleRoot)
+}
+
+// IsGenesis 是否为创世区块的区块头
+func (h *BlockHeader) IsGenesis() bool {
+	return isBreakLoop(h.PrevBlockHash)
+}
+
+// VerifyHeaders 检查区块头链 每个区块头有效且引用前一个区块头 高度依次加一
+func VerifyHeaders(headers []*BlockHeader) error {
+	for i, header := range headers {
+		if !header.Validate() {
+			return fmt.Errorf("%w: block[%x] at height %d", ErrInvalidHeader, header.Hash, header.Height)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := headers[i-1]
+		if !bytes.Equal(header.PrevBlockHash, prev.Hash) || header.Height != prev.Height+1 {
+			return fmt.Errorf("%w: block[%x] does not follow block[%x]", ErrBrokenHeaders, header.Hash, prev.Hash)
+		}
+	}
+	return nil
+}
+
+// GetHeaders 主链上从创世区块到最新区块的区块头
+func (c *Chain) GetHeaders() []*BlockHeader {
+	var headers []*BlockHeader
+	it := c.NewIterator()
+	for {
+		b := it.Next()
+		headers = append(headers, b.Header())
+		if isBreakLoop(b.PrevBlockHash) {
+			break
+		}
+	}
+	for i, j := 0, len(headers)-1; i < j; i, j = i+1, j-1 {
+		headers[i], headers[j] = headers[j], headers[i]
+	}
+	return headers
+}
+
+// HeadersAfter 主链上定位哈希之后的最多max个区块头
+// locator从新到旧排列 使用其中第一个位于主链上的区块 都不在主链上时从创世区块开始
+// 乱序同步中区块数据不完整时返回空
+func (c *Chain) HeadersAfter(locator [][]byte, max int) []*BlockHeader {
+	if !c.IsComplete() {
+		return nil
+	}
+	headers := c.GetHeaders()
+	start := 0
+	for _, hash := range locator {
+		found := false
+		for i, header := range headers {
+			if bytes.Equal(header.Hash, hash) {
+				start, found = i+1, true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	headers = headers[start:]
+	if len(headers) > max {
+		headers = headers[:max]
+	}
+	return headers
+}
+
+// TxProof 交易被打包在区块中的证明
+type TxProof struct {
+	Header *BlockHeader
+	Proof  *merkle.Proof // 交易哈希为叶节点的Merkle证明
+}
+
+// NewTxProof 生成区块中第index笔交易的证明
+func NewTxProof(b *Block, index int) (*TxProof, error) {
+	proof, err := b.MerkleTree().Proof(index)
+	if err != nil {
+		return nil, err
+	}
+	return &TxProof{Header: b.Header(), Proof: proof}, nil
+}
+
+// GetTxProof 在主链中查找交易 生成其所在区块的包含证明
+func (c *Chain) GetTxProof(txHash []byte) (*TxProof, error) {
+	latest := c.GetLatestBlock()
+	if latest == nil {
+		return nil, ErrTxNotInChain
+	}
+	_, b, ok := c.findTxBlockFrom(latest, txHash)
+	if !ok {
+		return nil, ErrTxNotInChain
+	}
+	for index, tx := range b.Txs {
+		if bytes.Equal(tx.TxHash, txHash) {
+			return NewTxProof(b, index)
+		}
+	}
+	return nil, ErrTxNotInChain
+}
+
+// TxHash 证明的交易哈希
+func (p *TxProof) TxHash() []byte {
+	return p.Proof.Leaf
+}
+
+// Verify 检查区块头有效 且由Merkle证明算出的根哈希与区块头中的一致
+func (p *TxProof) Verify() error {
+	if p.Header == nil || p.Proof == nil {
+		return ErrInvalidTxProof
+	}
+	if !p.Header.Validate() {
+		return fmt.Errorf("%w: block[%x]", ErrInvalidHeader, p.Header.Hash)
+	}
+	if !p.Proof.Verify(p.Header.MerkleRoot) {
+		return ErrInvalidTxProof
+	}
+	return nil
+}
+
+// VerifyAgainst 检查证明 并确认其区块在已验证的区块头链headers中 返回交易的确认数
+func (p *TxProof) VerifyAgainst(headers []*BlockHeader) (int64, error) {
+	if err := p.Verify(); err != nil {
+		return 0, err
+	}
+	for _, header := range headers {
+		if bytes.Equal(header.Hash, p.Header.Hash) {
+			if !bytes.Equal(header.MerkleRoot, p.Header.MerkleRoot) {
+				return 0, ErrInvalidTxProof
+			}
+			return headers[len(headers)-1].Height - header.Height + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: block[%s]", ErrHeaderNotInChain, hex.EncodeToString(p.Header.Hash))
+}
+
+// Serialize 证明序列化
+func (p *TxProof) Serialize() []byte {
+	var result bytes.Buffer
+	if err := gob.NewEncoder(&result).Encode(p); err != nil {
+		log.Panicf("serialize the transaction proof failed: %v\n", err)
+	}
+	return result.Bytes()
+}
+
+// DecodeTxProof 证明反序列化 解析失败时返回错误
+func DecodeTxProof(data []byte) (*TxProof, error) {
+	var proof TxProof
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&proof); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+// SerializeHeaders 区块头链序列化
+func SerializeHeaders(headers []*BlockHeader) []byte {
+	var result bytes.Buffer
+	if err := gob.NewEncoder(&result).Encode(headers); err != nil {
+		log.Panicf("serialize the block headers failed: %v\n", err)
+	}
+	return result.Bytes()
+}
+
+// DecodeHeaders 区块头链反序列化 解析失败时返回错误
+func DecodeHeaders(data []byte) ([]*BlockHeader, error) {
+	var headers []*BlockHeader
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
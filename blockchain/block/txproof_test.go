@@ -0,0 +1,125 @@
+package block
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTxProof(t *testing.T) {
+	tc := newTestChain(t, 0)
+	first := tc.spend(tc.genesis.Txs[0], 0, 4, 6)
+	second := tc.spend(first, 1, 6)
+	b := tc.MineBlock([]*Transaction{first, second}, tc.address())
+	tc.MineBlock(nil, tc.address())
+	headers := tc.GetHeaders()
+	if err := VerifyHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tx := range b.Txs {
+		proof, err := tc.GetTxProof(tx.TxHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(proof.TxHash(), tx.TxHash) || !bytes.Equal(proof.Header.Hash, b.Hash) {
+			t.Fatalf("proof of transaction[%x] is for transaction[%x] in block[%x]", tx.TxHash, proof.TxHash(), proof.Header.Hash)
+		}
+		decoded, err := DecodeTxProof(proof.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if confirmations, err := decoded.VerifyAgainst(headers); confirmations != 2 || err != nil {
+			t.Fatalf("VerifyAgainst() = %d, %v, want 2 confirmations", confirmations, err)
+		}
+	}
+	if _, err := tc.GetTxProof([]byte("unknown transaction")); !errors.Is(err, ErrTxNotInChain) {
+		t.Fatalf("GetTxProof(unknown) = %v, want %v", err, ErrTxNotInChain)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(p *TxProof)
+		headers []*BlockHeader
+		err     error
+	}{
+		{"other transaction", func(p *TxProof) { p.Proof.Leaf = tc.genesis.Txs[0].TxHash }, headers, ErrInvalidTxProof},
+		{"other merkle root", func(p *TxProof) { p.Header.MerkleRoot = tc.genesis.Header().MerkleRoot }, headers, ErrInvalidHeader},
+		{"other time stamp", func(p *TxProof) { p.Header.TimeStamp++ }, headers, ErrInvalidHeader},
+		{"missing proof", func(p *TxProof) { p.Proof = nil }, headers, ErrInvalidTxProof},
+		{"block not in header chain", func(p *TxProof) {}, headers[:1], ErrHeaderNotInChain},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proof, err := tc.GetTxProof(second.TxHash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.tamper(proof)
+			if _, err := proof.VerifyAgainst(test.headers); !errors.Is(err, test.err) {
+				t.Fatalf("VerifyAgainst() = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestVerifyHeaders(t *testing.T) {
+	tc := newTestChain(t, 0)
+	for i := 0; i < 3; i++ {
+		tc.MineBlock(nil, tc.address())
+	}
+	headers, err := DecodeHeaders(SerializeHeaders(tc.GetHeaders()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 4 || !headers[0].IsGenesis() || headers[1].IsGenesis() {
+		t.Fatalf("%d headers, want 4 starting from the genesis block", len(headers))
+	}
+
+	tests := []struct {
+		name    string
+		headers []*BlockHeader
+		err     error
+	}{
+		{"valid", headers, nil},
+		{"from the middle", headers[2:], nil},
+		{"missing header", []*BlockHeader{headers[0], headers[2]}, ErrBrokenHeaders},
+		{"reversed", []*BlockHeader{headers[1], headers[0]}, ErrBrokenHeaders},
+		{"invalid proof of work", []*BlockHeader{headers[0], {Height: 1, PrevBlockHash: headers[0].Hash, MerkleRoot: headers[1].MerkleRoot, Hash: headers[1].Hash}}, ErrInvalidHeader},
+	}
+	for _, test := range tests {
+		if err := VerifyHeaders(test.headers); !errors.Is(err, test.err) {
+			t.Fatalf("%s: VerifyHeaders() = %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestHeadersAfter(t *testing.T) {
+	tc := newTestChain(t, 0)
+	for i := 0; i < 4; i++ {
+		tc.MineBlock(nil, tc.address())
+	}
+	headers := tc.GetHeaders()
+	tests := []struct {
+		name    string
+		locator [][]byte
+		max     int
+		first   int // 第一个区块头在headers中的位置 -1表示没有区块头
+		count   int
+	}{
+		{"no locator", nil, 10, 0, 5},
+		{"from the second block", [][]byte{headers[1].Hash}, 10, 2, 3},
+		{"first known hash", [][]byte{[]byte("unknown"), headers[3].Hash, headers[1].Hash}, 10, 4, 1},
+		{"up to date", [][]byte{headers[4].Hash}, 10, -1, 0},
+		{"limited", [][]byte{headers[0].Hash}, 2, 1, 2},
+	}
+	for _, test := range tests {
+		after := tc.HeadersAfter(test.locator, test.max)
+		if len(after) != test.count {
+			t.Fatalf("%s: %d headers, want %d", test.name, len(after), test.count)
+		}
+		if test.count > 0 && !bytes.Equal(after[0].Hash, headers[test.first].Hash) {
+			t.Fatalf("%s: first header at height %d, want %d", test.name, after[0].Height, headers[test.first].Height)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package block
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"github.com/boltdb/bolt"
@@ -17,13 +18,18 @@ import (
 // 2. 输出索引
 // 3. 交易输出
 
-const utxoTableName = "utxoTable" // UTXO表
+const (
+	utxoTableName = "utxoTable" // UTXO表
+	utxoTipKey    = "utxo"      // 区块表中保存UTXO集对应区块哈希的键
+)
 
 // UTXO 结构
 type UTXO struct {
-	TxHash []byte    // UTXO对应哈希
-	Index  int       // 所属交易输出列表中索引
-	Output *TxOutput // 交易输出
+	TxHash   []byte    // UTXO对应哈希
+	Index    int       // 所属交易输出列表中索引
+	Output   *TxOutput // 交易输出
+	Height   int64     // 所在区块高度 尚未打包时为0
+	Coinbase bool      // 是否为挖矿奖励
 }
 
 // UTXOSet UTXO集合结构
@@ -31,7 +37,7 @@ type UTXOSet struct {
 	Chain *Chain
 }
 
-// UpdateUTXOSet 更新UTXO集
+// UpdateUTXOSet 更新UTXO集 最新区块须连接在UTXO集对应的区块之后
 func (s *UTXOSet) UpdateUTXOSet() {
 	// 获取最新区块
 	latestBlock := s.Chain.NewIterator().Next()
@@ -42,37 +48,40 @@ func (s *UTXOSet) UpdateUTXOSet() {
 			for _, t := range latestBlock.Txs {
 				if !t.IsCoinbaseTransaction() {
 					for _, vin := range t.Vins {
-						updatedOutputs := TxOutputs{}
 						outputBytes := b.Get(vin.TxHash)
+						if outputBytes == nil {
+							continue
+						}
+						// 按输出位置删除被花费的输出
 						outs := DeserializeTxOutputs(outputBytes)
-						for outIdx, out := range outs.Set {
-							if vin.Vout != outIdx {
+						updatedOutputs := TxOutputs{Coinbase: outs.Coinbase, Height: outs.Height}
+						for i, out := range outs.Set {
+							if outs.Indexes[i] != vin.Vout {
 								updatedOutputs.Set = append(updatedOutputs.Set, out)
+								updatedOutputs.Indexes = append(updatedOutputs.Indexes, outs.Indexes[i])
 							}
 						}
-						if len(updatedOutputs.Set) == 0 {
-							err := b.Delete(vin.TxHash)
-							if err != nil {
-								log.Panicf("delete tx failed: %v\n", err)
-							}
-						} else {
-							// 将更新后的UTXO数据存入数据库
-							err := b.Put(vin.TxHash, updatedOutputs.Serialize())
-							if err != nil {
-								log.Panicf("put tx failed: %v\n", err)
-							}
+						// 输出全部花费后保留交易记录 用于判断输出已被花费
+						err := b.Put(vin.TxHash, updatedOutputs.Serialize())
+						if err != nil {
+							log.Panicf("put tx failed: %v\n", err)
 						}
 					}
 				}
-				newOutputs := TxOutputs{}
-				newOutputs.Set = append(newOutputs.Set, t.Vouts...)
+				newOutputs := TxOutputs{Coinbase: t.IsCoinbaseTransaction(), Height: latestBlock.Height}
+				for index, out := range t.Vouts {
+					if !out.IsUnspendable() {
+						newOutputs.Set = append(newOutputs.Set, out)
+						newOutputs.Indexes = append(newOutputs.Indexes, index)
+					}
+				}
 				err := b.Put(t.TxHash, newOutputs.Serialize())
 				if err != nil {
 					log.Panicf("put txhash failed: %v\n", err)
 				}
 			}
 		}
-		return nil
+		return putUTXOTip(tx, latestBlock.Hash)
 	})
 	if err != nil {
 		log.Panicf("update UTXOs failed: %v\n", err)
@@ -107,13 +116,62 @@ func (s *UTXOSet) ResetUTXOSet() {
 				}
 			}
 		}
-		return nil
+		return putUTXOTip(tx, s.Chain.Tip)
 	})
 	if err != nil {
 		log.Panicf("update database failed: %v\n", err)
 	}
 }
 
+// 保存UTXO集对应的区块哈希
+func putUTXOTip(tx *bolt.Tx, hash []byte) error {
+	b := tx.Bucket([]byte(blockTableName))
+	if b == nil {
+		return nil
+	}
+	return b.Put([]byte(utxoTipKey), hash)
+}
+
+// UTXO集对应的区块哈希
+func (c *Chain) utxoTip() []byte {
+	var tip []byte
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(blockTableName)); b != nil {
+			tip = append([]byte{}, b.Get([]byte(utxoTipKey))...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panicf("view database failed: %v\n", err)
+	}
+	return tip
+}
+
+// 交易的第index个输出是否在UTXO集中 交易不在UTXO集对应的主链上时found为false
+func (c *Chain) isUnspentOutput(txHash []byte, index int) (unspent, found bool) {
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoTableName))
+		if b == nil {
+			return nil
+		}
+		outputBytes := b.Get(txHash)
+		if outputBytes == nil {
+			return nil
+		}
+		found = true
+		for _, i := range DeserializeTxOutputs(outputBytes).Indexes {
+			if i == index {
+				unspent = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panicf("view database failed: %v\n", err)
+	}
+	return unspent, found
+}
+
 // FindUTXOWithAddress 查找该地址对应的UTXO
 func (s *UTXOSet) FindUTXOWithAddress(address string) []*UTXO {
 	var utxos []*UTXO
@@ -125,9 +183,9 @@ func (s *UTXOSet) FindUTXOWithAddress(address string) []*UTXO {
 			// 通过游标遍历bolt数据库中数据
 			for k, v := c.First(); k != nil; k, v = c.Next() {
 				txOutputs := DeserializeTxOutputs(v)
-				for _, utxo := range txOutputs.Set {
+				for i, utxo := range txOutputs.Set {
 					if utxo.UnLockScriptPubkeyWithAddress(address) {
-						singleUTXO := UTXO{Output: utxo}
+						singleUTXO := UTXO{TxHash: append([]byte{}, k...), Index: txOutputs.Indexes[i], Output: utxo, Height: txOutputs.Height, Coinbase: txOutputs.Coinbase}
 						utxos = append(utxos, &singleUTXO)
 					}
 				}
@@ -142,16 +200,58 @@ func (s *UTXOSet) FindUTXOWithAddress(address string) []*UTXO {
 	return utxos
 }
 
-// GetBalance 获取余额
+// GetBalance 获取余额 不含尚未成熟的挖矿奖励
 func (s *UTXOSet) GetBalance(address string) int {
+	amount, _ := s.GetBalances(address)
+	return amount
+}
+
+// GetBalances 获取可花费的余额和尚未成熟的挖矿奖励 按能否在下一个区块中花费区分
+func (s *UTXOSet) GetBalances(address string) (int, int) {
 	UTXOS := s.FindUTXOWithAddress(address)
-	var amount int
+	next := s.Chain.GetHeight() + 1
+	var amount, immature int
 	for _, utxo := range UTXOS {
-		fmt.Printf("utxo-txhash: %x\n", utxo.TxHash)
-		fmt.Printf("utxo-index: %x\n", utxo.Index)
-		fmt.Printf("utxo-Ripemd160Hash: %x\n", utxo.Output.Ripemd160Hash)
-		fmt.Printf("utxo-value: %x\n", utxo.Output.Value)
-		amount += utxo.Output.Value
+		if utxo.Coinbase && !s.Chain.IsMature(utxo.Height, next) {
+			immature += utxo.Output.Value
+		} else {
+			amount += utxo.Output.Value
+		}
 	}
-	return amount
+	return amount, immature
+}
+
+// Digest 计算UTXO集摘要 用于比较不同节点的UTXO集是否一致
+// 忽略输出已全部花费的交易记录
+func (s *UTXOSet) Digest() []byte {
+	hash := sha256.New()
+	err := s.Chain.DB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoTableName))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		// bolt按键有序遍历 结果与插入顺序无关
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			txOutputs := DeserializeTxOutputs(v)
+			if len(txOutputs.Set) == 0 {
+				continue
+			}
+			hash.Write(k)
+			if txOutputs.Coinbase {
+				fmt.Fprintf(hash, "coinbase:%d;", txOutputs.Height)
+			}
+			for _, out := range txOutputs.Set {
+				fmt.Fprintf(hash, "%d:%x;", out.Value, out.Ripemd160Hash)
+				if out.Script != nil {
+					fmt.Fprintf(hash, "script:%x;", out.Script)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panicf("digest the utxo table failed: %v\n", err)
+	}
+	return hash.Sum(nil)
 }
@@ -0,0 +1,356 @@
+package block
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"log"
+)
+
+// 区块验证 用于处理从其他节点接收到的区块
+
+var (
+	ErrNoTransactions = errors.New("block has no transactions")
+	ErrInvalidPoW     = errors.New("proof of work is invalid")
+	ErrMalformedTx    = errors.New("transaction is malformed")
+	ErrMutatedBlock   = errors.New("block has duplicate transactions in its merkle tree")
+	ErrBadHeight      = errors.New("block height does not follow its parent")
+	ErrBadCoinbase    = errors.New("coinbase pays more than the subsidy and fees")
+	ErrNoCoinbase     = errors.New("first transaction is not a coinbase transaction")
+	ErrCoinbaseInputs = errors.New("coinbase transaction has more than one input")
+	ErrMultiCoinbase  = errors.New("block has more than one coinbase transaction")
+	ErrInvalidValue   = errors.New("output value is not positive")
+	ErrSpentOutput    = errors.New("output is already spent")
+	ErrValueOverspent = errors.New("outputs exceed inputs")
+)
+
+// TxError 区块中存在无效交易
+type TxError struct {
+	TxHash []byte
+	Err    error
+}
+
+func (e *TxError) Error() string {
+	return fmt.Sprintf("invalid transaction[%x]: %v", e.TxHash, e.Err)
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
+}
+
+// HasBlock 判断数据库中是否存在指定区块
+func (c *Chain) HasBlock(hash []byte) bool {
+	return len(hash) != 0 && c.GetBlock(hash) != nil
+}
+
+// IsComplete 判断从最新区块到创世区块的数据是否完整
+func (c *Chain) IsComplete() bool {
+	complete := false
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockTableName))
+		if bucket == nil {
+			return nil
+		}
+		hash := c.Tip
+		for {
+			blockBytes := bucket.Get(hash)
+			if blockBytes == nil {
+				return nil
+			}
+			current := DeserializeBlock(blockBytes)
+			if isBreakLoop(current.PrevBlockHash) {
+				complete = true
+				return nil
+			}
+			hash = current.PrevBlockHash
+		}
+	})
+	if err != nil {
+		log.Panicf("view database failed: %v", err)
+	}
+	return complete
+}
+
+// ValidateBlock 验证区块
+// 检查区块结构与工作量证明 若父区块已存在 再验证高度和交易
+// 父区块未知时(乱序同步)只做上下文无关的检查 调用方须在父区块连接后再次验证
+func (c *Chain) ValidateBlock(b *Block) error {
+	if len(b.Txs) == 0 {
+		return ErrNoTransactions
+	}
+	for i, tx := range b.Txs {
+		if tx == nil || len(tx.TxHash) == 0 || len(tx.Vins) == 0 || len(tx.Vouts) == 0 {
+			return ErrMalformedTx
+		}
+		for _, vin := range tx.Vins {
+			if vin == nil {
+				return &TxError{tx.TxHash, ErrMalformedTx}
+			}
+		}
+		for _, vout := range tx.Vouts {
+			if vout == nil {
+				return &TxError{tx.TxHash, ErrMalformedTx}
+			}
+		}
+		if i == 0 {
+			if err := checkCoinbase(tx); err != nil {
+				return err
+			}
+		} else if hasCoinbaseInput(tx) {
+			return &TxError{tx.TxHash, ErrMultiCoinbase}
+		}
+		if err := tx.CheckValues(); err != nil {
+			return &TxError{tx.TxHash, err}
+		}
+	}
+	// 复制末尾交易的区块与原区块的Merkle根和区块哈希相同 工作量证明无法发现
+	if b.MerkleTree().Mutated {
+		return ErrMutatedBlock
+	}
+	if !NewProofOfWork(b).Validate() {
+		return ErrInvalidPoW
+	}
+	if !c.HasBlock(b.PrevBlockHash) {
+		return nil
+	}
+	parent := DeserializeBlock(c.GetBlock(b.PrevBlockHash))
+	if b.Height != parent.Height+1 {
+		return fmt.Errorf("%w: %d after %d", ErrBadHeight, b.Height, parent.Height)
+	}
+	return c.validateTxs(b)
+}
+
+// CheckValues 检查输出金额 可花费的输出金额须为正 数据输出不能为负
+func (tx *Transaction) CheckValues() error {
+	for id, vout := range tx.Vouts {
+		if vout.Value < 0 || vout.Value == 0 && !vout.IsUnspendable() {
+			return fmt.Errorf("output %d: %w", id, ErrInvalidValue)
+		}
+	}
+	return nil
+}
+
+// 区块的第一笔交易须是只有一个输入的coinbase交易
+func checkCoinbase(tx *Transaction) error {
+	if !tx.IsCoinbaseTransaction() {
+		return ErrNoCoinbase
+	}
+	if len(tx.Vins) != 1 {
+		return fmt.Errorf("%w: %d inputs", ErrCoinbaseInputs, len(tx.Vins))
+	}
+	return nil
+}
+
+// 交易是否包含coinbase形式的输入 只有区块的第一笔交易可以包含
+func hasCoinbaseInput(tx *Transaction) bool {
+	for _, vin := range tx.Vins {
+		if vin.Vout == -1 && len(vin.TxHash) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// 在父区块所在的分支上验证区块中的交易
+// 输入须引用之前区块或本区块中排在前面的交易的输出 且输出在该分支上未被花费
+// 输入金额不少于输出金额 第一笔coinbase交易的金额不超过挖矿奖励与手续费之和
+// 主链上输出的花费情况由UTXO集判断 分叉上的区块只需遍历分叉点之后的区块
+func (c *Chain) validateTxs(b *Block) error {
+	view := c.branchViewBefore(b)
+	fees := 0
+	for i, tx := range b.Txs {
+		if i == 0 {
+			view.connect(tx)
+			continue
+		}
+		// 只包含排在当前交易之前的交易 不能引用之后的交易
+		before := &Block{PrevBlockHash: b.PrevBlockHash, Txs: b.Txs[:i]}
+		prevTxs := make(map[string]Transaction)
+		for id, vin := range tx.Vins {
+			prevTx, ok := c.findTransactionFrom(before, vin.TxHash)
+			if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vouts) {
+				return &TxError{tx.TxHash, fmt.Errorf("input %d: %w", id, ErrPrevTxNotFound)}
+			}
+			if view.isSpent(vin.TxHash, vin.Vout) {
+				return &TxError{tx.TxHash, fmt.Errorf("input %d: %w", id, ErrSpentOutput)}
+			}
+			view.spent[outPointKey(vin.TxHash, vin.Vout)] = true
+			prevTxs[hex.EncodeToString(prevTx.TxHash)] = *prevTx
+		}
+		if !tx.Verify(prevTxs, b.Height) {
+			return &TxError{tx.TxHash, errors.New("signature verification failed")}
+		}
+		if err := c.CheckLocks(tx, b); err != nil {
+			return &TxError{tx.TxHash, err}
+		}
+		fee, err := tx.Fee(prevTxs)
+		if err != nil {
+			return &TxError{tx.TxHash, err}
+		}
+		if fee < 0 {
+			return &TxError{tx.TxHash, fmt.Errorf("%w by %d", ErrValueOverspent, -fee)}
+		}
+		fees += fee
+		view.connect(tx)
+	}
+	value := 0
+	for _, vout := range b.Txs[0].Vouts {
+		value += vout.Value
+	}
+	if value > BlockSubsidy+fees {
+		return fmt.Errorf("%w: %d > %d + %d", ErrBadCoinbase, value, BlockSubsidy, fees)
+	}
+	return nil
+}
+
+// CheckInputsUnspent 检查交易的输入在主链上没有被花费 用于接受交易池中的交易
+// 引用交易池中交易的输入不在链上 由交易池检查冲突
+func (c *Chain) CheckInputsUnspent(tx *Transaction) error {
+	view := c.branchViewBefore(c.NextBlock())
+	for id, vin := range tx.Vins {
+		if view.isSpent(vin.TxHash, vin.Vout) {
+			return fmt.Errorf("input %d: %w", id, ErrSpentOutput)
+		}
+	}
+	return nil
+}
+
+// 输出位置的键
+func outPointKey(txHash []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txHash, index)
+}
+
+// 区块所在分支上输出的花费情况
+// UTXO集对应主链上的一个区块 只遍历分叉点之后两侧的区块 区块连接在该区块之后时不遍历
+type branchView struct {
+	chain    *Chain
+	utxo     bool            // UTXO集对应的区块是否已知 未知时遍历整个分支
+	spent    map[string]bool // 分叉点之后在分支上花费的输出
+	created  map[string]bool // 分叉点之后在分支上创建的输出 不在UTXO集中
+	restored map[string]bool // 分叉点之后只在UTXO集一侧花费的输出 在分支上仍未花费
+}
+
+// 区块b之前(从父区块到创世区块)的分支相对UTXO集的差异
+// 从父区块和UTXO集对应的区块分别向前走到分叉点 区块数据不完整时只使用已遍历的区块
+func (c *Chain) branchViewBefore(b *Block) *branchView {
+	view := &branchView{chain: c, spent: make(map[string]bool), created: make(map[string]bool), restored: make(map[string]bool)}
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockTableName))
+		if bucket == nil {
+			return nil
+		}
+		get := func(hash []byte) *Block {
+			if isBreakLoop(hash) {
+				return nil
+			}
+			blockBytes := bucket.Get(hash)
+			if blockBytes == nil {
+				return nil
+			}
+			return DeserializeBlock(blockBytes)
+		}
+		branch, main := get(b.PrevBlockHash), get(bucket.Get([]byte(utxoTipKey)))
+		view.utxo = main != nil
+		for branch != nil && (main == nil || !bytes.Equal(branch.Hash, main.Hash)) {
+			if main == nil || branch.Height >= main.Height {
+				for _, t := range branch.Txs {
+					view.connect(t)
+				}
+				branch = get(branch.PrevBlockHash)
+				continue
+			}
+			for _, t := range main.Txs {
+				if !t.IsCoinbaseTransaction() {
+					for _, vin := range t.Vins {
+						view.restored[outPointKey(vin.TxHash, vin.Vout)] = true
+					}
+				}
+			}
+			main = get(main.PrevBlockHash)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panicf("view database failed: %v", err)
+	}
+	return view
+}
+
+// 在分支上记录交易花费的输入和创建的输出
+func (v *branchView) connect(tx *Transaction) {
+	if !tx.IsCoinbaseTransaction() {
+		for _, vin := range tx.Vins {
+			v.spent[outPointKey(vin.TxHash, vin.Vout)] = true
+		}
+	}
+	for index := range tx.Vouts {
+		v.created[outPointKey(tx.TxHash, index)] = true
+	}
+}
+
+// 输出是否已在分支上花费 不在分支上的交易的输出视为未花费
+func (v *branchView) isSpent(txHash []byte, index int) bool {
+	key := outPointKey(txHash, index)
+	if v.spent[key] {
+		return true
+	}
+	if v.created[key] || v.restored[key] || !v.utxo {
+		return false
+	}
+	unspent, found := v.chain.isUnspentOutput(txHash, index)
+	return found && !unspent
+}
+
+// LookupTransaction 从最新区块开始查找交易 区块数据不完整时不会失败
+func (c *Chain) LookupTransaction(id []byte) (*Transaction, bool) {
+	latest := c.GetLatestBlock()
+	if latest == nil {
+		return nil, false
+	}
+	return c.findTransactionFrom(latest, id)
+}
+
+// 从指定区块开始向前查找交易 遇到缺失的区块时停止
+func (c *Chain) findTransactionFrom(b *Block, id []byte) (*Transaction, bool) {
+	tx, _, ok := c.findTxBlockFrom(b, id)
+	return tx, ok
+}
+
+// 从指定区块开始向前查找交易及其所在区块
+func (c *Chain) findTxBlockFrom(b *Block, id []byte) (*Transaction, *Block, bool) {
+	for _, tx := range b.Txs {
+		if bytes.Equal(tx.TxHash, id) {
+			return tx, b, true
+		}
+	}
+	var found *Transaction
+	var foundBlock *Block
+	err := c.DB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(blockTableName))
+		if bucket == nil {
+			return nil
+		}
+		hash := b.PrevBlockHash
+		for !isBreakLoop(hash) {
+			blockBytes := bucket.Get(hash)
+			if blockBytes == nil {
+				return nil
+			}
+			current := DeserializeBlock(blockBytes)
+			for _, t := range current.Txs {
+				if bytes.Equal(t.TxHash, id) {
+					found, foundBlock = t, current
+					return nil
+				}
+			}
+			hash = current.PrevBlockHash
+		}
+		return nil
+	})
+	if err != nil {
+		log.Panicf("view database failed: %v", err)
+	}
+	return found, foundBlock, found != nil
+}
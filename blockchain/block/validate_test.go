@@ -0,0 +1,223 @@
+package block
+
+import (
+	"blockchain/wallet"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// 测试用区块链 创世区块的挖矿奖励属于owner
+type testChain struct {
+	*Chain
+	owner   *wallet.Wallet
+	genesis *Block
+}
+
+// 区块链数据库创建在临时目录中
+func newTestChain(t *testing.T, maturity int64) *testChain {
+	t.Helper()
+	owner := wallet.NewWallet()
+	genesis := CreateGenesisBlock([]*Transaction{NewCoinbaseTransaction(string(owner.GetAddress()))})
+	chain, err := NewChainWithGenesis(filepath.Join(t.TempDir(), "block.db"), genesis, maturity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.DB.Close() })
+	return &testChain{Chain: chain, owner: owner, genesis: genesis}
+}
+
+func (tc *testChain) address() string {
+	return string(tc.owner.GetAddress())
+}
+
+// 由owner签名 花费prev的第index个输出 每个金额生成一个属于owner的输出
+func (tc *testChain) spend(prev *Transaction, index int, values ...int) *Transaction {
+	tx := &Transaction{
+		Vins:    []*TxInput{{TxHash: prev.TxHash, Vout: index, PublicKey: tc.owner.PublicKey}},
+		Version: TxVersion,
+	}
+	for _, value := range values {
+		tx.Vouts = append(tx.Vouts, NewTxOutput(value, tc.address()))
+	}
+	tx.HashTransaction()
+	prevTxs := map[string]Transaction{hex.EncodeToString(prev.TxHash): *prev}
+	tx.SignInputs([]ecdsa.PrivateKey{tc.owner.PrivateKey}, prevTxs)
+	return tx
+}
+
+// 在parent之后打包交易 开头加上owner的coinbase交易
+func (tc *testChain) block(parent *Block, txs ...*Transaction) *Block {
+	txs = append([]*Transaction{NewCoinbaseTransaction(tc.address())}, txs...)
+	return NewBlock(parent.Height+1, parent.Hash, txs)
+}
+
+// 金额为value的coinbase交易
+func coinbaseWithValue(address string, value int) *Transaction {
+	tx := NewCoinbaseTransaction(address)
+	tx.Vouts[0].Value = value
+	tx.HashTransaction()
+	return tx
+}
+
+func TestValidateBlock(t *testing.T) {
+	tc := newTestChain(t, 0)
+	coinbase := tc.genesis.Txs[0]
+	unknown := tc.spend(coinbase, 0, BlockSubsidy)
+	unknown.TxHash = []byte("unknown transaction")
+
+	tests := []struct {
+		name  string
+		block func() *Block
+		err   error
+		txErr bool
+	}{
+		{"valid", func() *Block {
+			return tc.block(tc.genesis, tc.spend(coinbase, 0, 4, 5))
+		}, nil, false},
+		{"coinbase collects fees", func() *Block {
+			tx := tc.spend(coinbase, 0, 7)
+			return NewBlock(2, tc.genesis.Hash, []*Transaction{coinbaseWithValue(tc.address(), BlockSubsidy+3), tx})
+		}, nil, false},
+		{"unknown input", func() *Block {
+			return tc.block(tc.genesis, tc.spend(unknown, 0, 1))
+		}, ErrPrevTxNotFound, true},
+		{"outputs exceed inputs", func() *Block {
+			return tc.block(tc.genesis, tc.spend(coinbase, 0, BlockSubsidy+1))
+		}, ErrValueOverspent, true},
+		{"zero output", func() *Block {
+			return tc.block(tc.genesis, tc.spend(coinbase, 0, 0))
+		}, ErrInvalidValue, true},
+		{"negative output balances a larger one", func() *Block {
+			return tc.block(tc.genesis, tc.spend(coinbase, 0, BlockSubsidy+5, -5))
+		}, ErrInvalidValue, true},
+		{"in-block double spend", func() *Block {
+			return tc.block(tc.genesis, tc.spend(coinbase, 0, 5), tc.spend(coinbase, 0, 6))
+		}, ErrSpentOutput, true},
+		{"spends a later transaction", func() *Block {
+			first := tc.spend(coinbase, 0, BlockSubsidy)
+			second := tc.spend(first, 0, BlockSubsidy)
+			return tc.block(tc.genesis, second, first)
+		}, ErrPrevTxNotFound, true},
+		{"spends an earlier transaction", func() *Block {
+			first := tc.spend(coinbase, 0, BlockSubsidy)
+			return tc.block(tc.genesis, first, tc.spend(first, 0, BlockSubsidy))
+		}, nil, false},
+		{"coinbase exceeds subsidy and fees", func() *Block {
+			tx := tc.spend(coinbase, 0, 7)
+			return NewBlock(2, tc.genesis.Hash, []*Transaction{coinbaseWithValue(tc.address(), BlockSubsidy+4), tx})
+		}, ErrBadCoinbase, false},
+		{"two coinbases", func() *Block {
+			return NewBlock(2, tc.genesis.Hash, []*Transaction{NewCoinbaseTransaction(tc.address()), NewCoinbaseTransaction(tc.address())})
+		}, ErrMultiCoinbase, true},
+		{"coinbase in the middle", func() *Block {
+			return tc.block(tc.genesis, tc.spend(coinbase, 0, 5), NewCoinbaseTransaction(tc.address()), tc.spend(coinbase, 0, 6))
+		}, ErrMultiCoinbase, true},
+		{"coinbase not first", func() *Block {
+			return NewBlock(2, tc.genesis.Hash, []*Transaction{tc.spend(coinbase, 0, 5), NewCoinbaseTransaction(tc.address())})
+		}, ErrNoCoinbase, false},
+		{"coinbase with extra inputs", func() *Block {
+			tx := NewCoinbaseTransaction(tc.address())
+			tx.Vins = append(tx.Vins, &TxInput{TxHash: coinbase.TxHash, Vout: 0, PublicKey: tc.owner.PublicKey})
+			tx.HashTransaction()
+			return NewBlock(2, tc.genesis.Hash, []*Transaction{tx})
+		}, ErrCoinbaseInputs, false},
+		{"coinbase-shaped input", func() *Block {
+			tx := tc.spend(coinbase, 0, 5)
+			tx.Vins = append(tx.Vins, &TxInput{TxHash: []byte{}, Vout: -1})
+			tx.HashTransaction()
+			return tc.block(tc.genesis, tx)
+		}, ErrMultiCoinbase, true},
+		{"height skips the parent", func() *Block {
+			return NewBlock(3, tc.genesis.Hash, []*Transaction{NewCoinbaseTransaction(tc.address())})
+		}, ErrBadHeight, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := tc.ValidateBlock(test.block())
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ValidateBlock() = %v, want %v", err, test.err)
+			}
+			var txErr *TxError
+			if errors.As(err, &txErr) != test.txErr {
+				t.Fatalf("ValidateBlock() = %v, transaction error %v", err, test.txErr)
+			}
+		})
+	}
+}
+
+// 验证区块后添加到区块链 updateUTXO时同时更新UTXO集
+func (tc *testChain) connect(t *testing.T, b *Block, updateUTXO bool) {
+	t.Helper()
+	if err := tc.ValidateBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	tc.AddBlock(b)
+	if updateUTXO {
+		utxoSet := UTXOSet{Chain: tc.Chain}
+		utxoSet.UpdateUTXOSet()
+	}
+}
+
+// 输出在区块所在的分支上已花费时拒绝 在另一分支上花费不影响
+// UTXO集对应的区块落后于父区块或位于另一分支时 遍历分叉点之后的区块
+func TestValidateBlockSpentOutput(t *testing.T) {
+	for _, updateUTXO := range []bool{false, true} {
+		tc := newTestChain(t, 0)
+		coinbase := tc.genesis.Txs[0]
+		first := tc.spend(coinbase, 0, 5, BlockSubsidy-5)
+		main := tc.block(tc.genesis, first)
+		tc.connect(t, main, updateUTXO)
+		if err := tc.CheckInputsUnspent(tc.spend(coinbase, 0, 1)); !errors.Is(err, ErrSpentOutput) {
+			t.Fatalf("utxo %v: mempool spend of a spent output: %v, want %v", updateUTXO, err, ErrSpentOutput)
+		}
+		if err := tc.CheckInputsUnspent(tc.spend(first, 1, 1)); err != nil {
+			t.Fatalf("utxo %v: mempool spend of an unspent output: %v", updateUTXO, err)
+		}
+
+		tests := []struct {
+			name   string
+			parent *Block
+			tx     *Transaction
+			err    error
+		}{
+			{"spend again on the same branch", main, tc.spend(coinbase, 0, BlockSubsidy), ErrSpentOutput},
+			{"spend a main chain output", main, tc.spend(first, 0, 5), nil},
+			{"spend on a fork", tc.genesis, tc.spend(coinbase, 0, BlockSubsidy), nil},
+		}
+		for _, test := range tests {
+			if err := tc.ValidateBlock(tc.block(test.parent, test.tx)); !errors.Is(err, test.err) {
+				t.Fatalf("utxo %v: %s: %v, want %v", updateUTXO, test.name, err, test.err)
+			}
+		}
+
+		// 分叉上花费的输出在分叉上不能再次花费 分叉上创建的输出可以花费
+		forkTx := tc.spend(coinbase, 0, BlockSubsidy)
+		fork := tc.block(tc.genesis, forkTx)
+		tc.connect(t, fork, false)
+		if err := tc.ValidateBlock(tc.block(fork, tc.spend(coinbase, 0, BlockSubsidy))); !errors.Is(err, ErrSpentOutput) {
+			t.Fatalf("utxo %v: spend again on the fork: %v, want %v", updateUTXO, err, ErrSpentOutput)
+		}
+		if err := tc.ValidateBlock(tc.block(fork, tc.spend(forkTx, 0, BlockSubsidy))); err != nil {
+			t.Fatalf("utxo %v: spend a fork output on the fork: %v", updateUTXO, err)
+		}
+		if err := tc.ValidateBlock(tc.block(fork, tc.spend(first, 0, 5))); !errors.Is(err, ErrPrevTxNotFound) {
+			t.Fatalf("utxo %v: spend a main chain output on the fork: %v, want %v", updateUTXO, err, ErrPrevTxNotFound)
+		}
+	}
+}
+
+// 父区块未知时只做上下文无关的检查
+func TestValidateOrphanBlock(t *testing.T) {
+	tc := newTestChain(t, 0)
+	orphan := NewBlock(5, []byte("unknown parent"), []*Transaction{coinbaseWithValue(tc.address(), 1000)})
+	if err := tc.ValidateBlock(orphan); err != nil {
+		t.Fatalf("orphan block: %v", err)
+	}
+	orphan.Txs[0].Vouts[0].Value = -1
+	if err := tc.ValidateBlock(orphan); !errors.Is(err, ErrInvalidValue) {
+		t.Fatalf("orphan block with a negative output: %v, want %v", err, ErrInvalidValue)
+	}
+}
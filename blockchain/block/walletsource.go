@@ -0,0 +1,59 @@
+package block
+
+import (
+	"blockchain/wallet"
+	"bytes"
+)
+
+// 由钱包跟踪的输出构造交易
+// 轻节点没有UTXO表 钱包记录的已确认且未花费的输出即可作为交易输入
+
+// WalletSource 以钱包交易记录为数据来源的交易构造器输入
+type WalletSource struct {
+	Wallets  *wallet.Wallets
+	Maturity int64 // 挖矿奖励可以花费前需要的确认数
+}
+
+// SelectCoins 从地址列表from已确认的未花费输出中选择支付amount的输入
+// 尚未确认的交易(包括txs)的输出不能花费 只观察地址不能签名 同样跳过
+func (src *WalletSource) SelectCoins(from []string, amount int, outputs int, txs []*Transaction, opts *SendOptions) (*CoinSelection, error) {
+	senders := make(map[string]bool)
+	for _, address := range from {
+		senders[address] = true
+	}
+	_, scanned := src.Wallets.SyncedTip()
+	var utxos, mature []*UTXO
+	for _, out := range src.Wallets.Outputs() {
+		if out.SpentBy != nil || out.Height == 0 || !senders[out.Address] || src.Wallets.IsWatchOnly(out.Address) {
+			continue
+		}
+		utxo := &UTXO{
+			TxHash:   out.TxHash,
+			Index:    out.Index,
+			Output:   NewTxOutput(out.Value, out.Address),
+			Height:   out.Height,
+			Coinbase: out.Coinbase,
+		}
+		utxos = append(utxos, utxo)
+		// 交易将被打包进下一个区块
+		if !out.Coinbase || scanned+1-out.Height >= src.Maturity {
+			mature = append(mature, utxo)
+		}
+	}
+	return SelectUTXOs(mature, utxos, amount, outputs, opts)
+}
+
+// LookupTransaction 由钱包记录还原交易 只包含钱包地址的输出 其他输出为nil 只用于签名
+func (src *WalletSource) LookupTransaction(txHash []byte) (*Transaction, bool) {
+	tx := &Transaction{TxHash: txHash}
+	for _, out := range src.Wallets.Outputs() {
+		if !bytes.Equal(out.TxHash, txHash) {
+			continue
+		}
+		for len(tx.Vouts) <= out.Index {
+			tx.Vouts = append(tx.Vouts, nil)
+		}
+		tx.Vouts[out.Index] = NewTxOutput(out.Value, out.Address)
+	}
+	return tx, len(tx.Vouts) > 0
+}
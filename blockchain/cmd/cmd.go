@@ -2,11 +2,20 @@ package cmd
 
 import (
 	"blockchain/block"
+	"blockchain/node"
+	"blockchain/script"
 	"blockchain/utils"
+	"blockchain/wallet"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 const message = " ____  _            _     ____ _           _       \n| __ )| | ___   ___| | __/ ___| |__   __ _(_)_ __  \n|  _ \\| |/ _ \\ / __| |/ / |   | '_ \\ / _` | | '_ \\ \n| |_) | | (_) | (__|   <| |___| | | | (_| | | | | |\n|____/|_|\\___/ \\___|_|\\_\\\\____|_| |_|\\__,_|_|_| |_|\n                                                   \n"
@@ -26,19 +35,82 @@ func IsValidArgs() {
 
 func PrintUsage() {
 	fmt.Println("Usage: ")
-	fmt.Println("\tcreatewallet -- create wallet")
+	fmt.Println("\tcreatewallet [-mnemonic [-words N]] -- create wallet")
+	fmt.Println("\t\t-mnemonic -- create a deterministic wallet from a new mnemonic seed")
+	fmt.Println("\t\t-words N -- number of mnemonic words: 12, 15, 18, 21 or 24 (default 12)")
+	fmt.Println("\tnewaddress [-account N] [-change] -- derive the next address of a deterministic wallet")
+	fmt.Println("\trestorewallet -mnemonic WORDS [-gap N] -- restore a deterministic wallet and rescan used addresses")
+	// 私钥导入导出
+	fmt.Println("\tdumpprivkey -address ADDRESS -- print the private key of an address")
+	fmt.Println("\timportprivkey -key KEY [-rescan=false] -- import a private key printed by dumpprivkey")
+	fmt.Println("\timportaddress -address ADDRESS [-rescan=false] -- watch an address without its private key")
+	fmt.Println("\trescan -- rebuild the outputs of the wallet addresses from the blockchain")
+	// 多重签名
+	fmt.Println("\tgetpubkey -address ADDRESS -- print the public key of an address to share with co-signers")
+	fmt.Println("\tcreatemultisig -m M -keys KEY,KEY,... -- add an M-of-N multisig script hash address to the wallet")
+	fmt.Println("\t\tKEY -- a hex public key or an address of this wallet, the order of the keys changes the address")
+	// 哈希时间锁合约
+	fmt.Println("\tinithtlc -from ADDRESS -to ADDRESS -amount N [-secrethash HASH] [-locktime N | -timeout DURATION] [-feerate N] -- lock coins in a hash time-locked contract")
+	fmt.Println("\t\t-secrethash -- the sha256 of the secret, a new secret is generated when omitted (initiator of a swap)")
+	fmt.Println("\t\t-timeout -- the refund is possible after this duration when no -locktime is given (default 48h, use a shorter one as participant)")
+	fmt.Println("\tredeemhtlc -contract HEX -tx TXID -secret HEX [-to ADDRESS] [-feerate N] -- redeem a contract as the recipient, revealing the secret")
+	fmt.Println("\trefundhtlc -contract HEX -tx TXID [-to ADDRESS] [-feerate N] -- refund a contract after its lock time")
+	fmt.Println("\taudithtlc -contract HEX -tx TXID -- print the terms, the funds and the state of a contract")
+	fmt.Println("\textractsecret -tx TXID -secrethash HASH -- extract the secret from the transaction redeeming a contract")
+	// 数据锚定
+	fmt.Println("\tanchor -from ADDRESS (-data HEX | -file PATH) [-feerate N] -- embed data or the sha256 of a file in an unspendable output")
+	fmt.Println("\tverifyanchor (-data HEX | -file PATH) -- prove the block and the time anchoring the data with a merkle proof")
+	// 交易包含证明
+	fmt.Println("\tgettxproof -txid TXID [-out FILE] -- create a merkle proof that the transaction is in a block of the chain")
+	fmt.Println("\tgetheaders [-out FILE] -- export the block headers of the chain")
+	fmt.Println("\tverifytxproof -proof FILE|HEX -headers FILE|HEX -- verify a transaction proof against a header chain, no blockchain needed")
+	// 钱包加密
+	fmt.Println("\tencryptwallet [-passphrase PASSPHRASE] -- encrypt the private keys of the wallet")
+	fmt.Println("\twalletpassphrase [-passphrase PASSPHRASE] [-timeout TIMEOUT] -- unlock the wallet in memory for signing (default 60s)")
+	fmt.Println("\twalletlock -- lock the wallet")
+	fmt.Println("\tchangepassphrase [-old OLD] [-new NEW] -- change the wallet passphrase")
+	fmt.Println("\t\tpassphrases not given as arguments are read from stdin")
+	fmt.Println("\t\tthe unlocked key is only kept in the memory of this process, commands that sign with a locked wallet ask for the passphrase")
+	fmt.Println("\t\tcommands using the private keys of an encrypted wallet read the passphrase from stdin each time")
 	fmt.Println("\taccounts -- list accounts")
 	// 创建区块链
-	fmt.Println("\tcreatechain -address address -- create blockchain")
+	fmt.Println("\tcreatechain -address address [-maturity N] -- create blockchain")
+	fmt.Printf("\t\t-maturity -- confirmations before a mining reward can be spent (default %d, 0 lets mining rewards be spent immediately)\n", block.DefaultMaturity)
 	// 添加区块
 	fmt.Println("\taddblock -data data -- add a block")
+	// 挖出区块
+	fmt.Println("\tgenerate -address ADDRESS [-blocks N] -- mine N blocks rewarding the address, e.g. until mining rewards mature (default 1)")
 	// 打印区块链完整信息
 	fmt.Println("\tprintchain -- print blockchain")
 	// 获取余额信息
 	fmt.Println("\tgetbalance -address address -- get balance of address")
+	fmt.Println("\tgetwalletbalance [-light] -- get confirmed, unconfirmed and immature balance of the wallet")
+	fmt.Println("\t\t-light -- use the outputs synced by the light node instead of the blockchain")
+	fmt.Println("\tlisttransactions [-count N] -- list the latest transactions of the wallet (default 10, 0 for all)")
+	fmt.Println("\tsetlabel -address ADDRESS [-label LABEL] -- set the label of an address, an empty label removes it")
 
 	// 通过命令行转账
-	fmt.Println("\tsend -from FROM -to TO -amount AMOUNT -- Initiate a transfer")
+	fmt.Println("\tsend -from FROM -to TO -amount AMOUNT [-strategy NAME] [-feerate N] [-dust N] [-inputs TXID:VOUT,...] [-locktime N] [-relative N[s]] -- Initiate a transfer")
+	fmt.Printf("\t\t-strategy -- coin selection strategy: %s (default auto)\n", strings.Join(block.CoinSelectorNames(), ", "))
+	fmt.Println("\t\t-feerate -- fee per 1000 bytes of the transaction (default the rate estimated for confirmation within 6 blocks, 0 without an estimate)")
+	fmt.Println("\t\t-dust -- change below this amount is added to the fee (default derived from the fee rate)")
+	fmt.Println("\t\t-inputs -- spend exactly these outputs, only with a single sender")
+	fmt.Println("\t\t-locktime -- the transaction is valid from this block height, or unix time if not below 500000000")
+	fmt.Println("\t\t-relative -- the inputs must be confirmed for this many blocks, or seconds with an s suffix (rounded up to 512s)")
+	// 离线签名
+	fmt.Println("\tcreaterawtx -from ADDRESS[,ADDRESS...] -outputs '{\"ADDRESS\":AMOUNT,...}' [-change ADDRESS] [-strategy NAME] [-feerate N] [-dust N] [-inputs TXID:VOUT,...] [-locktime N] [-relative N[s]] [-rbf] [-out FILE] -- create an unsigned transaction, the senders may be watch-only")
+	fmt.Println("\tsignrawtx -tx FILE|HEX [-out FILE] -- sign the inputs owned by the wallet, no blockchain needed")
+	fmt.Println("\tfinalizerawtx -tx FILE|HEX [-out FILE] -- check the signatures and print the final transaction")
+	fmt.Println("\tbroadcastrawtx -tx FILE|HEX [-miner ADDRESS] -- verify the transaction and mine it into a new block")
+	fmt.Println("\tsendmany -from ADDRESS[,ADDRESS...] -outputs '{\"ADDRESS\":AMOUNT,...}' [-change ADDRESS] [-strategy NAME] [-feerate N] [-dust N] [-inputs TXID:VOUT,...] [-locktime N] [-relative N[s]] [-rbf] -- pay several recipients in one transaction")
+	fmt.Println("\t\t-rbf -- the transaction may be replaced by one paying a higher fee until it is mined")
+	// 提高手续费
+	fmt.Println("\tbumpfee -txid TXID [-feerate N] -- replace an unconfirmed wallet transaction signalling -rbf with one paying a higher fee from its change")
+	fmt.Println("\t\t-feerate -- fee per 1000 bytes of the replacement (default the lowest rate accepted for a replacement)")
+	fmt.Println("\tcpfp -txid TXID -feerate N [-to ADDRESS] -- spend a wallet output of an unconfirmed transaction with a fee lifting both to the fee rate")
+	// 轻节点
+	fmt.Println("\tlightsend -from ADDRESS -to ADDRESS -amount N [-feerate N] -- pay from the outputs tracked by a light node wallet, the running light node broadcasts it")
+	fmt.Println("\testimatefee -blocks N -- estimate the fee per 1000 bytes for confirmation within N blocks from the history recorded by the node")
 	fmt.Println("\tdescription of the transfer parameters:")
 	fmt.Println("\t\t-from FROM -- the source address of the transfer")
 	fmt.Println("\t\t-to TO -- The destination address of the transfer")
@@ -47,6 +119,15 @@ func PrintUsage() {
 	fmt.Println("\t\tMETHOD -- name of method")
 	fmt.Println("\t\t\tbalance -- find all the UTXOs")
 	fmt.Println("\t\t\treset -- reset UTXO table")
+	fmt.Println("\tstart [-light] [-secure] [-allowlist FILE] -- start the node server")
+	fmt.Println("\t\t-light -- only sync block headers and filters, download the blocks matching the wallet from full nodes")
+	fmt.Println("\t\t-secure -- encrypt and authenticate traffic between nodes")
+	fmt.Println("\t\t-allowlist FILE -- only accept peers whose node keys are listed in FILE")
+	fmt.Println("\tnodekey -- print the public identity key of this node")
+	// 节点封禁管理
+	fmt.Println("\tban -addr ADDR [-duration DURATION] -- ban a peer (default 24h)")
+	fmt.Println("\tunban -addr ADDR -- remove a peer from the ban list")
+	fmt.Println("\tlistbanned -- list banned peers")
 }
 
 // Run 命令行
@@ -56,32 +137,217 @@ func (cli *Client) Run() {
 
 	GetAccountsCmd := flag.NewFlagSet("accounts", flag.ExitOnError)
 	CreateWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)               // 创建钱包
+	NewAddressCmd := flag.NewFlagSet("newaddress", flag.ExitOnError)                   // 派生新地址
+	RestoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)             // 恢复钱包
+	DumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)                 // 导出私钥
+	ImportPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)             // 导入私钥
+	ImportAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)             // 导入只观察地址
+	GetPubKeyCmd := flag.NewFlagSet("getpubkey", flag.ExitOnError)                     // 查看公钥
+	CreateMultiSigCmd := flag.NewFlagSet("createmultisig", flag.ExitOnError)           // 创建多重签名地址
+	InitHTLCCmd := flag.NewFlagSet("inithtlc", flag.ExitOnError)                       // 创建哈希时间锁合约
+	RedeemHTLCCmd := flag.NewFlagSet("redeemhtlc", flag.ExitOnError)                   // 合约取款
+	RefundHTLCCmd := flag.NewFlagSet("refundhtlc", flag.ExitOnError)                   // 合约退款
+	AuditHTLCCmd := flag.NewFlagSet("audithtlc", flag.ExitOnError)                     // 审核合约
+	ExtractSecretCmd := flag.NewFlagSet("extractsecret", flag.ExitOnError)             // 提取秘密值
+	AnchorCmd := flag.NewFlagSet("anchor", flag.ExitOnError)                           // 锚定数据
+	VerifyAnchorCmd := flag.NewFlagSet("verifyanchor", flag.ExitOnError)               // 验证锚定数据
+	GetTxProofCmd := flag.NewFlagSet("gettxproof", flag.ExitOnError)                   // 生成交易证明
+	GetHeadersCmd := flag.NewFlagSet("getheaders", flag.ExitOnError)                   // 导出区块头
+	VerifyTxProofCmd := flag.NewFlagSet("verifytxproof", flag.ExitOnError)             // 验证交易证明
+	RescanCmd := flag.NewFlagSet("rescan", flag.ExitOnError)                           // 重新扫描区块链
+	EncryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)             // 加密钱包
+	WalletPassphraseCmd := flag.NewFlagSet("walletpassphrase", flag.ExitOnError)       // 解锁钱包
+	WalletLockCmd := flag.NewFlagSet("walletlock", flag.ExitOnError)                   // 锁定钱包
+	ChangePassphraseCmd := flag.NewFlagSet("changepassphrase", flag.ExitOnError)       // 修改钱包口令
 	AddBlockCmd := flag.NewFlagSet("addblock", flag.ExitOnError)                       // 新建相关命令 添加区块
+	GenerateCmd := flag.NewFlagSet("generate", flag.ExitOnError)                       // 挖出区块
 	PrintChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)                   // 输出区块链完整信息
 	CreateChainWithGenesisBlockCmd := flag.NewFlagSet("createchain", flag.ExitOnError) // 创建区块链
 	SendCmd := flag.NewFlagSet("send", flag.ExitOnError)                               // 发起交易
+	SendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)                       // 批量转账
+	CreateRawTxCmd := flag.NewFlagSet("createrawtx", flag.ExitOnError)                 // 生成未签名交易
+	SignRawTxCmd := flag.NewFlagSet("signrawtx", flag.ExitOnError)                     // 离线签名
+	FinalizeRawTxCmd := flag.NewFlagSet("finalizerawtx", flag.ExitOnError)             // 完成签名
+	BroadcastRawTxCmd := flag.NewFlagSet("broadcastrawtx", flag.ExitOnError)           // 广播交易
+	BumpFeeCmd := flag.NewFlagSet("bumpfee", flag.ExitOnError)                         // 替换交易提高手续费
+	CPFPCmd := flag.NewFlagSet("cpfp", flag.ExitOnError)                               // 子交易代付手续费
+	LightSendCmd := flag.NewFlagSet("lightsend", flag.ExitOnError)                     // 轻节点转账
+	EstimateFeeCmd := flag.NewFlagSet("estimatefee", flag.ExitOnError)                 // 估算手续费
 	GetBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)                   // 查询余额命令
+	GetWalletBalanceCmd := flag.NewFlagSet("getwalletbalance", flag.ExitOnError)       // 查询钱包余额
+	ListTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)       // 钱包交易记录
+	SetLabelCmd := flag.NewFlagSet("setlabel", flag.ExitOnError)                       // 设置地址标签
 	UTXOTestCmd := flag.NewFlagSet("utxo", flag.ExitOnError)
 	StartNodeCmd := flag.NewFlagSet("start", flag.ExitOnError)
+	NodeKeyCmd := flag.NewFlagSet("nodekey", flag.ExitOnError)
+	BanCmd := flag.NewFlagSet("ban", flag.ExitOnError)               // 封禁节点
+	UnbanCmd := flag.NewFlagSet("unban", flag.ExitOnError)           // 解除封禁
+	ListBannedCmd := flag.NewFlagSet("listbanned", flag.ExitOnError) // 查看封禁列表
 
 	flagAddBlockArg := AddBlockCmd.String("data", "", "add block")                              //  数据参数处理
 	flagCreateChainArg := CreateChainWithGenesisBlockCmd.String("address", "", "miner address") // 创建区块链的矿工地址 接收奖励
+	flagCreateChainMaturityArg := CreateChainWithGenesisBlockCmd.Int64("maturity", block.DefaultMaturity, "Confirmations before a mining reward can be spent")
+	flagGenerateAddressArg := GenerateCmd.String("address", "", "The address receiving the mining rewards")
+	flagGenerateBlocksArg := GenerateCmd.Int("blocks", 1, "The number of blocks")
 
 	// 发起交易参数
 	flagSendFromArg := SendCmd.String("from", "", "The source address of the transfer")  // 交易源地址
 	flagSendToArg := SendCmd.String("to", "", "The destination address of the transfer") // 交易目标地址
 	flagSendAmountArg := SendCmd.String("amount", "", "The amount transferred")          // 交易额度
+	flagSendStrategyArg := SendCmd.String("strategy", block.DefaultCoinSelector.Name(), "Coin selection strategy")
+	flagSendFeeRateArg := SendCmd.Int("feerate", -1, "Fee per 1000 bytes (default estimated)")
+	flagSendDustArg := SendCmd.Int("dust", -1, "Dust threshold of the change")
+	flagSendInputsArg := SendCmd.String("inputs", "", "Outputs to spend, as txid:vout separated by commas")
+	flagSendLockTimeArg := SendCmd.Int64("locktime", 0, "The earliest block height or unix time to mine the transaction")
+	flagSendRelativeArg := SendCmd.String("relative", "", "Blocks, or seconds with an s suffix, the inputs must be confirmed for")
+
+	// 批量转账参数
+	flagSendManyFromArg := SendManyCmd.String("from", "", "The funding addresses separated by commas")
+	flagSendManyOutputsArg := SendManyCmd.String("outputs", "", "The recipients as a JSON object of address to amount")
+	flagSendManyChangeArg := SendManyCmd.String("change", "", "The change address")
+	flagSendManyStrategyArg := SendManyCmd.String("strategy", block.DefaultCoinSelector.Name(), "Coin selection strategy")
+	flagSendManyFeeRateArg := SendManyCmd.Int("feerate", -1, "Fee per 1000 bytes (default estimated)")
+	flagSendManyDustArg := SendManyCmd.Int("dust", -1, "Dust threshold of the change")
+	flagSendManyInputsArg := SendManyCmd.String("inputs", "", "Outputs to spend, as txid:vout separated by commas")
+	flagSendManyLockTimeArg := SendManyCmd.Int64("locktime", 0, "The earliest block height or unix time to mine the transaction")
+	flagSendManyRelativeArg := SendManyCmd.String("relative", "", "Blocks, or seconds with an s suffix, the inputs must be confirmed for")
+	flagSendManyRBFArg := SendManyCmd.Bool("rbf", false, "Allow the transaction to be replaced by one paying a higher fee")
+
+	// 离线签名参数
+	flagCreateRawFromArg := CreateRawTxCmd.String("from", "", "The funding addresses separated by commas")
+	flagCreateRawOutputsArg := CreateRawTxCmd.String("outputs", "", "The recipients as a JSON object of address to amount")
+	flagCreateRawChangeArg := CreateRawTxCmd.String("change", "", "The change address")
+	flagCreateRawStrategyArg := CreateRawTxCmd.String("strategy", block.DefaultCoinSelector.Name(), "Coin selection strategy")
+	flagCreateRawFeeRateArg := CreateRawTxCmd.Int("feerate", 0, "Fee per 1000 bytes")
+	flagCreateRawDustArg := CreateRawTxCmd.Int("dust", -1, "Dust threshold of the change")
+	flagCreateRawInputsArg := CreateRawTxCmd.String("inputs", "", "Outputs to spend, as txid:vout separated by commas")
+	flagCreateRawLockTimeArg := CreateRawTxCmd.Int64("locktime", 0, "The earliest block height or unix time to mine the transaction")
+	flagCreateRawRelativeArg := CreateRawTxCmd.String("relative", "", "Blocks, or seconds with an s suffix, the inputs must be confirmed for")
+	flagCreateRawRBFArg := CreateRawTxCmd.Bool("rbf", false, "Allow the transaction to be replaced by one paying a higher fee")
+	flagCreateRawOutArg := CreateRawTxCmd.String("out", "", "Write the transaction to this file")
+	flagSignRawTxArg := SignRawTxCmd.String("tx", "", "The partially signed transaction, a file or hex string")
+	flagSignRawOutArg := SignRawTxCmd.String("out", "", "Write the transaction to this file")
+	flagFinalizeRawTxArg := FinalizeRawTxCmd.String("tx", "", "The signed transaction, a file or hex string")
+	flagFinalizeRawOutArg := FinalizeRawTxCmd.String("out", "", "Write the transaction to this file")
+	flagBroadcastRawTxArg := BroadcastRawTxCmd.String("tx", "", "The transaction, a file or hex string")
+	flagBroadcastMinerArg := BroadcastRawTxCmd.String("miner", "", "The address receiving the mining reward")
 
 	// 查询余额命令行参数
 	flagGetBalanceArg := GetBalanceCmd.String("address", "", "The address to query")
+	flagListCountArg := ListTransactionsCmd.Int("count", 10, "Number of transactions to list")
+	flagLabelAddressArg := SetLabelCmd.String("address", "", "The address to label")
+	flagLabelArg := SetLabelCmd.String("label", "", "The label of the address")
 	flagUTXOArg := UTXOTestCmd.String("method", "", "UTXO table related actions")
 
+	// 分层确定性钱包参数
+	flagCreateMnemonicArg := CreateWalletCmd.Bool("mnemonic", false, "Create a deterministic wallet from a new mnemonic")
+	flagCreateWordsArg := CreateWalletCmd.Int("words", 12, "Number of mnemonic words")
+	flagNewAddressAccountArg := NewAddressCmd.Uint("account", 0, "The account to derive the address from")
+	flagNewAddressChangeArg := NewAddressCmd.Bool("change", false, "Derive a change address")
+	flagRestoreMnemonicArg := RestoreWalletCmd.String("mnemonic", "", "The mnemonic of the wallet")
+	flagRestoreGapArg := RestoreWalletCmd.Int("gap", wallet.DefaultGapLimit, "Stop scanning after this many unused addresses")
+
+	// 私钥导入导出参数
+	flagDumpAddressArg := DumpPrivKeyCmd.String("address", "", "The address whose private key is printed")
+	flagImportKeyArg := ImportPrivKeyCmd.String("key", "", "The private key to import")
+	flagImportKeyRescanArg := ImportPrivKeyCmd.Bool("rescan", true, "Rescan the blockchain after importing")
+	flagImportAddressArg := ImportAddressCmd.String("address", "", "The address to watch")
+	flagImportAddressRescanArg := ImportAddressCmd.Bool("rescan", true, "Rescan the blockchain after importing")
+
+	// 多重签名参数
+	flagPubKeyAddressArg := GetPubKeyCmd.String("address", "", "The address whose public key is printed")
+	flagMultiSigMArg := CreateMultiSigCmd.Int("m", 0, "Number of signatures required")
+	flagMultiSigKeysArg := CreateMultiSigCmd.String("keys", "", "Public keys or wallet addresses separated by commas")
+
+	// 哈希时间锁合约参数
+	flagInitHTLCFromArg := InitHTLCCmd.String("from", "", "The funding address, also receiving the refund")
+	flagInitHTLCToArg := InitHTLCCmd.String("to", "", "The recipient address")
+	flagInitHTLCAmountArg := InitHTLCCmd.Int("amount", 0, "The amount locked in the contract")
+	flagInitHTLCSecretHashArg := InitHTLCCmd.String("secrethash", "", "The sha256 of the secret in hex")
+	flagInitHTLCLockTimeArg := InitHTLCCmd.Int64("locktime", 0, "The block height or unix time after which the refund is possible")
+	flagInitHTLCTimeoutArg := InitHTLCCmd.Duration("timeout", 48*time.Hour, "The refund is possible after this duration")
+	flagInitHTLCFeeRateArg := InitHTLCCmd.Int("feerate", 0, "Fee per 1000 bytes")
+	flagRedeemContractArg := RedeemHTLCCmd.String("contract", "", "The contract script in hex")
+	flagRedeemTxArg := RedeemHTLCCmd.String("tx", "", "The transaction funding the contract")
+	flagRedeemSecretArg := RedeemHTLCCmd.String("secret", "", "The secret in hex")
+	flagRedeemToArg := RedeemHTLCCmd.String("to", "", "The address receiving the coins (default the recipient)")
+	flagRedeemFeeRateArg := RedeemHTLCCmd.Int("feerate", 0, "Fee per 1000 bytes")
+	flagRefundContractArg := RefundHTLCCmd.String("contract", "", "The contract script in hex")
+	flagRefundTxArg := RefundHTLCCmd.String("tx", "", "The transaction funding the contract")
+	flagRefundToArg := RefundHTLCCmd.String("to", "", "The address receiving the coins (default the refund address)")
+	flagRefundFeeRateArg := RefundHTLCCmd.Int("feerate", 0, "Fee per 1000 bytes")
+	flagAuditContractArg := AuditHTLCCmd.String("contract", "", "The contract script in hex")
+	flagAuditTxArg := AuditHTLCCmd.String("tx", "", "The transaction funding the contract")
+	flagExtractTxArg := ExtractSecretCmd.String("tx", "", "The transaction redeeming the contract")
+	flagExtractSecretHashArg := ExtractSecretCmd.String("secrethash", "", "The sha256 of the secret in hex")
+
+	// 提高手续费参数
+	flagBumpFeeTxArg := BumpFeeCmd.String("txid", "", "The unconfirmed transaction to replace")
+	flagBumpFeeRateArg := BumpFeeCmd.Int("feerate", 0, "Fee per 1000 bytes of the replacement")
+	flagCPFPTxArg := CPFPCmd.String("txid", "", "The unconfirmed parent transaction")
+	flagCPFPFeeRateArg := CPFPCmd.Int("feerate", 0, "Fee per 1000 bytes of the parent and the child together")
+	flagCPFPToArg := CPFPCmd.String("to", "", "The address receiving the output (default the address of the output)")
+	flagLightSendFromArg := LightSendCmd.String("from", "", "The source address of the transfer")
+	flagLightSendToArg := LightSendCmd.String("to", "", "The destination address of the transfer")
+	flagLightSendAmountArg := LightSendCmd.Int("amount", 0, "The amount transferred")
+	flagLightSendFeeRateArg := LightSendCmd.Int("feerate", -1, "Fee per 1000 bytes (default estimated)")
+	flagWalletBalanceLightArg := GetWalletBalanceCmd.Bool("light", false, "Use the outputs synced by the light node")
+	flagEstimateBlocksArg := EstimateFeeCmd.Int("blocks", node.DefaultConfirmTarget, "The number of blocks to confirm within")
+
+	// 数据锚定参数
+	flagAnchorFromArg := AnchorCmd.String("from", "", "The address paying the fee")
+	flagAnchorDataArg := AnchorCmd.String("data", "", "The data in hex")
+	flagAnchorFileArg := AnchorCmd.String("file", "", "The file whose sha256 is anchored")
+	flagAnchorFeeRateArg := AnchorCmd.Int("feerate", 0, "Fee per 1000 bytes")
+	flagVerifyAnchorDataArg := VerifyAnchorCmd.String("data", "", "The data in hex")
+	flagVerifyAnchorFileArg := VerifyAnchorCmd.String("file", "", "The file whose sha256 was anchored")
+
+	// 交易证明参数
+	flagGetTxProofTxArg := GetTxProofCmd.String("txid", "", "The transaction to prove")
+	flagGetTxProofOutArg := GetTxProofCmd.String("out", "", "Write the proof to the file instead of printing it")
+	flagGetHeadersOutArg := GetHeadersCmd.String("out", "", "Write the headers to the file instead of printing them")
+	flagVerifyTxProofArg := VerifyTxProofCmd.String("proof", "", "The proof file or hex")
+	flagVerifyTxProofHeadersArg := VerifyTxProofCmd.String("headers", "", "The header chain file or hex")
+
+	// 钱包口令参数
+	flagEncryptPassphraseArg := EncryptWalletCmd.String("passphrase", "", "The new wallet passphrase")
+	flagUnlockPassphraseArg := WalletPassphraseCmd.String("passphrase", "", "The wallet passphrase")
+	flagUnlockTimeoutArg := WalletPassphraseCmd.Duration("timeout", defaultUnlockTimeout, "How long the wallet stays unlocked")
+	flagOldPassphraseArg := ChangePassphraseCmd.String("old", "", "The current wallet passphrase")
+	flagNewPassphraseArg := ChangePassphraseCmd.String("new", "", "The new wallet passphrase")
+
+	// 节点启动参数
+	flagStartLightArg := StartNodeCmd.Bool("light", false, "Run a light node")
+	flagStartSecureArg := StartNodeCmd.Bool("secure", false, "Use the encrypted transport")
+	flagStartAllowlistArg := StartNodeCmd.String("allowlist", "", "File of node public keys allowed to connect")
+
+	// 封禁管理参数
+	flagBanAddrArg := BanCmd.String("addr", "", "The peer host or secure node key to ban")
+	flagBanDurationArg := BanCmd.Duration("duration", node.DefaultBanTime, "How long the ban lasts")
+	flagUnbanAddrArg := UnbanCmd.String("addr", "", "The peer host or secure node key to unban")
+
 	// 判断参数
 	switch os.Args[1] {
 	case "start":
 		if err := StartNodeCmd.Parse(os.Args[2:]); err != nil {
 			log.Panicf("parse cmd start node server failed: %v\n", err)
 		}
+	case "nodekey":
+		if err := NodeKeyCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd nodekey failed: %v\n", err)
+		}
+	case "ban":
+		if err := BanCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd ban failed: %v\n", err)
+		}
+	case "unban":
+		if err := UnbanCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd unban failed: %v\n", err)
+		}
+	case "listbanned":
+		if err := ListBannedCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd listbanned failed: %v\n", err)
+		}
 	case "utxo":
 		err := UTXOTestCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -97,14 +363,154 @@ func (cli *Client) Run() {
 		if err != nil {
 			log.Panicf("parse cmd of create wallet failed: %v\n", err)
 		}
+	case "newaddress": // 派生新地址
+		if err := NewAddressCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd new address failed: %v\n", err)
+		}
+	case "restorewallet": // 恢复钱包
+		if err := RestoreWalletCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd restore wallet failed: %v\n", err)
+		}
+	case "dumpprivkey": // 导出私钥
+		if err := DumpPrivKeyCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd dump private key failed: %v\n", err)
+		}
+	case "importprivkey": // 导入私钥
+		if err := ImportPrivKeyCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd import private key failed: %v\n", err)
+		}
+	case "importaddress": // 导入只观察地址
+		if err := ImportAddressCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd import address failed: %v\n", err)
+		}
+	case "getpubkey": // 查看公钥
+		if err := GetPubKeyCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd get public key failed: %v\n", err)
+		}
+	case "createmultisig": // 创建多重签名地址
+		if err := CreateMultiSigCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd create multisig failed: %v\n", err)
+		}
+	case "inithtlc": // 创建哈希时间锁合约
+		if err := InitHTLCCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd init htlc failed: %v\n", err)
+		}
+	case "redeemhtlc": // 合约取款
+		if err := RedeemHTLCCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd redeem htlc failed: %v\n", err)
+		}
+	case "refundhtlc": // 合约退款
+		if err := RefundHTLCCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd refund htlc failed: %v\n", err)
+		}
+	case "audithtlc": // 审核合约
+		if err := AuditHTLCCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd audit htlc failed: %v\n", err)
+		}
+	case "extractsecret": // 提取秘密值
+		if err := ExtractSecretCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd extract secret failed: %v\n", err)
+		}
+	case "anchor": // 锚定数据
+		if err := AnchorCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd anchor failed: %v\n", err)
+		}
+	case "gettxproof": // 生成交易证明
+		if err := GetTxProofCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd get tx proof failed: %v\n", err)
+		}
+	case "getheaders": // 导出区块头
+		if err := GetHeadersCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd get headers failed: %v\n", err)
+		}
+	case "verifytxproof": // 验证交易证明
+		if err := VerifyTxProofCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd verify tx proof failed: %v\n", err)
+		}
+	case "verifyanchor": // 验证锚定数据
+		if err := VerifyAnchorCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd verify anchor failed: %v\n", err)
+		}
+	case "rescan": // 重新扫描区块链
+		if err := RescanCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd rescan failed: %v\n", err)
+		}
+	case "encryptwallet": // 加密钱包
+		if err := EncryptWalletCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd encrypt wallet failed: %v\n", err)
+		}
+	case "walletpassphrase": // 解锁钱包
+		if err := WalletPassphraseCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd wallet passphrase failed: %v\n", err)
+		}
+	case "walletlock": // 锁定钱包
+		if err := WalletLockCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd wallet lock failed: %v\n", err)
+		}
+	case "changepassphrase": // 修改钱包口令
+		if err := ChangePassphraseCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd change passphrase failed: %v\n", err)
+		}
+	case "getwalletbalance": // 获取钱包余额
+		if err := GetWalletBalanceCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd get wallet balance failed: %v\n", err)
+		}
+	case "listtransactions": // 钱包交易记录
+		if err := ListTransactionsCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd list transactions failed: %v\n", err)
+		}
+	case "setlabel": // 设置地址标签
+		if err := SetLabelCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd set label failed: %v\n", err)
+		}
 	case "getbalance": // 获取余额
 		if err := GetBalanceCmd.Parse(os.Args[2:]); err != nil {
 			log.Panicf("parse cmd get balance failed: %v\n", err)
 		}
+	case "createrawtx": // 生成未签名交易
+		if err := CreateRawTxCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd create raw transaction failed: %v\n", err)
+		}
+	case "signrawtx": // 离线签名
+		if err := SignRawTxCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd sign raw transaction failed: %v\n", err)
+		}
+	case "finalizerawtx": // 完成签名
+		if err := FinalizeRawTxCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd finalize raw transaction failed: %v\n", err)
+		}
+	case "broadcastrawtx": // 广播交易
+		if err := BroadcastRawTxCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd broadcast raw transaction failed: %v\n", err)
+		}
+	case "bumpfee": // 替换交易提高手续费
+		if err := BumpFeeCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd bump fee failed: %v\n", err)
+		}
+	case "cpfp": // 子交易代付手续费
+		if err := CPFPCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd cpfp failed: %v\n", err)
+		}
+	case "lightsend": // 轻节点转账
+		if err := LightSendCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd lightsend failed: %v\n", err)
+		}
+	case "estimatefee": // 估算手续费
+		if err := EstimateFeeCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd estimate fee failed: %v\n", err)
+		}
+	case "sendmany": // 批量转账
+		if err := SendManyCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd send many failed: %v\n", err)
+		}
 	case "send": // 发起交易参数
 		if err := SendCmd.Parse(os.Args[2:]); err != nil {
 			log.Panicf("parse sendCmd failed %v", err)
 		}
+	case "generate": // 挖出区块
+		if err := GenerateCmd.Parse(os.Args[2:]); err != nil {
+			log.Panicf("parse cmd generate failed: %v\n", err)
+		}
 	case "addblock": // 添加区块
 		if err := AddBlockCmd.Parse(os.Args[2:]); err != nil {
 			log.Panicf("parse addBlockCmd failed %v\n", err)
@@ -129,7 +535,35 @@ func (cli *Client) Run() {
 	// 解析命令行参数
 
 	if StartNodeCmd.Parsed() {
-		cli.startNode(nodeId)
+		if *flagStartAllowlistArg != "" && !*flagStartSecureArg {
+			fmt.Println("the allowlist requires the secure transport")
+			os.Exit(1)
+		}
+		cli.startNode(nodeId, *flagStartLightArg, *flagStartSecureArg, *flagStartAllowlistArg)
+	}
+
+	if NodeKeyCmd.Parsed() {
+		cli.NodeKey(nodeId)
+	}
+
+	if BanCmd.Parsed() {
+		if *flagBanAddrArg == "" || *flagBanDurationArg <= 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.Ban(*flagBanAddrArg, *flagBanDurationArg, nodeId)
+	}
+
+	if UnbanCmd.Parsed() {
+		if *flagUnbanAddrArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.Unban(*flagUnbanAddrArg, nodeId)
+	}
+
+	if ListBannedCmd.Parsed() {
+		cli.ListBanned(nodeId)
 	}
 
 	if UTXOTestCmd.Parsed() {
@@ -146,7 +580,187 @@ func (cli *Client) Run() {
 	}
 
 	if CreateWalletCmd.Parsed() {
-		cli.CreateWallets(nodeId)
+		if *flagCreateMnemonicArg {
+			cli.CreateHDWallet(*flagCreateWordsArg*32/3, nodeId)
+		} else {
+			cli.CreateWallets(nodeId)
+		}
+	}
+
+	if NewAddressCmd.Parsed() {
+		cli.NewAddress(*flagNewAddressAccountArg, *flagNewAddressChangeArg, nodeId)
+	}
+
+	if RestoreWalletCmd.Parsed() {
+		if *flagRestoreMnemonicArg == "" || *flagRestoreGapArg <= 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.RestoreWallet(*flagRestoreMnemonicArg, *flagRestoreGapArg, nodeId)
+	}
+
+	if DumpPrivKeyCmd.Parsed() {
+		if *flagDumpAddressArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.DumpPrivKey(*flagDumpAddressArg, nodeId)
+	}
+
+	if ImportPrivKeyCmd.Parsed() {
+		if *flagImportKeyArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.ImportPrivKey(*flagImportKeyArg, *flagImportKeyRescanArg, nodeId)
+	}
+
+	if ImportAddressCmd.Parsed() {
+		if *flagImportAddressArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.ImportAddress(*flagImportAddressArg, *flagImportAddressRescanArg, nodeId)
+	}
+
+	if RescanCmd.Parsed() {
+		cli.Rescan(nodeId)
+	}
+
+	if GetPubKeyCmd.Parsed() {
+		if *flagPubKeyAddressArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.GetPubKey(*flagPubKeyAddressArg, nodeId)
+	}
+
+	if CreateMultiSigCmd.Parsed() {
+		if *flagMultiSigMArg <= 0 || *flagMultiSigKeysArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.CreateMultiSig(*flagMultiSigMArg, strings.Split(*flagMultiSigKeysArg, ","), nodeId)
+	}
+
+	if InitHTLCCmd.Parsed() {
+		if *flagInitHTLCFromArg == "" || *flagInitHTLCToArg == "" || *flagInitHTLCAmountArg <= 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		lockTime := *flagInitHTLCLockTimeArg
+		if lockTime == 0 {
+			lockTime = time.Now().Add(*flagInitHTLCTimeoutArg).Unix()
+		}
+		opts := sendOptions(block.DefaultCoinSelector.Name(), *flagInitHTLCFeeRateArg, -1, "", 0, "")
+		cli.InitHTLC(*flagInitHTLCFromArg, *flagInitHTLCToArg, *flagInitHTLCAmountArg,
+			*flagInitHTLCSecretHashArg, lockTime, opts, nodeId)
+	}
+
+	if RedeemHTLCCmd.Parsed() {
+		if *flagRedeemContractArg == "" || *flagRedeemTxArg == "" || *flagRedeemSecretArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		secret := decodeHexArg("secret", *flagRedeemSecretArg)
+		cli.SpendHTLC(*flagRedeemContractArg, *flagRedeemTxArg, secret, *flagRedeemToArg, *flagRedeemFeeRateArg, nodeId)
+	}
+
+	if RefundHTLCCmd.Parsed() {
+		if *flagRefundContractArg == "" || *flagRefundTxArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.SpendHTLC(*flagRefundContractArg, *flagRefundTxArg, nil, *flagRefundToArg, *flagRefundFeeRateArg, nodeId)
+	}
+
+	if AuditHTLCCmd.Parsed() {
+		if *flagAuditContractArg == "" || *flagAuditTxArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.AuditHTLC(*flagAuditContractArg, *flagAuditTxArg, nodeId)
+	}
+
+	if ExtractSecretCmd.Parsed() {
+		if *flagExtractTxArg == "" || *flagExtractSecretHashArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.ExtractSecret(*flagExtractTxArg, *flagExtractSecretHashArg, nodeId)
+	}
+
+	if AnchorCmd.Parsed() {
+		if *flagAnchorFromArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		opts := sendOptions(block.DefaultCoinSelector.Name(), *flagAnchorFeeRateArg, -1, "", 0, "")
+		cli.Anchor(*flagAnchorFromArg, anchorData(*flagAnchorDataArg, *flagAnchorFileArg), opts, nodeId)
+	}
+
+	if GetTxProofCmd.Parsed() {
+		if *flagGetTxProofTxArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.GetTxProof(*flagGetTxProofTxArg, *flagGetTxProofOutArg, nodeId)
+	}
+
+	if GetHeadersCmd.Parsed() {
+		cli.GetHeaders(*flagGetHeadersOutArg, nodeId)
+	}
+
+	if VerifyTxProofCmd.Parsed() {
+		if *flagVerifyTxProofArg == "" || *flagVerifyTxProofHeadersArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.VerifyTxProof(*flagVerifyTxProofArg, *flagVerifyTxProofHeadersArg)
+	}
+
+	if VerifyAnchorCmd.Parsed() {
+		cli.VerifyAnchor(anchorData(*flagVerifyAnchorDataArg, *flagVerifyAnchorFileArg), nodeId)
+	}
+
+	if EncryptWalletCmd.Parsed() {
+		cli.EncryptWallet(*flagEncryptPassphraseArg, nodeId)
+	}
+
+	if WalletPassphraseCmd.Parsed() {
+		if *flagUnlockTimeoutArg <= 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.WalletPassphrase(*flagUnlockPassphraseArg, *flagUnlockTimeoutArg, nodeId)
+	}
+
+	if WalletLockCmd.Parsed() {
+		cli.WalletLock(nodeId)
+	}
+
+	if ChangePassphraseCmd.Parsed() {
+		cli.ChangePassphrase(*flagOldPassphraseArg, *flagNewPassphraseArg, nodeId)
+	}
+
+	if GetWalletBalanceCmd.Parsed() {
+		if *flagWalletBalanceLightArg {
+			cli.GetLightBalance(nodeId)
+		} else {
+			cli.GetWalletBalance(nodeId)
+		}
+	}
+
+	if ListTransactionsCmd.Parsed() {
+		cli.ListTransactions(*flagListCountArg, nodeId)
+	}
+
+	if SetLabelCmd.Parsed() {
+		if *flagLabelAddressArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.SetLabel(*flagLabelAddressArg, *flagLabelArg, nodeId)
 	}
 
 	if GetBalanceCmd.Parsed() {
@@ -157,6 +771,86 @@ func (cli *Client) Run() {
 		cli.getBalance(*flagGetBalanceArg, nodeId)
 	}
 
+	if CreateRawTxCmd.Parsed() {
+		if *flagCreateRawFromArg == "" || *flagCreateRawOutputsArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		outputs := parseOutputs(*flagCreateRawOutputsArg)
+		opts := sendOptions(*flagCreateRawStrategyArg, *flagCreateRawFeeRateArg, *flagCreateRawDustArg, *flagCreateRawInputsArg,
+			*flagCreateRawLockTimeArg, *flagCreateRawRelativeArg)
+		opts.Replaceable = *flagCreateRawRBFArg
+		cli.CreateRawTx(strings.Split(*flagCreateRawFromArg, ","), outputs, *flagCreateRawChangeArg, opts, *flagCreateRawOutArg, nodeId)
+	}
+
+	if SignRawTxCmd.Parsed() {
+		if *flagSignRawTxArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.SignRawTx(*flagSignRawTxArg, *flagSignRawOutArg, nodeId)
+	}
+
+	if FinalizeRawTxCmd.Parsed() {
+		if *flagFinalizeRawTxArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.FinalizeRawTx(*flagFinalizeRawTxArg, *flagFinalizeRawOutArg)
+	}
+
+	if BroadcastRawTxCmd.Parsed() {
+		if *flagBroadcastRawTxArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.BroadcastRawTx(*flagBroadcastRawTxArg, *flagBroadcastMinerArg, nodeId)
+	}
+
+	if BumpFeeCmd.Parsed() {
+		if *flagBumpFeeTxArg == "" || *flagBumpFeeRateArg < 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.BumpFee(*flagBumpFeeTxArg, *flagBumpFeeRateArg, nodeId)
+	}
+
+	if CPFPCmd.Parsed() {
+		if *flagCPFPTxArg == "" || *flagCPFPFeeRateArg <= 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.CPFP(*flagCPFPTxArg, *flagCPFPFeeRateArg, *flagCPFPToArg, nodeId)
+	}
+
+	if LightSendCmd.Parsed() {
+		if *flagLightSendFromArg == "" || *flagLightSendToArg == "" || *flagLightSendAmountArg <= 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.LightSend(*flagLightSendFromArg, *flagLightSendToArg, *flagLightSendAmountArg, *flagLightSendFeeRateArg, nodeId)
+	}
+
+	if EstimateFeeCmd.Parsed() {
+		if *flagEstimateBlocksArg < 1 || *flagEstimateBlocksArg > node.MaxConfirmTarget {
+			fmt.Printf("blocks must be between 1 and %d\n", node.MaxConfirmTarget)
+			os.Exit(1)
+		}
+		cli.EstimateFee(*flagEstimateBlocksArg, nodeId)
+	}
+
+	if SendManyCmd.Parsed() {
+		if *flagSendManyFromArg == "" || *flagSendManyOutputsArg == "" {
+			PrintUsage()
+			os.Exit(1)
+		}
+		outputs := parseOutputs(*flagSendManyOutputsArg)
+		opts := sendOptions(*flagSendManyStrategyArg, *flagSendManyFeeRateArg, *flagSendManyDustArg, *flagSendManyInputsArg,
+			*flagSendManyLockTimeArg, *flagSendManyRelativeArg)
+		opts.Replaceable = *flagSendManyRBFArg
+		cli.SendMany(strings.Split(*flagSendManyFromArg, ","), outputs, *flagSendManyChangeArg, opts, nodeId)
+	}
+
 	if SendCmd.Parsed() {
 		if *flagSendFromArg == "" {
 			fmt.Println("The source address cannot be empty")
@@ -176,9 +870,11 @@ func (cli *Client) Run() {
 		fmt.Printf("FROM: %s\n", utils.JsonToSlice(*flagSendFromArg))
 		fmt.Printf("TO: %s\n", utils.JsonToSlice(*flagSendToArg))
 		fmt.Printf("AMOUNT: %s\n", utils.JsonToSlice(*flagSendAmountArg))
+		opts := sendOptions(*flagSendStrategyArg, *flagSendFeeRateArg, *flagSendDustArg, *flagSendInputsArg,
+			*flagSendLockTimeArg, *flagSendRelativeArg)
 		cli.Send(utils.JsonToSlice(*flagSendFromArg),
 			utils.JsonToSlice(*flagSendToArg),
-			utils.JsonToSlice(*flagSendAmountArg), nodeId)
+			utils.JsonToSlice(*flagSendAmountArg), nodeId, opts)
 	}
 
 	if AddBlockCmd.Parsed() {
@@ -191,11 +887,93 @@ func (cli *Client) Run() {
 	if PrintChainCmd.Parsed() {
 		cli.PrintChain(nodeId)
 	}
+	if GenerateCmd.Parsed() {
+		if *flagGenerateAddressArg == "" || *flagGenerateBlocksArg <= 0 {
+			PrintUsage()
+			os.Exit(1)
+		}
+		cli.Generate(*flagGenerateAddressArg, *flagGenerateBlocksArg, nodeId)
+	}
+
 	if CreateChainWithGenesisBlockCmd.Parsed() {
 		if *flagCreateChainArg == "" {
 			PrintUsage()
 			os.Exit(1)
 		}
-		cli.CreateBlockChain(*flagCreateChainArg, nodeId)
+		if *flagCreateChainMaturityArg < 0 {
+			fmt.Println("the maturity must not be negative")
+			os.Exit(1)
+		}
+		cli.CreateBlockChain(*flagCreateChainArg, *flagCreateChainMaturityArg, nodeId)
+	}
+}
+
+// 由命令行参数生成选币参数 参数无效时退出
+func sendOptions(strategy string, feeRate int, dust int, inputs string, lockTime int64, relative string) *block.SendOptions {
+	selector, err := block.CoinSelectorByName(strategy)
+	if err != nil {
+		fmt.Printf("%v: %s\n", err, strategy)
+		os.Exit(1)
+	}
+	opts := &block.SendOptions{Selector: selector, FeeRate: feeRate, Dust: dust, LockTime: lockTime}
+	if lockTime < 0 {
+		fmt.Println("the lock time cannot be negative")
+		os.Exit(1)
+	}
+	if relative != "" {
+		if opts.Sequence, err = block.ParseRelativeLock(relative); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	if inputs != "" {
+		if opts.Inputs, err = block.ParseOutPoints(inputs); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	return opts
+}
+
+// 解析十六进制参数 格式错误时退出
+func decodeHexArg(name string, value string) []byte {
+	data, err := hex.DecodeString(value)
+	if err != nil {
+		fmt.Printf("invalid %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return data
+}
+
+// 锚定的数据 -data为十六进制数据 -file为文件的sha256 二者只能指定一个
+func anchorData(dataHex string, file string) []byte {
+	if (dataHex == "") == (file == "") {
+		PrintUsage()
+		os.Exit(1)
+	}
+	if file != "" {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("read file failed: %v\n", err)
+			os.Exit(1)
+		}
+		hash := sha256.Sum256(content)
+		return hash[:]
+	}
+	data := decodeHexArg("data", dataHex)
+	if len(data) > script.MaxDataCarrierSize {
+		fmt.Printf("data is %d bytes, at most %d bytes can be anchored\n", len(data), script.MaxDataCarrierSize)
+		os.Exit(1)
+	}
+	return data
+}
+
+// 解析地址到金额的JSON对象 格式错误时退出
+func parseOutputs(text string) map[string]int {
+	outputs := make(map[string]int)
+	if err := json.Unmarshal([]byte(text), &outputs); err != nil {
+		fmt.Printf("parse outputs failed: %v\n", err)
+		os.Exit(1)
 	}
+	return outputs
 }
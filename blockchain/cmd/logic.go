@@ -2,42 +2,424 @@ package cmd
 
 import (
 	"blockchain/block"
+	"blockchain/crypto"
 	"blockchain/node"
+	"blockchain/script"
 	"blockchain/wallet"
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
 // 实现命令行完整逻辑
 
 // Send 发起转账
-func (cli *Client) Send(from, to, amount []string, nodeId string) {
+func (cli *Client) Send(from, to, amount []string, nodeId string, opts *block.SendOptions) {
 	if !block.IsDBExists(nodeId) {
 		fmt.Println("database not exists")
 		os.Exit(1)
 	}
-	chain := block.GetBlockChainObject(nodeId)
-	defer chain.DB.Close()
 	if len(from) != len(to) || len(from) != len(amount) {
 		fmt.Println("the sender and receiver are inconsistent...")
 		os.Exit(1)
 	}
-	chain.MineNewBlock(from, to, amount, nodeId) // 挖掘一个新区块储存转账信息
+	if len(opts.Inputs) > 0 && len(from) != 1 {
+		fmt.Println("inputs can only be specified with a single sender")
+		os.Exit(1)
+	}
+	// 签名前检查钱包 锁定的钱包无法签名
+	wallets := unlockedWallets(nodeId)
+	for _, address := range from {
+		if _, err := wallets.GetWallet(address); err != nil {
+			fmt.Printf("cannot sign for address[%s]: %v\n", address, err)
+			os.Exit(1)
+		}
+	}
+	if opts.FeeRate < 0 {
+		opts.FeeRate = estimatedFeeRate(nodeId)
+	}
+	chain := block.GetBlockChainObject(nodeId)
+	defer chain.DB.Close()
+	chain.MineNewBlock(from, to, amount, nodeId, opts) // 挖掘一个新区块储存转账信息
+
+	utxoSet := &block.UTXOSet{Chain: chain}
+	utxoSet.UpdateUTXOSet()
+}
+
+// SendMany 由一个或多个地址出资 生成包含多个收款输出的一笔交易并打包到新区块
+// 未指定找零地址时 由助记词派生的钱包使用新的找零地址 否则找零返回第一个出资地址
+func (cli *Client) SendMany(from []string, outputs map[string]int, change string, opts *block.SendOptions, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	wallets := unlockedWallets(nodeId)
+	for _, address := range from {
+		if _, err := wallets.GetWallet(address); err != nil {
+			fmt.Printf("cannot sign for address[%s]: %v\n", address, err)
+			os.Exit(1)
+		}
+	}
+	if opts.FeeRate < 0 {
+		opts.FeeRate = estimatedFeeRate(nodeId)
+	}
+	builder := block.NewTxBuilder(chain, nil).From(from...).Options(opts)
+	for _, address := range sortedOutputs(outputs) {
+		builder.AddOutput(address, outputs[address])
+	}
+	if change == "" && wallets.HasSeed() {
+		var err error
+		if change, err = wallets.NewAddress(0, wallet.ChangeChain); err != nil {
+			fmt.Printf("derive change address failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	builder.Change(change)
+	tx, selection, err := builder.Build()
+	if err != nil {
+		fmt.Printf("build transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := builder.Sign(tx, wallets); err != nil {
+		fmt.Printf("sign transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("transaction[%x]: %d inputs, %d outputs, fee: %d, change: %d\n",
+		tx.TxHash, len(tx.Vins), len(tx.Vouts), selection.Fee, selection.Change)
+	if err := chain.CheckLocks(tx, chain.NextBlock()); err != nil {
+		fmt.Printf("transaction cannot be mined yet: %v\n", err)
+		os.Exit(1)
+	}
 
+	chain.MineBlock([]*block.Transaction{tx}, from[0])
 	utxoSet := &block.UTXOSet{Chain: chain}
 	utxoSet.UpdateUTXOSet()
 }
 
+// EstimateFee 根据节点记录的确认历史 估算blocks个区块内确认需要的手续费率
+func (cli *Client) EstimateFee(blocks int, nodeId string) {
+	feeRate, err := node.NewFeeEstimator(nodeId).Estimate(blocks)
+	if err != nil {
+		fmt.Printf("estimate fee failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("fee rate for confirmation within %d blocks: %d per 1000 bytes\n", blocks, feeRate)
+}
+
+// 转账未指定手续费率时 使用DefaultConfirmTarget个区块内确认的估算费率 无法估算时不付手续费
+func estimatedFeeRate(nodeId string) int {
+	feeRate, err := node.NewFeeEstimator(nodeId).Estimate(node.DefaultConfirmTarget)
+	if err != nil {
+		fmt.Printf("no fee estimate (%v), using fee rate 0\n", err)
+		return 0
+	}
+	fmt.Printf("estimated fee rate for confirmation within %d blocks: %d\n", node.DefaultConfirmTarget, feeRate)
+	return feeRate
+}
+
+// BumpFee 以更高的手续费率替换钱包中带有替换标记的未确认交易 增加的手续费由找零支付
+// 未指定手续费率时使用满足替换规则的最低费率 替换交易记录到钱包 由运行中的节点提交到交易池
+func (cli *Client) BumpFee(txid string, feeRate int, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	wallets := unlockedWallets(nodeId)
+	original := unconfirmedWalletTx(wallets, txid)
+	bump, err := node.NewFeeBump(chain, wallets, original, feeRate)
+	if errors.Is(err, node.ErrNotReplaceable) {
+		fmt.Printf("%v, use cpfp instead\n", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("build replacement failed: %v\n", err)
+		os.Exit(1)
+	}
+	// 与交易池相同的替换规则 费率和总手续费都须提高
+	if err := bump.CheckReplacement(original); err != nil {
+		fmt.Printf("replacement rejected: %v\n", err)
+		os.Exit(1)
+	}
+	if err := chain.CheckLocks(bump.Tx, chain.NextBlock()); err != nil {
+		fmt.Printf("transaction cannot be mined yet: %v\n", err)
+		os.Exit(1)
+	}
+	node.AddPendingTx(wallets, bump.Tx)
+	wallets.SaveWallets(nodeId)
+	fmt.Printf("transaction[%x] replaced by [%x], fee: %d -> %d, change: %d\n",
+		original.TxHash, bump.Tx.TxHash, bump.OriginalFee, bump.Fee, bump.Change)
+	fmt.Println("the running node submits the replacement to its mempool")
+}
+
+// CPFP 花费钱包中未确认交易的输出 子交易的手续费使父子交易合计的手续费率达到feeRate
+// 输出扣除手续费后转入to 默认为原输出的地址 子交易记录到钱包 由运行中的节点提交到交易池
+func (cli *Client) CPFP(txid string, feeRate int, to string, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	wallets := unlockedWallets(nodeId)
+	parent := unconfirmedWalletTx(wallets, txid)
+	parentFee, err := parent.Fee(lookupPrevTxs(chain, parent))
+	if err != nil {
+		fmt.Printf("inputs of the transaction are not confirmed: %v\n", err)
+		os.Exit(1)
+	}
+	index := -1 // 金额最大的钱包输出
+	for i, vout := range parent.Vouts {
+		if _, ok := wallets.Wallets[vout.Address()]; ok && !vout.IsUnspendable() && (index < 0 || vout.Value > parent.Vouts[index].Value) {
+			index = i
+		}
+	}
+	if index < 0 {
+		fmt.Println("transaction has no output of the wallet")
+		os.Exit(1)
+	}
+	from := parent.Vouts[index].Address()
+	if to == "" {
+		to = from
+	}
+	parentSize := len(parent.Serialize())
+	if block.FeeRate(parentFee, parentSize) >= feeRate {
+		fmt.Printf("the fee rate of the transaction is already %d\n", block.FeeRate(parentFee, parentSize))
+		os.Exit(1)
+	}
+	childRate := block.ChildFeeRate(parentFee, parentSize, block.EstimateTxSize(1, 1), feeRate)
+	// 子交易只有一个输出 不按粉尘阈值并入手续费
+	opts := sendOptions(block.DefaultCoinSelector.Name(), childRate, 0, fmt.Sprintf("%x:%d", parent.TxHash, index), 0, "")
+	builder := block.NewTxBuilder(chain, []*block.Transaction{parent}).From(from).Change(to).Options(opts)
+	child, selection, err := builder.Build()
+	if err != nil {
+		fmt.Printf("build child transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := builder.Sign(child, wallets); err != nil {
+		fmt.Printf("sign transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := chain.CheckUnspent(parent); err != nil {
+		fmt.Printf("transaction cannot be mined: %v\n", err)
+		os.Exit(1)
+	}
+	for _, tx := range []*block.Transaction{parent, child} {
+		if err := chain.CheckLocks(tx, chain.NextBlock()); err != nil {
+			fmt.Printf("transaction cannot be mined yet: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	node.AddPendingTx(wallets, child)
+	wallets.SaveWallets(nodeId)
+	packageFee, packageSize := parentFee+selection.Fee, parentSize+len(child.Serialize())
+	fmt.Printf("child transaction[%x], fee: %d\n", child.TxHash, selection.Fee)
+	fmt.Printf("package fee: %d, size: %d, fee rate: %d\n", packageFee, packageSize, block.FeeRate(packageFee, packageSize))
+	fmt.Println("the running node submits the child transaction to its mempool")
+}
+
+// 钱包中未确认交易的原始数据 由节点在交易进入交易池时记录
+func unconfirmedWalletTx(wallets *wallet.Wallets, txid string) *block.Transaction {
+	hash, err := hex.DecodeString(txid)
+	if err != nil {
+		fmt.Printf("invalid transaction id: %s\n", txid)
+		os.Exit(1)
+	}
+	rec, ok := wallets.Transaction(hash)
+	if !ok || rec.BlockHash != nil || rec.Raw == nil {
+		fmt.Printf("transaction[%s] is not an unconfirmed transaction of the wallet\n", txid)
+		os.Exit(1)
+	}
+	tx, err := block.DecodeTransaction(rec.Raw)
+	if err != nil {
+		log.Panicf("decode the transaction of the wallet failed: %v\n", err)
+	}
+	return tx
+}
+
+// 在区块链中查找交易输入引用的交易
+func lookupPrevTxs(chain *block.Chain, tx *block.Transaction) map[string]block.Transaction {
+	prevTxs := make(map[string]block.Transaction)
+	for _, vin := range tx.Vins {
+		if prevTx, ok := chain.LookupTransaction(vin.TxHash); ok {
+			prevTxs[hex.EncodeToString(prevTx.TxHash)] = *prevTx
+		}
+	}
+	return prevTxs
+}
+
+// CreateRawTx 生成部分签名交易 出资地址可以是只观察地址
+func (cli *Client) CreateRawTx(from []string, outputs map[string]int, change string, opts *block.SendOptions, out string, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	builder := block.NewTxBuilder(chain, nil).From(from...).Change(change).Options(opts)
+	for _, address := range sortedOutputs(outputs) {
+		builder.AddOutput(address, outputs[address])
+	}
+	tx, selection, err := builder.Build()
+	if err != nil {
+		fmt.Printf("build transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	tx.HashTransaction()
+	ptx, err := chain.NewPartialTx(tx)
+	if err != nil {
+		fmt.Printf("create partial transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	ptx.AddRedeemScripts(wallet.NewWallets(nodeId)) // 多重签名输入的签名方不必保存赎回脚本
+	fmt.Printf("transaction[%x]: %d inputs, %d outputs, fee: %d, change: %d\n",
+		tx.TxHash, len(tx.Vins), len(tx.Vouts), selection.Fee, selection.Change)
+	writeRawData(out, ptx.Serialize())
+}
+
+// SignRawTx 使用钱包签名部分签名交易 无需区块链数据
+func (cli *Client) SignRawTx(in string, out string, nodeId string) {
+	ptx, err := block.DecodePartialTx(readRawData(in))
+	if err != nil {
+		fmt.Printf("decode partial transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	for i, vin := range ptx.Tx.Vins {
+		fmt.Printf("input %d: %x:%d %d [%s]\n", i, vin.TxHash, vin.Vout, ptx.PrevOuts[i].Value, ptx.InputAddress(i))
+	}
+	for i, vout := range ptx.Tx.Vouts {
+		fmt.Printf("output %d: %d [%s]\n", i, vout.Value, vout.Address())
+	}
+	fmt.Printf("fee: %d\n", ptx.Fee())
+	signed, err := ptx.Sign(unlockedWallets(nodeId))
+	if err != nil {
+		fmt.Printf("sign partial transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("added %d signatures, complete: %v\n", signed, ptx.IsComplete())
+	writeRawData(out, ptx.Serialize())
+}
+
+// FinalizeRawTx 检查部分签名交易的签名 输出可以广播的交易
+func (cli *Client) FinalizeRawTx(in string, out string) {
+	tx := finalizeRawTx(readRawData(in))
+	writeRawData(out, tx.Serialize())
+}
+
+// BroadcastRawTx 验证交易并打包到新区块 可以接受完成签名的部分签名交易
+// 挖矿奖励默认给第一个输入所属地址
+func (cli *Client) BroadcastRawTx(in string, miner string, nodeId string) {
+	data := readRawData(in)
+	var tx *block.Transaction
+	if block.IsPartialTx(data) {
+		tx = finalizeRawTx(data)
+	} else {
+		var err error
+		if tx, err = block.DecodeTransaction(data); err != nil || len(tx.Vins) == 0 {
+			fmt.Println("decode transaction failed")
+			os.Exit(1)
+		}
+	}
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	if err := chain.CheckUnspent(tx); err != nil {
+		fmt.Printf("transaction rejected: %v\n", err)
+		os.Exit(1)
+	}
+	if !chain.VerifyTransaction(tx) {
+		fmt.Println("transaction rejected: signature verification failed")
+		os.Exit(1)
+	}
+	if err := chain.CheckLocks(tx, chain.NextBlock()); err != nil {
+		fmt.Printf("transaction rejected: %v\n", err)
+		os.Exit(1)
+	}
+	if miner == "" {
+		prevTx, _ := chain.LookupTransaction(tx.Vins[0].TxHash)
+		miner = prevTx.Vouts[tx.Vins[0].Vout].Address()
+	}
+	chain.MineBlock([]*block.Transaction{tx}, miner)
+	utxoSet := &block.UTXOSet{Chain: chain}
+	utxoSet.UpdateUTXOSet()
+	fmt.Printf("transaction[%x] broadcast\n", tx.TxHash)
+}
+
+func finalizeRawTx(data []byte) *block.Transaction {
+	ptx, err := block.DecodePartialTx(data)
+	if err != nil {
+		fmt.Printf("decode partial transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	tx, err := ptx.Finalize()
+	if err != nil {
+		fmt.Printf("finalize transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	return tx
+}
+
+// 读取十六进制编码的交易 参数为文件名或十六进制字符串
+func readRawData(in string) []byte {
+	text := in
+	if content, err := ioutil.ReadFile(in); err == nil {
+		text = string(content)
+	}
+	data, err := hex.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		fmt.Printf("decode hex data failed: %v\n", err)
+		os.Exit(1)
+	}
+	return data
+}
+
+// 以十六进制编码输出 指定文件名时写入文件
+func writeRawData(out string, data []byte) {
+	text := hex.EncodeToString(data)
+	if out == "" {
+		fmt.Println(text)
+		return
+	}
+	if err := ioutil.WriteFile(out, []byte(text+"\n"), 0644); err != nil {
+		log.Panicf("write file[%s] failed: %v\n", out, err)
+	}
+	fmt.Printf("written to %s\n", out)
+}
+
+// 按地址排序的收款地址 地址无效时退出
+func sortedOutputs(outputs map[string]int) []string {
+	var addresses []string
+	for address := range outputs {
+		if !wallet.IsValidAddress([]byte(address)) {
+			fmt.Printf("invalid address[%s]\n", address)
+			os.Exit(1)
+		}
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
 // CreateBlockChain 初始化区块链
-func (cli *Client) CreateBlockChain(address string, nodeId string) {
-	cli.BlockChain = block.CreateBlockChainWithGenesisBlock(address, nodeId)
+func (cli *Client) CreateBlockChain(address string, maturity int64, nodeId string) {
+	cli.BlockChain = block.CreateBlockChainWithGenesisBlock(address, maturity, nodeId)
 	defer cli.BlockChain.DB.Close()
 
 	utxoSet := &block.UTXOSet{Chain: cli.BlockChain}
 	utxoSet.ResetUTXOSet()
 }
 
+// Generate 挖出blocks个只包含挖矿奖励的区块
+func (cli *Client) Generate(address string, blocks int, nodeId string) {
+	if !wallet.IsValidAddress([]byte(address)) {
+		fmt.Printf("invalid address[%s]\n", address)
+		os.Exit(1)
+	}
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	utxoSet := &block.UTXOSet{Chain: chain}
+	for i := 0; i < blocks; i++ {
+		chain.MineBlock(nil, address)
+		utxoSet.UpdateUTXOSet()
+	}
+	fmt.Printf("height: %d\n", chain.GetHeight())
+}
+
 // AddBlock 添加区块
 func (cli *Client) AddBlock(txs []*block.Transaction, nodeId string) {
 	cli.BlockChain = block.GetBlockChainObject(nodeId)
@@ -54,16 +436,666 @@ func (cli *Client) PrintChain(nodeId string) {
 
 // CreateWallets 创建钱包集合
 func (cli *Client) CreateWallets(nodeId string) {
-	wallets := wallet.NewWallets(nodeId) // 创建一个集合对象
-	wallets.CreateWallet(nodeId)
+	wallets := unlockedWallets(nodeId) // 创建一个集合对象
+	if err := wallets.CreateWallet(nodeId); err != nil {
+		fmt.Printf("create wallet failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// CreateHDWallet 生成助记词并派生第一个地址
+func (cli *Client) CreateHDWallet(bits int, nodeId string) {
+	wallets := unlockedWallets(nodeId)
+	mnemonic, err := wallets.CreateHDWallet(bits)
+	if err != nil {
+		fmt.Printf("create wallet failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("mnemonic (write it down, it restores every address of this wallet):")
+	fmt.Println(mnemonic)
+	for address := range wallets.Wallets {
+		if path, ok := wallets.Path(address); ok {
+			fmt.Printf("[%s] %s\n", address, path)
+		}
+	}
+}
+
+// NewAddress 派生分层确定性钱包中指定账户的下一个地址
+func (cli *Client) NewAddress(account uint, change bool, nodeId string) {
+	wallets := unlockedWallets(nodeId)
+	chain := wallet.ExternalChain
+	if change {
+		chain = wallet.ChangeChain
+	}
+	address, err := wallets.NewAddress(uint32(account), chain)
+	if err != nil {
+		fmt.Printf("create address failed: %v\n", err)
+		os.Exit(1)
+	}
+	path, _ := wallets.Path(address)
+	fmt.Printf("[%s] %s\n", address, path)
+}
+
+// RestoreWallet 由助记词恢复钱包 扫描区块链找回使用过的地址
+func (cli *Client) RestoreWallet(mnemonic string, gap int, nodeId string) {
+	used := map[string]bool{}
+	if block.IsDBExists(nodeId) {
+		chain := block.GetBlockChainObject(nodeId)
+		used = chain.UsedPubKeyHashes()
+		chain.DB.Close()
+	} else {
+		fmt.Println("database not exists, only the first address is restored")
+	}
+	wallets := unlockedWallets(nodeId)
+	err := wallets.Restore(mnemonic, gap, func(address string) bool {
+		return used[hex.EncodeToString(wallet.StringToHash160(address))]
+	})
+	if err != nil {
+		fmt.Printf("restore wallet failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("restored addresses:")
+	for address := range wallets.Wallets {
+		if path, ok := wallets.Path(address); ok {
+			fmt.Printf(" [%s] %s\n", address, path)
+		}
+	}
+}
+
+// DumpPrivKey 导出地址的私钥
+func (cli *Client) DumpPrivKey(address string, nodeId string) {
+	wallets := unlockedWallets(nodeId)
+	key, err := wallets.DumpPrivateKey(address)
+	if err != nil {
+		fmt.Printf("dump private key failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(key)
+}
+
+// ImportPrivKey 导入私钥
+func (cli *Client) ImportPrivKey(key string, rescan bool, nodeId string) {
+	wallets := unlockedWallets(nodeId)
+	address, err := wallets.ImportPrivateKey(key)
+	if err != nil {
+		fmt.Printf("import private key failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("imported [%s]\n", address)
+	if rescan {
+		cli.Rescan(nodeId)
+	}
+}
+
+// ImportAddress 导入只观察地址
+func (cli *Client) ImportAddress(address string, rescan bool, nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	if err := wallets.ImportAddress(address); err != nil {
+		fmt.Printf("import address failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("imported watch-only [%s]\n", address)
+	if rescan {
+		cli.Rescan(nodeId)
+	}
+}
+
+// GetPubKey 输出地址的公钥 用于与其他签名方创建多重签名地址
+func (cli *Client) GetPubKey(address string, nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	w, ok := wallets.Wallets[address]
+	if !ok {
+		fmt.Printf("get public key failed: %v\n", wallet.ErrWalletNotFound)
+		os.Exit(1)
+	}
+	fmt.Printf("%x\n", w.PublicKey)
+}
+
+// CreateMultiSig 由公钥生成M-of-N多重签名赎回脚本 脚本哈希地址加入钱包
+// 各签名方使用相同顺序的公钥得到相同的地址
+func (cli *Client) CreateMultiSig(m int, keys []string, nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	var pubKeys [][]byte
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if w, ok := wallets.Wallets[key]; ok {
+			pubKeys = append(pubKeys, w.PublicKey)
+			continue
+		}
+		pubKey, err := hex.DecodeString(key)
+		if err != nil || !crypto.SchemeOf(pubKey).IsPublicKey(pubKey) {
+			fmt.Printf("invalid public key: %s\n", key)
+			os.Exit(1)
+		}
+		pubKeys = append(pubKeys, pubKey)
+	}
+	redeemScript, err := script.MultiSig(m, pubKeys)
+	if err == nil && len(redeemScript) > script.MaxElementSize {
+		err = script.ErrElementTooLarge
+	}
+	if err != nil {
+		fmt.Printf("create multisig failed: %v\n", err)
+		os.Exit(1)
+	}
+	address := wallets.AddRedeemScript(redeemScript)
+	fmt.Printf("address: %s\n", address)
+	fmt.Printf("redeem script: %x\n", redeemScript)
+	fmt.Printf("\t%s\n", script.Disasm(redeemScript))
+}
+
+// InitHTLC 将金额锁定到哈希时间锁合约 并打包到新区块
+// 未指定秘密哈希时生成新的秘密值(交换的发起方) 合约地址加入钱包以便查看和退款
+func (cli *Client) InitHTLC(from, to string, amount int, secretHashHex string, lockTime int64, opts *block.SendOptions, nodeId string) {
+	var secret, secretHash []byte
+	if secretHashHex == "" {
+		secret = make([]byte, script.SecretSize)
+		if _, err := rand.Read(secret); err != nil {
+			log.Panicf("generate secret failed: %v\n", err)
+		}
+		hash := sha256.Sum256(secret)
+		secretHash = hash[:]
+	} else {
+		secretHash = decodeHexArg("secret hash", secretHashHex)
+	}
+	h, err := block.NewHTLC(secretHash, to, from, lockTime)
+	if err != nil {
+		fmt.Printf("create contract failed: %v\n", err)
+		os.Exit(1)
+	}
+	contract, _ := h.Script()
+
+	wallets := unlockedWallets(nodeId)
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	builder := block.NewTxBuilder(chain, nil).From(from).AddOutput(block.ContractAddress(contract), amount).Options(opts)
+	tx, selection, err := builder.Build()
+	if err != nil {
+		fmt.Printf("build transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := builder.Sign(tx, wallets); err != nil {
+		fmt.Printf("sign transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	chain.MineBlock([]*block.Transaction{tx}, from)
+	utxoSet := &block.UTXOSet{Chain: chain}
+	utxoSet.UpdateUTXOSet()
+	wallets.AddRedeemScript(contract)
+
+	if secret != nil {
+		fmt.Printf("secret: %x\n", secret)
+	}
+	fmt.Printf("secret hash: %x\n", secretHash)
+	fmt.Printf("contract address: %s\n", block.ContractAddress(contract))
+	fmt.Printf("contract: %x\n", contract)
+	fmt.Printf("contract transaction[%x], fee: %d\n", tx.TxHash, selection.Fee)
+	fmt.Printf("refund after: %s\n", formatLockTime(lockTime))
+}
+
+// SpendHTLC 花费合约输出 secret非空时作为收款方取款 否则作为退款方退款
+func (cli *Client) SpendHTLC(contractHex, txid string, secret []byte, to string, feeRate int, nodeId string) {
+	contract := decodeHexArg("contract", contractHex)
+	h, err := script.ParseHTLC(contract)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	party := h.Refund
+	if secret != nil {
+		party = h.Recipient
+	}
+	address := string(wallet.Hash160ToAddress(party))
+	w, err := unlockedWallets(nodeId).GetWallet(address)
+	if err != nil {
+		fmt.Printf("cannot sign for address[%s]: %v\n", address, err)
+		os.Exit(1)
+	}
+	if to == "" {
+		to = address
+	}
+
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	contractTx, ok := chain.LookupTransaction(decodeHexArg("transaction id", txid))
+	if !ok {
+		fmt.Printf("transaction[%s] not found\n", txid)
+		os.Exit(1)
+	}
+	tx, err := block.SpendHTLC(contractTx, contract, w, secret, to, feeRate)
+	if err != nil {
+		fmt.Printf("spend contract failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := chain.CheckUnspent(tx); err != nil {
+		fmt.Printf("transaction rejected: %v\n", err)
+		os.Exit(1)
+	}
+	if err := chain.CheckLocks(tx, chain.NextBlock()); err != nil {
+		fmt.Printf("transaction cannot be mined yet: %v\n", err)
+		os.Exit(1)
+	}
+	chain.MineBlock([]*block.Transaction{tx}, to)
+	utxoSet := &block.UTXOSet{Chain: chain}
+	utxoSet.UpdateUTXOSet()
+	fmt.Printf("transaction[%x]: %d to %s\n", tx.TxHash, tx.Vouts[0].Value, to)
+}
+
+// AuditHTLC 输出合约的条款、资金和花费情况
+func (cli *Client) AuditHTLC(contractHex, txid string, nodeId string) {
+	contract := decodeHexArg("contract", contractHex)
+	h, err := script.ParseHTLC(contract)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	contractTx, ok := chain.LookupTransaction(decodeHexArg("transaction id", txid))
+	if !ok {
+		fmt.Printf("transaction[%s] not found\n", txid)
+		os.Exit(1)
+	}
+	index, err := block.FindContractOutput(contractTx, contract)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("contract address: %s\n", block.ContractAddress(contract))
+	fmt.Printf("contract value: %d\n", contractTx.Vouts[index].Value)
+	fmt.Printf("recipient: %s\n", wallet.Hash160ToAddress(h.Recipient))
+	fmt.Printf("refund address: %s\n", wallet.Hash160ToAddress(h.Refund))
+	fmt.Printf("secret hash: %x\n", h.SecretHash)
+	fmt.Printf("refund after: %s\n", formatLockTime(h.LockTime))
+	if height, ok := chain.TxHeight(contractTx.TxHash); ok {
+		fmt.Printf("confirmations: %d\n", chain.GetHeight()-height+1)
+	}
+	// 取款交易公开了秘密值 退款交易没有
+	spender, height, ok := chain.FindSpendingTx(contractTx.TxHash, index)
+	if !ok {
+		fmt.Println("state: unspent")
+	} else if _, err := block.ExtractSecret(spender, h.SecretHash); err == nil {
+		fmt.Printf("state: redeemed by transaction[%x] at height %d\n", spender.TxHash, height)
+	} else {
+		fmt.Printf("state: refunded by transaction[%x] at height %d\n", spender.TxHash, height)
+	}
+}
+
+// ExtractSecret 从取款交易中提取秘密值
+func (cli *Client) ExtractSecret(txid string, secretHashHex string, nodeId string) {
+	secretHash := decodeHexArg("secret hash", secretHashHex)
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	tx, ok := chain.LookupTransaction(decodeHexArg("transaction id", txid))
+	if !ok {
+		fmt.Printf("transaction[%s] not found\n", txid)
+		os.Exit(1)
+	}
+	secret, err := block.ExtractSecret(tx, secretHash)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("secret: %x\n", secret)
+}
+
+// 时间锁的文本形式 区块高度或本地时间
+func formatLockTime(lockTime int64) string {
+	if lockTime < block.LockTimeThreshold {
+		return fmt.Sprintf("block %d", lockTime)
+	}
+	return time.Unix(lockTime, 0).Format(time.RFC3339)
+}
+
+// LightSend 由轻节点钱包跟踪的输出构造并签名交易 记录为钱包的未确认交易
+// 运行中的轻节点广播该交易 直到其被打包
+func (cli *Client) LightSend(from string, to string, amount int, feeRate int, nodeId string) {
+	wallets := unlockedWallets(nodeId)
+	if _, err := wallets.GetWallet(from); err != nil {
+		fmt.Printf("cannot sign for address[%s]: %v\n", from, err)
+		os.Exit(1)
+	}
+	if tip, _ := wallets.SyncedTip(); tip == nil {
+		fmt.Println("the wallet is not synced, start the node with start -light first")
+		os.Exit(1)
+	}
+	opts := block.DefaultSendOptions()
+	opts.FeeRate = feeRate
+	if opts.FeeRate < 0 {
+		opts.FeeRate = estimatedFeeRate(nodeId)
+	}
+	source := &block.WalletSource{Wallets: wallets, Maturity: node.NewHeaderChain(nodeId).Maturity()}
+	builder := block.NewTxBuilder(source, nil).From(from).AddOutput(to, amount).Options(opts)
+	tx, selection, err := builder.Build()
+	if err != nil {
+		fmt.Printf("build transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := builder.Sign(tx, wallets); err != nil {
+		fmt.Printf("sign transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	node.AddPendingTx(wallets, tx)
+	wallets.SaveWallets(nodeId)
+	fmt.Printf("transaction[%x]: %d inputs, %d outputs, fee: %d, change: %d\n",
+		tx.TxHash, len(tx.Vins), len(tx.Vouts), selection.Fee, selection.Change)
+	fmt.Println("the light node broadcasts the transaction until it is mined")
+}
+
+// Anchor 生成携带数据的交易并打包到新区块 由from支付手续费 余额找零给from
+func (cli *Client) Anchor(from string, data []byte, opts *block.SendOptions, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	wallets := unlockedWallets(nodeId)
+	if _, err := wallets.GetWallet(from); err != nil {
+		fmt.Printf("cannot sign for address[%s]: %v\n", from, err)
+		os.Exit(1)
+	}
+	if proof, err := chain.FindAnchor(data); err == nil {
+		fmt.Printf("data is already anchored in block %d by transaction[%x]\n", proof.Height, proof.Tx.TxHash)
+		os.Exit(1)
+	}
+	builder := block.NewTxBuilder(chain, nil).From(from).AddData(data).Options(opts)
+	tx, selection, err := builder.Build()
+	if err != nil {
+		fmt.Printf("build transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := builder.Sign(tx, wallets); err != nil {
+		fmt.Printf("sign transaction failed: %v\n", err)
+		os.Exit(1)
+	}
+	chain.MineBlock([]*block.Transaction{tx}, from)
+	utxoSet := &block.UTXOSet{Chain: chain}
+	utxoSet.UpdateUTXOSet()
+	fmt.Printf("data: %x\n", data)
+	fmt.Printf("anchor transaction[%x], fee: %d\n", tx.TxHash, selection.Fee)
+	fmt.Printf("block: %d [%x]\n", chain.GetHeight(), chain.GetLatestBlock().Hash)
+}
+
+// VerifyAnchor 查找携带数据的交易 输出所在区块、时间和Merkle证明 验证证明与区块头一致
+func (cli *Client) VerifyAnchor(data []byte, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	proof, err := chain.FindAnchor(data)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("data: %x\n", data)
+	fmt.Printf("transaction: %x\n", proof.Tx.TxHash)
+	fmt.Printf("block: %d [%x]\n", proof.Height, proof.BlockHash)
+	fmt.Printf("time: %s\n", time.Unix(proof.TimeStamp, 0).Format(time.RFC3339))
+	fmt.Printf("confirmations: %d\n", chain.GetHeight()-proof.Height+1)
+	fmt.Printf("merkle proof (leaf %d):\n", proof.Proof.Index)
+	for i, step := range proof.Proof.Steps {
+		side := "right"
+		if step.Left {
+			side = "left"
+		}
+		if step.Sibling == nil {
+			fmt.Printf("\t%d: duplicate\n", i)
+		} else {
+			fmt.Printf("\t%d: %s %x\n", i, side, step.Sibling)
+		}
+	}
+	fmt.Printf("merkle root: %x\n", proof.Proof.Root())
+	if err := proof.Verify(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println("proof verified")
+}
+
+// GetTxProof 生成主链中交易的包含证明 写入文件或输出十六进制
+func (cli *Client) GetTxProof(txid string, out string, nodeId string) {
+	txHash, err := hex.DecodeString(txid)
+	if err != nil {
+		fmt.Printf("invalid txid: %v\n", err)
+		os.Exit(1)
+	}
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	proof, err := chain.GetTxProof(txHash)
+	if err != nil {
+		fmt.Printf("transaction[%s]: %v\n", txid, err)
+		os.Exit(1)
+	}
+	fmt.Printf("transaction[%s] in block %d [%x], leaf %d of the merkle tree\n",
+		txid, proof.Header.Height, proof.Header.Hash, proof.Proof.Index)
+	writeRawData(out, proof.Serialize())
+}
+
+// GetHeaders 导出主链的区块头 供不持有区块链的验证方使用
+func (cli *Client) GetHeaders(out string, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	headers := chain.GetHeaders()
+	fmt.Printf("%d block headers, tip [%x]\n", len(headers), headers[len(headers)-1].Hash)
+	writeRawData(out, block.SerializeHeaders(headers))
+}
+
+// VerifyTxProof 根据区块头链验证交易的包含证明 不需要区块链数据
+func (cli *Client) VerifyTxProof(proofIn string, headersIn string) {
+	proof, err := block.DecodeTxProof(readRawData(proofIn))
+	if err != nil || proof.Header == nil || proof.Proof == nil {
+		fmt.Printf("decode the proof failed: %v\n", err)
+		os.Exit(1)
+	}
+	headers, err := block.DecodeHeaders(readRawData(headersIn))
+	if err != nil || len(headers) == 0 {
+		fmt.Printf("decode the block headers failed: %v\n", err)
+		os.Exit(1)
+	}
+	if err := block.VerifyHeaders(headers); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	confirmations, err := proof.VerifyAgainst(headers)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("transaction: %x\n", proof.TxHash())
+	fmt.Printf("block: %d [%x]\n", proof.Header.Height, proof.Header.Hash)
+	fmt.Printf("confirmations: %d\n", confirmations)
+	fmt.Println("proof verified")
+}
+
+// Rescan 清除钱包交易记录 从创世区块重新扫描区块链
+func (cli *Client) Rescan(nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	wallets := wallet.NewWallets(nodeId)
+	chain.RescanWallet(wallets, nodeId)
+	_, height := wallets.SyncedTip()
+	fmt.Printf("rescanned up to height %d, %d transactions found\n", height, len(wallets.Transactions()))
+	printWalletBalance(wallets, chain.Maturity)
+}
+
+// ListTransactions 列出钱包最近的count笔交易
+func (cli *Client) ListTransactions(count int, nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	wallets := wallet.NewWallets(nodeId)
+	chain.SyncWallet(wallets, nodeId)
+	txs := wallets.Transactions()
+	if count > 0 && len(txs) > count {
+		txs = txs[len(txs)-count:]
+	}
+	for _, rec := range txs {
+		fmt.Printf("%x\n", rec.TxHash)
+		fmt.Printf("\tamount: %d, fee: %d, confirmations: %d, height: %d, time: %s\n",
+			rec.Amount(), rec.Fee, wallets.Confirmations(rec), rec.Height, time.Unix(rec.Time, 0).Format(time.RFC3339))
+		for _, entry := range rec.Entries {
+			category := entry.Category
+			if category == wallet.CategoryGenerate && wallets.Confirmations(rec) < chain.Maturity {
+				category = "immature"
+			}
+			fmt.Printf("\t%-8s %d [%s]", category, entry.Value, entry.Address)
+			if label := wallets.Label(entry.Address); label != "" {
+				fmt.Printf(" %s", label)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+// GetWalletBalance 查询钱包余额
+func (cli *Client) GetWalletBalance(nodeId string) {
+	chain := openChain(nodeId)
+	defer chain.DB.Close()
+	wallets := wallet.NewWallets(nodeId)
+	chain.SyncWallet(wallets, nodeId)
+	printWalletBalance(wallets, chain.Maturity)
+}
+
+// GetLightBalance 获取轻节点钱包的余额 使用轻节点最后同步的输出
+func (cli *Client) GetLightBalance(nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	tip, height := wallets.SyncedTip()
+	fmt.Printf("synced block: %x at height %d\n", tip, height)
+	printWalletBalance(wallets, node.NewHeaderChain(nodeId).Maturity())
+}
+
+// SetLabel 设置地址标签
+func (cli *Client) SetLabel(address string, label string, nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	if err := wallets.SetLabel(address, label); err != nil {
+		fmt.Printf("set label failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// 打开区块链 数据库不存在时退出
+func openChain(nodeId string) *block.Chain {
+	if !block.IsDBExists(nodeId) {
+		fmt.Println("database not exists")
+		os.Exit(1)
+	}
+	return block.GetBlockChainObject(nodeId)
+}
+
+func printWalletBalance(wallets *wallet.Wallets, maturity int64) {
+	balance := wallets.GetBalance(maturity)
+	fmt.Printf("confirmed: %d\n", balance.Confirmed)
+	fmt.Printf("unconfirmed: %d\n", balance.Unconfirmed)
+	fmt.Printf("immature: %d\n", balance.Immature)
+	if balance.WatchOnly != 0 {
+		fmt.Printf("watch-only: %d\n", balance.WatchOnly)
+	}
+}
+
+const defaultUnlockTimeout = 60 * time.Second // 解锁钱包的默认时长
+
+// 读取口令 未通过参数指定时从标准输入读取一行
+func readPassphrase(passphrase string, prompt string) string {
+	if passphrase != "" {
+		return passphrase
+	}
+	fmt.Print(prompt)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Panicf("read the passphrase failed: %v\n", err)
+	}
+	passphrase = strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		fmt.Println("the passphrase cannot be empty")
+		os.Exit(1)
+	}
+	return passphrase
+}
+
+// 需要私钥的命令使用的钱包集合
+// 命令行每次运行都是独立的进程 加密的钱包处于锁定状态时从标准输入读取口令 只在本次命令中解锁
+func unlockedWallets(nodeId string) *wallet.Wallets {
+	wallets := wallet.NewWallets(nodeId)
+	if !wallets.IsLocked() {
+		return wallets
+	}
+	fmt.Print("wallet passphrase: ")
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		fmt.Println(wallet.ErrWalletLocked)
+		os.Exit(1)
+	}
+	if err := wallets.Unlock(passphrase, defaultUnlockTimeout); err != nil {
+		fmt.Printf("unlock wallet failed: %v\n", err)
+		os.Exit(1)
+	}
+	return wallets
+}
+
+// EncryptWallet 使用口令加密钱包
+func (cli *Client) EncryptWallet(passphrase string, nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	passphrase = readPassphrase(passphrase, "new passphrase: ")
+	if err := wallets.Encrypt(passphrase); err != nil {
+		fmt.Printf("encrypt wallet failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("wallet encrypted and locked")
+}
+
+// WalletPassphrase 解锁钱包 派生的密钥只保存在本进程的内存中 超过timeout后失效
+func (cli *Client) WalletPassphrase(passphrase string, timeout time.Duration, nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	passphrase = readPassphrase(passphrase, "wallet passphrase: ")
+	if err := wallets.Unlock(passphrase, timeout); err != nil {
+		fmt.Printf("unlock wallet failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("wallet unlocked for %v\n", timeout)
+}
+
+// WalletLock 锁定钱包 清除内存中的解锁密钥
+func (cli *Client) WalletLock(nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	if !wallets.IsEncrypted() {
+		fmt.Println(wallet.ErrNotEncrypted)
+		os.Exit(1)
+	}
+	wallets.Lock()
+	fmt.Println("wallet locked")
+}
+
+// ChangePassphrase 修改钱包口令
+func (cli *Client) ChangePassphrase(oldPassphrase, newPassphrase string, nodeId string) {
+	wallets := wallet.NewWallets(nodeId)
+	oldPassphrase = readPassphrase(oldPassphrase, "old passphrase: ")
+	newPassphrase = readPassphrase(newPassphrase, "new passphrase: ")
+	if err := wallets.ChangePassphrase(oldPassphrase, newPassphrase); err != nil {
+		fmt.Printf("change passphrase failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println("wallet passphrase changed, the wallet is locked")
 }
 
 // GetAccounts 获取账户列表
 func (cli *Client) GetAccounts(nodeId string) {
 	wallets := wallet.NewWallets(nodeId)
+	if wallets.IsEncrypted() && wallets.IsLocked() {
+		fmt.Println("wallet is locked")
+	}
 	fmt.Println("account list:")
-	for key := range wallets.Wallets {
-		fmt.Printf(" [%s]\n", key)
+	for _, key := range wallets.Addresses() {
+		fmt.Printf(" [%s]", key)
+		if path, ok := wallets.Path(key); ok {
+			fmt.Printf(" %s", path)
+		}
+		if redeemScript, ok := wallets.RedeemScript(key); ok {
+			if m, pubKeys, ok := script.ParseMultiSig(redeemScript); ok {
+				fmt.Printf(" multisig %d-of-%d", m, len(pubKeys))
+			} else if h, err := script.ParseHTLC(redeemScript); err == nil {
+				fmt.Printf(" htlc to %s, refund after %s", wallet.Hash160ToAddress(h.Recipient), formatLockTime(h.LockTime))
+			}
+		} else if wallets.IsWatchOnly(key) {
+			fmt.Print(" watch-only")
+		}
+		if label := wallets.Label(key); label != "" {
+			fmt.Printf(" %q", label)
+		}
+		fmt.Println()
 	}
 }
 
@@ -85,8 +1117,11 @@ func (cli *Client) getBalance(from string, nodeId string) {
 	chain := block.GetBlockChainObject(nodeId)
 	defer chain.DB.Close()
 	utxoSet := block.UTXOSet{Chain: chain}
-	amount := utxoSet.GetBalance(from)
+	amount, immature := utxoSet.GetBalances(from)
 	fmt.Printf("balance of address[%s]: %d\n", from, amount)
+	if immature > 0 {
+		fmt.Printf("immature: %d\n", immature)
+	}
 }
 
 // SetNodeId 设置端口号
@@ -103,6 +1138,42 @@ func (cli *Client) SetNodeId(nodeId string) {
 }
 
 // 启动节点
-func (cli *Client) startNode(nodeId string) {
-	node.StartServer(nodeId)
+func (cli *Client) startNode(nodeId string, light bool, secure bool, allowlist string) {
+	if light {
+		node.StartLightServer(nodeId, secure, allowlist)
+		return
+	}
+	node.StartServer(nodeId, secure, allowlist)
+}
+
+// NodeKey 输出节点身份公钥 用于配置其他节点的白名单
+func (cli *Client) NodeKey(nodeId string) {
+	fmt.Printf("node key: %s\n", node.NodePublicKey(nodeId))
+}
+
+// Ban 封禁节点
+func (cli *Client) Ban(addr string, duration time.Duration, nodeId string) {
+	banList := node.NewBanList(nodeId)
+	banList.Ban(addr, duration, "manually banned")
+	fmt.Printf("peer[%s] banned for %v\n", addr, duration)
+}
+
+// Unban 解除节点封禁
+func (cli *Client) Unban(addr string, nodeId string) {
+	banList := node.NewBanList(nodeId)
+	if !banList.Unban(addr) {
+		fmt.Printf("peer[%s] is not banned\n", addr)
+		return
+	}
+	fmt.Printf("peer[%s] unbanned\n", addr)
+}
+
+// ListBanned 输出封禁列表
+func (cli *Client) ListBanned(nodeId string) {
+	banList := node.NewBanList(nodeId)
+	fmt.Println("banned peers:")
+	for _, entry := range banList.List() {
+		fmt.Printf(" [%s] until %s (%s)\n", entry.Addr,
+			time.Unix(entry.Until, 0).Format(time.RFC3339), entry.Reason)
+	}
 }
@@ -28,22 +28,39 @@ func Base58Encode(input []byte) []byte {
 		// 在字母表中进行索引
 		result = append(result, base58Alphabet[mod.Int64()])
 	}
+	// 输入开头的0字节在转换为整数时丢失 每个0字节编码为一个字母表首字符
+	for _, b := range input {
+		if b != 0 {
+			break
+		}
+		result = append(result, base58Alphabet[0])
+	}
 	utils.Reverse(result) // 倒序得到结果
 	result = append([]byte{base58Alphabet[0]}, result...)
 	return result
 }
 
+// IsBase58 判断字符是否属于base58字母表
+func IsBase58(c byte) bool {
+	return bytes.IndexByte(base58Alphabet, c) >= 0
+}
+
 // Base58Decode base58解码函数
 func Base58Decode(input []byte) []byte {
 	result := big.NewInt(0)
 	zeroBytes := 1
 	// 去除前缀 再查找input中指定数字/字符在基数表中出现的索引
 	data := input[zeroBytes:]
+	// 前缀之后的字母表首字符对应开头的0字节
+	leadingZeros := 0
+	for leadingZeros < len(data) && data[leadingZeros] == base58Alphabet[0] {
+		leadingZeros++
+	}
 	for _, b := range data {
 		charIndex := bytes.IndexByte(base58Alphabet, b) // 返回字符在切片中第一次出现的索引
 		result.Mul(result, big.NewInt(58))
 		result.Add(result, big.NewInt(int64(charIndex)))
 	}
-	decoded := result.Bytes()
+	decoded := append(make([]byte, leadingZeros), result.Bytes()...)
 	return decoded
 }
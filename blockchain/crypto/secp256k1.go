@@ -0,0 +1,33 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// secp256k1椭圆曲线 y^2 = x^3 + 7
+// 标准库的通用曲线实现假设a=-3 不适用于a=0的secp256k1
+// 曲线运算和签名使用decred的secp256k1实现 签名时私钥和随机数的运算为常数时间
+// elliptic.Curve接口仅用于在ecdsa.PrivateKey中标识曲线和派生公钥
+
+var secp256k1Curve = secp256k1.S256()
+
+// S256 secp256k1曲线
+func S256() elliptic.Curve {
+	return secp256k1Curve
+}
+
+// 转换为decred的私钥 私钥标量不小于曲线阶时返回false
+func toSecp256k1PrivateKey(priv *ecdsa.PrivateKey) (*secp256k1.PrivateKey, bool) {
+	if priv.D.Sign() <= 0 || priv.D.BitLen() > 256 {
+		return nil, false
+	}
+	var d [32]byte
+	priv.D.FillBytes(d[:])
+	var key secp256k1.ModNScalar
+	if overflow := key.SetBytes(&d); overflow != 0 || key.IsZero() {
+		return nil, false
+	}
+	return secp256k1.NewPrivateKey(&key), true
+}
@@ -0,0 +1,298 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"errors"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	dcrecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"math/big"
+)
+
+// 签名方案
+// 交易输入中的公钥格式决定验证使用的方案:
+// 1. secp256k1: 33字节压缩公钥 DER编码签名(也接受64字节定长签名) 签名使用RFC 6979确定性随机数 s取较小值
+// 2. P-256: 早期版本的公钥为X和Y直接拼接 签名为r和s直接拼接 只为验证已有交易而保留
+// 新生成的密钥默认使用secp256k1
+
+var (
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+	ErrUnknownScheme     = errors.New("unknown signature scheme")
+)
+
+// SignatureScheme 签名方案
+type SignatureScheme interface {
+	Name() string
+	Curve() elliptic.Curve
+	// GenerateKey 生成随机私钥
+	GenerateKey() (*ecdsa.PrivateKey, error)
+	// PublicKey 序列化公钥 地址由序列化后的公钥计算
+	PublicKey(pub *ecdsa.PublicKey) []byte
+	// IsPublicKey 判断公钥是否为该方案的格式
+	IsPublicKey(pubKey []byte) bool
+	Sign(priv *ecdsa.PrivateKey, hash []byte) ([]byte, error)
+	Verify(pubKey []byte, hash []byte, sig []byte) bool
+}
+
+var (
+	Secp256k1     SignatureScheme = secp256k1Scheme{}
+	P256          SignatureScheme = p256Scheme{}
+	DefaultScheme                 = Secp256k1
+)
+
+// 已注册的方案 按顺序匹配公钥格式 最后一个作为兜底
+var schemes = []SignatureScheme{Secp256k1, P256}
+
+// RegisterScheme 注册新的签名方案 优先于已有方案匹配
+func RegisterScheme(scheme SignatureScheme) {
+	schemes = append([]SignatureScheme{scheme}, schemes...)
+}
+
+// SchemeOf 根据公钥格式选择签名方案
+func SchemeOf(pubKey []byte) SignatureScheme {
+	for _, scheme := range schemes {
+		if scheme.IsPublicKey(pubKey) {
+			return scheme
+		}
+	}
+	return schemes[len(schemes)-1]
+}
+
+// SchemeOfKey 根据私钥的曲线选择签名方案
+func SchemeOfKey(priv *ecdsa.PrivateKey) (SignatureScheme, error) {
+	if priv == nil || priv.Curve == nil || priv.D == nil {
+		return nil, ErrInvalidPrivateKey
+	}
+	for _, scheme := range schemes {
+		if scheme.Curve() == priv.Curve {
+			return scheme, nil
+		}
+	}
+	return nil, ErrUnknownScheme
+}
+
+// SchemeByName 根据名称获取签名方案
+func SchemeByName(name string) (SignatureScheme, error) {
+	for _, scheme := range schemes {
+		if scheme.Name() == name {
+			return scheme, nil
+		}
+	}
+	return nil, ErrUnknownScheme
+}
+
+// Sign 使用私钥对应的方案签名
+func Sign(priv *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	scheme, err := SchemeOfKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.Sign(priv, hash)
+}
+
+// Verify 使用公钥对应的方案验证签名
+func Verify(pubKey []byte, hash []byte, sig []byte) bool {
+	return SchemeOf(pubKey).Verify(pubKey, hash, sig)
+}
+
+// PublicKeyBytes 序列化私钥对应的公钥
+func PublicKeyBytes(priv *ecdsa.PrivateKey) ([]byte, error) {
+	scheme, err := SchemeOfKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return scheme.PublicKey(&priv.PublicKey), nil
+}
+
+// NewPrivateKey 由私钥标量创建指定曲线的私钥
+func NewPrivateKey(curve elliptic.Curve, d []byte) (*ecdsa.PrivateKey, error) {
+	k := new(big.Int).SetBytes(d)
+	if k.Sign() == 0 || k.Cmp(curve.Params().N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	priv := &ecdsa.PrivateKey{D: k}
+	priv.Curve = curve
+	priv.X, priv.Y = curve.ScalarBaseMult(d)
+	return priv, nil
+}
+
+// secp256k1签名方案
+type secp256k1Scheme struct{}
+
+func (secp256k1Scheme) Name() string {
+	return "secp256k1"
+}
+
+func (secp256k1Scheme) Curve() elliptic.Curve {
+	return secp256k1Curve
+}
+
+func (s secp256k1Scheme) GenerateKey() (*ecdsa.PrivateKey, error) {
+	d := make([]byte, 32)
+	for {
+		if _, err := rand.Read(d); err != nil {
+			return nil, err
+		}
+		if priv, err := NewPrivateKey(secp256k1Curve, d); err == nil {
+			return priv, nil
+		}
+	}
+}
+
+// PublicKey 33字节压缩公钥 前缀0x02/0x03表示y的奇偶性
+func (secp256k1Scheme) PublicKey(pub *ecdsa.PublicKey) []byte {
+	return elliptic.MarshalCompressed(secp256k1Curve, pub.X, pub.Y)
+}
+
+func (secp256k1Scheme) IsPublicKey(pubKey []byte) bool {
+	return len(pubKey) == 33 && (pubKey[0] == 2 || pubKey[0] == 3)
+}
+
+// ParseSecp256k1PublicKey 解析压缩公钥
+func ParseSecp256k1PublicKey(pubKey []byte) (*ecdsa.PublicKey, bool) {
+	pub, ok := parseSecp256k1PublicKey(pubKey)
+	if !ok {
+		return nil, false
+	}
+	return pub.ToECDSA(), true
+}
+
+func parseSecp256k1PublicKey(pubKey []byte) (*secp256k1.PublicKey, bool) {
+	if !Secp256k1.IsPublicKey(pubKey) {
+		return nil, false
+	}
+	pub, err := secp256k1.ParsePubKey(pubKey)
+	if err != nil {
+		return nil, false
+	}
+	return pub, true
+}
+
+// Sign 签名 随机数按RFC 6979由私钥和哈希确定性生成 s取较小值 输出DER编码
+func (secp256k1Scheme) Sign(priv *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	key, ok := toSecp256k1PrivateKey(priv)
+	if !ok {
+		return nil, ErrInvalidPrivateKey
+	}
+	defer key.Zero()
+	return dcrecdsa.Sign(key, hash).Serialize(), nil
+}
+
+// Verify 验证签名 拒绝s较大的签名 避免签名延展性
+func (secp256k1Scheme) Verify(pubKey []byte, hash []byte, sig []byte) bool {
+	pub, ok := parseSecp256k1PublicKey(pubKey)
+	if !ok {
+		return false
+	}
+	r, s, ok := parseSignature(sig)
+	if !ok {
+		return false
+	}
+	rScalar, ok := toModNScalar(r)
+	if !ok {
+		return false
+	}
+	sScalar, ok := toModNScalar(s)
+	if !ok || sScalar.IsOverHalfOrder() {
+		return false
+	}
+	return dcrecdsa.NewSignature(rScalar, sScalar).Verify(hash, pub)
+}
+
+// 转换为模曲线阶的标量 要求在[1, n)范围内
+func toModNScalar(v *big.Int) (*secp256k1.ModNScalar, bool) {
+	if v.Sign() <= 0 || v.BitLen() > 256 {
+		return nil, false
+	}
+	var scalar secp256k1.ModNScalar
+	if overflow := scalar.SetByteSlice(v.Bytes()); overflow {
+		return nil, false
+	}
+	return &scalar, true
+}
+
+// P-256签名方案 兼容早期版本的编码
+type p256Scheme struct{}
+
+func (p256Scheme) Name() string {
+	return "p256"
+}
+
+func (p256Scheme) Curve() elliptic.Curve {
+	return elliptic.P256()
+}
+
+// GenerateKey 坐标有前导零时拼接的公钥无法按长度的一半拆分 重新生成
+func (p p256Scheme) GenerateKey() (*ecdsa.PrivateKey, error) {
+	for {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.PublicKey(&priv.PublicKey)) == 64 {
+			return priv, nil
+		}
+	}
+}
+
+// PublicKey X和Y直接拼接 与早期版本生成的地址保持一致
+func (p256Scheme) PublicKey(pub *ecdsa.PublicKey) []byte {
+	return append(pub.X.Bytes(), pub.Y.Bytes()...)
+}
+
+func (p256Scheme) IsPublicKey(pubKey []byte) bool {
+	return len(pubKey) != 33 && len(pubKey) <= 64 && len(pubKey)%2 == 0
+}
+
+// Sign 输出64字节定长签名 可以按长度的一半拆分
+func (p256Scheme) Sign(priv *ecdsa.PrivateKey, hash []byte) ([]byte, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, priv, hash)
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return sig, nil
+}
+
+// Verify 公钥和签名均按长度的一半拆分
+func (p256Scheme) Verify(pubKey []byte, hash []byte, sig []byte) bool {
+	if len(pubKey) == 0 || len(sig) == 0 {
+		return false
+	}
+	x := new(big.Int).SetBytes(pubKey[:len(pubKey)/2])
+	y := new(big.Int).SetBytes(pubKey[len(pubKey)/2:])
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:len(sig)/2])
+	s := new(big.Int).SetBytes(sig[len(sig)/2:])
+	return ecdsa.Verify(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, hash, r, s)
+}
+
+// DER编码的签名结构
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// 解析DER编码或64字节定长签名
+func parseSignature(sig []byte) (*big.Int, *big.Int, bool) {
+	if len(sig) == 64 {
+		return new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]), true
+	}
+	var parsed ecdsaSignature
+	rest, err := asn1.Unmarshal(sig, &parsed)
+	if err != nil || len(rest) != 0 || parsed.R == nil || parsed.S == nil {
+		return nil, nil, false
+	}
+	// 只接受规范编码 防止同一签名有多种编码
+	canonical, err := asn1.Marshal(parsed)
+	if err != nil || string(canonical) != string(sig) {
+		return nil, nil, false
+	}
+	return parsed.R, parsed.S, true
+}
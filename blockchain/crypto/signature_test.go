@@ -0,0 +1,185 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 私钥为1 消息为"Satoshi Nakamoto"的RFC 6979签名
+func TestSecp256k1SignVector(t *testing.T) {
+	priv, err := NewPrivateKey(S256(), []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("Satoshi Nakamoto"))
+	sig, err := Sign(priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := asn1.Marshal(ecdsaSignature{
+		new(big.Int).SetBytes(mustHex(t, "934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8")),
+		new(big.Int).SetBytes(mustHex(t, "2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5")),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, want) {
+		t.Fatalf("Sign() = %x, want %x", sig, want)
+	}
+	pubKey, err := PublicKeyBytes(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(pubKey) != "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" {
+		t.Fatalf("public key = %x, want the generator", pubKey)
+	}
+	if !Verify(pubKey, hash[:], sig) {
+		t.Fatal("the signature does not verify")
+	}
+}
+
+func TestSecp256k1Verify(t *testing.T) {
+	priv, err := Secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := Secp256k1.PublicKey(&priv.PublicKey)
+	hash := sha256.Sum256([]byte("message"))
+	sig, err := Secp256k1.Sign(priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, ok := parseSignature(sig)
+	if !ok {
+		t.Fatalf("signature %x is not DER encoded", sig)
+	}
+	n := S256().Params().N
+	fixed := make([]byte, 64)
+	r.FillBytes(fixed[:32])
+	s.FillBytes(fixed[32:])
+	highS, _ := asn1.Marshal(ecdsaSignature{r, new(big.Int).Sub(n, s)})
+	other, _ := Secp256k1.GenerateKey()
+	otherHash := sha256.Sum256([]byte("other message"))
+
+	tests := []struct {
+		name   string
+		pubKey []byte
+		hash   []byte
+		sig    []byte
+		valid  bool
+	}{
+		{"DER", pubKey, hash[:], sig, true},
+		{"fixed length", pubKey, hash[:], fixed, true},
+		{"high s", pubKey, hash[:], highS, false},
+		{"other message", pubKey, otherHash[:], sig, false},
+		{"other key", Secp256k1.PublicKey(&other.PublicKey), hash[:], sig, false},
+		{"trailing data", pubKey, hash[:], append(append([]byte{}, sig...), 0), false},
+		{"zero r", pubKey, hash[:], make([]byte, 64), false},
+		{"point not on curve", append([]byte{2}, bytes.Repeat([]byte{0xff}, 32)...), hash[:], sig, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := Verify(test.pubKey, test.hash, test.sig); valid != test.valid {
+				t.Fatalf("Verify() = %v, want %v", valid, test.valid)
+			}
+		})
+	}
+}
+
+// 签名是确定性的 s总是取较小值
+func TestSecp256k1SignLowS(t *testing.T) {
+	priv, err := Secp256k1.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	halfN := new(big.Int).Rsh(S256().Params().N, 1)
+	for i := 0; i < 32; i++ {
+		hash := sha256.Sum256([]byte{byte(i)})
+		sig, err := Secp256k1.Sign(priv, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, _ := Secp256k1.Sign(priv, hash[:])
+		if !bytes.Equal(sig, again) {
+			t.Fatal("signing is not deterministic")
+		}
+		if _, s, _ := parseSignature(sig); s.Cmp(halfN) > 0 {
+			t.Fatalf("signature %x has a high s", sig)
+		}
+	}
+}
+
+func TestNewPrivateKey(t *testing.T) {
+	n := S256().Params().N
+	tests := []struct {
+		name  string
+		d     []byte
+		valid bool
+	}{
+		{"one", []byte{1}, true},
+		{"order minus one", new(big.Int).Sub(n, big.NewInt(1)).Bytes(), true},
+		{"zero", make([]byte, 32), false},
+		{"order", n.Bytes(), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			priv, err := NewPrivateKey(S256(), test.d)
+			if (err == nil) != test.valid {
+				t.Fatalf("NewPrivateKey() = %v, valid %v", err, test.valid)
+			}
+			if err == nil && !S256().IsOnCurve(priv.X, priv.Y) {
+				t.Fatal("public key is not on the curve")
+			}
+		})
+	}
+}
+
+// 早期版本的P-256密钥仍可签名和验证
+func TestP256Scheme(t *testing.T) {
+	priv, err := P256.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := PublicKeyBytes(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if SchemeOf(pubKey) != P256 {
+		t.Fatalf("scheme of %x is %s", pubKey, SchemeOf(pubKey).Name())
+	}
+	hash := sha256.Sum256([]byte("message"))
+	sig, err := Sign(priv, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(pubKey, hash[:], sig) {
+		t.Fatal("the signature does not verify")
+	}
+	if Secp256k1.Verify(pubKey, hash[:], sig) {
+		t.Fatal("secp256k1 accepts a P-256 key")
+	}
+}
+
+func BenchmarkSecp256k1Sign(b *testing.B) {
+	priv, err := Secp256k1.GenerateKey()
+	if err != nil {
+		b.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("message"))
+	for i := 0; i < b.N; i++ {
+		Secp256k1.Sign(priv, hash[:])
+	}
+}
@@ -0,0 +1,199 @@
+package gcs
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// Golomb编码集合(GCS) 概率性的集合成员检查 只会误判存在 不会漏判
+// N个元素的SipHash映射到[0, N*M)后排序 相邻差值用参数P的Golomb-Rice编码保存
+// 误判率约为1/M 每个元素约占P+2位 远小于元素本身
+
+const (
+	P = 19     // Golomb-Rice编码的余数位数
+	M = 784931 // 误判率的倒数
+)
+
+var ErrCorruptFilter = errors.New("corrupt filter data")
+
+// Filter Golomb编码集合
+type Filter struct {
+	N    uint32 // 元素个数
+	Data []byte // 排序后哈希差值的编码
+}
+
+// 元素的哈希映射到[0, f) 乘法取高位代替取模
+func hashToRange(key [KeySize]byte, item []byte, f uint64) uint64 {
+	hi, _ := bits.Mul64(SipHash(key, item), f)
+	return hi
+}
+
+// 元素映射后排序的值
+func sortedValues(key [KeySize]byte, items [][]byte, f uint64) []uint64 {
+	values := make([]uint64, 0, len(items))
+	for _, item := range items {
+		values = append(values, hashToRange(key, item, f))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// Build 以key构造元素集合的过滤器 重复的元素只计一次
+func Build(key [KeySize]byte, items [][]byte) *Filter {
+	seen := make(map[string]bool)
+	var unique [][]byte
+	for _, item := range items {
+		if !seen[string(item)] {
+			seen[string(item)] = true
+			unique = append(unique, item)
+		}
+	}
+	f := &Filter{N: uint32(len(unique))}
+	w := &bitWriter{}
+	last := uint64(0)
+	for _, value := range sortedValues(key, unique, uint64(f.N)*M) {
+		delta := value - last
+		last = value
+		// 商用一元编码 余数保存低P位
+		for q := delta >> P; q > 0; q-- {
+			w.writeBit(1)
+		}
+		w.writeBit(0)
+		w.writeBits(delta, P)
+	}
+	f.Data = w.bytes
+	return f
+}
+
+// 依次解码集合中排序后的值
+type decoder struct {
+	r    *bitReader
+	left uint32
+	last uint64
+}
+
+func (f *Filter) decoder() *decoder {
+	return &decoder{r: &bitReader{data: f.Data}, left: f.N}
+}
+
+// 下一个值 没有更多值时返回io.EOF
+func (d *decoder) next() (uint64, error) {
+	if d.left == 0 {
+		return 0, io.EOF
+	}
+	q := uint64(0)
+	for {
+		bit, err := d.r.readBit()
+		if err != nil {
+			return 0, ErrCorruptFilter
+		}
+		if bit == 0 {
+			break
+		}
+		q++
+	}
+	rem, err := d.r.readBits(P)
+	if err != nil {
+		return 0, ErrCorruptFilter
+	}
+	d.left--
+	d.last += q<<P | rem
+	return d.last, nil
+}
+
+// Match 元素是否可能在集合中
+func (f *Filter) Match(key [KeySize]byte, item []byte) (bool, error) {
+	return f.MatchAny(key, [][]byte{item})
+}
+
+// MatchAny 任一元素是否可能在集合中 排序后与集合的值归并比较
+func (f *Filter) MatchAny(key [KeySize]byte, items [][]byte) (bool, error) {
+	if f.N == 0 || len(items) == 0 {
+		return false, nil
+	}
+	values := sortedValues(key, items, uint64(f.N)*M)
+	d := f.decoder()
+	value, err := d.next()
+	for i := 0; err == nil && i < len(values); {
+		switch {
+		case values[i] == value:
+			return true, nil
+		case values[i] < value:
+			i++
+		default:
+			value, err = d.next()
+		}
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return false, nil
+}
+
+// Bytes 过滤器序列化 元素个数(变长整数)之后为编码数据
+func (f *Filter) Bytes() []byte {
+	buf := make([]byte, binary.MaxVarintLen32, binary.MaxVarintLen32+len(f.Data))
+	n := binary.PutUvarint(buf, uint64(f.N))
+	return append(buf[:n], f.Data...)
+}
+
+// FromBytes 过滤器反序列化
+func FromBytes(data []byte) (*Filter, error) {
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > 1<<32-1 {
+		return nil, ErrCorruptFilter
+	}
+	return &Filter{N: uint32(n), Data: data[size:]}, nil
+}
+
+// 按位写入 高位在前
+type bitWriter struct {
+	bytes []byte
+	used  uint // 最后一个字节已使用的位数 0表示需要新字节
+}
+
+func (w *bitWriter) writeBit(bit uint64) {
+	if w.used == 0 {
+		w.bytes = append(w.bytes, 0)
+		w.used = 8
+	}
+	w.used--
+	w.bytes[len(w.bytes)-1] |= byte(bit&1) << w.used
+}
+
+// 写入value的低n位
+func (w *bitWriter) writeBits(value uint64, n uint) {
+	for i := n; i > 0; i-- {
+		w.writeBit(value >> (i - 1))
+	}
+}
+
+// 按位读取
+type bitReader struct {
+	data []byte
+	pos  uint // 已读取的位数
+}
+
+func (r *bitReader) readBit() (uint64, error) {
+	if r.pos >= uint(len(r.data))*8 {
+		return 0, io.EOF
+	}
+	bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+	r.pos++
+	return uint64(bit), nil
+}
+
+func (r *bitReader) readBits(n uint) (uint64, error) {
+	value := uint64(0)
+	for i := uint(0); i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<1 | bit
+	}
+	return value, nil
+}
@@ -0,0 +1,127 @@
+package gcs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+var testKey = [KeySize]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// n个20字节的随机元素 固定种子使结果可以重现
+func randomItems(r *rand.Rand, n int) [][]byte {
+	items := make([][]byte, n)
+	for i := range items {
+		items[i] = make([]byte, 20)
+		r.Read(items[i])
+	}
+	return items
+}
+
+func TestFilterMatch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	members := randomItems(r, 1000)
+	others := randomItems(r, 3)
+	filter := Build(testKey, append(members, members[0], members[1]))
+	if filter.N != uint32(len(members)) {
+		t.Fatalf("N = %d, want %d without duplicates", filter.N, len(members))
+	}
+	for i, member := range members {
+		if ok, err := filter.Match(testKey, member); !ok || err != nil {
+			t.Fatalf("Match(member %d) = %v, %v", i, ok, err)
+		}
+	}
+
+	otherKey := [KeySize]byte{1}
+	tests := []struct {
+		name   string
+		filter *Filter
+		key    [KeySize]byte
+		items  [][]byte
+		match  bool
+	}{
+		{"one member among others", filter, testKey, append(others[:2:2], members[500]), true},
+		{"last member", filter, testKey, [][]byte{members[len(members)-1]}, true},
+		{"no items", filter, testKey, nil, false},
+		{"empty filter", Build(testKey, nil), testKey, members[:10], false},
+		{"filter key", Build(otherKey, others), otherKey, others, true},
+		{"other key", Build(otherKey, others), testKey, others, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if ok, err := test.filter.MatchAny(test.key, test.items); ok != test.match || err != nil {
+				t.Fatalf("MatchAny() = %v, %v, want %v", ok, err, test.match)
+			}
+		})
+	}
+}
+
+func TestFilterBytes(t *testing.T) {
+	filter := Build(testKey, randomItems(rand.New(rand.NewSource(2)), 100))
+	decoded, err := FromBytes(filter.Bytes())
+	if err != nil || decoded.N != filter.N || !bytes.Equal(decoded.Data, filter.Data) {
+		t.Fatalf("FromBytes(Bytes()) = %+v, %v", decoded, err)
+	}
+	empty, err := FromBytes(Build(testKey, nil).Bytes())
+	if err != nil || empty.N != 0 {
+		t.Fatalf("FromBytes(empty filter) = %+v, %v", empty, err)
+	}
+
+	// 缺少元素个数或个数超过32位
+	for _, data := range [][]byte{nil, {0x80}, {0xff, 0xff, 0xff, 0xff, 0x1f}} {
+		if _, err := FromBytes(data); !errors.Is(err, ErrCorruptFilter) {
+			t.Fatalf("FromBytes(%x) = %v, want %v", data, err, ErrCorruptFilter)
+		}
+	}
+	// 元素个数多于编码数据时匹配失败
+	truncated := &Filter{N: filter.N, Data: filter.Data[:len(filter.Data)/2]}
+	if _, err := truncated.MatchAny(testKey, [][]byte{{0xff}, {0xfe}, {0xfd}}); !errors.Is(err, ErrCorruptFilter) {
+		t.Fatalf("MatchAny(truncated filter) = %v, want %v", err, ErrCorruptFilter)
+	}
+}
+
+// 每个元素约占P+2位 误判率约为1/M
+func TestFilterFalsePositives(t *testing.T) {
+	const items, queries, batch = 10000, 2000, 100
+	r := rand.New(rand.NewSource(3))
+	filter := Build(testKey, randomItems(r, items))
+	if bitsPerItem := float64(len(filter.Data)*8) / items; bitsPerItem < P+1 || bitsPerItem > P+3 {
+		t.Fatalf("%.2f bits per item, want about %d", bitsPerItem, P+2)
+	}
+	falsePositives := 0
+	for i := 0; i < queries; i++ {
+		if ok, err := filter.MatchAny(testKey, randomItems(r, batch)); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			falsePositives++
+		}
+	}
+	if expected := float64(queries*batch) / M; float64(falsePositives) > expected*10+5 {
+		t.Fatalf("%d false positives in %d queries, expected about %.2f", falsePositives, queries*batch, expected)
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	for _, n := range []int{100, 10000} {
+		items := randomItems(rand.New(rand.NewSource(4)), n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Build(testKey, items)
+			}
+		})
+	}
+}
+
+func BenchmarkMatchAny(b *testing.B) {
+	r := rand.New(rand.NewSource(5))
+	filter := Build(testKey, randomItems(r, 10000))
+	query := randomItems(r, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := filter.MatchAny(testKey, query); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package gcs
+
+import "testing"
+
+// SipHash-2-4参考实现的测试向量 密钥为00..0f 消息为00..(n-1)
+func TestSipHash(t *testing.T) {
+	var key [KeySize]byte
+	for i := range key {
+		key[i] = byte(i)
+	}
+	vectors := []struct {
+		length int
+		hash   uint64
+	}{
+		{0, 0x726fdb47dd0e0e31},
+		{1, 0x74f839c593dc67fd},
+		{2, 0x0d6c8009d9a94f5a},
+		{3, 0x85676696d7fb7e2d},
+		{4, 0xcf2794e0277187b7},
+		{5, 0x18765564cd99a68d},
+		{6, 0xcbc9466e58fee3ce},
+		{7, 0xab0200f58b01d137},
+		{8, 0x93f5f5799a932462},
+		{9, 0x9e0082df0ba9e4b0},
+		{15, 0xa129ca6149be45e5},
+	}
+	for _, vector := range vectors {
+		message := make([]byte, vector.length)
+		for i := range message {
+			message[i] = byte(i)
+		}
+		if hash := SipHash(key, message); hash != vector.hash {
+			t.Errorf("SipHash(%d bytes) = %x, want %x", vector.length, hash, vector.hash)
+		}
+	}
+}
@@ -4,5 +4,8 @@ go 1.18
 
 require (
 	github.com/boltdb/bolt v1.3.1
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0
 	golang.org/x/crypto v0.1.0
 )
+
+require golang.org/x/sys v0.1.0 // indirect
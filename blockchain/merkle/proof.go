@@ -0,0 +1,91 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+// Merkle证明
+// 证明由叶节点到根节点路径上每一层的兄弟节点组成 验证方只需交易哈希和证明即可算出根哈希
+// 与区块头中的根哈希比较 不必下载区块中的其他交易
+// 证明的层数与NewTree相同 节点数为奇数的层中 最后一个节点的兄弟节点是自身的复制
+
+var ErrLeafNotFound = errors.New("leaf index out of range")
+
+// ProofStep 路径上的一层 各层的Left依次为叶节点位置由低到高的二进制位
+type ProofStep struct {
+	Sibling []byte // 兄弟节点哈希 为空表示兄弟节点是自身的复制
+	Left    bool   // 兄弟节点是否在左侧
+}
+
+// Proof 叶节点的Merkle证明
+type Proof struct {
+	Leaf  []byte // 叶节点数据(交易哈希)
+	Index int    // 叶节点位置
+	Steps []ProofStep
+}
+
+// NewProof 生成txHashes中第index个叶节点的证明 层数与NewTree相同
+func NewProof(txHashes [][]byte, index int) (*Proof, error) {
+	if index < 0 || index >= len(txHashes) {
+		return nil, ErrLeafNotFound
+	}
+	proof := &Proof{Leaf: txHashes[index], Index: index}
+	level := txHashes
+	for len(level) > 1 {
+		n := len(level)
+		if n%2 != 0 {
+			level = append(level[:n:n], level[n-1])
+		}
+		sibling := index ^ 1
+		step := ProofStep{Left: sibling < index}
+		if sibling < n {
+			step.Sibling = level[sibling]
+		}
+		proof.Steps = append(proof.Steps, step)
+
+		parents := make([][]byte, 0, len(level)/2)
+		for j := 0; j < len(level); j += 2 {
+			parents = append(parents, hashPair(level[j], level[j+1]))
+		}
+		level = parents
+		index /= 2
+	}
+	return proof, nil
+}
+
+// Root 由证明计算根哈希
+func (p *Proof) Root() []byte {
+	hash := p.Leaf
+	for _, step := range p.Steps {
+		sibling := step.Sibling
+		if sibling == nil {
+			sibling = hash
+		}
+		if step.Left {
+			hash = hashPair(sibling, hash)
+		} else {
+			hash = hashPair(hash, sibling)
+		}
+	}
+	return hash
+}
+
+// Verify 证明计算出的根哈希是否与root相同 各层兄弟节点的方向须与叶节点位置的二进制位一致
+func (p *Proof) Verify(root []byte) bool {
+	if p.Index < 0 {
+		return false
+	}
+	for i, step := range p.Steps {
+		if step.Left != (p.Index>>uint(i)&1 == 1) {
+			return false
+		}
+	}
+	return bytes.Equal(p.Root(), root)
+}
+
+func hashPair(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+	return hash[:]
+}
@@ -0,0 +1,92 @@
+package merkle
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// 每个叶节点的证明都能验证 层数为ceil(log2(n)) 不构建树的证明与由树生成的证明一致
+func TestProof(t *testing.T) {
+	leaves := testLeaves(64)
+	for n := 1; n <= len(leaves); n++ {
+		tree := NewTree(leaves[:n])
+		levels := 0
+		for 1<<uint(levels) < n {
+			levels++
+		}
+		for index := 0; index < n; index++ {
+			proof, err := tree.Proof(index)
+			if err != nil {
+				t.Fatalf("%d leaves: Proof(%d) = %v", n, index, err)
+			}
+			if len(proof.Steps) != levels {
+				t.Fatalf("%d leaves: proof %d has %d steps, want %d", n, index, len(proof.Steps), levels)
+			}
+			if !tree.Verify(proof) {
+				t.Fatalf("%d leaves: proof %d does not verify", n, index)
+			}
+			standalone, err := NewProof(leaves[:n], index)
+			if err != nil || !standalone.Verify(tree.Root.Data) {
+				t.Fatalf("%d leaves: standalone proof %d does not verify: %v", n, index, err)
+			}
+		}
+	}
+}
+
+func TestProofRejected(t *testing.T) {
+	leaves := testLeaves(5)
+	tree := NewTree(leaves)
+	other := NewTree(testLeaves(6))
+	tests := []struct {
+		name   string
+		change func(p *Proof)
+		tree   *Tree
+	}{
+		{"other leaf", func(p *Proof) { p.Leaf = leaves[3] }, tree},
+		{"other index", func(p *Proof) { p.Index = 3 }, tree},
+		{"negative index", func(p *Proof) { p.Index = -2 }, tree},
+		{"flipped direction", func(p *Proof) { p.Steps[0].Left = !p.Steps[0].Left }, tree},
+		{"changed sibling", func(p *Proof) { p.Steps[1].Sibling = leaves[0] }, tree},
+		{"missing step", func(p *Proof) { p.Steps = p.Steps[:len(p.Steps)-1] }, tree},
+		{"other tree", func(p *Proof) {}, other},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proof, err := tree.Proof(2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.change(proof)
+			if test.tree.Verify(proof) {
+				t.Fatal("the changed proof verifies")
+			}
+		})
+	}
+}
+
+func TestProofOutOfRange(t *testing.T) {
+	leaves := testLeaves(3)
+	for _, index := range []int{-1, 3} {
+		if _, err := NewTree(leaves).Proof(index); !errors.Is(err, ErrLeafNotFound) {
+			t.Fatalf("Proof(%d) = %v, want %v", index, err, ErrLeafNotFound)
+		}
+		if _, err := NewProof(leaves, index); !errors.Is(err, ErrLeafNotFound) {
+			t.Fatalf("NewProof(%d) = %v, want %v", index, err, ErrLeafNotFound)
+		}
+	}
+}
+
+func BenchmarkProof(b *testing.B) {
+	for _, n := range []int{100, 5000} {
+		tree := NewTree(randomLeaves(b, n))
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				proof, err := tree.Proof(i % n)
+				if err != nil || !proof.Verify(tree.Root.Data) {
+					b.Fatalf("proof %d failed: %v", i%n, err)
+				}
+			}
+		})
+	}
+}
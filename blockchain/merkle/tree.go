@@ -1,18 +1,23 @@
 package merkle
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+)
 
 // Merkle树是一种二叉树结构 由一个根节点 一组中间节点和叶节点组成树
 // 所有节点都存储了哈希值
-// 叶节点: 对于一个区块而言，每一笔交易数据 进行哈希运算后 得到的哈希值就是叶节点
+// 叶节点: 对于一个区块而言 每一笔交易的哈希直接作为叶节点 不再重复哈希
 // 中间节点: 子节点两两匹配 子节点哈希值合并成新的字符串 对合并结果再次进行哈希运算 得到的哈希值
-// 根节点：有且只有一个 为终止节点
-// Merkle树是从下往上逐层计算的
-// 每个中间节点是根据相邻的两个叶子节点组合计算得出的
-// 根节点是根据两个中间节点组合计算得出的
+// 根节点：有且只有一个 为终止节点 只有一个叶节点时根节点就是该叶节点
+// Merkle树是从下往上逐层计算的 n个叶节点共ceil(log2(n))层中间节点
+// 某一层节点数为奇数时 复制最后一个节点补齐
+// 补齐使交易列表[a b c]与[a b c c]的根哈希相同 后者在某一层出现相同的相邻节点对 构建时标记为篡改
 
 type Tree struct {
-	Root *Node // 根节点
+	Root    *Node    // 根节点
+	Leaves  [][]byte // 叶节点数据(交易哈希) 不含补齐的复制
+	Mutated bool     // 存在相同的相邻节点对 叶节点列表可能由复制末尾元素篡改而来
 }
 
 type Node struct {
@@ -21,50 +26,93 @@ type Node struct {
 	Data  []byte
 }
 
-// MakeNode 创建Merkle节点
+// MakeNode 创建Merkle节点 叶节点直接使用data 中间节点为左右节点数据拼接后的哈希
 func MakeNode(left, right *Node, data []byte) *Node {
-	node := &Node{}
-	// 判断叶子节点
+	node := &Node{Left: left, Right: right}
 	if left == nil && right == nil {
-		hash := sha256.Sum256(data)
-		node.Data = hash[:]
+		node.Data = data
 	} else {
-		// 将左右节点数据拼接取哈希值
-		prevHashes := append(left.Data, right.Data...)
-		hash := sha256.Sum256(prevHashes)
-		node.Data = hash[:]
+		node.Data = hashPair(left.Data, right.Data)
 	}
-	node.Left = left
-	node.Right = right
 	return node
 }
 
-// NewTree 创建Merkle树
+// NewTree 创建Merkle树 没有叶节点时根哈希为全零
 func NewTree(txHashes [][]byte) *Tree {
-	var nodes []Node
-	if len(txHashes)%2 != 0 {
-		txHashes = append(txHashes, txHashes[len(txHashes)-1])
+	tree := &Tree{Leaves: txHashes}
+	if len(txHashes) == 0 {
+		tree.Root = &Node{Data: make([]byte, sha256.Size)}
+		return tree
 	}
 
 	// 生成叶子节点
+	nodes := make([]*Node, 0, len(txHashes)+1)
 	for _, data := range txHashes {
-		node := MakeNode(nil, nil, data)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, MakeNode(nil, nil, data))
 	}
 
-	// 自下而上计算中间节点 直至根节点
-	for i := 0; i < len(txHashes); i++ {
-		var parentNodes []Node
+	// 自下而上逐层计算中间节点 直至只剩根节点
+	for len(nodes) > 1 {
+		n := len(nodes)
+		if n%2 != 0 {
+			nodes = append(nodes, nodes[n-1])
+		}
+		parents := make([]*Node, 0, len(nodes)/2+1)
 		for j := 0; j < len(nodes); j += 2 {
-			// 通过相邻两个节点生成一个父节点
-			node := MakeNode(&nodes[j], &nodes[j+1], nil)
-			parentNodes = append(parentNodes, *node) // 放入父节点
+			// 补齐之外的相同节点对只能来自重复的交易
+			if j+1 < n && bytes.Equal(nodes[j].Data, nodes[j+1].Data) {
+				tree.Mutated = true
+			}
+			parents = append(parents, MakeNode(nodes[j], nodes[j+1], nil))
+		}
+		nodes = parents
+	}
+	tree.Root = nodes[0]
+	return tree
+}
+
+// Index 叶节点数据在树中的位置 不存在时返回-1
+func (t *Tree) Index(leaf []byte) int {
+	for i, data := range t.Leaves {
+		if bytes.Equal(data, leaf) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Proof 生成第index个叶节点的包含证明 由根节点按位置的二进制位逐层向下 只需访问路径上的节点
+func (t *Tree) Proof(index int) (*Proof, error) {
+	if index < 0 || index >= len(t.Leaves) {
+		return nil, ErrLeafNotFound
+	}
+	levels := 0
+	for node := t.Root; node.Left != nil; node = node.Left {
+		levels++
+	}
+	steps := make([]ProofStep, levels)
+	node := t.Root
+	for level := levels - 1; level >= 0; level-- {
+		left := index>>uint(level)&1 == 1
+		child, sibling := node.Left, node.Right
+		if left {
+			child, sibling = node.Right, node.Left
 		}
-		if len(parentNodes)%2 != 0 {
-			parentNodes = append(parentNodes, parentNodes[len(parentNodes)-1])
+		step := ProofStep{Left: left}
+		// 补齐的节点与自身共用同一个节点
+		if sibling != child {
+			step.Sibling = sibling.Data
 		}
-		nodes = parentNodes
+		steps[level] = step
+		node = child
+	}
+	return &Proof{Leaf: t.Leaves[index], Index: index, Steps: steps}, nil
+}
+
+// Verify 证明是否属于该树 叶节点须在证明所述的位置上
+func (t *Tree) Verify(p *Proof) bool {
+	if p.Index < 0 || p.Index >= len(t.Leaves) || !bytes.Equal(t.Leaves[p.Index], p.Leaf) {
+		return false
 	}
-	tree := Tree{&nodes[0]}
-	return &tree // 返回根节点
+	return p.Verify(t.Root.Data)
 }
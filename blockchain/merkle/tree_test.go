@@ -0,0 +1,90 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+// n个由序号哈希得到的叶节点
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		hash := sha256.Sum256([]byte(fmt.Sprint(i)))
+		leaves[i] = hash[:]
+	}
+	return leaves
+}
+
+func TestNewTree(t *testing.T) {
+	leaves := testLeaves(5)
+	a, b, c, d, e := leaves[0], leaves[1], leaves[2], leaves[3], leaves[4]
+	pair := func(left, right []byte) []byte {
+		hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+		return hash[:]
+	}
+	tests := []struct {
+		name    string
+		leaves  [][]byte
+		root    []byte
+		mutated bool
+	}{
+		{"no leaves", nil, make([]byte, sha256.Size), false},
+		{"one leaf", [][]byte{a}, a, false},
+		{"two leaves", [][]byte{a, b}, pair(a, b), false},
+		{"odd leaves", [][]byte{a, b, c}, pair(pair(a, b), pair(c, c)), false},
+		{"duplicated last leaf", [][]byte{a, b, c, c}, pair(pair(a, b), pair(c, c)), true},
+		{"four leaves", [][]byte{a, b, c, d}, pair(pair(a, b), pair(c, d)), false},
+		{"odd level", [][]byte{a, b, c, d, e}, pair(pair(pair(a, b), pair(c, d)), pair(pair(e, e), pair(e, e))), false},
+		{"duplicated odd level", [][]byte{a, b, c, d, e, e}, pair(pair(pair(a, b), pair(c, d)), pair(pair(e, e), pair(e, e))), true},
+		{"duplicated pair", [][]byte{a, b, a, b}, pair(pair(a, b), pair(a, b)), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tree := NewTree(test.leaves)
+			if !bytes.Equal(tree.Root.Data, test.root) {
+				t.Fatalf("root = %x, want %x", tree.Root.Data, test.root)
+			}
+			if tree.Mutated != test.mutated {
+				t.Fatalf("mutated = %v, want %v", tree.Mutated, test.mutated)
+			}
+		})
+	}
+}
+
+func TestTreeIndex(t *testing.T) {
+	leaves := testLeaves(3)
+	tree := NewTree(leaves)
+	for i, leaf := range leaves {
+		if index := tree.Index(leaf); index != i {
+			t.Fatalf("Index(leaf %d) = %d", i, index)
+		}
+	}
+	if index := tree.Index(testLeaves(4)[3]); index != -1 {
+		t.Fatalf("Index(unknown leaf) = %d, want -1", index)
+	}
+}
+
+func randomLeaves(b *testing.B, n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = make([]byte, sha256.Size)
+		if _, err := rand.Read(leaves[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return leaves
+}
+
+func BenchmarkNewTree(b *testing.B) {
+	for _, n := range []int{100, 5000} {
+		leaves := randomLeaves(b, n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewTree(leaves)
+			}
+		})
+	}
+}
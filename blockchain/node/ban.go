@@ -0,0 +1,162 @@
+package node
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 封禁列表 持久化到banlist-<NODE_ID>.dat
+// 运行中的节点在文件被命令行修改后会重新加载
+
+const banListFile = "banlist-%s.dat"
+
+// BanEntry 封禁记录
+type BanEntry struct {
+	Addr    string // 节点主机或身份公钥
+	Until   int64  // 解封时间(unix秒)
+	Reason  string // 封禁原因
+	Created int64  // 封禁时间
+}
+
+// BanList 封禁列表
+type BanList struct {
+	mu      sync.Mutex
+	name    string               // 文件名
+	modTime time.Time            // 文件上次修改时间
+	Entries map[string]*BanEntry // 地址->封禁记录
+}
+
+// NewBanList 加载节点的封禁列表
+func NewBanList(nodeId string) *BanList {
+	return NewBanListFile(fmt.Sprintf(banListFile, nodeId))
+}
+
+// NewBanListFile 从指定文件加载封禁列表
+func NewBanListFile(name string) *BanList {
+	list := &BanList{
+		name:    name,
+		Entries: make(map[string]*BanEntry),
+	}
+	list.load()
+	return list
+}
+
+// 从文件中读取封禁列表
+func (l *BanList) load() {
+	info, err := os.Stat(l.name)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Printf("stat the ban list[%s] failed: %v\n", l.name, err)
+		return
+	}
+	content, err := ioutil.ReadFile(l.name)
+	if err != nil {
+		log.Printf("read the ban list[%s] failed: %v\n", l.name, err)
+		return
+	}
+	entries := make(map[string]*BanEntry)
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&entries); err != nil {
+		log.Printf("decode the ban list[%s] failed: %v\n", l.name, err)
+		return
+	}
+	l.Entries = entries
+	l.modTime = info.ModTime()
+}
+
+// 文件被其他进程修改后重新加载
+func (l *BanList) reload() {
+	info, err := os.Stat(l.name)
+	if err != nil {
+		return
+	}
+	if info.ModTime().After(l.modTime) {
+		l.load()
+	}
+}
+
+// 持久化封禁列表
+func (l *BanList) save() {
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(l.Entries); err != nil {
+		log.Panicf("encode the ban list failed: %v\n", err)
+	}
+	if err := ioutil.WriteFile(l.name, content.Bytes(), 0600); err != nil {
+		log.Panicf("save the ban list[%s] failed: %v\n", l.name, err)
+	}
+	if info, err := os.Stat(l.name); err == nil {
+		l.modTime = info.ModTime()
+	}
+}
+
+// Ban 封禁指定地址 duration为封禁时长
+func (l *BanList) Ban(addr string, duration time.Duration, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reload()
+	now := time.Now()
+	l.Entries[addr] = &BanEntry{
+		Addr:    addr,
+		Until:   now.Add(duration).Unix(),
+		Reason:  reason,
+		Created: now.Unix(),
+	}
+	l.save()
+}
+
+// Unban 解除封禁 返回该地址此前是否被封禁
+func (l *BanList) Unban(addr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reload()
+	if _, ok := l.Entries[addr]; !ok {
+		return false
+	}
+	delete(l.Entries, addr)
+	l.save()
+	return true
+}
+
+// IsBanned 判断地址是否处于封禁期
+func (l *BanList) IsBanned(addr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reload()
+	entry, ok := l.Entries[addr]
+	if !ok {
+		return false
+	}
+	if time.Now().Unix() >= entry.Until {
+		// 封禁到期 自动解除
+		delete(l.Entries, addr)
+		l.save()
+		return false
+	}
+	return true
+}
+
+// List 获取未到期的封禁记录 按解封时间排序
+func (l *BanList) List() []*BanEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reload()
+	var entries []*BanEntry
+	now := time.Now().Unix()
+	for _, entry := range l.Entries {
+		if entry.Until > now {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Until < entries[j].Until
+	})
+	return entries
+}
@@ -0,0 +1,263 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 紧凑区块传播
+// 发送方只发送区块头和每笔交易的短ID 接收方使用交易池中的交易重建区块
+// 交易池中缺少的交易通过getblocktxn/blocktxn补齐 重建失败时回退为请求完整区块
+
+const shortIDLength = 6 // 短ID字节数
+
+// CompactStats 紧凑区块统计
+type CompactStats struct {
+	Sent          int64 // 发送的紧凑区块数
+	Received      int64 // 接收的紧凑区块数
+	Reconstructed int64 // 成功重建的区块数
+	Fallbacks     int64 // 回退为请求完整区块的次数
+	TxsRequested  int64 // 向对方请求的缺失交易数
+	BytesSaved    int64 // 与发送完整区块相比节省的字节数
+}
+
+// 等待缺失交易的区块
+type partialBlock struct {
+	from      string
+	header    CmpctBlock
+	txs       []*block.Transaction // 已重建的交易 缺失的位置为nil
+	missing   []int                // 缺失交易的位置
+	received  int                  // 已接收的字节数
+	requested time.Time            // 请求缺失交易的时间
+}
+
+// 计算交易在指定区块中的短ID
+// 短ID与区块哈希相关 避免针对固定短ID构造碰撞
+func shortTxID(blockHash []byte, txHash []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, blockHash...), txHash...))
+	return hash[:shortIDLength]
+}
+
+// 构造紧凑区块 coinbase交易不会出现在对方交易池中 直接随消息发送
+func newCmpctBlock(addrFrom string, b *block.Block) CmpctBlock {
+	cmpct := CmpctBlock{
+		AddrFrom:      addrFrom,
+		TimeStamp:     b.TimeStamp,
+		Hash:          b.Hash,
+		PrevBlockHash: b.PrevBlockHash,
+		Height:        b.Height,
+		Nonce:         b.Nonce,
+	}
+	for i, tx := range b.Txs {
+		if tx.IsCoinbaseTransaction() {
+			cmpct.Prefilled = append(cmpct.Prefilled, PrefilledTx{Index: i, Tx: tx.Serialize()})
+			continue
+		}
+		cmpct.ShortIDs = append(cmpct.ShortIDs, shortTxID(b.Hash, tx.TxHash))
+	}
+	return cmpct
+}
+
+// SendCompactBlock 发送紧凑区块
+// 交易很少的区块 紧凑区块消息不比完整区块消息小 直接发送完整区块
+func (s *Server) SendCompactBlock(toAddress string, b *block.Block) {
+	data := utils.GobEncoder(newCmpctBlock(s.Addr, b))
+	req := append(utils.CommandToBytes(CMDCMPCTBLOCK), data...)
+	if full := blockMessage(s.Addr, b.Serialize()); len(full) <= len(req) {
+		s.SendMessage(toAddress, full)
+		return
+	}
+	atomic.AddInt64(&s.compactStats.Sent, 1)
+	s.SendMessage(toAddress, req)
+}
+
+// SendGetBlockTxn 请求区块中缺失的交易
+func (s *Server) SendGetBlockTxn(toAddress string, blockHash []byte, indexes []int) {
+	data := utils.GobEncoder(GetBlockTxn{AddrFrom: s.Addr, BlockHash: blockHash, Indexes: indexes})
+	req := append(utils.CommandToBytes(GETBLOCKTXN), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendBlockTxn 发送区块中的交易
+func (s *Server) SendBlockTxn(toAddress string, blockHash []byte, txs [][]byte) {
+	data := utils.GobEncoder(BlockTxn{AddrFrom: s.Addr, BlockHash: blockHash, Txs: txs})
+	req := append(utils.CommandToBytes(CMDBLOCKTXN), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// HandleCompactBlock 处理紧凑区块
+func (s *Server) HandleCompactBlock(req []byte) error {
+	var data CmpctBlock
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	atomic.AddInt64(&s.compactStats.Received, 1)
+	if s.Chain.HasBlock(data.Hash) {
+		return nil
+	}
+
+	// 按位置放置预填充交易 其余位置依次对应短ID
+	total := len(data.ShortIDs) + len(data.Prefilled)
+	if total == 0 {
+		return misbehave(ScoreInvalidBlock, "compact block[%x] has no transactions", data.Hash)
+	}
+	txs := make([]*block.Transaction, total)
+	for _, prefilled := range data.Prefilled {
+		if prefilled.Index < 0 || prefilled.Index >= total || txs[prefilled.Index] != nil {
+			return misbehave(ScoreMalformed, "compact block[%x] has an invalid prefilled index %d", data.Hash, prefilled.Index)
+		}
+		tx, err := block.DecodeTransaction(prefilled.Tx)
+		if err != nil {
+			return misbehave(ScoreMalformed, "decode the prefilled transaction failed: %v", err)
+		}
+		txs[prefilled.Index] = tx
+	}
+
+	// 交易池中短ID相同的交易无法区分 视为缺失
+	candidates := make(map[string]*block.Transaction)
+	collisions := make(map[string]bool)
+	for _, tx := range s.Mempool.Txs() {
+		id := hex.EncodeToString(shortTxID(data.Hash, tx.TxHash))
+		if _, ok := candidates[id]; ok {
+			collisions[id] = true
+		}
+		candidates[id] = tx
+	}
+	var missing []int
+	next := 0
+	for i := range txs {
+		if txs[i] != nil {
+			continue
+		}
+		id := hex.EncodeToString(data.ShortIDs[next])
+		next++
+		if tx, ok := candidates[id]; ok && !collisions[id] {
+			txs[i] = tx
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	partial := &partialBlock{from: data.AddrFrom, header: data, txs: txs, missing: missing, received: len(req), requested: time.Now()}
+	if len(missing) == 0 {
+		return s.completeCompactBlock(partial)
+	}
+
+	s.compactMu.Lock()
+	s.partialBlocks[hex.EncodeToString(data.Hash)] = partial
+	s.compactMu.Unlock()
+	atomic.AddInt64(&s.compactStats.TxsRequested, int64(len(missing)))
+	fmt.Printf("compact block[%x] is missing %d transactions, request them from %s\n", data.Hash, len(missing), data.AddrFrom)
+	s.SendGetBlockTxn(data.AddrFrom, data.Hash, missing)
+	return nil
+}
+
+// HandleGetBlockTxn 处理缺失交易请求
+func (s *Server) HandleGetBlockTxn(req []byte) error {
+	var data GetBlockTxn
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	blockBytes := s.Chain.GetBlock(data.BlockHash)
+	if blockBytes == nil {
+		return fmt.Errorf("block[%x] not found", data.BlockHash)
+	}
+	b := block.DeserializeBlock(blockBytes)
+	txs := make([][]byte, 0, len(data.Indexes))
+	for _, index := range data.Indexes {
+		if index < 0 || index >= len(b.Txs) {
+			return misbehave(ScoreMalformed, "block[%x] has no transaction at index %d", data.BlockHash, index)
+		}
+		txs = append(txs, b.Txs[index].Serialize())
+	}
+	s.SendBlockTxn(data.AddrFrom, data.BlockHash, txs)
+	return nil
+}
+
+// HandleBlockTxn 处理缺失交易 补齐后重建区块
+func (s *Server) HandleBlockTxn(req []byte) error {
+	var data BlockTxn
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	key := hex.EncodeToString(data.BlockHash)
+	s.compactMu.Lock()
+	partial, ok := s.partialBlocks[key]
+	if ok {
+		delete(s.partialBlocks, key)
+	}
+	s.compactMu.Unlock()
+	if !ok {
+		return fmt.Errorf("unexpected transactions for block[%x]", data.BlockHash)
+	}
+	if len(data.Txs) != len(partial.missing) {
+		return misbehave(ScoreMalformed, "block[%x]: requested %d transactions, received %d",
+			data.BlockHash, len(partial.missing), len(data.Txs))
+	}
+	for i, index := range partial.missing {
+		tx, err := block.DecodeTransaction(data.Txs[i])
+		if err != nil {
+			return misbehave(ScoreMalformed, "decode the block transaction failed: %v", err)
+		}
+		partial.txs[index] = tx
+	}
+	partial.received += len(req)
+	return s.completeCompactBlock(partial)
+}
+
+// 使用重建的交易组装区块并验证
+// 验证失败可能是短ID碰撞导致 不惩罚对方 改为请求完整区块
+func (s *Server) completeCompactBlock(partial *partialBlock) error {
+	header := partial.header
+	newBlock := &block.Block{
+		TimeStamp:     header.TimeStamp,
+		Hash:          header.Hash,
+		PrevBlockHash: header.PrevBlockHash,
+		Height:        header.Height,
+		Txs:           partial.txs,
+		Nonce:         header.Nonce,
+	}
+	s.chainMu.Lock()
+	if err := s.Chain.ValidateBlock(newBlock); err != nil {
+		s.chainMu.Unlock()
+		var txErr *block.TxError
+		if errors.Is(err, block.ErrInvalidPoW) || errors.As(err, &txErr) {
+			atomic.AddInt64(&s.compactStats.Fallbacks, 1)
+			fmt.Printf("reconstruct compact block[%x] failed: %v, request the full block\n", header.Hash, err)
+			s.SendGetData(partial.from, header.Hash)
+			return nil
+		}
+		return misbehave(ScoreInvalidBlock, "block[%x]: %v", header.Hash, err)
+	}
+	atomic.AddInt64(&s.compactStats.Reconstructed, 1)
+	// 与完整区块消息比较 补齐缺失交易的往返可能超过完整区块 此时不计入节省
+	if saved := len(blockMessage(partial.from, newBlock.Serialize())) - partial.received; saved > 0 {
+		atomic.AddInt64(&s.compactStats.BytesSaved, int64(saved))
+	}
+	fmt.Printf("reconstructed compact block[%x] with %d transactions\n", header.Hash, len(newBlock.Txs))
+	s.acceptBlock(partial.from, newBlock)
+	return nil
+}
+
+// CompactStats 获取紧凑区块统计
+func (s *Server) CompactStats() CompactStats {
+	return CompactStats{
+		Sent:          atomic.LoadInt64(&s.compactStats.Sent),
+		Received:      atomic.LoadInt64(&s.compactStats.Received),
+		Reconstructed: atomic.LoadInt64(&s.compactStats.Reconstructed),
+		Fallbacks:     atomic.LoadInt64(&s.compactStats.Fallbacks),
+		TxsRequested:  atomic.LoadInt64(&s.compactStats.TxsRequested),
+		BytesSaved:    atomic.LoadInt64(&s.compactStats.BytesSaved),
+	}
+}
+
+func (st CompactStats) String() string {
+	return fmt.Sprintf("compact blocks: sent %d, received %d, reconstructed %d, fallbacks %d, txs requested %d, bytes saved %d",
+		st.Sent, st.Received, st.Reconstructed, st.Fallbacks, st.TxsRequested, st.BytesSaved)
+}
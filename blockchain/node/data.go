@@ -1,8 +1,46 @@
 package node
 
+import (
+	"blockchain/block"
+	"blockchain/merkle"
+)
+
+// Version 版本握手消息
 type Version struct {
-	Height   int    // 当前节点区块高度
-	AddrFrom string // 当前节点地址
+	ProtocolVersion int    // 协议版本
+	Services        uint64 // 节点提供的服务
+	Features        uint64 // 节点支持的可选功能
+	GenesisHash     []byte // 创世区块哈希 标识节点所在的链
+	Height          int    // 当前节点区块高度
+	Maturity        int64  // 挖矿奖励成熟度 同一条链的完整节点须一致
+	UserAgent       string // 客户端标识
+	Timestamp       int64  // 发送时间
+	Nonce           uint64 // 随机数 用于检测节点连接自身
+	AddrFrom        string // 当前节点地址
+}
+
+// VerAck 确认收到对方的version
+type VerAck struct {
+	AddrFrom string
+}
+
+// Ping 心跳请求
+type Ping struct {
+	AddrFrom string
+	Nonce    uint64
+}
+
+// Pong 心跳响应 携带ping中的随机数
+type Pong struct {
+	AddrFrom string
+	Nonce    uint64
+}
+
+// Reject 拒绝对方的消息
+type Reject struct {
+	AddrFrom string
+	Command  string // 被拒绝的命令
+	Reason   string // 拒绝原因
 }
 
 type BlockData struct {
@@ -14,12 +52,114 @@ type GetBlocks struct {
 	AddrFrom string
 }
 
+// 清单类型
+const (
+	InvBlock = "block" // 区块 为空时视为区块
+	InvTx    = "tx"    // 交易
+)
+
 type GetData struct {
 	AddrFrom string
-	ID       []byte // 区块哈希
+	Type     string // 清单类型
+	ID       []byte // 区块或交易哈希
 }
 
 type Inv struct {
 	AddrFrom string // 当前节点地址
+	Type     string // 清单类型
 	Hashes   [][]byte
 }
+
+// TxData 交易数据
+type TxData struct {
+	AddrFrom string
+	Tx       []byte // 序列化交易
+}
+
+// PrefilledTx 紧凑区块中直接携带的交易
+type PrefilledTx struct {
+	Index int    // 交易在区块中的位置
+	Tx    []byte // 序列化交易
+}
+
+// CmpctBlock 紧凑区块 由区块头、交易短ID和预填交易组成
+// 接收方通过交易池中的交易还原区块
+type CmpctBlock struct {
+	AddrFrom      string
+	TimeStamp     int64
+	Hash          []byte
+	PrevBlockHash []byte
+	Height        int64
+	Nonce         int64
+	ShortIDs      [][]byte      // 未预填交易的短ID 按区块中顺序排列
+	Prefilled     []PrefilledTx // 预填交易(coinbase)
+}
+
+// GetBlockTxn 请求紧凑区块中缺少的交易
+type GetBlockTxn struct {
+	AddrFrom  string
+	BlockHash []byte
+	Indexes   []int // 交易在区块中的位置
+}
+
+// BlockTxn 响应缺少的交易
+type BlockTxn struct {
+	AddrFrom  string
+	BlockHash []byte
+	Txs       [][]byte // 按请求顺序排列的序列化交易
+}
+
+// GetTxProof 请求交易的包含证明
+type GetTxProof struct {
+	AddrFrom string
+	TxHash   []byte
+}
+
+// MerkleBlock 区块头和其中一笔交易的Merkle证明
+type MerkleBlock struct {
+	AddrFrom string
+	Header   *block.BlockHeader
+	Proof    *merkle.Proof
+}
+
+// GetHeaders 请求定位哈希之后的主链区块头
+type GetHeaders struct {
+	AddrFrom string
+	Locator  [][]byte // 从新到旧排列的区块哈希
+}
+
+// Headers 响应区块头 按高度排列
+type Headers struct {
+	AddrFrom string
+	Headers  []*block.BlockHeader
+}
+
+// GetCFHeaders 请求以StopHash结束的分支上从StartHeight开始的过滤器哈希
+type GetCFHeaders struct {
+	AddrFrom    string
+	StartHeight int64
+	StopHash    []byte
+}
+
+// CFHeaders 响应过滤器哈希 接收方由PrevHeader依次计算各区块的过滤器头
+type CFHeaders struct {
+	AddrFrom     string
+	StartHeight  int64
+	StopHash     []byte
+	PrevHeader   []byte   // StartHeight前一个区块的过滤器头
+	FilterHashes [][]byte // 按高度排列
+}
+
+// GetCFilters 请求以StopHash结束的分支上从StartHeight开始的区块过滤器 每个区块以一条cfilter响应
+type GetCFilters struct {
+	AddrFrom    string
+	StartHeight int64
+	StopHash    []byte
+}
+
+// CFilterData 区块过滤器
+type CFilterData struct {
+	AddrFrom  string
+	BlockHash []byte
+	Filter    []byte // 序列化的Golomb编码集合
+}
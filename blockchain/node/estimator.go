@@ -0,0 +1,222 @@
+package node
+
+import (
+	"blockchain/block"
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sync"
+)
+
+// 手续费估算 统计持久化到feeestimates-<NODE_ID>.dat
+// 交易进入交易池时记录手续费率和当时的区块高度 被打包后记录经过的区块数 未打包就离开交易池的交易记为失败
+// 手续费率按指数增长的区间分组 每个新区块使旧的统计按衰减系数降低权重 估算更依赖近期的区块
+// 估算N个区块内确认的费率时 从最高的区间向下合并数据 合并的区间在N个区块内确认的比例达到阈值即通过
+// 返回最低的通过区间内交易的平均费率
+
+const feeEstimatesFile = "feeestimates-%s.dat"
+
+const (
+	MaxConfirmTarget     = 25   // 可估算的最大确认区块数
+	DefaultConfirmTarget = 6    // 转账未指定手续费时的确认区块数
+	feeDecay             = 0.99 // 每个区块统计的衰减系数
+	feeSuccessThreshold  = 0.85 // 区间通过需要的确认比例
+	feeMinTxs            = 2    // 区间合并后至少需要的交易数(衰减后)
+	maxBucketFeeRate     = 100000
+)
+
+var (
+	ErrNoFeeEstimate   = errors.New("insufficient data to estimate the fee")
+	ErrInvalidTarget   = fmt.Errorf("confirmation target must be between 1 and %d", MaxConfirmTarget)
+	defaultFeeBuckets  = feeBuckets()
+	errBucketsMismatch = errors.New("fee buckets changed")
+)
+
+// 手续费率区间的下界 0和1之后每个区间比上一个增长约1/4
+func feeBuckets() []int {
+	buckets := []int{0, 1}
+	for last := 1; last < maxBucketFeeRate; {
+		next := last * 5 / 4
+		if next == last {
+			next++
+		}
+		buckets = append(buckets, next)
+		last = next
+	}
+	return buckets
+}
+
+// 费率所在的区间
+func bucketIndex(buckets []int, feeRate int) int {
+	index := 0
+	for i, lower := range buckets {
+		if feeRate >= lower {
+			index = i
+		}
+	}
+	return index
+}
+
+// 持久化的统计数据
+type feeStats struct {
+	Height    int64       // 最后处理的区块高度
+	Buckets   []int       // 区间下界
+	Confirmed [][]float64 // [确认区块数-1][区间] 在该区块数内确认的交易
+	Total     []float64   // 各区间已结束跟踪的交易 包括确认和失败
+	FeeSum    []float64   // 各区间已结束跟踪交易的费率之和
+}
+
+func newFeeStats() *feeStats {
+	stats := &feeStats{
+		Buckets:   defaultFeeBuckets,
+		Confirmed: make([][]float64, MaxConfirmTarget),
+		Total:     make([]float64, len(defaultFeeBuckets)),
+		FeeSum:    make([]float64, len(defaultFeeBuckets)),
+	}
+	for i := range stats.Confirmed {
+		stats.Confirmed[i] = make([]float64, len(defaultFeeBuckets))
+	}
+	return stats
+}
+
+// 跟踪中的交易
+type trackedTx struct {
+	Height  int64 // 进入交易池时的区块高度
+	FeeRate int
+}
+
+// FeeEstimator 手续费估算器
+type FeeEstimator struct {
+	mu      sync.Mutex
+	name    string // 文件名
+	stats   *feeStats
+	tracked map[string]*trackedTx // 交易池中的交易 不持久化
+}
+
+// NewFeeEstimator 加载节点的手续费统计
+func NewFeeEstimator(nodeId string) *FeeEstimator {
+	return NewFeeEstimatorFile(fmt.Sprintf(feeEstimatesFile, nodeId))
+}
+
+// NewFeeEstimatorFile 从指定文件加载手续费统计 文件不存在时从空统计开始
+func NewFeeEstimatorFile(name string) *FeeEstimator {
+	e := &FeeEstimator{name: name, stats: newFeeStats(), tracked: make(map[string]*trackedTx)}
+	if err := e.load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("load the fee estimates[%s] failed: %v\n", name, err)
+	}
+	return e
+}
+
+// 从文件中读取统计
+func (e *FeeEstimator) load() error {
+	content, err := ioutil.ReadFile(e.name)
+	if err != nil {
+		return err
+	}
+	var stats feeStats
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&stats); err != nil {
+		return err
+	}
+	if len(stats.Confirmed) != MaxConfirmTarget || fmt.Sprint(stats.Buckets) != fmt.Sprint(defaultFeeBuckets) {
+		return errBucketsMismatch
+	}
+	e.stats = &stats
+	return nil
+}
+
+// 持久化统计
+func (e *FeeEstimator) save() {
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(e.stats); err != nil {
+		log.Panicf("encode the fee estimates failed: %v\n", err)
+	}
+	if err := ioutil.WriteFile(e.name, content.Bytes(), 0600); err != nil {
+		log.Panicf("save the fee estimates[%s] failed: %v\n", e.name, err)
+	}
+}
+
+// Track 跟踪进入交易池的交易 height为当时的区块高度
+func (e *FeeEstimator) Track(txHash []byte, feeRate int, height int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tracked[hex.EncodeToString(txHash)] = &trackedTx{Height: height, FeeRate: feeRate}
+}
+
+// 结束跟踪交易 blocks为确认经过的区块数 0表示未确认就离开交易池 调用方须持有锁
+func (e *FeeEstimator) resolve(tx *trackedTx, blocks int64) {
+	bucket := bucketIndex(e.stats.Buckets, tx.FeeRate)
+	e.stats.Total[bucket]++
+	e.stats.FeeSum[bucket] += float64(tx.FeeRate)
+	if blocks < 1 {
+		return
+	}
+	for target := blocks; target <= MaxConfirmTarget; target++ {
+		e.stats.Confirmed[target-1][bucket]++
+	}
+}
+
+// ProcessBlock 处理连接到最新区块的新区块 记录其中跟踪交易的确认区块数
+// 已不在交易池中的其他跟踪交易(被替换或与区块冲突)记为失败
+func (e *FeeEstimator) ProcessBlock(b *block.Block, mempool *Mempool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if b.Height <= e.stats.Height {
+		return
+	}
+	e.stats.Height = b.Height
+	for i := range e.stats.Total {
+		e.stats.Total[i] *= feeDecay
+		e.stats.FeeSum[i] *= feeDecay
+		for target := range e.stats.Confirmed {
+			e.stats.Confirmed[target][i] *= feeDecay
+		}
+	}
+	for _, tx := range b.Txs {
+		key := hex.EncodeToString(tx.TxHash)
+		if tracked, ok := e.tracked[key]; ok {
+			e.resolve(tracked, b.Height-tracked.Height)
+			delete(e.tracked, key)
+		}
+	}
+	for key, tracked := range e.tracked {
+		if hash, _ := hex.DecodeString(key); !mempool.Has(hash) {
+			e.resolve(tracked, 0)
+			delete(e.tracked, key)
+		}
+	}
+	e.save()
+}
+
+// Estimate 估算target个区块内确认需要的手续费率(每千字节)
+func (e *FeeEstimator) Estimate(target int) (int, error) {
+	if target < 1 || target > MaxConfirmTarget {
+		return 0, ErrInvalidTarget
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	best := -1.0
+	var confirmed, total, feeSum float64
+	for bucket := len(e.stats.Buckets) - 1; bucket >= 0; bucket-- {
+		confirmed += e.stats.Confirmed[target-1][bucket]
+		total += e.stats.Total[bucket]
+		feeSum += e.stats.FeeSum[bucket]
+		if total < feeMinTxs {
+			continue
+		}
+		if confirmed/total < feeSuccessThreshold {
+			break
+		}
+		best = feeSum / total
+		confirmed, total, feeSum = 0, 0, 0
+	}
+	if best < 0 {
+		return 0, ErrNoFeeEstimate
+	}
+	return int(math.Ceil(best)), nil
+}
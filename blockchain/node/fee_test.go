@@ -0,0 +1,104 @@
+package node
+
+import (
+	"blockchain/block"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// 估算器的测试环境 交易池中的交易由区块打包或被移除
+type feeTest struct {
+	*FeeEstimator
+	mempool *Mempool
+	height  int64
+}
+
+func newFeeTest(t *testing.T) *feeTest {
+	return &feeTest{
+		FeeEstimator: NewFeeEstimatorFile(filepath.Join(t.TempDir(), "feeestimates.dat")),
+		mempool:      NewMempool(),
+	}
+}
+
+// 费率为feeRate的交易进入交易池
+func (ft *feeTest) track(t *testing.T, feeRate int) *block.Transaction {
+	t.Helper()
+	tx := poolTx(false, 1, confirmedOutPoint(t))
+	mustAdd(t, ft.mempool, tx, feeRate)
+	ft.Track(tx.TxHash, feeRate, ft.height)
+	return tx
+}
+
+// 打包txs的下一个区块
+func (ft *feeTest) mine(txs ...*block.Transaction) {
+	ft.height++
+	b := &block.Block{Height: ft.height, Txs: txs}
+	ft.mempool.RemoveBlockTxs(b)
+	ft.ProcessBlock(b, ft.mempool)
+}
+
+// 每个区块只能容纳一笔交易时 高费率的交易在下一个区块确认 低费率的交易多等一个区块
+func TestFeeEstimate(t *testing.T) {
+	const lowRate, highRate = 2, 6
+	ft := newFeeTest(t)
+	for round := 0; round < 6; round++ {
+		high, low := ft.track(t, highRate), ft.track(t, lowRate)
+		ft.mine(high)
+		ft.mine(low)
+	}
+
+	next, err := ft.Estimate(1)
+	if err != nil {
+		t.Fatalf("Estimate(1) = %v", err)
+	}
+	later, err := ft.Estimate(2)
+	if err != nil {
+		t.Fatalf("Estimate(2) = %v", err)
+	}
+	if next <= lowRate || later >= next {
+		t.Fatalf("estimates %d for 1 block and %d for 2 blocks do not separate the low fee rate %d", next, later, lowRate)
+	}
+
+	// 统计在重启后保留
+	reloaded := NewFeeEstimatorFile(ft.name)
+	if estimate, err := reloaded.Estimate(1); err != nil || estimate != next {
+		t.Fatalf("reloaded Estimate(1) = %d, %v, want %d", estimate, err, next)
+	}
+}
+
+// 未打包就离开交易池的交易记为失败 确认比例不足时没有估算
+func TestFeeEstimateFailures(t *testing.T) {
+	ft := newFeeTest(t)
+	var confirmed []*block.Transaction
+	for i := 0; i < 4; i++ {
+		tx := ft.track(t, 6)
+		if i%2 == 0 {
+			confirmed = append(confirmed, tx)
+		} else {
+			ft.mempool.Remove(tx.TxHash)
+		}
+	}
+	ft.mine(confirmed...)
+	if _, err := ft.Estimate(1); !errors.Is(err, ErrNoFeeEstimate) {
+		t.Fatalf("Estimate(1) = %v, want %v", err, ErrNoFeeEstimate)
+	}
+}
+
+func TestFeeEstimateErrors(t *testing.T) {
+	ft := newFeeTest(t)
+	tests := []struct {
+		target int
+		err    error
+	}{
+		{0, ErrInvalidTarget},
+		{MaxConfirmTarget + 1, ErrInvalidTarget},
+		{1, ErrNoFeeEstimate},
+		{MaxConfirmTarget, ErrNoFeeEstimate},
+	}
+	for _, test := range tests {
+		if _, err := ft.Estimate(test.target); !errors.Is(err, test.err) {
+			t.Fatalf("Estimate(%d) = %v, want %v", test.target, err, test.err)
+		}
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"blockchain/utils"
 	"bytes"
 	"encoding/gob"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
@@ -13,125 +16,334 @@ import (
 
 // 数据请求进行处理
 
+const maxOrphanBlocks = 100 // 暂存的孤块数量上限
+
+// 所有消息都携带发送方地址 用于识别节点
+type messageHeader struct {
+	AddrFrom string
+}
+
+// 解析请求中命令之后的数据 失败时返回违规行为错误
+func decodePayload(req []byte, data interface{}) error {
+	decoder := gob.NewDecoder(bytes.NewReader(req[utils.LENGTH:]))
+	if err := decoder.Decode(data); err != nil {
+		return misbehave(ScoreMalformed, "decode the %T struct failed: %v", data, err)
+	}
+	return nil
+}
+
 // HandleConn 处理请求
-func HandleConn(conn net.Conn, chain *block.Chain) {
-	req, err := ioutil.ReadAll(conn)
+// 惩罚和封禁以连接对端的标识为准 消息中自报的发送方地址只用于回复和握手状态
+// 对端标识在加密传输时为身份公钥 否则为主机地址
+func (s *Server) HandleConn(conn net.Conn) {
+	defer conn.Close()
+	peer := remoteHost(conn)
+	if s.isBanned(peer) {
+		return
+	}
+	var r io.Reader = conn
+	if s.secureTransport {
+		sc, err := s.SecureServer(conn)
+		if err != nil {
+			log.Printf("secure handshake with [%s] failed: %v\n", conn.RemoteAddr(), err)
+			return
+		}
+		// 加密传输认证了对方的身份公钥 以其标识节点
+		peer = peerKeyID(sc.PeerKey)
+		if s.isBanned(peer) {
+			return
+		}
+		r = sc
+	}
+	// 限制读取长度 防止超长消息耗尽内存
+	req, err := ioutil.ReadAll(io.LimitReader(r, maxMessageSize+1))
 	if err != nil {
-		log.Panicf("receive a request failed: %v", err)
+		log.Printf("receive a request failed: %v\n", err)
+		return
+	}
+	if len(req) > maxMessageSize {
+		s.Penalize(peer, ScoreOversized, "message exceeds the size limit")
+		return
+	}
+	if len(req) < utils.LENGTH {
+		s.Penalize(peer, ScoreMalformed, "message is shorter than the command header")
+		return
 	}
-	command := utils.BytesToCommand(req[:12])
+	command := utils.BytesToCommand(req[:utils.LENGTH])
 	fmt.Printf("receive a command: %s\n", command)
 
+	// 发送方地址须与握手时的连接对端一致 防止冒用其他节点的握手状态
+	addr := peer
+	var header messageHeader
+	if decodePayload(req, &header) == nil && header.AddrFrom != "" {
+		addr = header.AddrFrom
+		if !s.bindPeer(addr, peer, command == VERSION) {
+			log.Printf("ignore command %s from [%s] claiming to be peer[%s]\n", command, peer, addr)
+			return
+		}
+	}
+
+	// 解析不可信数据时的意外错误不应导致节点崩溃
+	defer func() {
+		if r := recover(); r != nil {
+			s.Penalize(peer, ScoreMalformed, fmt.Sprintf("handle command %s panicked: %v", command, r))
+		}
+	}()
+
+	// 未发送version的节点只能进行握手
+	switch command {
+	case VERSION, VERACK, CMDREJECT:
+	default:
+		if !s.isVersionReceived(addr) {
+			log.Printf("ignore command %s from peer[%s] before version\n", command, addr)
+			return
+		}
+	}
+
+	// 轻节点没有区块链 只处理握手、区块通知、区块头、过滤器和钱包相关的区块
+	if s.Light != nil && !isLightCommand(command) {
+		log.Printf("light node ignores command %s from peer[%s]\n", command, addr)
+		return
+	}
+
 	// 判断命令
 	switch command {
 	case VERSION:
-		HandleVersion(req, chain)
+		err = s.HandleVersion(req)
+	case VERACK:
+		err = s.HandleVerAck(req)
+	case CMDPING:
+		err = s.HandlePing(req)
+	case CMDPONG:
+		err = s.HandlePong(req)
+	case CMDREJECT:
+		err = s.HandleReject(req)
 	case GETDATA:
-		HandleGetData(req, chain)
+		err = s.HandleGetData(req)
 	case GETBLOCKS:
-		HandleGetBlocks(req, chain)
+		err = s.HandleGetBlocks(req)
 	case CMDINV:
-		HandleInv(req)
+		err = s.HandleInv(req)
 	case CMDBLOCK:
-		HandleBlock(req, chain)
+		err = s.HandleBlock(req)
+	case CMDTX:
+		err = s.HandleTx(req)
+	case CMDCMPCTBLOCK:
+		err = s.HandleCompactBlock(req)
+	case GETBLOCKTXN:
+		err = s.HandleGetBlockTxn(req)
+	case CMDBLOCKTXN:
+		err = s.HandleBlockTxn(req)
+	case GETTXPROOF:
+		err = s.HandleGetTxProof(req)
+	case CMDMERKLEBLOCK:
+		err = s.HandleMerkleBlock(req)
+	case GETHEADERS:
+		err = s.HandleGetHeaders(req)
+	case CMDHEADERS:
+		err = s.HandleHeaders(req)
+	case GETCFHEADERS:
+		err = s.HandleGetCFHeaders(req)
+	case CMDCFHEADERS:
+		err = s.HandleCFHeaders(req)
+	case GETCFILTERS:
+		err = s.HandleGetCFilters(req)
+	case CMDCFILTER:
+		err = s.HandleCFilter(req)
 	default:
-		fmt.Println("unknown command")
+		err = misbehave(ScoreUnknown, "unknown command %q", command)
 	}
-}
 
-// HandleVersion 处理版本验证
-func HandleVersion(req []byte, chain *block.Chain) {
-	fmt.Println("the request of version handle...")
-	var buff bytes.Buffer
-	var data Version
-
-	// 解析请求
-	dataBytes := req[12:]
-	buff.Write(dataBytes)
-	decoder := gob.NewDecoder(&buff)
-	if err := decoder.Decode(&data); err != nil {
-		log.Panicf("decode the version struct failed: %v\n", err)
-	}
-
-	// 生成version结构
-	versionHeight := data.Height
-	height := chain.GetHeight() // 获取当前高度
-	fmt.Printf("height: %v versionHeight: %v\n", height, versionHeight)
-	if height > int64(versionHeight) {
-		SendVersion(data.AddrFrom, chain)
-	} else if height < int64(versionHeight) {
-		// 当前节点区块高度小于发送方的versionHeight
-		// 向发送方发起同步数据请求
-		SendGetBlocks(data.AddrFrom) // 发送请求同步数据
+	if err != nil {
+		var m *Misbehavior
+		if errors.As(err, &m) {
+			s.Penalize(peer, m.Score, m.Reason)
+			return
+		}
+		log.Printf("handle command %s failed: %v\n", command, err)
 	}
 }
 
 // HandleGetData 处理数据获取请求
-func HandleGetData(req []byte, chain *block.Chain) {
+func (s *Server) HandleGetData(req []byte) error {
 	fmt.Println("the request of get block handle...")
-	var buff bytes.Buffer
 	var data GetData
 
-	dataBytes := req[12:]
-	buff.Write(dataBytes)
-	decoder := gob.NewDecoder(&buff)
-	if err := decoder.Decode(&data); err != nil {
-		log.Panicf("decode the getData struct failed: %v", err)
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	if data.Type == InvTx {
+		tx, ok := s.Mempool.Get(data.ID)
+		if !ok {
+			return fmt.Errorf("transaction[%x] not found", data.ID)
+		}
+		s.SendTx(data.AddrFrom, tx)
+		return nil
 	}
-	blockBytes := chain.GetBlock(data.ID) // 获取到区块数据
-	SendBlock(data.AddrFrom, blockBytes)
+	blockBytes := s.Chain.GetBlock(data.ID) // 获取到区块数据
+	if blockBytes == nil {
+		return fmt.Errorf("block[%x] not found", data.ID)
+	}
+	s.SendBlock(data.AddrFrom, blockBytes)
+	return nil
 }
 
-func HandleGetBlocks(req []byte, c *block.Chain) {
+func (s *Server) HandleGetBlocks(req []byte) error {
 	fmt.Println("the request of get blocks handle...")
-	var buff bytes.Buffer
 	var data GetBlocks
 
-	dataBytes := req[12:]
-	buff.Write(dataBytes)
-	decoder := gob.NewDecoder(&buff)
-	if err := decoder.Decode(&data); err != nil {
-		log.Panicf("decode the getblocks struct failed: %v\n", err)
+	if err := decodePayload(req, &data); err != nil {
+		return err
 	}
-	hashes := c.GetBlockHashes() // 获取区块链所有区块哈希
-	SendInv(data.AddrFrom, hashes)
+	hashes := s.Chain.GetBlockHashes() // 获取区块链所有区块哈希
+	s.SendInv(data.AddrFrom, hashes)
+	return nil
 }
 
 // HandleInv 处理INV请求
-func HandleInv(req []byte) {
+func (s *Server) HandleInv(req []byte) error {
 	fmt.Println("the request of inv handle...")
-	var buff bytes.Buffer
 	var data Inv
-	dataBytes := req[12:]
-	buff.Write(dataBytes)
-	decoder := gob.NewDecoder(&buff)
-	if err := decoder.Decode(&data); err != nil {
-		log.Panicf("decode the inv struct failed: %v\n", err)
+	if err := decodePayload(req, &data); err != nil {
+		return err
 	}
 
-	// 同步哈希对应的区块数据
+	if s.Light != nil {
+		// 轻节点不接收交易池中的交易 新区块通过区块头同步
+		if data.Type != InvTx {
+			s.SendGetHeaders(data.AddrFrom)
+		}
+		return nil
+	}
+	if data.Type == InvTx {
+		// 请求交易池中没有的交易
+		for _, hash := range data.Hashes {
+			if !s.Mempool.Has(hash) {
+				s.SendGetDataType(data.AddrFrom, InvTx, hash)
+			}
+		}
+		return nil
+	}
+
+	// 同步本地缺少的区块数据
 	for _, hash := range data.Hashes {
-		SendGetData(data.AddrFrom, hash)
+		if !s.Chain.HasBlock(hash) {
+			s.SendGetData(data.AddrFrom, hash)
+		}
 	}
+	return nil
 }
 
 // HandleBlock 处理请求
-func HandleBlock(req []byte, c *block.Chain) {
+func (s *Server) HandleBlock(req []byte) error {
 	fmt.Println("the request of handle block handle...")
-	var buff bytes.Buffer
 	var data BlockData
 
-	dataBytes := req[12:]
-	buff.Write(dataBytes)
-	decoder := gob.NewDecoder(&buff)
-	if err := decoder.Decode(&data); err != nil {
-		log.Panicf("decode the block data struct failed: %v\n", err)
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+
+	// 验证接收到的区块
+	newBlock, err := block.DecodeBlock(data.Block)
+	if err != nil {
+		return misbehave(ScoreMalformed, "decode the block failed: %v", err)
+	}
+	if s.Light != nil {
+		return s.handleLightBlock(data.AddrFrom, newBlock)
+	}
+	s.chainMu.Lock()
+	if err := s.Chain.ValidateBlock(newBlock); err != nil {
+		s.chainMu.Unlock()
+		var txErr *block.TxError
+		if errors.As(err, &txErr) {
+			return misbehave(ScoreInvalidTx, "block[%x]: %v", newBlock.Hash, err)
+		}
+		return misbehave(ScoreInvalidBlock, "block[%x]: %v", newBlock.Hash, err)
+	}
+
+	s.acceptBlock(data.AddrFrom, newBlock)
+	return nil
+}
+
+// 将验证通过的区块添加到区块链 向发送方请求未知的父区块 并继续传播新的最新区块
+// 父区块未知的区块只通过了上下文无关的检查 暂存为孤块 父区块连接后再完整验证
+// 调用方须持有chainMu 函数返回前释放
+func (s *Server) acceptBlock(from string, newBlock *block.Block) {
+	if len(newBlock.PrevBlockHash) != 0 && !s.Chain.HasBlock(newBlock.PrevBlockHash) {
+		s.addOrphan(newBlock)
+		s.chainMu.Unlock()
+		// 父区块未知 向发送方请求
+		s.SendGetData(from, newBlock.PrevBlockHash)
+		return
+	}
+	prevTip := s.Chain.Tip
+	s.connectBlock(newBlock)
+	s.connectOrphans(newBlock.Hash)
+	tip := s.Chain.Tip
+	s.chainMu.Unlock()
+
+	if !bytes.Equal(prevTip, tip) {
+		// 新的最新区块 继续向其他节点展示
+		s.AnnounceBlock(tip)
 	}
+}
+
+// 暂存孤块 超出上限时丢弃
+// 调用方须持有chainMu
+func (s *Server) addOrphan(b *block.Block) {
+	if s.Chain.HasBlock(b.Hash) || len(s.orphans) >= maxOrphanBlocks {
+		return
+	}
+	key := hex.EncodeToString(b.PrevBlockHash)
+	for _, orphan := range s.orphans[key] {
+		if bytes.Equal(orphan.Hash, b.Hash) {
+			return
+		}
+	}
+	s.orphans[key] = append(s.orphans[key], b)
+}
+
+// 验证并连接以hash为父区块的孤块 以及依赖它们的孤块 验证失败的孤块被丢弃
+// 调用方须持有chainMu
+func (s *Server) connectOrphans(hash []byte) {
+	parents := [][]byte{hash}
+	for len(parents) > 0 {
+		key := hex.EncodeToString(parents[0])
+		parents = parents[1:]
+		children := s.orphans[key]
+		delete(s.orphans, key)
+		for _, child := range children {
+			if err := s.Chain.ValidateBlock(child); err != nil {
+				log.Printf("drop the orphan block[%x]: %v\n", child.Hash, err)
+				continue
+			}
+			s.connectBlock(child)
+			parents = append(parents, child.Hash)
+		}
+	}
+}
+
+// 将区块添加到区块链并更新UTXO集和区块过滤器
+// 区块按顺序连接到最新区块时增量更新 乱序到达时在链完整后重建UTXO集
+func (s *Server) connectBlock(newBlock *block.Block) {
+	prevTip := s.Chain.Tip
+	s.Chain.AddBlock(newBlock)
+	s.Mempool.RemoveBlockTxs(newBlock)
+	utxoSet := block.UTXOSet{Chain: s.Chain}
+	if bytes.Equal(newBlock.PrevBlockHash, prevTip) && bytes.Equal(s.Chain.Tip, newBlock.Hash) {
+		utxoSet.UpdateUTXOSet()
+		s.Fees.ProcessBlock(newBlock, s.Mempool)
+		s.buildFilter(newBlock.Hash)
+	} else if s.Chain.IsComplete() {
+		utxoSet.ResetUTXOSet()
+		s.buildFilter(s.Chain.Tip)
+	}
+	s.syncWallet()
+}
 
-	// 接收到的区块添加到区块链
-	blockBytes := data.Block
-	newBlock := block.DeserializeBlock(blockBytes)
-	c.AddBlock(newBlock)
-	utxoSet := block.UTXOSet{Chain: c}
-	utxoSet.UpdateUTXOSet()
+// 计算并保存区块及其缺少过滤器的祖先的过滤器 轻节点请求时不必再计算
+func (s *Server) buildFilter(hash []byte) {
+	if _, err := s.Chain.GetCFilter(hash); err != nil {
+		log.Printf("build the filter of block[%x] failed: %v\n", hash, err)
+	}
 }
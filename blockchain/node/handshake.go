@@ -0,0 +1,421 @@
+package node
+
+import (
+	"blockchain/utils"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"time"
+)
+
+// 版本握手
+// 节点之间交换version 双方各自回复verack后握手完成
+// version携带协议版本、服务标识、创世区块哈希、区块高度和客户端标识
+// 创世区块不同或协议版本过低的节点会被拒绝
+// 握手完成后定期发送ping 通过pong计算延迟 长时间无响应的节点被移除
+
+const (
+	ProtocolVersion    = 2                // 当前协议版本
+	MinProtocolVersion = 2                // 可接受的最低协议版本
+	UserAgent          = "/coin:0.12/"    // 客户端标识
+	pingInterval       = 30 * time.Second // 心跳间隔
+	pingTimeout        = 2 * pingInterval // 心跳超时
+)
+
+// 服务标识
+const (
+	SFNodeFull  uint64 = 1 << iota // 保存完整区块数据
+	SFNodeMiner                    // 挖矿节点
+	SFNodeLight                    // 轻节点
+)
+
+// 可选功能 握手时取双方交集
+const (
+	FeaturePing          uint64 = 1 << iota // 支持ping/pong心跳
+	FeatureCompactBlocks                    // 支持紧凑区块
+)
+
+// Peer 已知节点的握手状态
+type Peer struct {
+	Addr            string
+	ID              string // 连接对端的标识(主机地址或身份公钥) 由收到version的连接确定
+	ProtocolVersion int
+	Services        uint64
+	Features        uint64 // 协商后的可选功能
+	UserAgent       string
+	Height          int
+	VersionSent     bool // 已向对方发送version
+	VersionReceived bool // 已收到对方version
+	VerAckReceived  bool // 已收到对方verack
+	PingNonce       uint64
+	PingSent        time.Time
+	Latency         time.Duration // 最近一次心跳延迟
+	LastSeen        time.Time
+
+	versionAttempts int // 未收到verack时已发送version的次数
+}
+
+// HandshakeDone 判断握手是否完成
+func (p *Peer) HandshakeDone() bool {
+	return p.VersionReceived && p.VerAckReceived
+}
+
+// HasFeature 判断协商后是否支持指定功能
+func (p *Peer) HasFeature(feature uint64) bool {
+	return p.Features&feature != 0
+}
+
+// 获取节点状态 不存在则创建 调用方须持有peersMutex
+func (s *Server) getPeer(addr string) *Peer {
+	peer, ok := s.peers[addr]
+	if !ok {
+		peer = &Peer{Addr: addr}
+		s.peers[addr] = peer
+	}
+	return peer
+}
+
+// 移除节点
+func (s *Server) removePeer(addr string) {
+	s.peersMutex.Lock()
+	delete(s.peers, addr)
+	s.peersMutex.Unlock()
+}
+
+// 移除连接标识为id的所有节点
+func (s *Server) removePeersWithID(id string) {
+	s.peersMutex.Lock()
+	for addr, peer := range s.peers {
+		if peer.ID == id {
+			delete(s.peers, addr)
+		}
+	}
+	s.peersMutex.Unlock()
+}
+
+// 检查声称来自addr的消息是否来自连接标识为id的对端 返回false时应忽略消息
+// 收到version时记录尚未确定的标识 已确定的标识不会被其他连接替换
+func (s *Server) bindPeer(addr string, id string, version bool) bool {
+	s.peersMutex.Lock()
+	defer s.peersMutex.Unlock()
+	peer, ok := s.peers[addr]
+	if !ok || peer.ID == "" {
+		if version {
+			s.getPeer(addr).ID = id
+		}
+		return true
+	}
+	return peer.ID == id
+}
+
+// Peers 获取已知节点的状态副本
+func (s *Server) Peers() []Peer {
+	s.peersMutex.Lock()
+	defer s.peersMutex.Unlock()
+	var list []Peer
+	for _, peer := range s.peers {
+		list = append(list, *peer)
+	}
+	return list
+}
+
+// 判断是否已收到节点的version
+// 消息通过独立连接并发处理 verack可能晚于后续请求到达 因此不要求握手完全结束
+func (s *Server) isVersionReceived(addr string) bool {
+	s.peersMutex.Lock()
+	defer s.peersMutex.Unlock()
+	peer, ok := s.peers[addr]
+	return ok && peer.VersionReceived
+}
+
+// 生成随机数
+func randomNonce() uint64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		log.Panicf("generate nonce failed: %v\n", err)
+	}
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// 本节点提供的服务
+func (s *Server) services() uint64 {
+	if s.Light != nil {
+		return SFNodeLight
+	}
+	return SFNodeFull
+}
+
+// 本节点支持的可选功能 轻节点不接收完整区块
+func (s *Server) features() uint64 {
+	if s.Light != nil {
+		return FeaturePing
+	}
+	return FeaturePing | FeatureCompactBlocks
+}
+
+// 本节点的创世区块哈希 尚未同步的轻节点为nil
+func (s *Server) localGenesis() []byte {
+	if s.Light != nil {
+		return s.Light.Headers.GenesisHash()
+	}
+	return s.genesisHash
+}
+
+// 本节点的区块高度 轻节点为区块头链的高度
+// 区块写入时最新区块哈希先于事务提交更新 读取须持有chainMu
+func (s *Server) height() int64 {
+	if s.Light != nil {
+		return s.Light.Headers.Height()
+	}
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	return s.Chain.GetHeight()
+}
+
+// 本节点的挖矿奖励成熟度 轻节点为完整节点声明的值
+func (s *Server) maturity() int64 {
+	if s.Light != nil {
+		return s.Light.Headers.Maturity()
+	}
+	return s.Chain.Maturity
+}
+
+// 生成本节点的version
+func (s *Server) newVersion() Version {
+	return Version{
+		ProtocolVersion: ProtocolVersion,
+		Services:        s.services(),
+		Features:        s.features(),
+		GenesisHash:     s.localGenesis(),
+		Height:          int(s.height()),
+		Maturity:        s.maturity(),
+		UserAgent:       UserAgent,
+		Timestamp:       time.Now().Unix(),
+		Nonce:           s.nonce,
+		AddrFrom:        s.Addr,
+	}
+}
+
+// 检查对方version是否与本节点兼容
+func (s *Server) checkVersion(data *Version) error {
+	if data.Nonce == s.nonce {
+		return fmt.Errorf("connected to self")
+	}
+	if data.ProtocolVersion < MinProtocolVersion {
+		return fmt.Errorf("protocol version %d is lower than %d", data.ProtocolVersion, MinProtocolVersion)
+	}
+	genesis := s.localGenesis()
+	switch {
+	case len(data.GenesisHash) == 0 && data.Services&SFNodeLight != 0:
+		// 尚未同步区块头的轻节点
+	case len(genesis) == 0 && s.Light != nil:
+		// 轻节点信任第一个同步的创世区块
+	case !bytes.Equal(data.GenesisHash, genesis):
+		return fmt.Errorf("genesis block %x does not match %x", data.GenesisHash, genesis)
+	}
+	// 成熟度不同的完整节点对挖矿奖励能否花费的判断不同
+	if s.Light == nil && data.Services&SFNodeFull != 0 && data.Maturity != s.Chain.Maturity {
+		return fmt.Errorf("coinbase maturity %d does not match %d", data.Maturity, s.Chain.Maturity)
+	}
+	return nil
+}
+
+// HandleVersion 处理版本握手
+func (s *Server) HandleVersion(req []byte) error {
+	fmt.Println("the request of version handle...")
+	var data Version
+
+	// 解析请求
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	if err := s.checkVersion(&data); err != nil {
+		// 不兼容的节点 拒绝并忘记其状态
+		s.removePeer(data.AddrFrom)
+		s.SendReject(data.AddrFrom, VERSION, err.Error())
+		return fmt.Errorf("reject peer[%s]: %v", data.AddrFrom, err)
+	}
+
+	s.peersMutex.Lock()
+	peer := s.getPeer(data.AddrFrom)
+	if peer.VersionReceived && peer.ProtocolVersion != data.ProtocolVersion {
+		fmt.Printf("peer[%s] changed protocol version to %d\n", data.AddrFrom, data.ProtocolVersion)
+	}
+	peer.ProtocolVersion = data.ProtocolVersion
+	peer.Services = data.Services
+	peer.Features = data.Features & s.features() // 协商可选功能
+	peer.UserAgent = data.UserAgent
+	peer.Height = data.Height
+	peer.VersionReceived = true
+	peer.LastSeen = time.Now()
+	needVersion := !peer.VersionSent
+	s.peersMutex.Unlock()
+
+	fmt.Printf("peer[%s] version: %d services: %b features: %b agent: %s\n",
+		data.AddrFrom, data.ProtocolVersion, data.Services, peer.Features, data.UserAgent)
+
+	// 对方主动发起握手 回复本节点的version
+	if needVersion {
+		s.SendVersion(data.AddrFrom)
+	}
+	s.SendVerAck(data.AddrFrom)
+
+	if s.Light != nil {
+		// 轻节点从完整节点同步区块头和钱包相关的交易
+		if data.Services&SFNodeFull != 0 {
+			s.Light.Headers.SetMaturity(data.Maturity)
+			s.startLightSync(data.AddrFrom)
+		}
+		return nil
+	}
+	height := s.height() // 获取当前高度
+	fmt.Printf("height: %v versionHeight: %v\n", height, data.Height)
+	if height < int64(data.Height) && data.Services&SFNodeFull != 0 {
+		// 当前节点区块高度小于发送方
+		// 向发送方发起同步数据请求
+		s.SendGetBlocks(data.AddrFrom) // 发送请求同步数据
+	}
+	return nil
+}
+
+// HandleVerAck 处理版本确认
+func (s *Server) HandleVerAck(req []byte) error {
+	var data VerAck
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	s.peersMutex.Lock()
+	defer s.peersMutex.Unlock()
+	peer, ok := s.peers[data.AddrFrom]
+	if !ok || !peer.VersionSent {
+		return misbehave(ScoreUnknown, "unexpected verack")
+	}
+	peer.VerAckReceived = true
+	peer.versionAttempts = 0
+	peer.LastSeen = time.Now()
+	fmt.Printf("handshake with peer[%s] done: %v\n", data.AddrFrom, peer.HandshakeDone())
+	return nil
+}
+
+// HandlePing 处理心跳请求
+func (s *Server) HandlePing(req []byte) error {
+	var data Ping
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	s.SendPong(data.AddrFrom, data.Nonce)
+	return nil
+}
+
+// HandlePong 处理心跳响应 计算延迟
+func (s *Server) HandlePong(req []byte) error {
+	var data Pong
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	s.peersMutex.Lock()
+	defer s.peersMutex.Unlock()
+	peer, ok := s.peers[data.AddrFrom]
+	if !ok || peer.PingNonce == 0 || peer.PingNonce != data.Nonce {
+		return misbehave(ScoreUnknown, "unexpected pong nonce %d", data.Nonce)
+	}
+	peer.Latency = time.Since(peer.PingSent)
+	peer.PingNonce = 0
+	peer.LastSeen = time.Now()
+	fmt.Printf("peer[%s] latency: %v\n", data.AddrFrom, peer.Latency)
+	return nil
+}
+
+// HandleReject 处理对方的拒绝消息
+func (s *Server) HandleReject(req []byte) error {
+	var data Reject
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	fmt.Printf("peer[%s] rejected %s: %s\n", data.AddrFrom, data.Command, data.Reason)
+	if data.Command == VERSION {
+		s.removePeer(data.AddrFrom)
+	}
+	return nil
+}
+
+// SendVersion 发起版本握手
+func (s *Server) SendVersion(toAddress string) {
+	s.peersMutex.Lock()
+	peer := s.getPeer(toAddress)
+	peer.VersionSent = true
+	peer.versionAttempts++
+	s.peersMutex.Unlock()
+
+	data := utils.GobEncoder(s.newVersion())
+	request := append(utils.CommandToBytes(VERSION), data...)
+	s.SendMessage(toAddress, request)
+}
+
+// SendVerAck 确认对方的version
+func (s *Server) SendVerAck(toAddress string) {
+	data := utils.GobEncoder(VerAck{AddrFrom: s.Addr})
+	req := append(utils.CommandToBytes(VERACK), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendPing 发送心跳请求
+func (s *Server) SendPing(toAddress string, nonce uint64) {
+	data := utils.GobEncoder(Ping{AddrFrom: s.Addr, Nonce: nonce})
+	req := append(utils.CommandToBytes(CMDPING), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendPong 回复心跳
+func (s *Server) SendPong(toAddress string, nonce uint64) {
+	data := utils.GobEncoder(Pong{AddrFrom: s.Addr, Nonce: nonce})
+	req := append(utils.CommandToBytes(CMDPONG), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendReject 拒绝对方的消息
+func (s *Server) SendReject(toAddress string, command string, reason string) {
+	data := utils.GobEncoder(Reject{AddrFrom: s.Addr, Command: command, Reason: reason})
+	req := append(utils.CommandToBytes(CMDREJECT), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// 定期向握手完成的节点发送心跳 移除超时未响应的节点
+func (s *Server) keepAlive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+		var targets []string
+		var nonces []uint64
+		s.peersMutex.Lock()
+		for addr, peer := range s.peers {
+			if !peer.HandshakeDone() || !peer.HasFeature(FeaturePing) {
+				continue
+			}
+			if time.Since(peer.LastSeen) > pingTimeout {
+				fmt.Printf("peer[%s] timed out\n", addr)
+				delete(s.peers, addr)
+				continue
+			}
+			if peer.PingNonce != 0 {
+				continue // 上一次心跳尚未响应
+			}
+			peer.PingNonce = randomNonce()
+			peer.PingSent = time.Now()
+			targets = append(targets, addr)
+			nonces = append(nonces, peer.PingNonce)
+		}
+		s.peersMutex.Unlock()
+
+		for i, addr := range targets {
+			s.SendPing(addr, nonces[i])
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/wallet"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 成熟度不同的完整节点不能连接 不限制成熟度的节点不能连接使用默认成熟度的节点
+func TestVersionMaturity(t *testing.T) {
+	s := newTestServer(t, NewMemoryNetwork(), "node0:3000")
+	tests := []struct {
+		name     string
+		maturity int64
+		accepted bool
+	}{
+		{"same maturity", s.Chain.Maturity, true},
+		{"different maturity", s.Chain.Maturity + 1, false},
+		{"default maturity", block.DefaultMaturity, false},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr := fmt.Sprintf("peer%d:%d", i+1, 3001+i)
+			version := testVersion(s, addr)
+			version.Maturity = test.maturity
+			deliver(s, addr, VERSION, version)
+			if s.isVersionReceived(addr) != test.accepted {
+				t.Fatalf("version accepted = %v, want %v", s.isVersionReceived(addr), test.accepted)
+			}
+		})
+	}
+}
+
+// 轻节点连接完整节点前使用默认成熟度 之后使用完整节点声明的成熟度 并随区块头保存
+func TestLightMaturityFromVersion(t *testing.T) {
+	network := NewMemoryNetwork()
+	full := newTestServer(t, network, "full:3000")
+	name := filepath.Join(t.TempDir(), "headers.dat")
+	light := newLightClient(NewHeaderChainFile(name), memoryWalletStore{wallet.NewMemoryWallets()})
+	s := NewLightServer("light", "light:3001", light, network.Transport("light:3001"))
+	s.banList = NewBanListFile(filepath.Join(t.TempDir(), "banlist.dat"))
+	if maturity := light.Headers.Maturity(); maturity != block.DefaultMaturity {
+		t.Fatalf("light maturity before the handshake = %d, want %d", maturity, block.DefaultMaturity)
+	}
+
+	// 完整节点明确不限制成熟度
+	deliver(s, full.Addr, VERSION, full.newVersion())
+	if maturity := light.Headers.Maturity(); maturity != 0 {
+		t.Fatalf("light maturity = %d, want 0", maturity)
+	}
+	if maturity := NewHeaderChainFile(name).Maturity(); maturity != 0 {
+		t.Fatalf("saved maturity = %d, want 0", maturity)
+	}
+}
+
+// 节点addr的握手状态
+func testPeer(s *Server, addr string) (Peer, bool) {
+	s.peersMutex.Lock()
+	defer s.peersMutex.Unlock()
+	peer, ok := s.peers[addr]
+	if !ok {
+		return Peer{}, false
+	}
+	return *peer, true
+}
+
+// 连接自身、协议版本过低或创世区块不同的节点被拒绝 尚未同步区块头的轻节点可以连接
+func TestVersionCompatibility(t *testing.T) {
+	s := newTestServer(t, NewMemoryNetwork(), "node0:3000")
+	tests := []struct {
+		name     string
+		modify   func(v *Version)
+		accepted bool
+	}{
+		{"compatible", func(v *Version) {}, true},
+		{"connected to self", func(v *Version) { v.Nonce = s.nonce }, false},
+		{"old protocol version", func(v *Version) { v.ProtocolVersion = MinProtocolVersion - 1 }, false},
+		{"other genesis block", func(v *Version) { v.GenesisHash = []byte("other genesis") }, false},
+		{"light node without headers", func(v *Version) { v.Services, v.GenesisHash = SFNodeLight, nil }, true},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr := fmt.Sprintf("peer%d:3001", i)
+			version := testVersion(s, addr)
+			test.modify(&version)
+			deliver(s, addr, VERSION, version)
+			if s.isVersionReceived(addr) != test.accepted {
+				t.Fatalf("version accepted = %v, want %v", s.isVersionReceived(addr), test.accepted)
+			}
+		})
+	}
+}
+
+// 对方发起握手时回复version 双方交换verack后握手完成 可选功能取双方交集
+func TestHandshake(t *testing.T) {
+	s := newTestServer(t, NewMemoryNetwork(), "node0:3000")
+	const addr = "peer1:3001"
+	version := testVersion(s, addr)
+	version.Features = FeaturePing | 1<<10
+	deliver(s, addr, VERSION, version)
+	peer, ok := testPeer(s, addr)
+	if !ok || !peer.VersionReceived || !peer.VersionSent || peer.HandshakeDone() {
+		t.Fatalf("peer state after version: %+v", peer)
+	}
+	if peer.Features != FeaturePing {
+		t.Fatalf("negotiated features %b, want %b", peer.Features, FeaturePing)
+	}
+	deliver(s, addr, VERACK, VerAck{AddrFrom: addr})
+	if peer, _ := testPeer(s, addr); !peer.HandshakeDone() {
+		t.Fatal("handshake is not done after verack")
+	}
+
+	// 握手前的其他消息被忽略 未发送version时收到verack被惩罚
+	deliver(s, "peer2:3002", CMDBLOCK, BlockData{AddrFrom: "peer2:3002", Block: []byte("junk")})
+	if score := s.PeerScore("peer2"); score != 0 {
+		t.Fatalf("message before version was handled, score = %d", score)
+	}
+	deliver(s, "peer3:3003", VERACK, VerAck{AddrFrom: "peer3:3003"})
+	if score := s.PeerScore("peer3"); score != ScoreUnknown {
+		t.Fatalf("unexpected verack score = %d, want %d", score, ScoreUnknown)
+	}
+}
+
+// pong须与最近一次ping的随机数一致
+func TestPong(t *testing.T) {
+	s := newTestServer(t, NewMemoryNetwork(), "node0:3000")
+	const addr = "peer1:3001"
+	deliver(s, addr, VERSION, testVersion(s, addr))
+	deliver(s, addr, VERACK, VerAck{AddrFrom: addr})
+	s.peersMutex.Lock()
+	s.peers[addr].PingNonce = 42
+	s.peers[addr].PingSent = time.Now()
+	s.peersMutex.Unlock()
+
+	deliver(s, addr, CMDPONG, Pong{AddrFrom: addr, Nonce: 43})
+	if score := s.PeerScore("peer1"); score != ScoreUnknown {
+		t.Fatalf("unexpected pong score = %d, want %d", score, ScoreUnknown)
+	}
+	deliver(s, addr, CMDPONG, Pong{AddrFrom: addr, Nonce: 42})
+	if peer, _ := testPeer(s, addr); peer.PingNonce != 0 || peer.Latency <= 0 {
+		t.Fatalf("peer state after pong: %+v", peer)
+	}
+}
+
+// 未收到verack时重发version 超过次数后移除节点 握手完成的节点不再重发
+func TestRetryHandshakes(t *testing.T) {
+	s := newTestServer(t, NewMemoryNetwork(), "node0:3000")
+	const lost, done = "lost:3001", "done:3002"
+	s.SendVersion(lost)
+	deliver(s, done, VERSION, testVersion(s, done))
+	deliver(s, done, VERACK, VerAck{AddrFrom: done})
+
+	for i := 1; i < maxVersionAttempts; i++ {
+		s.retryHandshakes()
+	}
+	if peer, ok := testPeer(s, lost); !ok || peer.versionAttempts != maxVersionAttempts {
+		t.Fatalf("version sent %d times, want %d", peer.versionAttempts, maxVersionAttempts)
+	}
+	if peer, _ := testPeer(s, done); peer.versionAttempts != 0 {
+		t.Fatalf("version resent %d times after the handshake", peer.versionAttempts)
+	}
+	s.retryHandshakes()
+	if _, ok := testPeer(s, lost); ok {
+		t.Fatal("peer without verack is still in the peer table")
+	}
+}
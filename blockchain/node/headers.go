@@ -0,0 +1,244 @@
+package node
+
+import (
+	"blockchain/block"
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"sync"
+)
+
+// 区块头链 轻节点只同步区块头 持久化到headers-<NODE_ID>.dat
+// 每个区块头须满足工作量证明并引用已知的区块头 分叉上的区块头同样保存
+// 更高的分叉出现时切换主链 钱包据此断开分叉上的区块
+// 空的区块头链信任第一个收到的创世区块头
+
+const headersFile = "headers-%s.dat"
+
+const maxHeadersResult = 2000 // 一次响应的最大区块头数
+
+var ErrOrphanHeader = errors.New("previous block header is unknown")
+
+// 持久化的区块头 主链由最新区块头向前重建
+type headerChainData struct {
+	Headers  []*block.BlockHeader
+	Tip      []byte
+	Maturity int64
+	Declared bool // 是否已收到完整节点声明的成熟度
+}
+
+// HeaderChain 区块头链
+type HeaderChain struct {
+	mu       sync.Mutex
+	name     string                        // 文件名
+	headers  map[string]*block.BlockHeader // 所有已验证的区块头 包括分叉
+	main     []*block.BlockHeader          // 主链 下标为高度-1
+	maturity int64                         // 完整节点声明的挖矿奖励成熟度
+	declared bool                          // 是否已收到完整节点声明的成熟度
+}
+
+// NewHeaderChain 加载节点的区块头链
+func NewHeaderChain(nodeId string) *HeaderChain {
+	return NewHeaderChainFile(fmt.Sprintf(headersFile, nodeId))
+}
+
+// NewHeaderChainFile 从指定文件加载区块头链 文件不存在时从空链开始
+func NewHeaderChainFile(name string) *HeaderChain {
+	hc := &HeaderChain{name: name, headers: make(map[string]*block.BlockHeader), maturity: block.DefaultMaturity}
+	if err := hc.load(); err != nil && !os.IsNotExist(err) {
+		log.Printf("load the block headers[%s] failed: %v\n", name, err)
+	}
+	return hc
+}
+
+// 从文件中读取区块头
+func (hc *HeaderChain) load() error {
+	content, err := ioutil.ReadFile(hc.name)
+	if err != nil {
+		return err
+	}
+	var data headerChainData
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		return err
+	}
+	for _, header := range data.Headers {
+		hc.headers[hex.EncodeToString(header.Hash)] = header
+	}
+	if tip, ok := hc.headers[hex.EncodeToString(data.Tip)]; ok {
+		hc.setTip(tip)
+	}
+	if data.Declared {
+		hc.maturity, hc.declared = data.Maturity, true
+	}
+	return nil
+}
+
+// 持久化区块头 调用方须持有锁
+func (hc *HeaderChain) save() {
+	data := headerChainData{Maturity: hc.maturity, Declared: hc.declared}
+	for _, header := range hc.headers {
+		data.Headers = append(data.Headers, header)
+	}
+	sort.Slice(data.Headers, func(i, j int) bool { return data.Headers[i].Height < data.Headers[j].Height })
+	if len(hc.main) > 0 {
+		data.Tip = hc.main[len(hc.main)-1].Hash
+	}
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(&data); err != nil {
+		log.Panicf("encode the block headers failed: %v\n", err)
+	}
+	if err := ioutil.WriteFile(hc.name, content.Bytes(), 0600); err != nil {
+		log.Panicf("save the block headers[%s] failed: %v\n", hc.name, err)
+	}
+}
+
+// 由最新区块头向前重建主链 调用方须持有锁
+func (hc *HeaderChain) setTip(tip *block.BlockHeader) {
+	main := make([]*block.BlockHeader, tip.Height)
+	for header := tip; header != nil; header = hc.headers[hex.EncodeToString(header.PrevBlockHash)] {
+		main[header.Height-1] = header
+		if header.IsGenesis() {
+			break
+		}
+	}
+	hc.main = main
+}
+
+// Add 验证并添加区块头 headers须按高度排列 返回主链是否变化
+// 无效或无法连接的区块头使添加停止 之前的区块头仍然保留
+func (hc *HeaderChain) Add(headers []*block.BlockHeader) (bool, error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	changed := false
+	defer func() {
+		if changed {
+			hc.save()
+		}
+	}()
+	for _, header := range headers {
+		if header == nil {
+			return changed, block.ErrInvalidHeader
+		}
+		key := hex.EncodeToString(header.Hash)
+		if _, ok := hc.headers[key]; ok {
+			continue
+		}
+		if !header.Validate() {
+			return changed, fmt.Errorf("%w: block[%x] at height %d", block.ErrInvalidHeader, header.Hash, header.Height)
+		}
+		if header.IsGenesis() {
+			// 只接受第一个创世区块头
+			if len(hc.main) > 0 || header.Height != 1 {
+				return changed, fmt.Errorf("%w: unexpected genesis block[%x]", block.ErrBrokenHeaders, header.Hash)
+			}
+		} else {
+			prev, ok := hc.headers[hex.EncodeToString(header.PrevBlockHash)]
+			if !ok {
+				return changed, fmt.Errorf("%w: block[%x]", ErrOrphanHeader, header.Hash)
+			}
+			if header.Height != prev.Height+1 {
+				return changed, fmt.Errorf("%w: block[%x] does not follow block[%x]", block.ErrBrokenHeaders, header.Hash, prev.Hash)
+			}
+		}
+		hc.headers[key] = header
+		if header.Height > int64(len(hc.main)) {
+			hc.setTip(header)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Tip 主链的最新区块头 空链时为nil
+func (hc *HeaderChain) Tip() *block.BlockHeader {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if len(hc.main) == 0 {
+		return nil
+	}
+	return hc.main[len(hc.main)-1]
+}
+
+// Height 主链高度
+func (hc *HeaderChain) Height() int64 {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return int64(len(hc.main))
+}
+
+// GenesisHash 创世区块哈希 空链时为nil
+func (hc *HeaderChain) GenesisHash() []byte {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if len(hc.main) == 0 {
+		return nil
+	}
+	return hc.main[0].Hash
+}
+
+// Maturity 挖矿奖励可以花费前需要的确认数 尚未连接完整节点时使用默认成熟度
+func (hc *HeaderChain) Maturity() int64 {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.maturity
+}
+
+// SetMaturity 记录完整节点声明的成熟度
+func (hc *HeaderChain) SetMaturity(maturity int64) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if !hc.declared || hc.maturity != maturity {
+		hc.maturity, hc.declared = maturity, true
+		hc.save()
+	}
+}
+
+// Get 查找已知的区块头 包括分叉上的区块头
+func (hc *HeaderChain) Get(hash []byte) (*block.BlockHeader, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	header, ok := hc.headers[hex.EncodeToString(hash)]
+	return header, ok
+}
+
+// AtHeight 主链上指定高度的区块头
+func (hc *HeaderChain) AtHeight(height int64) (*block.BlockHeader, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if height < 1 || height > int64(len(hc.main)) {
+		return nil, false
+	}
+	return hc.main[height-1], true
+}
+
+// IsMain 区块是否在主链上
+func (hc *HeaderChain) IsMain(hash []byte) bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	header, ok := hc.headers[hex.EncodeToString(hash)]
+	return ok && header.Height <= int64(len(hc.main)) && hc.main[header.Height-1] == header
+}
+
+// Locator 请求后续区块头时的定位哈希 从最新区块头开始 前10个连续 之后间隔加倍 最后为创世区块
+func (hc *HeaderChain) Locator() [][]byte {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	var locator [][]byte
+	step := 1
+	for i := len(hc.main) - 1; i > 0; i -= step {
+		locator = append(locator, hc.main[i].Hash)
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+	if len(hc.main) > 0 {
+		locator = append(locator, hc.main[0].Hash)
+	}
+	return locator
+}
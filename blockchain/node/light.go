@@ -0,0 +1,471 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/gcs"
+	"blockchain/wallet"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 轻节点
+// 只同步区块头 不保存区块和UTXO表 钱包跟踪的输出代替UTXO表
+// 握手后向完整节点请求区块头、过滤器哈希和区块过滤器 由过滤器哈希计算过滤器头链 下载的过滤器须与过滤器头一致
+// 钱包地址和可能被花费的输出在本地与过滤器匹配 只下载匹配的完整区块 不匹配的区块直接连接到钱包
+// 区块头链切换到更高的分叉时 钱包先断开分叉上的区块
+// 钱包中未确认的交易由轻节点广播 确认前定期重新广播
+
+const (
+	lightInterval       = 5 * time.Second // 检查同步和重新广播的间隔
+	lightRequestTimeout = 5 * time.Second // 过滤器和区块请求的超时
+)
+
+// 轻节点钱包的存储 节点运行时命令行可能修改钱包 每次使用时重新加载
+type walletStore interface {
+	Load() *wallet.Wallets
+	Save(wallets *wallet.Wallets)
+}
+
+// 钱包文件 以节点ID命名
+type fileWalletStore string
+
+func (nodeId fileWalletStore) Load() *wallet.Wallets {
+	return wallet.NewWallets(string(nodeId))
+}
+
+func (nodeId fileWalletStore) Save(wallets *wallet.Wallets) {
+	wallets.SaveWallets(string(nodeId))
+}
+
+// 只保存在内存中的钱包 用于测试
+type memoryWalletStore struct {
+	wallets *wallet.Wallets
+}
+
+func (m memoryWalletStore) Load() *wallet.Wallets {
+	return m.wallets
+}
+
+func (m memoryWalletStore) Save(*wallet.Wallets) {}
+
+// 等待响应的请求 超时后可以重新发送
+type pendingRequest struct {
+	hash []byte // 请求的区块 过滤器请求为最后一个区块
+	at   time.Time
+}
+
+// 是否正在等待hash的响应
+func (r *pendingRequest) waiting(hash []byte) bool {
+	return bytes.Equal(r.hash, hash) && time.Since(r.at) < lightRequestTimeout
+}
+
+func (r *pendingRequest) start(hash []byte) {
+	r.hash, r.at = hash, time.Now()
+}
+
+// 收到hash的响应
+func (r *pendingRequest) done(hash []byte) {
+	if bytes.Equal(r.hash, hash) {
+		r.hash = nil
+	}
+}
+
+// LightClient 轻节点状态
+type LightClient struct {
+	Headers *HeaderChain
+
+	store     walletStore
+	mu        sync.Mutex             // 串行化钱包同步
+	cfheaders map[string][]byte      // 区块的过滤器头 只保存在内存中 重启后重新请求
+	filters   map[string]*gcs.Filter // 已验证尚未处理的区块过滤器
+	fetched   int                    // 过滤器匹配后下载的区块数
+
+	cfheadersReq pendingRequest
+	cfiltersReq  pendingRequest
+	blockReq     pendingRequest
+}
+
+func newLightClient(headers *HeaderChain, store walletStore) *LightClient {
+	return &LightClient{
+		Headers:   headers,
+		store:     store,
+		cfheaders: make(map[string][]byte),
+		filters:   make(map[string]*gcs.Filter),
+	}
+}
+
+// NewLightClient 加载节点的区块头链和钱包文件
+func NewLightClient(nodeId string) *LightClient {
+	return newLightClient(NewHeaderChain(nodeId), fileWalletStore(nodeId))
+}
+
+// NewLightServer 创建轻节点服务
+func NewLightServer(nodeId string, addr string, light *LightClient, transport Transport) *Server {
+	s := NewServer(nodeId, addr, nil, transport)
+	s.Light = light
+	return s
+}
+
+// Balance 钱包余额
+func (light *LightClient) Balance() wallet.Balance {
+	light.mu.Lock()
+	defer light.mu.Unlock()
+	return light.store.Load().GetBalance(light.Headers.Maturity())
+}
+
+// 轻节点处理的命令
+func isLightCommand(command string) bool {
+	switch command {
+	case VERSION, VERACK, CMDPING, CMDPONG, CMDREJECT, CMDINV, CMDHEADERS, CMDCFHEADERS, CMDCFILTER, CMDBLOCK, CMDMERKLEBLOCK:
+		return true
+	}
+	return false
+}
+
+// 区块头对应的钱包区块
+func headerRef(header *block.BlockHeader) wallet.BlockRef {
+	return wallet.BlockRef{Hash: header.Hash, PrevHash: header.PrevBlockHash, Height: header.Height, Time: header.TimeStamp}
+}
+
+// 钱包在过滤器中匹配的元素 地址的公钥哈希 以及未被确认交易花费的钱包输出的位置
+func watchItems(wallets *wallet.Wallets) [][]byte {
+	var items [][]byte
+	for _, address := range wallets.Addresses() {
+		items = append(items, wallet.StringToHash160(address))
+	}
+	for _, out := range wallets.Outputs() {
+		if out.SpentBy != nil {
+			if rec, ok := wallets.Transaction(out.SpentBy); ok && rec.BlockHash != nil {
+				continue
+			}
+		}
+		items = append(items, block.OutPointElement(out.TxHash, out.Index))
+	}
+	return items
+}
+
+// 握手完成的完整节点
+func (s *Server) fullPeers() []string {
+	var peers []string
+	for _, peer := range s.Peers() {
+		if peer.HandshakeDone() && peer.Services&SFNodeFull != 0 {
+			peers = append(peers, peer.Addr)
+		}
+	}
+	return peers
+}
+
+// 与完整节点握手后请求区块头 并广播未确认的交易
+func (s *Server) startLightSync(peer string) {
+	s.SendGetHeaders(peer)
+	s.broadcastPending([]string{peer})
+}
+
+// 定期请求区块头、重试超时的过滤器和区块请求并重新广播未确认的交易
+func (s *Server) lightLoop() {
+	ticker := time.NewTicker(lightInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+		peers := s.fullPeers()
+		if len(peers) == 0 {
+			continue
+		}
+		s.SendGetHeaders(peers[0])
+		s.syncLight(peers[0])
+		s.broadcastPending(peers)
+	}
+}
+
+// HandleHeaders 处理区块头 添加到区块头链后继续同步
+func (s *Server) HandleHeaders(req []byte) error {
+	var data Headers
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	if s.Light == nil {
+		return fmt.Errorf("unexpected headers from peer[%s]", data.AddrFrom)
+	}
+	if len(data.Headers) > maxHeadersResult {
+		return misbehave(ScoreOversized, "%d headers exceed %d", len(data.Headers), maxHeadersResult)
+	}
+	changed, err := s.Light.Headers.Add(data.Headers)
+	if err != nil {
+		return misbehave(ScoreInvalidBlock, "headers: %v", err)
+	}
+	if changed {
+		tip := s.Light.Headers.Tip()
+		fmt.Printf("header chain tip: block[%x] at height %d\n", tip.Hash, tip.Height)
+	}
+	if len(data.Headers) == maxHeadersResult {
+		// 对方可能还有更多区块头
+		s.SendGetHeaders(data.AddrFrom)
+	}
+	s.syncLight(data.AddrFrom)
+	return nil
+}
+
+// 断开钱包同步的分叉上的区块 返回钱包是否改变
+// 钱包同步的区块不在区块头链中时清除交易记录 从创世区块重新同步
+func (light *LightClient) disconnectForks(wallets *wallet.Wallets) bool {
+	changed := false
+	for {
+		synced, _ := wallets.SyncedTip()
+		if synced == nil || light.Headers.IsMain(synced) {
+			return changed
+		}
+		header, ok := light.Headers.Get(synced)
+		if !ok {
+			wallets.ResetHistory()
+			return true
+		}
+		wallets.DisconnectBlock(headerRef(header))
+		changed = true
+	}
+}
+
+// 主链上已知过滤器头的最高区块的高度 过滤器头按区块的祖先依次验证 该区块之前的过滤器头都已知
+func (light *LightClient) filterHeight() int64 {
+	for height := light.Headers.Height(); height > 0; height-- {
+		header, _ := light.Headers.AtHeight(height)
+		if _, ok := light.cfheaders[hex.EncodeToString(header.Hash)]; ok {
+			return height
+		}
+	}
+	return 0
+}
+
+// 将钱包同步到区块头链的最新区块 向节点peer请求缺少的过滤器头、过滤器和匹配的区块
+// 过滤器按固定边界分批请求 同一批的过滤器可能乱序到达 超时前不重复请求
+func (s *Server) syncLight(peer string) {
+	light := s.Light
+	light.mu.Lock()
+	defer light.mu.Unlock()
+	wallets := light.store.Load()
+	changed := light.disconnectForks(wallets)
+	defer func() {
+		if changed {
+			light.store.Save(wallets)
+		}
+	}()
+
+	verified := light.filterHeight()
+	if height := light.Headers.Height(); verified < height {
+		if verified+maxCFHeadersResult < height {
+			height = verified + maxCFHeadersResult
+		}
+		stop, _ := light.Headers.AtHeight(height)
+		if !light.cfheadersReq.waiting(stop.Hash) {
+			light.cfheadersReq.start(stop.Hash)
+			s.SendGetCFHeaders(peer, verified+1, stop.Hash)
+		}
+	}
+
+	items := watchItems(wallets)
+	for {
+		_, scanned := wallets.SyncedTip()
+		next, ok := light.Headers.AtHeight(scanned + 1)
+		if !ok || next.Height > verified {
+			return
+		}
+		key := hex.EncodeToString(next.Hash)
+		filter, ok := light.filters[key]
+		if !ok {
+			height := (next.Height-1)/maxCFiltersResult*maxCFiltersResult + maxCFiltersResult
+			if height > verified {
+				height = verified
+			}
+			stop, _ := light.Headers.AtHeight(height)
+			if !light.cfiltersReq.waiting(stop.Hash) {
+				light.cfiltersReq.start(stop.Hash)
+				s.SendGetCFilters(peer, next.Height, stop.Hash)
+			}
+			return
+		}
+		// 过滤器已与过滤器头验证 解码失败时按匹配处理 下载区块
+		matched, err := filter.MatchAny(block.FilterKey(next.Hash), items)
+		if matched || err != nil {
+			if !light.blockReq.waiting(next.Hash) {
+				light.blockReq.start(next.Hash)
+				s.SendGetData(peer, next.Hash)
+			}
+			return
+		}
+		delete(light.filters, key)
+		wallets.ConnectBlock(headerRef(next), nil)
+		changed = true
+	}
+}
+
+// HandleCFHeaders 处理过滤器哈希 由已知的过滤器头依次计算并保存各区块的过滤器头
+func (s *Server) HandleCFHeaders(req []byte) error {
+	var data CFHeaders
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	if s.Light == nil {
+		return fmt.Errorf("unexpected filter headers from peer[%s]", data.AddrFrom)
+	}
+	if len(data.FilterHashes) > maxCFHeadersResult {
+		return misbehave(ScoreOversized, "%d filter hashes exceed %d", len(data.FilterHashes), maxCFHeadersResult)
+	}
+	s.Light.mu.Lock()
+	err := s.Light.addCFHeaders(&data)
+	s.Light.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	s.syncLight(data.AddrFrom)
+	return nil
+}
+
+// 计算过滤器头 StartHeight前一个区块的过滤器头须与已知的一致 区块由区块头链确定
+// 轻节点信任提供区块头的完整节点的过滤器哈希 过滤器头链保证之后下载的过滤器与之一致
+func (light *LightClient) addCFHeaders(data *CFHeaders) error {
+	stop, ok := light.Headers.Get(data.StopHash)
+	if !ok {
+		return fmt.Errorf("block[%x] of the filter headers is not in the header chain", data.StopHash)
+	}
+	if data.StartHeight < 1 || stop.Height-data.StartHeight+1 != int64(len(data.FilterHashes)) {
+		return misbehave(ScoreMalformed, "%d filter hashes for heights %d to %d", len(data.FilterHashes), data.StartHeight, stop.Height)
+	}
+	hashes := make([][]byte, len(data.FilterHashes))
+	first := stop
+	for i := len(hashes) - 1; i >= 0; i-- {
+		hashes[i] = first.Hash
+		if i > 0 {
+			if first, ok = light.Headers.Get(first.PrevBlockHash); !ok {
+				return fmt.Errorf("block[%x] is not in the header chain", hashes[i])
+			}
+		}
+	}
+	prevHeader := block.ZeroFilterHeader()
+	if !first.IsGenesis() {
+		if prevHeader, ok = light.cfheaders[hex.EncodeToString(first.PrevBlockHash)]; !ok {
+			return fmt.Errorf("filter header of block[%x] is unknown", first.PrevBlockHash)
+		}
+	}
+	if !bytes.Equal(prevHeader, data.PrevHeader) {
+		return misbehave(ScoreInvalidBlock, "filter headers do not follow block[%x]", first.PrevBlockHash)
+	}
+	for i, filterHash := range data.FilterHashes {
+		prevHeader = block.FilterHeader(filterHash, prevHeader)
+		light.cfheaders[hex.EncodeToString(hashes[i])] = prevHeader
+	}
+	light.cfheadersReq.done(stop.Hash)
+	return nil
+}
+
+// HandleCFilter 处理区块过滤器 与过滤器头不一致的过滤器受到惩罚
+func (s *Server) HandleCFilter(req []byte) error {
+	var data CFilterData
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	light := s.Light
+	if light == nil {
+		return fmt.Errorf("unexpected filter from peer[%s]", data.AddrFrom)
+	}
+	filter, err := gcs.FromBytes(data.Filter)
+	if err != nil {
+		return misbehave(ScoreMalformed, "filter of block[%x]: %v", data.BlockHash, err)
+	}
+	header, ok := light.Headers.Get(data.BlockHash)
+	if !ok {
+		return fmt.Errorf("block[%x] of the filter is not in the header chain", data.BlockHash)
+	}
+
+	light.mu.Lock()
+	key := hex.EncodeToString(header.Hash)
+	expected, ok := light.cfheaders[key]
+	prevHeader := block.ZeroFilterHeader()
+	if ok && !header.IsGenesis() {
+		prevHeader, ok = light.cfheaders[hex.EncodeToString(header.PrevBlockHash)]
+	}
+	if !ok {
+		light.mu.Unlock()
+		return fmt.Errorf("filter header of block[%x] is unknown", header.Hash)
+	}
+	if !bytes.Equal(block.FilterHeader(block.FilterHash(data.Filter), prevHeader), expected) {
+		light.mu.Unlock()
+		return misbehave(ScoreInvalidBlock, "filter of block[%x] does not match its filter header", header.Hash)
+	}
+	light.filters[key] = filter
+	light.mu.Unlock()
+
+	s.syncLight(data.AddrFrom)
+	return nil
+}
+
+// 轻节点处理过滤器匹配后请求的区块 交易须与区块头链中区块头的Merkle根一致
+// 区块中与钱包无关的交易不会被记录
+func (s *Server) handleLightBlock(from string, b *block.Block) error {
+	light := s.Light
+	header, ok := light.Headers.Get(b.Hash)
+	if !ok {
+		return fmt.Errorf("block[%x] is not in the header chain", b.Hash)
+	}
+	tree := b.MerkleTree()
+	if tree.Mutated || !bytes.Equal(tree.Root.Data, header.MerkleRoot) ||
+		b.Height != header.Height || !bytes.Equal(b.PrevBlockHash, header.PrevBlockHash) {
+		return misbehave(ScoreInvalidBlock, "block[%x] does not match its header", b.Hash)
+	}
+	var views []*wallet.TxView
+	for _, tx := range b.Txs {
+		views = append(views, block.WalletTxView(tx))
+	}
+
+	light.mu.Lock()
+	light.blockReq.done(header.Hash)
+	wallets := light.store.Load()
+	_, scanned := wallets.SyncedTip()
+	if header.Height == scanned+1 && light.Headers.IsMain(header.Hash) {
+		wallets.ConnectBlock(headerRef(header), views)
+		light.store.Save(wallets)
+		delete(light.filters, hex.EncodeToString(header.Hash))
+		light.fetched++
+		fmt.Printf("wallet synced to block[%x] at height %d\n", header.Hash, header.Height)
+	}
+	light.mu.Unlock()
+
+	s.syncLight(from)
+	return nil
+}
+
+// 向完整节点广播钱包中未确认的交易
+func (s *Server) broadcastPending(peers []string) {
+	s.Light.mu.Lock()
+	pending := pendingTxs(s.Light.store.Load())
+	s.Light.mu.Unlock()
+	for _, tx := range pending {
+		for _, peer := range peers {
+			s.SendTx(peer, tx)
+		}
+	}
+}
+
+// AddPendingTx 将钱包的新交易记录为未确认 由运行中的节点提交到交易池或由轻节点广播 直到确认
+func AddPendingTx(wallets *wallet.Wallets, tx *block.Transaction) {
+	view := block.WalletTxView(tx)
+	view.Raw = tx.Serialize()
+	wallets.AddUnconfirmed(view)
+}
+
+// SendLightTx 记录轻节点钱包的新交易并立即广播
+func (s *Server) SendLightTx(tx *block.Transaction) {
+	s.Light.mu.Lock()
+	wallets := s.Light.store.Load()
+	AddPendingTx(wallets, tx)
+	s.Light.store.Save(wallets)
+	s.Light.mu.Unlock()
+	for _, peer := range s.fullPeers() {
+		s.SendTx(peer, tx)
+	}
+}
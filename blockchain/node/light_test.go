@@ -0,0 +1,399 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/wallet"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	lightTestAmount  = 3
+	lightTestFeeRate = 1
+	lightTestTimeout = 3 * lightInterval // 允许丢失的请求在超时后重试
+)
+
+// 共享创世区块的两条区块链 分别挖到mainHeight和forkHeight
+func newForkedChains(t *testing.T, mainHeight, forkHeight int64) (main, fork *block.Chain) {
+	t.Helper()
+	miner := string(wallet.NewWallet().GetAddress())
+	genesis := block.CreateGenesisBlock([]*block.Transaction{block.NewCoinbaseTransaction(miner)})
+	open := func(name string, height int64) *block.Chain {
+		chain, err := block.NewChainWithGenesis(filepath.Join(t.TempDir(), name), genesis, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { chain.DB.Close() })
+		for chain.GetHeight() < height {
+			chain.MineBlock(nil, miner)
+		}
+		return chain
+	}
+	return open("main.db", mainHeight), open("fork.db", forkHeight)
+}
+
+// 创建只保存在内存中的轻节点 区块头和封禁列表保存在临时目录
+func newTestLight(t *testing.T, network *MemoryNetwork, addr string, w *wallet.Wallet) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	light := newLightClient(NewHeaderChainFile(filepath.Join(dir, "headers.dat")), memoryWalletStore{wallet.NewMemoryWallets(w)})
+	s := NewLightServer(addr, addr, light, network.Transport(addr))
+	s.banList = NewBanListFile(filepath.Join(dir, fmt.Sprintf(banListFile, addr)))
+	s.Fees = NewFeeEstimatorFile(filepath.Join(dir, fmt.Sprintf(feeEstimatesFile, addr)))
+	s.KnownNodes = nil
+	return s
+}
+
+// 区块头的副本 修改不影响区块链返回的区块头
+func copyHeader(header *block.BlockHeader) *block.BlockHeader {
+	h := *header
+	return &h
+}
+
+func TestHeaderChainAdd(t *testing.T) {
+	main, fork := newForkedChains(t, 4, 2)
+	headers, other := main.GetHeaders(), fork.GetHeaders()
+	tampered := copyHeader(headers[2])
+	tampered.Nonce++
+	otherGenesis, _ := newForkedChains(t, 1, 1)
+	tests := []struct {
+		name    string
+		headers []*block.BlockHeader
+		err     error
+		height  int64 // 添加后的主链高度
+	}{
+		{"linked headers", headers, nil, 4},
+		{"known headers are skipped", append(headers[:2:2], headers...), nil, 4},
+		{"nil header", []*block.BlockHeader{headers[0], nil}, block.ErrInvalidHeader, 1},
+		{"invalid proof of work", []*block.BlockHeader{headers[0], headers[1], tampered, headers[3]}, block.ErrInvalidHeader, 2},
+		{"unknown previous header", []*block.BlockHeader{headers[0], headers[2]}, ErrOrphanHeader, 1},
+		{"second genesis", []*block.BlockHeader{headers[0], otherGenesis.GetHeaders()[0]}, block.ErrBrokenHeaders, 1},
+		{"fork does not replace a higher tip", append(headers[:3:3], other[1]), nil, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hc := NewHeaderChainFile(filepath.Join(t.TempDir(), "headers.dat"))
+			_, err := hc.Add(test.headers)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Add() = %v, want %v", err, test.err)
+			}
+			if height := hc.Height(); height != test.height {
+				t.Fatalf("height = %d, want %d", height, test.height)
+			}
+			if tip := hc.Tip(); !bytes.Equal(tip.Hash, headers[test.height-1].Hash) {
+				t.Fatalf("tip = block[%x], want block[%x]", tip.Hash, headers[test.height-1].Hash)
+			}
+		})
+	}
+}
+
+// 更高的分叉取代主链 主链在重新加载后保留
+func TestHeaderChainReorganize(t *testing.T) {
+	main, fork := newForkedChains(t, 3, 4)
+	headers, other := main.GetHeaders(), fork.GetHeaders()
+	name := filepath.Join(t.TempDir(), "headers.dat")
+	hc := NewHeaderChainFile(name)
+	if _, err := hc.Add(headers); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := hc.Add(other)
+	if err != nil || !changed {
+		t.Fatalf("Add(fork) = %v, %v", changed, err)
+	}
+	for _, reloaded := range []*HeaderChain{hc, NewHeaderChainFile(name)} {
+		if reloaded.Height() != 4 || !bytes.Equal(reloaded.Tip().Hash, other[3].Hash) {
+			t.Fatalf("tip = block[%x] at height %d, want the fork tip", reloaded.Tip().Hash, reloaded.Height())
+		}
+		if reloaded.IsMain(headers[2].Hash) || !reloaded.IsMain(headers[0].Hash) {
+			t.Fatal("the replaced block is still on the main chain")
+		}
+		if _, ok := reloaded.Get(headers[2].Hash); !ok {
+			t.Fatal("the fork header was dropped")
+		}
+	}
+}
+
+// 过滤器头由过滤器哈希和前一个过滤器头依次计算 与完整节点保存的一致
+// 不连接已知过滤器头或数量不符的过滤器哈希被拒绝
+func TestLightFilterHeaders(t *testing.T) {
+	main, _ := newForkedChains(t, 4, 1)
+	headers := main.GetHeaders()
+	light := newTestLight(t, NewMemoryNetwork(), "light:3001", wallet.NewWallet()).Light
+	if _, err := light.Headers.Add(headers); err != nil {
+		t.Fatal(err)
+	}
+	cfheaders := func(startHeight int64) *CFHeaders {
+		prevHeader, filterHashes, err := main.CFHeaders(startHeight, headers[3].Hash, maxCFHeadersResult)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &CFHeaders{StartHeight: startHeight, StopHash: headers[3].Hash, PrevHeader: prevHeader, FilterHashes: filterHashes}
+	}
+
+	unknown := cfheaders(3)
+	if err := light.addCFHeaders(unknown); err == nil {
+		t.Fatal("filter headers after an unknown filter header were accepted")
+	}
+	wrongPrev := cfheaders(1)
+	wrongPrev.PrevHeader = wrongPrev.FilterHashes[0]
+	if err := light.addCFHeaders(wrongPrev); err == nil {
+		t.Fatal("filter headers with a wrong previous header were accepted")
+	}
+	missing := cfheaders(1)
+	missing.FilterHashes = missing.FilterHashes[1:]
+	if err := light.addCFHeaders(missing); err == nil {
+		t.Fatal("filter hashes that do not cover the range were accepted")
+	}
+	if len(light.cfheaders) != 0 {
+		t.Fatalf("%d filter headers saved from rejected responses", len(light.cfheaders))
+	}
+
+	if err := light.addCFHeaders(cfheaders(1)); err != nil {
+		t.Fatal(err)
+	}
+	for _, header := range headers {
+		filter, err := main.GetCFilter(header.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(light.cfheaders[hex.EncodeToString(header.Hash)], filter.Header) {
+			t.Fatalf("filter header of block %d differs from the full node", header.Height)
+		}
+	}
+}
+
+// 与过滤器头一致的过滤器使钱包同步 不一致的过滤器使对方被封禁
+func TestLightFilterVerified(t *testing.T) {
+	network := NewMemoryNetwork()
+	full := newTestServer(t, network, "full:3000")
+	for i := 0; i < 2; i++ {
+		full.Chain.MineBlock(nil, string(wallet.NewWallet().GetAddress()))
+	}
+	s := newTestLight(t, network, "light:3001", wallet.NewWallet())
+	headers := full.Chain.GetHeaders()
+	if _, err := s.Light.Headers.Add(headers); err != nil {
+		t.Fatal(err)
+	}
+	prevHeader, filterHashes, err := full.Chain.CFHeaders(1, headers[2].Hash, maxCFHeadersResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Light.addCFHeaders(&CFHeaders{StartHeight: 1, StopHash: headers[2].Hash, PrevHeader: prevHeader, FilterHashes: filterHashes}); err != nil {
+		t.Fatal(err)
+	}
+	deliver(s, full.Addr, VERSION, full.newVersion())
+	filters := make([][]byte, len(headers))
+	for i, header := range headers {
+		filter, err := full.Chain.GetCFilter(header.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filters[i] = filter.Filter
+	}
+
+	// 钱包与前两个区块不匹配 过滤器验证后直接连接
+	for i := 0; i < 2; i++ {
+		deliver(s, full.Addr, CMDCFILTER, CFilterData{AddrFrom: full.Addr, BlockHash: headers[i].Hash, Filter: filters[i]})
+	}
+	s.Light.mu.Lock()
+	_, synced := s.Light.store.Load().SyncedTip()
+	s.Light.mu.Unlock()
+	if synced != 2 || s.PeerScore("full") != 0 {
+		t.Fatalf("wallet synced to height %d with peer score %d, want height 2", synced, s.PeerScore("full"))
+	}
+
+	deliver(s, full.Addr, CMDCFILTER, CFilterData{AddrFrom: full.Addr, BlockHash: headers[2].Hash, Filter: filters[1]})
+	if !s.isBanned("full") {
+		t.Fatal("the peer sending a mismatched filter is not banned")
+	}
+	s.Light.mu.Lock()
+	_, saved := s.Light.filters[hex.EncodeToString(headers[2].Hash)]
+	s.Light.mu.Unlock()
+	if saved {
+		t.Fatal("the mismatched filter was saved")
+	}
+}
+
+// AddLightNode 添加轻节点 钱包w只保存在内存中 须在Start之前调用
+func (sim *Simulation) AddLightNode(t *testing.T, w *wallet.Wallet) *Server {
+	t.Helper()
+	i := len(sim.LightNodes)
+	server := newTestLight(t, sim.Network, fmt.Sprintf("light%d:%d", i, port+len(sim.Nodes)+i), w)
+	sim.LightNodes = append(sim.LightNodes, server)
+	return server
+}
+
+// 等待所有节点的交易池包含交易
+func (sim *Simulation) waitTx(txHash []byte, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		done := true
+		for _, server := range sim.Nodes {
+			if !server.Mempool.Has(txHash) {
+				done = false
+				break
+			}
+		}
+		if done {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+// 等待轻节点i的区块头链和钱包同步到完整节点j的最新区块
+func (sim *Simulation) waitLightSynced(t *testing.T, i, j int) {
+	t.Helper()
+	light := sim.LightNodes[i].Light
+	deadline := time.Now().Add(lightTestTimeout)
+	for {
+		tip, _ := sim.state(j)
+		header := light.Headers.Tip()
+		light.mu.Lock()
+		synced, _ := light.store.Load().SyncedTip()
+		light.mu.Unlock()
+		if header != nil && bytes.Equal(header.Hash, tip) && bytes.Equal(synced, tip) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("light node %d synced to block[%x], node%d tip is block[%x]", i, synced, j, tip)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func waitConverged(t *testing.T, sim *Simulation) {
+	t.Helper()
+	if err := sim.WaitConverged(lightTestTimeout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 轻节点钱包中的交易记录
+func (light *LightClient) transaction(txHash []byte) (wallet.TxRecord, bool) {
+	light.mu.Lock()
+	defer light.mu.Unlock()
+	rec, ok := light.store.Load().Transaction(txHash)
+	if !ok {
+		return wallet.TxRecord{}, false
+	}
+	return *rec, true
+}
+
+// 区块是否包含交易
+func blockHasTx(b *block.Block, tx *block.Transaction) bool {
+	for _, t := range b.Txs {
+		if bytes.Equal(t.TxHash, tx.TxHash) {
+			return true
+		}
+	}
+	return false
+}
+
+// 完整节点向轻节点的钱包付款 轻节点只通过区块头和区块过滤器同步钱包 只下载与钱包匹配的区块
+// 之后轻节点由钱包跟踪的输出构造交易并广播 打包后检查确认和余额
+// 最后在网络分区中让确认交易的区块被更长的分叉取代 钱包中的交易恢复为未确认
+func TestLightSync(t *testing.T) {
+	minerWallet := wallet.NewWallet()
+	sim := newSimulation(t, 2, string(minerWallet.GetAddress()))
+	server := sim.AddLightNode(t, wallet.NewWallet())
+	if err := sim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sim.ConnectAll()
+	server.SendVersion(sim.Nodes[0].Addr)
+	light := server.Light
+	light.mu.Lock()
+	lightAddress := light.store.Load().Addresses()[0]
+	light.mu.Unlock()
+	payee := string(wallet.NewWallet().GetAddress())
+
+	// 挖矿奖励转入轻节点钱包
+	var rewards []*block.Transaction
+	for i := 0; i < 3; i++ {
+		rewards = append(rewards, sim.Mine(0).Txs[0])
+	}
+	waitConverged(t, sim)
+	funding, err := sim.Pay(0, minerWallet, rewards[0], lightAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sim.waitTx(funding.TxHash, lightTestTimeout) {
+		t.Fatalf("funding transaction[%x] did not propagate", funding.TxHash)
+	}
+	sim.Mine(1)
+	waitConverged(t, sim)
+	sim.waitLightSynced(t, 0, 0)
+	funded := funding.Vouts[0].Value
+	if balance := light.Balance(); balance.Confirmed != funded {
+		t.Fatalf("light wallet balance %d, want %d", balance.Confirmed, funded)
+	}
+	light.mu.Lock()
+	recorded := len(light.store.Load().Transactions())
+	fetched := light.fetched
+	light.mu.Unlock()
+	if recorded != 1 {
+		t.Fatalf("light wallet recorded %d transactions, want only the funding transaction", recorded)
+	}
+	// 除误判外只下载付款所在的区块
+	if height := light.Headers.Height(); fetched < 1 || int64(fetched) > height/2 {
+		t.Fatalf("light node downloaded %d of %d blocks", fetched, height)
+	}
+
+	// 轻节点由钱包的输出构造交易 网络分区中只有完整节点0收到交易
+	sim.Network.Partition([]string{sim.Nodes[0].Addr, server.Addr}, []string{sim.Nodes[1].Addr})
+	light.mu.Lock()
+	wallets := light.store.Load()
+	opts := &block.SendOptions{Selector: block.DefaultCoinSelector, FeeRate: lightTestFeeRate, Dust: -1}
+	builder := block.NewTxBuilder(&block.WalletSource{Wallets: wallets, Maturity: light.Headers.Maturity()}, nil).
+		From(lightAddress).AddOutput(payee, lightTestAmount).Options(opts)
+	tx, selection, err := builder.Build()
+	if err == nil {
+		err = builder.Sign(tx, wallets)
+	}
+	light.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SendLightTx(tx)
+	deadline := time.Now().Add(lightTestTimeout)
+	for !sim.Nodes[0].Mempool.Has(tx.TxHash) {
+		if time.Now().After(deadline) {
+			t.Fatalf("light transaction[%x] did not reach node0", tx.TxHash)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	confirmed := sim.Mine(0)
+	if !blockHasTx(confirmed, tx) {
+		t.Fatalf("block[%x] does not include the light transaction", confirmed.Hash)
+	}
+	sim.waitLightSynced(t, 0, 0)
+	rec, ok := light.transaction(tx.TxHash)
+	if !ok || rec.Height != confirmed.Height {
+		t.Fatalf("light transaction[%x] not confirmed at height %d", tx.TxHash, confirmed.Height)
+	}
+	if balance := light.Balance(); balance.Confirmed != selection.Change || balance.Unconfirmed != 0 {
+		t.Fatalf("light wallet balance %+v, want change %d", balance, selection.Change)
+	}
+
+	// 另一侧挖出更长的分叉 分区恢复后确认交易的区块被取代
+	for i := 0; i < 3; i++ {
+		sim.Mine(1)
+	}
+	sim.Network.Heal()
+	sim.Mine(1)
+	waitConverged(t, sim)
+	sim.waitLightSynced(t, 0, 0)
+	if light.Headers.IsMain(confirmed.Hash) {
+		t.Fatalf("block[%x] is still in the light header chain", confirmed.Hash)
+	}
+	if rec, ok := light.transaction(tx.TxHash); !ok || rec.Height != 0 {
+		t.Fatalf("light transaction[%x] is still confirmed after the reorganization", tx.TxHash)
+	}
+}
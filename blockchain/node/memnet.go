@@ -0,0 +1,218 @@
+package node
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 内存网络 用于在同一进程中运行多个节点
+// 可以为节点之间的链路设置延迟和丢包率 也可以将节点划分到不同的网络分区
+// 丢包由固定种子的随机数决定 同样的消息顺序得到同样的丢包结果 便于复现
+
+var (
+	ErrConnRefused = errors.New("connection refused")
+	ErrPartitioned = errors.New("peers are partitioned")
+	errListenerUp  = errors.New("address already in use")
+	errClosed      = errors.New("listener closed")
+)
+
+const memNetworkSeed = 1 // 丢包随机数的种子
+
+// 链路 发送方->接收方
+type link struct {
+	from, to string
+}
+
+// MemoryNetwork 内存网络
+type MemoryNetwork struct {
+	mu        sync.Mutex
+	listeners map[string]*memListener
+	delays    map[link]time.Duration
+	dropRates map[link]float64
+	partition map[string]int // 节点所在分区 未设置的节点位于分区0
+	rng       *rand.Rand
+
+	Delivered int64 // 已投递的消息数
+	Dropped   int64 // 丢弃的消息数
+}
+
+// NewMemoryNetwork 创建内存网络
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		listeners: make(map[string]*memListener),
+		delays:    make(map[link]time.Duration),
+		dropRates: make(map[link]float64),
+		partition: make(map[string]int),
+		rng:       rand.New(rand.NewSource(memNetworkSeed)),
+	}
+}
+
+// Transport 获取指定节点使用的传输
+func (n *MemoryNetwork) Transport(addr string) Transport {
+	return &memTransport{network: n, addr: addr}
+}
+
+// SetDelay 设置链路延迟
+func (n *MemoryNetwork) SetDelay(from, to string, delay time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.delays[link{from, to}] = delay
+}
+
+// SetDropRate 设置链路丢包率 取值[0,1]
+func (n *MemoryNetwork) SetDropRate(from, to string, rate float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.dropRates[link{from, to}] = rate
+}
+
+// Partition 将节点划分到不同分区 不同分区之间的消息被丢弃
+func (n *MemoryNetwork) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partition = make(map[string]int)
+	for i, group := range groups {
+		for _, addr := range group {
+			n.partition[addr] = i + 1
+		}
+	}
+}
+
+// Heal 取消所有分区
+func (n *MemoryNetwork) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partition = make(map[string]int)
+}
+
+// 建立从from到to的连接
+func (n *MemoryNetwork) dial(from, to string) (net.Conn, error) {
+	n.mu.Lock()
+	listener, ok := n.listeners[to]
+	if !ok {
+		n.mu.Unlock()
+		return nil, ErrConnRefused
+	}
+	if n.partition[from] != n.partition[to] {
+		n.mu.Unlock()
+		atomic.AddInt64(&n.Dropped, 1)
+		return nil, ErrPartitioned
+	}
+	delay := n.delays[link{from, to}]
+	drop := n.rng.Float64() < n.dropRates[link{from, to}]
+	n.mu.Unlock()
+
+	client, server := net.Pipe()
+	clientConn := &memConn{client, memAddr(from), memAddr(to)}
+	serverConn := &memConn{server, memAddr(to), memAddr(from)}
+	if drop {
+		// 发送方无法感知丢包 数据被直接丢弃
+		atomic.AddInt64(&n.Dropped, 1)
+		go func() {
+			io.Copy(ioutil.Discard, serverConn)
+			serverConn.Close()
+		}()
+		return clientConn, nil
+	}
+	go func() {
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		select {
+		case listener.conns <- serverConn:
+			atomic.AddInt64(&n.Delivered, 1)
+		case <-listener.closed:
+			serverConn.Close()
+		}
+	}()
+	return clientConn, nil
+}
+
+// 内存网络中的传输
+type memTransport struct {
+	network *MemoryNetwork
+	addr    string // 本节点地址
+}
+
+func (t *memTransport) Listen(addr string) (net.Listener, error) {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+	if _, ok := t.network.listeners[addr]; ok {
+		return nil, errListenerUp
+	}
+	listener := &memListener{
+		network: t.network,
+		addr:    addr,
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	t.network.listeners[addr] = listener
+	return listener, nil
+}
+
+func (t *memTransport) Dial(addr string) (net.Conn, error) {
+	return t.network.dial(t.addr, addr)
+}
+
+// 内存网络中的监听器
+type memListener struct {
+	network *MemoryNetwork
+	addr    string
+	conns   chan net.Conn
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errClosed
+	}
+}
+
+func (l *memListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.network.mu.Lock()
+		delete(l.network.listeners, l.addr)
+		l.network.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return memAddr(l.addr)
+}
+
+// 内存网络地址
+type memAddr string
+
+func (a memAddr) Network() string {
+	return "mem"
+}
+
+func (a memAddr) String() string {
+	return string(a)
+}
+
+// 内存连接 记录双方地址
+type memConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *memConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *memConn) RemoteAddr() net.Addr {
+	return c.remote
+}
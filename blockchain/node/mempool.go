@@ -0,0 +1,184 @@
+package node
+
+import (
+	"blockchain/block"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 交易池 保存已验证但尚未打包进区块的交易
+// 交易通过tx消息在节点间传播 区块连接后其中的交易从交易池移除
+// 与池中交易冲突的新交易按替换规则处理 见rbf.go
+
+var ErrConflict = errors.New("transaction conflicts with the mempool")
+
+// MempoolEntry 交易池中的交易
+type MempoolEntry struct {
+	Tx   *block.Transaction
+	Time time.Time // 进入交易池的时间
+	Size int       // 序列化后的字节数
+	Fee  int       // 手续费
+}
+
+// Mempool 交易池
+type Mempool struct {
+	mu      sync.Mutex
+	entries map[string]*MempoolEntry // 交易哈希->交易
+	spent   map[string]string        // 被花费的输出(交易哈希:索引)->花费它的交易哈希
+}
+
+// NewMempool 创建交易池
+func NewMempool() *Mempool {
+	return &Mempool{
+		entries: make(map[string]*MempoolEntry),
+		spent:   make(map[string]string),
+	}
+}
+
+// 输出的唯一标识
+func outpoint(txHash []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txHash, index)
+}
+
+// Add 添加手续费为fee的交易 返回被替换的交易
+// 与池中交易花费同一输出时按替换规则处理 被替换的交易不允许替换时返回ErrConflict
+func (m *Mempool) Add(tx *block.Transaction, fee int) ([]*block.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := hex.EncodeToString(tx.TxHash)
+	if _, ok := m.entries[key]; ok {
+		return nil, nil
+	}
+	entry := &MempoolEntry{Tx: tx, Time: time.Now(), Size: len(tx.Serialize()), Fee: fee}
+	var replaced []*block.Transaction
+	if conflicts := m.conflicts(tx); len(conflicts) > 0 {
+		evicted, err := m.checkReplacement(entry, conflicts)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range evicted {
+			replaced = append(replaced, m.entries[k].Tx)
+			m.remove(k)
+		}
+	}
+	for _, vin := range tx.Vins {
+		m.spent[outpoint(vin.TxHash, vin.Vout)] = key
+	}
+	m.entries[key] = entry
+	return replaced, nil
+}
+
+// 与交易花费同一输出的池中交易 调用方须持有锁
+func (m *Mempool) conflicts(tx *block.Transaction) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, vin := range tx.Vins {
+		if key, ok := m.spent[outpoint(vin.TxHash, vin.Vout)]; ok && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// 交易及其在池中的所有后代 父交易在前 调用方须持有锁
+func (m *Mempool) withDescendants(keys []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for len(keys) > 0 {
+		key := keys[0]
+		keys = keys[1:]
+		entry, ok := m.entries[key]
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, key)
+		for index := range entry.Tx.Vouts {
+			if child, ok := m.spent[outpoint(entry.Tx.TxHash, index)]; ok {
+				keys = append(keys, child)
+			}
+		}
+	}
+	return result
+}
+
+// 移除交易 调用方须持有锁
+func (m *Mempool) remove(key string) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return
+	}
+	for _, vin := range entry.Tx.Vins {
+		delete(m.spent, outpoint(vin.TxHash, vin.Vout))
+	}
+	delete(m.entries, key)
+}
+
+// Remove 移除交易
+func (m *Mempool) Remove(txHash []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(hex.EncodeToString(txHash))
+}
+
+// RemoveBlockTxs 移除已打包进区块的交易 以及与区块中交易冲突的交易及其后代
+func (m *Mempool) RemoveBlockTxs(b *block.Block) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, tx := range b.Txs {
+		m.remove(hex.EncodeToString(tx.TxHash))
+		if tx.IsCoinbaseTransaction() {
+			continue
+		}
+		for _, key := range m.withDescendants(m.conflicts(tx)) {
+			m.remove(key)
+		}
+	}
+}
+
+// Get 获取交易
+func (m *Mempool) Get(txHash []byte) (*block.Transaction, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.entries[hex.EncodeToString(txHash)]
+	if !ok {
+		return nil, false
+	}
+	return entry.Tx, true
+}
+
+// Has 判断交易是否在交易池中
+func (m *Mempool) Has(txHash []byte) bool {
+	_, ok := m.Get(txHash)
+	return ok
+}
+
+// Txs 按进入交易池的顺序获取所有交易
+func (m *Mempool) Txs() []*block.Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := make([]*MempoolEntry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	txs := make([]*block.Transaction, 0, len(entries))
+	for _, entry := range entries {
+		txs = append(txs, entry.Tx)
+	}
+	return txs
+}
+
+// Size 交易池中的交易数
+func (m *Mempool) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
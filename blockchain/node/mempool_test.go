@@ -0,0 +1,246 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/wallet"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+var testPayee = string(wallet.NewWallet().GetAddress())
+
+// 已确认的输出 交易池不检查区块链
+func confirmedOutPoint(t *testing.T) block.OutPoint {
+	t.Helper()
+	hash := make([]byte, 32)
+	if _, err := rand.Read(hash); err != nil {
+		t.Fatal(err)
+	}
+	return block.OutPoint{TxHash: hash, Index: 0}
+}
+
+// 花费inputs的交易 有outputs个输出 交易池不验证签名和金额
+func poolTx(replaceable bool, outputs int, inputs ...block.OutPoint) *block.Transaction {
+	tx := &block.Transaction{Version: block.TxVersion}
+	for _, input := range inputs {
+		vin := &block.TxInput{TxHash: input.TxHash, Vout: input.Index}
+		if replaceable {
+			vin.Sequence = block.SequenceReplaceable
+		}
+		tx.Vins = append(tx.Vins, vin)
+	}
+	for i := 0; i < outputs; i++ {
+		tx.Vouts = append(tx.Vouts, block.NewTxOutput(1, testPayee))
+	}
+	tx.HashTransaction()
+	return tx
+}
+
+func out(tx *block.Transaction, index int) block.OutPoint {
+	return block.OutPoint{TxHash: tx.TxHash, Index: index}
+}
+
+// 交易花费的第一个输出
+func spentBy(tx *block.Transaction) block.OutPoint {
+	return block.OutPoint{TxHash: tx.Vins[0].TxHash, Index: tx.Vins[0].Vout}
+}
+
+func mustAdd(t *testing.T, m *Mempool, tx *block.Transaction, fee int) {
+	t.Helper()
+	if _, err := m.Add(tx, fee); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMempoolReplacement(t *testing.T) {
+	tests := []struct {
+		name string
+		// 在交易池中加入原交易 返回与之冲突的新交易及其手续费
+		setup    func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int)
+		err      error
+		replaced int
+	}{
+		{"higher fee replaces", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			return poolTx(true, 1, spentBy(original)), 1000
+		}, nil, 1},
+		{"without the replacement signal", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			m.Remove(original.TxHash)
+			final := poolTx(false, 1, spentBy(original))
+			mustAdd(t, m, final, 100)
+			return poolTx(true, 1, spentBy(original)), 1000
+		}, ErrConflict, 0},
+		{"same fee rate", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			return poolTx(true, 2, spentBy(original)), 100
+		}, ErrReplacementFee, 0},
+		{"descendants are evicted", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			child := poolTx(false, 1, out(original, 0))
+			mustAdd(t, m, child, 100)
+			mustAdd(t, m, poolTx(false, 1, out(child, 0)), 100)
+			return poolTx(true, 1, spentBy(original)), 1000
+		}, nil, 3},
+		{"fee does not pay for the evicted descendants", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			mustAdd(t, m, poolTx(false, 1, out(original, 0)), 500)
+			return poolTx(true, 1, spentBy(original)), 300
+		}, ErrReplacementFee, 0},
+		{"spends an output of the replaced transaction", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			return poolTx(true, 1, spentBy(original), out(original, 1)), 1000
+		}, ErrReplacementSpends, 0},
+		{"spends a new unconfirmed input", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			other := poolTx(false, 1, confirmedOutPoint(t))
+			mustAdd(t, m, other, 100)
+			return poolTx(true, 1, spentBy(original), out(other, 0)), 1000
+		}, ErrReplacementInputs, 0},
+		{"evicts too many transactions", func(t *testing.T, m *Mempool, original *block.Transaction) (*block.Transaction, int) {
+			parent := original
+			for i := 0; i < MaxReplacementEvictions; i++ {
+				child := poolTx(false, 1, out(parent, 0))
+				mustAdd(t, m, child, 1)
+				parent = child
+			}
+			return poolTx(true, 1, spentBy(original)), 100000
+		}, ErrTooManyReplacements, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMempool()
+			original := poolTx(true, 2, confirmedOutPoint(t))
+			mustAdd(t, m, original, 100)
+			replacement, fee := test.setup(t, m, original)
+			size := m.Size()
+
+			replaced, err := m.Add(replacement, fee)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("Add() = %v, want %v", err, test.err)
+			}
+			if len(replaced) != test.replaced {
+				t.Fatalf("%d transactions replaced, want %d", len(replaced), test.replaced)
+			}
+			if err != nil {
+				if m.Size() != size || m.Has(replacement.TxHash) {
+					t.Fatal("the rejected replacement changed the mempool")
+				}
+				return
+			}
+			if m.Size() != size-test.replaced+1 || !m.Has(replacement.TxHash) || m.Has(original.TxHash) {
+				t.Fatal("the replacement is not in place of the original")
+			}
+		})
+	}
+}
+
+// 父交易只能与子交易一起打包 子交易的手续费带动零手续费的父交易进入区块
+func TestMempoolBlockTxs(t *testing.T) {
+	tests := []struct {
+		name      string
+		withChild bool
+		fillers   int // 打包的其他交易数
+		parent    bool
+	}{
+		{"parent without fee is left out", false, 2, false},
+		{"child pays for the parent", true, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMempool()
+			parent := poolTx(false, 1, confirmedOutPoint(t))
+			mustAdd(t, m, parent, 0)
+			var fillers []*block.Transaction
+			for i := 0; i < 2; i++ {
+				filler := poolTx(false, 1, confirmedOutPoint(t))
+				mustAdd(t, m, filler, 100)
+				fillers = append(fillers, filler)
+			}
+			fillerSize := len(fillers[0].Serialize())
+			maxSize := 2*fillerSize + 10
+			var child *block.Transaction
+			if test.withChild {
+				child = poolTx(false, 1, out(parent, 0))
+				mustAdd(t, m, child, 10000)
+				maxSize = len(parent.Serialize()) + len(child.Serialize()) + fillerSize + 10
+			}
+
+			txs := m.BlockTxs(maxSize)
+			index := func(tx *block.Transaction) int {
+				for i, selected := range txs {
+					if bytes.Equal(selected.TxHash, tx.TxHash) {
+						return i
+					}
+				}
+				return -1
+			}
+			if (index(parent) >= 0) != test.parent {
+				t.Fatalf("parent selected = %v, want %v", index(parent) >= 0, test.parent)
+			}
+			if test.withChild && index(child) != index(parent)+1 {
+				t.Fatal("the child does not follow its parent")
+			}
+			selected := 0
+			for _, filler := range fillers {
+				if index(filler) >= 0 {
+					selected++
+				}
+			}
+			if selected != test.fillers {
+				t.Fatalf("%d other transactions selected, want %d", selected, test.fillers)
+			}
+		})
+	}
+}
+
+// 命令行生成的替换交易满足交易池的替换规则 费率不足的替换交易被拒绝
+func TestFeeBump(t *testing.T) {
+	owner := wallet.NewWallet()
+	s := newTestServerWithOwner(t, NewMemoryNetwork(), "node0:3000", owner)
+	wallets := wallet.NewMemoryWallets(owner)
+	build := func(replaceable bool) *block.Transaction {
+		opts := block.DefaultSendOptions()
+		opts.FeeRate, opts.Replaceable = 2, replaceable
+		builder := block.NewTxBuilder(s.Chain, nil).From(string(owner.GetAddress())).AddOutput(testPayee, 3).Options(opts)
+		tx, _, err := builder.Build()
+		if err == nil {
+			err = builder.Sign(tx, wallets)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	if _, err := NewFeeBump(s.Chain, wallets, build(false), 0); !errors.Is(err, ErrNotReplaceable) {
+		t.Fatalf("NewFeeBump() without the replacement signal = %v, want %v", err, ErrNotReplaceable)
+	}
+	original := build(true)
+	if err := s.SubmitTx(original); err != nil {
+		t.Fatal(err)
+	}
+
+	low, err := NewFeeBump(s.Chain, wallets, original, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := low.CheckReplacement(original); !errors.Is(err, ErrReplacementFee) {
+		t.Fatalf("CheckReplacement() at the original fee rate = %v, want %v", err, ErrReplacementFee)
+	}
+	if err := s.SubmitTx(low.Tx); !errors.Is(err, ErrReplacementFee) {
+		t.Fatalf("SubmitTx() at the original fee rate = %v, want %v", err, ErrReplacementFee)
+	}
+
+	// 默认使用满足替换规则的最低费率
+	bump, err := NewFeeBump(s.Chain, wallets, original, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bump.CheckReplacement(original); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SubmitTx(bump.Tx); err != nil {
+		t.Fatal(err)
+	}
+	if s.Mempool.Has(original.TxHash) || !s.Mempool.Has(bump.Tx.TxHash) {
+		t.Fatal("the replacement did not replace the original transaction in the mempool")
+	}
+	if bump.Fee <= bump.OriginalFee {
+		t.Fatalf("replacement fee %d is not higher than %d", bump.Fee, bump.OriginalFee)
+	}
+}
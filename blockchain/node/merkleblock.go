@@ -0,0 +1,92 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/utils"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// 交易包含证明的传输
+// 节点通过gettxproof请求交易的证明 对方以merkleblock响应区块头和Merkle证明
+// 接收方验证区块头的工作量证明和Merkle证明 区块须在本地区块链(轻节点为区块头链)中 验证通过后保存证明
+
+// SendGetTxProof 请求交易的包含证明
+func (s *Server) SendGetTxProof(toAddress string, txHash []byte) {
+	data := utils.GobEncoder(GetTxProof{AddrFrom: s.Addr, TxHash: txHash})
+	req := append(utils.CommandToBytes(GETTXPROOF), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendMerkleBlock 发送交易的包含证明
+func (s *Server) SendMerkleBlock(toAddress string, proof *block.TxProof) {
+	data := utils.GobEncoder(MerkleBlock{AddrFrom: s.Addr, Header: proof.Header, Proof: proof.Proof})
+	req := append(utils.CommandToBytes(CMDMERKLEBLOCK), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// HandleGetTxProof 处理交易证明请求 交易不在区块链中时拒绝
+func (s *Server) HandleGetTxProof(req []byte) error {
+	var data GetTxProof
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	proof, err := s.Chain.GetTxProof(data.TxHash)
+	if err != nil {
+		s.SendReject(data.AddrFrom, GETTXPROOF, fmt.Sprintf("transaction[%x]: %v", data.TxHash, err))
+		return nil
+	}
+	s.SendMerkleBlock(data.AddrFrom, proof)
+	return nil
+}
+
+// HandleMerkleBlock 处理交易证明 证明无效的节点受到惩罚
+func (s *Server) HandleMerkleBlock(req []byte) error {
+	var data MerkleBlock
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	proof := &block.TxProof{Header: data.Header, Proof: data.Proof}
+	if err := proof.Verify(); err != nil {
+		return misbehave(ScoreInvalidBlock, "merkle block: %v", err)
+	}
+	if !s.hasBlock(proof.Header.Hash) {
+		return fmt.Errorf("block[%x] of the merkle block is not in the local chain", proof.Header.Hash)
+	}
+	s.proofMu.Lock()
+	s.txProofs[hex.EncodeToString(proof.TxHash())] = proof
+	s.proofMu.Unlock()
+	fmt.Printf("transaction[%x] proved in block[%x] at height %d\n", proof.TxHash(), proof.Header.Hash, proof.Header.Height)
+	return nil
+}
+
+// 本地是否有区块 轻节点查找区块头链
+func (s *Server) hasBlock(hash []byte) bool {
+	if s.Light != nil {
+		_, ok := s.Light.Headers.Get(hash)
+		return ok
+	}
+	return s.Chain.HasBlock(hash)
+}
+
+// TxProof 已收到并验证的交易证明
+func (s *Server) TxProof(txHash []byte) (*block.TxProof, bool) {
+	s.proofMu.Lock()
+	defer s.proofMu.Unlock()
+	proof, ok := s.txProofs[hex.EncodeToString(txHash)]
+	return proof, ok
+}
+
+// RequestTxProof 向节点addr请求交易证明并等待验证通过
+func (s *Server) RequestTxProof(addr string, txHash []byte, timeout time.Duration) (*block.TxProof, bool) {
+	s.SendGetTxProof(addr, txHash)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if proof, ok := s.TxProof(txHash); ok {
+			return proof, true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return nil, false
+}
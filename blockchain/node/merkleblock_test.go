@@ -0,0 +1,58 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/wallet"
+	"testing"
+)
+
+// 验证通过的证明被保存 伪造的证明受到惩罚 不在本地区块链中的区块被忽略
+func TestHandleMerkleBlock(t *testing.T) {
+	owner := wallet.NewWallet()
+	s := newTestServerWithOwner(t, NewMemoryNetwork(), "node0:3000", owner)
+	coinbase := s.Chain.GetLatestBlock().Txs[0]
+	tx := spendOnChain(s, owner, coinbase, 4, 6)
+	s.Chain.MineBlock([]*block.Transaction{tx}, string(owner.GetAddress()))
+	other := newTestServer(t, NewMemoryNetwork(), "other:3000")
+
+	const honest, evil, stranger = "honest:3001", "evil:3002", "stranger:3003"
+	for _, addr := range []string{honest, evil, stranger} {
+		deliver(s, addr, VERSION, testVersion(s, addr))
+	}
+	merkleBlock := func(chain *block.Chain, txHash []byte, from string) MerkleBlock {
+		proof, err := chain.GetTxProof(txHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return MerkleBlock{AddrFrom: from, Header: proof.Header, Proof: proof.Proof}
+	}
+
+	// 其他区块链中的区块 证明本身有效
+	unknown := other.Chain.GetLatestBlock().Txs[0]
+	deliver(s, stranger, CMDMERKLEBLOCK, merkleBlock(other.Chain, unknown.TxHash, stranger))
+	if _, ok := s.TxProof(unknown.TxHash); ok {
+		t.Fatal("proof for a block not in the chain was saved")
+	}
+	if score := s.PeerScore("stranger"); score != 0 {
+		t.Fatalf("stranger peer score = %d, want 0", score)
+	}
+
+	forged := merkleBlock(s.Chain, tx.TxHash, evil)
+	forged.Proof.Leaf = coinbase.TxHash
+	deliver(s, evil, CMDMERKLEBLOCK, forged)
+	if _, ok := s.TxProof(coinbase.TxHash); ok {
+		t.Fatal("forged proof was saved")
+	}
+	if !s.isBanned("evil") {
+		t.Fatal("peer sending a forged proof was not banned")
+	}
+
+	deliver(s, honest, CMDMERKLEBLOCK, merkleBlock(s.Chain, tx.TxHash, honest))
+	proof, ok := s.TxProof(tx.TxHash)
+	if !ok {
+		t.Fatal("valid proof was not saved")
+	}
+	if confirmations, err := proof.VerifyAgainst(s.Chain.GetHeaders()); confirmations != 1 || err != nil {
+		t.Fatalf("VerifyAgainst() = %d, %v, want 1 confirmation", confirmations, err)
+	}
+}
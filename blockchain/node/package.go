@@ -0,0 +1,83 @@
+package node
+
+import (
+	"blockchain/block"
+	"encoding/hex"
+	"sort"
+)
+
+// 按交易包选择打包的交易
+// 交易只能与其在池中的祖先一起打包 祖先在前 父交易手续费率低时 子交易的高手续费可以带动父交易进入区块
+// 每次选择祖先包(交易及其尚未选择的祖先)合计手续费率最高的交易 将整个包加入区块 直到达到字节数上限
+
+// DefaultBlockTxsSize 区块中交易(不含coinbase)的默认字节数上限
+const DefaultBlockTxsSize = 1 << 20
+
+// 交易及其尚未选择的祖先 祖先在前 调用方须持有锁
+func (m *Mempool) ancestorPackage(key string, selected map[string]bool) []string {
+	var pkg []string
+	seen := make(map[string]bool)
+	var visit func(key string)
+	visit = func(key string) {
+		seen[key] = true
+		for _, vin := range m.entries[key].Tx.Vins {
+			parent := hex.EncodeToString(vin.TxHash)
+			if _, ok := m.entries[parent]; ok && !selected[parent] && !seen[parent] {
+				visit(parent)
+			}
+		}
+		pkg = append(pkg, key)
+	}
+	visit(key)
+	return pkg
+}
+
+// BlockTxs 按祖先包手续费率选择打包进下一个区块的交易 交易总字节数不超过maxSize
+func (m *Mempool) BlockTxs(maxSize int) []*block.Transaction {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 手续费率相同时先进入交易池的交易优先
+	keys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return m.entries[keys[i]].Time.Before(m.entries[keys[j]].Time)
+	})
+
+	selected := make(map[string]bool)
+	skipped := make(map[string]bool) // 祖先包超过剩余空间的交易
+	var txs []*block.Transaction
+	size := 0
+	for {
+		var best []string
+		bestFee, bestSize := 0, 0
+		for _, key := range keys {
+			if selected[key] || skipped[key] {
+				continue
+			}
+			pkg := m.ancestorPackage(key, selected)
+			fee, pkgSize := 0, 0
+			for _, k := range pkg {
+				fee += m.entries[k].Fee
+				pkgSize += m.entries[k].Size
+			}
+			if best == nil || fee*bestSize > bestFee*pkgSize {
+				best, bestFee, bestSize = pkg, fee, pkgSize
+			}
+		}
+		if best == nil {
+			break
+		}
+		if size+bestSize > maxSize {
+			skipped[best[len(best)-1]] = true
+			continue
+		}
+		for _, k := range best {
+			selected[k] = true
+			txs = append(txs, m.entries[k].Tx)
+		}
+		size += bestSize
+	}
+	return txs
+}
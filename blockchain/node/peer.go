@@ -0,0 +1,103 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// 节点违规行为评分
+// 对等节点发送无法解析的数据、无效区块、无效交易、超长或未知消息时累计惩罚分
+// 惩罚分达到阈值后断开连接 并在一段时间内拒绝该节点的请求
+// 节点以连接对端的主机地址(加密传输时为身份公钥)标识 不采用消息中自报的地址 否则节点可以换个地址逃避惩罚或使诚实节点被封禁
+
+const (
+	banThreshold   = 100            // 封禁阈值
+	DefaultBanTime = 24 * time.Hour // 默认封禁时长
+	maxMessageSize = 32 << 20       // 单条消息的最大长度
+)
+
+// 各类违规行为的惩罚分
+const (
+	ScoreMalformed    = 20  // 数据无法解析
+	ScoreInvalidBlock = 100 // 无效区块
+	ScoreInvalidTx    = 50  // 无效交易
+	ScoreOversized    = 50  // 消息超长
+	ScoreUnknown      = 10  // 未知命令
+)
+
+// Misbehavior 违规行为 处理请求时返回该错误以惩罚发送方
+type Misbehavior struct {
+	Score  int    // 惩罚分
+	Reason string // 原因
+}
+
+func (m *Misbehavior) Error() string {
+	return fmt.Sprintf("misbehavior(+%d): %s", m.Score, m.Reason)
+}
+
+// 生成违规行为错误
+func misbehave(score int, format string, args ...interface{}) error {
+	return &Misbehavior{Score: score, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Penalize 增加节点惩罚分 达到阈值时封禁节点并返回true
+// peer为连接对端的标识
+func (s *Server) Penalize(peer string, score int, reason string) bool {
+	s.scoreMutex.Lock()
+	s.peerScores[peer] += score
+	total := s.peerScores[peer]
+	if total >= banThreshold {
+		delete(s.peerScores, peer)
+	}
+	s.scoreMutex.Unlock()
+
+	fmt.Printf("peer[%s] misbehaving (+%d => %d): %s\n", peer, score, total, reason)
+	if total < banThreshold {
+		return false
+	}
+	s.banList.Ban(peer, DefaultBanTime, reason)
+	s.removePeersWithID(peer)
+	fmt.Printf("peer[%s] banned for %v\n", peer, DefaultBanTime)
+	return true
+}
+
+// PeerScore 获取节点当前惩罚分
+func (s *Server) PeerScore(peer string) int {
+	s.scoreMutex.Lock()
+	defer s.scoreMutex.Unlock()
+	return s.peerScores[peer]
+}
+
+// 判断节点是否被封禁
+func (s *Server) isBanned(peer string) bool {
+	return s.banList.IsBanned(peer)
+}
+
+// 判断向addr发送消息是否会发给被封禁的节点
+// 已握手的节点按其连接标识判断 未知节点按地址中的主机判断 加密传输在握手后再按身份公钥判断
+func (s *Server) isBannedAddr(addr string) bool {
+	s.peersMutex.Lock()
+	peer, ok := s.peers[addr]
+	id := ""
+	if ok {
+		id = peer.ID
+	}
+	s.peersMutex.Unlock()
+	if id == "" {
+		id = addr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			id = host
+		}
+	}
+	return s.isBanned(id)
+}
+
+// 获取连接对端的主机地址
+func remoteHost(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
@@ -0,0 +1,156 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/utils"
+	"blockchain/wallet"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// 创建使用内存网络的测试节点 区块链、封禁列表和手续费统计保存在临时目录
+func newTestServer(t *testing.T, network *MemoryNetwork, addr string) *Server {
+	t.Helper()
+	return newTestServerWithOwner(t, network, addr, wallet.NewWallet())
+}
+
+// 创建测试节点 创世区块的挖矿奖励属于owner 挖矿奖励无须成熟即可花费
+func newTestServerWithOwner(t *testing.T, network *MemoryNetwork, addr string, owner *wallet.Wallet) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	genesis := block.CreateGenesisBlock([]*block.Transaction{block.NewCoinbaseTransaction(string(owner.GetAddress()))})
+	chain, err := block.NewChainWithGenesis(filepath.Join(dir, "block.db"), genesis, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { chain.DB.Close() })
+	s := NewServer(addr, addr, chain, network.Transport(addr))
+	s.banList = NewBanListFile(filepath.Join(dir, fmt.Sprintf(banListFile, addr)))
+	s.Fees = NewFeeEstimatorFile(filepath.Join(dir, fmt.Sprintf(feeEstimatesFile, addr)))
+	return s
+}
+
+// 模拟从from发起的连接向s发送一条消息
+func deliver(s *Server, from string, command string, payload interface{}) {
+	client, server := net.Pipe()
+	go func() {
+		client.Write(append(utils.CommandToBytes(command), utils.GobEncoder(payload)...))
+		client.Close()
+	}()
+	s.HandleConn(&memConn{server, memAddr(s.Addr), memAddr(from)})
+}
+
+// 启用加密传输 身份密钥不保存到文件
+func useTestKey(t *testing.T, s *Server) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.secureTransport = true
+	s.nodeKey = key
+}
+
+// 模拟sender经过加密连接向s发送一条消息 连接地址为from
+// 加密握手双方同时写入 使用有缓冲的TCP连接代替net.Pipe
+func deliverSecure(t *testing.T, s *Server, sender *Server, from string, command string, payload interface{}) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		sc, err := sender.SecureClient(&memConn{client, memAddr(from), memAddr(s.Addr)})
+		if err != nil {
+			return
+		}
+		sc.Write(append(utils.CommandToBytes(command), utils.GobEncoder(payload)...))
+	}()
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.HandleConn(&memConn{server, memAddr(s.Addr), memAddr(from)})
+}
+
+// 以addrFrom为发送方地址的version
+func testVersion(s *Server, addrFrom string) Version {
+	return Version{
+		ProtocolVersion: ProtocolVersion,
+		Services:        SFNodeFull,
+		GenesisHash:     s.genesisHash,
+		Nonce:           s.nonce + 1,
+		AddrFrom:        addrFrom,
+	}
+}
+
+func TestPenalizeConnectionPeer(t *testing.T) {
+	s := newTestServer(t, NewMemoryNetwork(), "node0:3000")
+	const honest, evil = "honest:3001", "evil:3002"
+	deliver(s, honest, VERSION, testVersion(s, honest))
+	deliver(s, evil, VERSION, testVersion(s, evil))
+
+	// 冒用诚实节点地址的消息被忽略 不影响诚实节点
+	deliver(s, evil, VERSION, testVersion(s, honest))
+	deliver(s, evil, CMDBLOCK, BlockData{AddrFrom: honest, Block: []byte("junk")})
+	if score := s.PeerScore("honest"); score != 0 {
+		t.Fatalf("honest peer score = %d, want 0", score)
+	}
+	if score := s.PeerScore("evil"); score != 0 {
+		t.Fatalf("spoofed message was handled, evil peer score = %d", score)
+	}
+
+	// 惩罚记在连接对端 与消息中的地址无关
+	for i := 0; i < banThreshold/ScoreMalformed; i++ {
+		deliver(s, evil, CMDBLOCK, BlockData{AddrFrom: evil, Block: []byte("junk")})
+	}
+	if !s.isBanned("evil") {
+		t.Fatal("misbehaving peer is not banned")
+	}
+	if s.isBanned("honest") || !s.isVersionReceived(honest) {
+		t.Fatal("honest peer is affected by the misbehaving peer")
+	}
+	if s.isVersionReceived(evil) {
+		t.Fatal("banned peer is still in the peer table")
+	}
+	if !s.isBannedAddr(evil) || s.isBannedAddr(honest) {
+		t.Fatal("messages to the banned peer are not skipped")
+	}
+}
+
+// 加密传输时以身份公钥标识节点 更换连接地址和消息中的地址都不能逃避封禁
+func TestPenalizeSecurePeer(t *testing.T) {
+	network := NewMemoryNetwork()
+	s := newTestServer(t, network, "node0:3000")
+	evil := newTestServer(t, network, "evil:3001")
+	useTestKey(t, s)
+	useTestKey(t, evil)
+	id := peerKeyID(evil.nodeKey.Public().(ed25519.PublicKey))
+
+	for i := 0; i < banThreshold/ScoreMalformed; i++ {
+		addr := fmt.Sprintf("evil%d:3001", i)
+		deliverSecure(t, s, evil, addr, VERSION, testVersion(s, addr))
+		if !s.isVersionReceived(addr) {
+			t.Fatalf("version %d was not handled", i)
+		}
+		deliverSecure(t, s, evil, addr, CMDBLOCK, BlockData{AddrFrom: addr, Block: []byte("junk")})
+	}
+	if !s.isBanned(id) {
+		t.Fatal("misbehaving node key is not banned")
+	}
+	const addr = "evil-new:3001"
+	deliverSecure(t, s, evil, addr, VERSION, testVersion(s, addr))
+	if s.isVersionReceived(addr) {
+		t.Fatal("banned node key was accepted from a new address")
+	}
+}
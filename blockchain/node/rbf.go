@@ -0,0 +1,73 @@
+package node
+
+import (
+	"blockchain/block"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 交易替换
+// 新交易与池中交易花费同一输出时 满足以下规则才能替换 否则拒绝新交易:
+//  1. 与之冲突的交易都带有替换标记 冲突交易在池中的后代随之移除
+//  2. 移除的交易(含后代)不超过MaxReplacementEvictions笔
+//  3. 新交易不花费被移除交易的输出 也不引用冲突交易之外的未确认输入
+//  4. 新交易的手续费率高于每笔冲突交易
+//  5. 新交易的手续费不低于被移除交易的手续费之和 再加上按增量费率计算的自身传播费用
+// 规则5保证每次替换都为占用的带宽付费 反复替换不能免费消耗网络资源
+
+// MaxReplacementEvictions 一次替换最多移除的交易数
+const MaxReplacementEvictions = 100
+
+var (
+	ErrReplacementFee      = errors.New("replacement transaction pays an insufficient fee")
+	ErrTooManyReplacements = errors.New("replacement transaction evicts too many transactions")
+	ErrReplacementInputs   = errors.New("replacement transaction spends new unconfirmed inputs")
+	ErrReplacementSpends   = errors.New("replacement transaction spends an output of a transaction it replaces")
+)
+
+// 检查entry能否替换冲突交易conflicts 返回须移除的交易 调用方须持有锁
+func (m *Mempool) checkReplacement(entry *MempoolEntry, conflicts []string) ([]string, error) {
+	parents := make(map[string]bool) // 冲突交易引用的未确认交易
+	for _, key := range conflicts {
+		conflict := m.entries[key]
+		if !conflict.Tx.SignalsReplacement() {
+			return nil, ErrConflict
+		}
+		for _, vin := range conflict.Tx.Vins {
+			parents[hex.EncodeToString(vin.TxHash)] = true
+		}
+	}
+	evicted := m.withDescendants(conflicts)
+	if len(evicted) > MaxReplacementEvictions {
+		return nil, fmt.Errorf("%w: %d > %d", ErrTooManyReplacements, len(evicted), MaxReplacementEvictions)
+	}
+	removed := make(map[string]bool)
+	for _, key := range evicted {
+		removed[key] = true
+	}
+	for _, vin := range entry.Tx.Vins {
+		parent := hex.EncodeToString(vin.TxHash)
+		if removed[parent] {
+			return nil, ErrReplacementSpends
+		}
+		if _, ok := m.entries[parent]; ok && !parents[parent] {
+			return nil, ErrReplacementInputs
+		}
+	}
+	for _, key := range conflicts {
+		conflict := m.entries[key]
+		if entry.Fee*conflict.Size <= conflict.Fee*entry.Size {
+			return nil, fmt.Errorf("%w: fee rate %d is not higher than %d of transaction[%s]",
+				ErrReplacementFee, block.FeeRate(entry.Fee, entry.Size), block.FeeRate(conflict.Fee, conflict.Size), key)
+		}
+	}
+	fees := 0
+	for _, key := range evicted {
+		fees += m.entries[key].Fee
+	}
+	if min := block.MinReplacementFee(fees, entry.Size); entry.Fee < min {
+		return nil, fmt.Errorf("%w: %d < %d", ErrReplacementFee, entry.Fee, min)
+	}
+	return evicted, nil
+}
@@ -0,0 +1,96 @@
+package node
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 消息丢失后的重试
+// 每条消息使用独立连接发送 丢失的消息不会重发
+// 节点定期重发未得到确认的version 并向完整节点展示最新区块 提交钱包中尚未进入交易池的交易
+// 对方缺少的区块通过inv/getdata补齐 父区块未知的孤块继续请求父区块
+// 长时间未补齐缺失交易的紧凑区块改为请求完整区块
+
+const (
+	resyncInterval     = 5 * time.Second // 重试间隔
+	maxVersionAttempts = 10              // 未收到verack时发送version的最大次数
+)
+
+// 定期重试丢失的握手、区块通知和缺失交易请求
+func (s *Server) resyncLoop() {
+	ticker := time.NewTicker(s.resyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+		s.retryHandshakes()
+		if s.Light == nil {
+			s.announceTip()
+			s.expirePartialBlocks()
+			s.submitWalletTxs()
+		}
+	}
+}
+
+// 向未确认本节点version的节点重发version
+// 对方收到version后总会回复verack 本节点未收到的version也会由对方重发
+func (s *Server) retryHandshakes() {
+	var targets []string
+	s.peersMutex.Lock()
+	for addr, peer := range s.peers {
+		if !peer.VersionSent || peer.VerAckReceived {
+			continue
+		}
+		if peer.versionAttempts >= maxVersionAttempts {
+			fmt.Printf("handshake with peer[%s] timed out\n", addr)
+			delete(s.peers, addr)
+			continue
+		}
+		targets = append(targets, addr)
+	}
+	s.peersMutex.Unlock()
+	for _, addr := range targets {
+		s.SendVersion(addr)
+	}
+}
+
+// 向握手完成的完整节点展示最新区块
+func (s *Server) announceTip() {
+	peers := s.fullPeers()
+	if len(peers) == 0 {
+		return
+	}
+	s.chainMu.Lock()
+	tip := append([]byte{}, s.Chain.Tip...)
+	s.chainMu.Unlock()
+	for _, addr := range peers {
+		if addr != s.Addr {
+			s.SendInv(addr, [][]byte{tip})
+		}
+	}
+}
+
+// 超时未收到缺失交易的紧凑区块 向发送方请求完整区块
+func (s *Server) expirePartialBlocks() {
+	var expired []*partialBlock
+	s.compactMu.Lock()
+	for key, partial := range s.partialBlocks {
+		if time.Since(partial.requested) >= s.resyncInterval {
+			delete(s.partialBlocks, key)
+			expired = append(expired, partial)
+		}
+	}
+	s.compactMu.Unlock()
+	for _, partial := range expired {
+		if s.Chain.HasBlock(partial.header.Hash) {
+			continue
+		}
+		atomic.AddInt64(&s.compactStats.Fallbacks, 1)
+		fmt.Printf("missing transactions of compact block[%x] timed out, request the full block\n", partial.header.Hash)
+		s.SendGetData(partial.from, partial.header.Hash)
+	}
+}
@@ -0,0 +1,336 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// 加密传输
+// 每个节点拥有一个持久化的ed25519身份密钥(nodekey-<NODE_ID>.dat)
+// 建立连接时双方交换临时X25519公钥 通过ECDH和HKDF派生两个方向的会话密钥
+// 随后在加密信道中交换身份公钥及对握手记录的签名 完成相互认证
+// 之后的数据按帧使用ChaCha20-Poly1305加密
+// 白名单模式下 只接受身份公钥在白名单中的节点
+// 启用加密传输后 节点表、惩罚和封禁都以身份公钥(十六进制)标识节点 节点更换地址不能逃避封禁
+
+const (
+	nodeKeyFile      = "nodekey-%s.dat"
+	handshakeTimeout = 10 * time.Second
+	maxFrameSize     = 64 << 10 // 单个加密帧的最大明文长度
+	transportInfo    = "coin secure transport v1"
+)
+
+var ErrNotAllowed = errors.New("peer identity is not in the allowlist")
+
+// LoadNodeKey 加载节点身份密钥 不存在则生成并保存
+func LoadNodeKey(nodeId string) ed25519.PrivateKey {
+	name := fmt.Sprintf(nodeKeyFile, nodeId)
+	content, err := ioutil.ReadFile(name)
+	if err == nil {
+		if len(content) != ed25519.SeedSize {
+			log.Panicf("the node key file[%s] is corrupted\n", name)
+		}
+		return ed25519.NewKeyFromSeed(content)
+	}
+	if !os.IsNotExist(err) {
+		log.Panicf("read the node key file[%s] failed: %v\n", name, err)
+	}
+	_, priKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.Panicf("generate node key failed: %v\n", err)
+	}
+	if err := ioutil.WriteFile(name, priKey.Seed(), 0600); err != nil {
+		log.Panicf("save the node key into file[%s] failed: %v\n", name, err)
+	}
+	return priKey
+}
+
+// NodePublicKey 获取节点身份公钥(十六进制)
+func NodePublicKey(nodeId string) string {
+	return hex.EncodeToString(LoadNodeKey(nodeId).Public().(ed25519.PublicKey))
+}
+
+// LoadAllowlist 读取白名单文件 每行一个十六进制身份公钥 #开头为注释
+func LoadAllowlist(path string) map[string]struct{} {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Panicf("open the allowlist[%s] failed: %v\n", path, err)
+	}
+	defer file.Close()
+	keys := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := hex.DecodeString(line)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			log.Panicf("invalid public key in allowlist: %s\n", line)
+		}
+		keys[hex.EncodeToString(key)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Panicf("read the allowlist[%s] failed: %v\n", path, err)
+	}
+	return keys
+}
+
+// UseSecureTransport 启用加密传输 allowlistPath非空时启用白名单模式
+func (s *Server) UseSecureTransport(allowlistPath string) {
+	s.secureTransport = true
+	s.nodeKey = LoadNodeKey(s.NodeId)
+	if allowlistPath != "" {
+		s.allowlist = LoadAllowlist(allowlistPath)
+	}
+	fmt.Printf("secure transport enabled, node key: %x\n", s.nodeKey.Public())
+}
+
+// 检查对方身份是否允许连接
+func (s *Server) isAllowed(pubKey ed25519.PublicKey) bool {
+	if len(s.allowlist) == 0 {
+		return true
+	}
+	_, ok := s.allowlist[hex.EncodeToString(pubKey)]
+	return ok
+}
+
+// 以身份公钥标识节点 用于节点表、惩罚和封禁
+func peerKeyID(pubKey ed25519.PublicKey) string {
+	return hex.EncodeToString(pubKey)
+}
+
+// SecureConn 加密连接
+type SecureConn struct {
+	net.Conn
+	sendCipher cipher.AEAD
+	recvCipher cipher.AEAD
+	sendNonce  uint64
+	recvNonce  uint64
+	readBuf    bytes.Buffer
+	PeerKey    ed25519.PublicKey // 对方身份公钥
+}
+
+// 生成帧的nonce 每个方向各自递增
+func frameNonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+// 写入一个加密帧: 4字节长度 + 密文
+func (c *SecureConn) writeFrame(plain []byte) error {
+	sealed := c.sendCipher.Seal(nil, frameNonce(c.sendNonce), plain, nil)
+	c.sendNonce++
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(sealed)))
+	if _, err := c.Conn.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := c.Conn.Write(sealed)
+	return err
+}
+
+// 读取并解密一个帧
+func (c *SecureConn) readFrame() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxFrameSize+chacha20poly1305.Overhead {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the limit", size)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(c.Conn, sealed); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	plain, err := c.recvCipher.Open(nil, frameNonce(c.recvNonce), sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt frame failed: %v", err)
+	}
+	c.recvNonce++
+	return plain, nil
+}
+
+// Write 分帧加密写入
+func (c *SecureConn) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		if err := c.writeFrame(data[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		data = data[n:]
+	}
+	return written, nil
+}
+
+// Read 读取解密后的数据
+func (c *SecureConn) Read(data []byte) (int, error) {
+	for c.readBuf.Len() == 0 {
+		plain, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		c.readBuf.Write(plain)
+	}
+	return c.readBuf.Read(data)
+}
+
+// 身份认证消息 在加密信道中发送
+type identity struct {
+	PublicKey []byte
+	Signature []byte // 对握手记录的签名
+}
+
+// SecureClient 作为发起方完成加密握手
+func (s *Server) SecureClient(conn net.Conn) (*SecureConn, error) {
+	return s.secureHandshake(conn, true)
+}
+
+// SecureServer 作为响应方完成加密握手
+func (s *Server) SecureServer(conn net.Conn) (*SecureConn, error) {
+	return s.secureHandshake(conn, false)
+}
+
+// 加密握手
+// 1. 双方交换临时公钥 计算共享密钥 以两个临时公钥的哈希作为握手记录
+// 2. 响应方发送身份公钥及对(记录+角色)的签名 发起方验证后发送自己的身份
+func (s *Server) secureHandshake(conn net.Conn, initiator bool) (*SecureConn, error) {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, err
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	// 交换临时公钥
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return nil, err
+	}
+	localPub, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(localPub); err != nil {
+		return nil, err
+	}
+	remotePub := make([]byte, curve25519.PointSize)
+	if _, err := io.ReadFull(conn, remotePub); err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, remotePub)
+	if err != nil {
+		return nil, err
+	}
+
+	// 握手记录: H(发起方临时公钥 || 响应方临时公钥)
+	var transcript [32]byte
+	if initiator {
+		transcript = sha256.Sum256(append(append([]byte{}, localPub...), remotePub...))
+	} else {
+		transcript = sha256.Sum256(append(append([]byte{}, remotePub...), localPub...))
+	}
+
+	// 派生两个方向的会话密钥
+	kdf := hkdf.New(sha256.New, shared, transcript[:], []byte(transportInfo))
+	keys := make([]byte, 2*chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(kdf, keys); err != nil {
+		return nil, err
+	}
+	initKey, respKey := keys[:chacha20poly1305.KeySize], keys[chacha20poly1305.KeySize:]
+	if !initiator {
+		initKey, respKey = respKey, initKey
+	}
+	sendCipher, err := chacha20poly1305.New(initKey)
+	if err != nil {
+		return nil, err
+	}
+	recvCipher, err := chacha20poly1305.New(respKey)
+	if err != nil {
+		return nil, err
+	}
+	sc := &SecureConn{Conn: conn, sendCipher: sendCipher, recvCipher: recvCipher}
+
+	// 签名内容区分角色 防止签名被反射
+	sign := func(role byte) []byte {
+		return ed25519.Sign(s.nodeKey, append(transcript[:], role))
+	}
+	verify := func(id *identity, role byte) error {
+		if len(id.PublicKey) != ed25519.PublicKeySize ||
+			!ed25519.Verify(id.PublicKey, append(transcript[:], role), id.Signature) {
+			return errors.New("peer identity signature is invalid")
+		}
+		if !s.isAllowed(id.PublicKey) {
+			return ErrNotAllowed
+		}
+		sc.PeerKey = id.PublicKey
+		return nil
+	}
+
+	if initiator {
+		var remote identity
+		if err := sc.readIdentity(&remote); err != nil {
+			return nil, err
+		}
+		if err := verify(&remote, 'r'); err != nil {
+			return nil, err
+		}
+		if err := sc.writeIdentity(&identity{s.nodeKey.Public().(ed25519.PublicKey), sign('i')}); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := sc.writeIdentity(&identity{s.nodeKey.Public().(ed25519.PublicKey), sign('r')}); err != nil {
+			return nil, err
+		}
+		var remote identity
+		if err := sc.readIdentity(&remote); err != nil {
+			return nil, err
+		}
+		if err := verify(&remote, 'i'); err != nil {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// 发送身份信息: 公钥 || 签名
+func (c *SecureConn) writeIdentity(id *identity) error {
+	return c.writeFrame(append(append([]byte{}, id.PublicKey...), id.Signature...))
+}
+
+// 读取身份信息
+func (c *SecureConn) readIdentity(id *identity) error {
+	frame, err := c.readFrame()
+	if err != nil {
+		return err
+	}
+	if len(frame) != ed25519.PublicKeySize+ed25519.SignatureSize {
+		return errors.New("malformed identity frame")
+	}
+	id.PublicKey = frame[:ed25519.PublicKeySize]
+	id.Signature = frame[ed25519.PublicKeySize:]
+	return nil
+}
@@ -7,56 +7,98 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
 )
 
 // SendMessage 向指定地址发送数据
-func SendMessage(to string, msg []byte) {
+func (s *Server) SendMessage(to string, msg []byte) {
+	if s.isBannedAddr(to) {
+		fmt.Printf("skip sending to banned peer[%s]\n", to)
+		return
+	}
 	fmt.Printf("send request to server[%s]...", to)
-	conn, err := net.Dial("tcp", to)
+	conn, err := s.Transport.Dial(to)
 	if err != nil {
-		log.Panicf("connect to server[%s] failed: %v\n", to, err)
+		// 对方节点不可达时不应导致本节点崩溃
+		log.Printf("connect to server[%s] failed: %v\n", to, err)
+		return
+	}
+	defer conn.Close()
+	var w io.Writer = conn
+	if s.secureTransport {
+		sc, err := s.SecureClient(conn)
+		if err != nil {
+			log.Printf("secure handshake with server[%s] failed: %v\n", to, err)
+			return
+		}
+		if s.isBanned(peerKeyID(sc.PeerKey)) {
+			fmt.Printf("skip sending to banned peer[%s]\n", to)
+			return
+		}
+		w = sc
 	}
-	_, err = io.Copy(conn, bytes.NewReader(msg))
+	_, err = io.Copy(w, bytes.NewReader(msg))
 	if err != nil {
-		log.Panicf("add the data to conn failed: %v\n", err)
+		log.Printf("add the data to conn failed: %v\n", err)
 	}
 }
 
-// SendVersion 区块链版本验证
-func SendVersion(toAddress string, chain *block.Chain) {
-	// 获取当前节点区块高度
-	height := chain.GetHeight()
-	versionData := Version{Height: int(height), AddrFrom: nodeAddr} // 组装生成version
-	data := utils.GobEncoder(versionData)
-	request := append(utils.CommandToBytes(VERSION), data...)
-	SendMessage(toAddress, request)
+// SendGetData 发送获取指定区块请求
+func (s *Server) SendGetData(toAddress string, hash []byte) {
+	s.SendGetDataType(toAddress, InvBlock, hash)
 }
 
-// SendGetData 发送获取指定区块请求
-func SendGetData(toAddress string, hash []byte) {
-	data := utils.GobEncoder(GetData{AddrFrom: nodeAddr, ID: hash})
+// SendGetDataType 发送获取指定类型数据的请求
+func (s *Server) SendGetDataType(toAddress string, invType string, hash []byte) {
+	data := utils.GobEncoder(GetData{AddrFrom: s.Addr, Type: invType, ID: hash})
 	req := append(utils.CommandToBytes(GETDATA), data...)
-	SendMessage(toAddress, req)
+	s.SendMessage(toAddress, req)
 }
 
 // SendGetBlocks 从指定结点同步数据
-func SendGetBlocks(address string) {
-	data := utils.GobEncoder(GetBlocks{AddrFrom: nodeAddr})
+func (s *Server) SendGetBlocks(address string) {
+	data := utils.GobEncoder(GetBlocks{AddrFrom: s.Addr})
 	req := append(utils.CommandToBytes(GETBLOCKS), data...)
-	SendMessage(address, req)
+	s.SendMessage(address, req)
 }
 
 // SendInv 向其他节点展示
-func SendInv(toAddress string, hashes [][]byte) {
-	data := utils.GobEncoder(Inv{AddrFrom: nodeAddr, Hashes: hashes})
+func (s *Server) SendInv(toAddress string, hashes [][]byte) {
+	s.SendInvType(toAddress, InvBlock, hashes)
+}
+
+// SendInvType 向其他节点展示指定类型的数据
+func (s *Server) SendInvType(toAddress string, invType string, hashes [][]byte) {
+	data := utils.GobEncoder(Inv{AddrFrom: s.Addr, Type: invType, Hashes: hashes})
 	req := append(utils.CommandToBytes(CMDINV), data...)
-	SendMessage(toAddress, req)
+	s.SendMessage(toAddress, req)
 }
 
 // SendBlock 发送区块信息
-func SendBlock(toAddress string, block []byte) {
-	data := utils.GobEncoder(BlockData{AddrFrom: nodeAddr, Block: block})
-	req := append(utils.CommandToBytes(CMDBLOCK), data...)
-	SendMessage(toAddress, req)
+func (s *Server) SendBlock(toAddress string, block []byte) {
+	s.SendMessage(toAddress, blockMessage(s.Addr, block))
+}
+
+// 完整区块消息
+func blockMessage(addrFrom string, block []byte) []byte {
+	data := utils.GobEncoder(BlockData{AddrFrom: addrFrom, Block: block})
+	return append(utils.CommandToBytes(CMDBLOCK), data...)
+}
+
+// AnnounceBlock 向握手完成的节点展示新区块
+// 支持紧凑区块的节点直接发送紧凑区块 其他节点发送inv
+func (s *Server) AnnounceBlock(hash []byte) {
+	var newBlock *block.Block
+	for _, peer := range s.Peers() {
+		if !peer.HandshakeDone() || peer.Addr == s.Addr {
+			continue
+		}
+		if peer.HasFeature(FeatureCompactBlocks) {
+			if newBlock == nil {
+				newBlock = block.DeserializeBlock(s.Chain.GetBlock(hash))
+			}
+			s.SendCompactBlock(peer.Addr, newBlock)
+			continue
+		}
+		s.SendInv(peer.Addr, [][]byte{hash})
+	}
 }
@@ -2,10 +2,13 @@ package node
 
 import (
 	"blockchain/block"
+	"crypto/ed25519"
 	"fmt"
 	"log"
 	"net"
 	"strconv"
+	"sync"
+	"time"
 )
 
 // 节点之间须要进行数据同步
@@ -18,38 +21,180 @@ const (
 	CMDINV    = "inv"
 	GETDATA   = "getdata"
 	CMDBLOCK  = "block"
+	VERACK    = "verack"
+	CMDPING   = "ping"
+	CMDPONG   = "pong"
+	CMDREJECT = "reject"
+	CMDTX     = "tx"
+
+	CMDCMPCTBLOCK = "cmpctblock"
+	GETBLOCKTXN   = "getblocktxn"
+	CMDBLOCKTXN   = "blocktxn"
+
+	GETTXPROOF     = "gettxproof"
+	CMDMERKLEBLOCK = "merkleblock"
+
+	GETHEADERS   = "getheaders"
+	CMDHEADERS   = "headers"
+	GETCFHEADERS = "getcfheaders"
+	CMDCFHEADERS = "cfheaders"
+	GETCFILTERS  = "getcfilters"
+	CMDCFILTER   = "cfilter"
 )
 
 var (
 	port       = 3000
 	knownNodes = []string{"localhost:" + strconv.Itoa(port)} // 主节点地址
-	nodeAddr   string                                        // 节点地址
 )
 
-// StartServer 启动服务
-func StartServer(nodeId string) {
-	nodeAddr = fmt.Sprintf("localhost:%s", nodeId)
-	fmt.Println("node address:", nodeAddr)
-	// 监听节点
-	listen, err := net.Listen(PROTOCOL, nodeAddr)
+// Server 节点服务
+// 节点状态(握手、评分、封禁等)保存在Server中 同一进程内可以运行多个节点
+type Server struct {
+	NodeId     string
+	Addr       string        // 节点地址
+	Chain      *block.Chain  // 本地区块链
+	Mempool    *Mempool      // 交易池
+	Fees       *FeeEstimator // 手续费估算
+	Transport  Transport     // 网络传输
+	KnownNodes []string      // 启动时连接的节点
+	Light      *LightClient  // 轻节点状态 完整节点为nil
+
+	listener       net.Listener
+	quit           chan struct{}
+	chainMu        sync.Mutex     // 串行化区块写入
+	resyncInterval time.Duration  // 重试丢失消息的间隔
+	loops          sync.WaitGroup // 后台循环 关闭节点时等待其退出
+
+	banList     *BanList // 封禁列表
+	scoreMutex  sync.Mutex
+	peerScores  map[string]int // 各节点当前的惩罚分
+	peersMutex  sync.Mutex
+	peers       map[string]*Peer // 已知节点的握手状态
+	nonce       uint64           // 本节点随机数 用于检测连接自身
+	genesisHash []byte           // 本节点创世区块哈希
+
+	secureTransport bool                // 是否启用加密传输
+	nodeKey         ed25519.PrivateKey  // 本节点身份私钥
+	allowlist       map[string]struct{} // 允许连接的身份公钥(十六进制) 为空表示不限制
+
+	compactMu     sync.Mutex
+	partialBlocks map[string]*partialBlock  // 等待缺失交易的紧凑区块
+	orphans       map[string][]*block.Block // 父区块未知的区块 以父区块哈希为键 由chainMu保护
+	compactStats  CompactStats              // 紧凑区块统计
+
+	proofMu  sync.Mutex
+	txProofs map[string]*block.TxProof // 从其他节点收到并验证通过的交易证明
+}
+
+// NewServer 创建节点服务
+func NewServer(nodeId string, addr string, chain *block.Chain, transport Transport) *Server {
+	s := &Server{
+		NodeId:         nodeId,
+		Addr:           addr,
+		Chain:          chain,
+		Mempool:        NewMempool(),
+		Fees:           NewFeeEstimator(nodeId),
+		Transport:      transport,
+		KnownNodes:     knownNodes,
+		quit:           make(chan struct{}),
+		resyncInterval: resyncInterval,
+		banList:        NewBanList(nodeId),
+		peerScores:     make(map[string]int),
+		peers:          make(map[string]*Peer),
+		nonce:          randomNonce(),
+
+		partialBlocks: make(map[string]*partialBlock),
+		orphans:       make(map[string][]*block.Block),
+		txProofs:      make(map[string]*block.TxProof),
+	}
+	if chain != nil {
+		s.genesisHash = chain.GetGenesisHash()
+	}
+	return s
+}
+
+// Listen 监听节点地址
+func (s *Server) Listen() error {
+	listener, err := s.Transport.Listen(s.Addr)
 	if err != nil {
-		log.Panicf("listen address of %s failed: %v\n", nodeAddr, err)
+		return err
+	}
+	s.listener = listener
+	return nil
+}
+
+// Serve 处理连接 直到节点关闭
+func (s *Server) Serve() {
+	s.startLoop(s.keepAlive)
+	s.startLoop(s.resyncLoop)
+	if s.Light != nil {
+		s.startLoop(s.lightLoop)
 	}
-	defer listen.Close()
 
 	// 主节点负责保存数据 钱包节点负责发送请求
 	// 判断是否为主节点 非主节点则发送请求 同步数据
-
-	chain := block.GetBlockChainObject(nodeId)
-	if nodeAddr != knownNodes[0] {
-		SendVersion(knownNodes[0], chain)
+	for _, addr := range s.KnownNodes {
+		if addr != s.Addr {
+			s.SendVersion(addr)
+		}
 	}
 
 	for {
-		conn, e := listen.Accept()
-		if e != nil {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.quit:
+				return
+			default:
+			}
 			log.Panicf("accept connect failed: %v\n", err)
 		}
-		go HandleConn(conn, chain) // 使用goroutine单独处理请求
+		go s.HandleConn(conn) // 使用goroutine单独处理请求
+	}
+}
+
+// 启动后台循环 循环在节点关闭时退出
+func (s *Server) startLoop(loop func()) {
+	s.loops.Add(1)
+	go func() {
+		defer s.loops.Done()
+		loop()
+	}()
+}
+
+// Close 关闭节点 等待后台循环退出后才能关闭区块链数据库
+func (s *Server) Close() {
+	close(s.quit)
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.loops.Wait()
+}
+
+// StartServer 启动服务
+func StartServer(nodeId string, secure bool, allowlistPath string) {
+	addr := fmt.Sprintf("localhost:%s", nodeId)
+	fmt.Println("node address:", addr)
+	chain := block.GetBlockChainObject(nodeId)
+	run(NewServer(nodeId, addr, chain, TCPTransport{}), secure, allowlistPath)
+}
+
+// StartLightServer 启动轻节点 只同步区块头和钱包相关的交易
+func StartLightServer(nodeId string, secure bool, allowlistPath string) {
+	addr := fmt.Sprintf("localhost:%s", nodeId)
+	fmt.Println("light node address:", addr)
+	run(NewLightServer(nodeId, addr, NewLightClient(nodeId), TCPTransport{}), secure, allowlistPath)
+}
+
+// 监听节点地址并处理连接
+func run(s *Server, secure bool, allowlistPath string) {
+	if secure {
+		s.UseSecureTransport(allowlistPath)
+	}
+	// 监听节点
+	if err := s.Listen(); err != nil {
+		log.Panicf("listen address of %s failed: %v\n", s.Addr, err)
 	}
+	defer s.listener.Close()
+	s.Serve()
 }
@@ -0,0 +1,357 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/wallet"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 多节点模拟
+// 在同一进程内启动N个节点 节点之间通过内存网络通信
+// 每个节点的区块链保存在临时目录中 所有节点共享同一个创世区块
+// 可以控制消息的延迟、丢弃和网络分区 并检查各节点是否收敛到相同的最新区块和UTXO集
+
+const (
+	simMaturity       = 1                      // 模拟中每个区块花费上一个区块的挖矿奖励
+	simResyncInterval = 200 * time.Millisecond // 缩短重试间隔 丢包时尽快收敛
+)
+
+// Simulation 模拟网络
+type Simulation struct {
+	Network *MemoryNetwork
+	Nodes   []*Server
+	// LightNodes 轻节点 不参与收敛检查
+	LightNodes []*Server
+	Miner      string // 挖矿奖励地址
+	// BlockTxsSize 区块中交易的字节数上限 交易池中的交易超出时按祖先包手续费率选择
+	BlockTxsSize int
+}
+
+// 创建包含n个节点的模拟网络 测试结束时关闭
+func newSimulation(t *testing.T, n int, minerAddress string) *Simulation {
+	t.Helper()
+	dir := t.TempDir()
+	sim := &Simulation{Network: NewMemoryNetwork(), Miner: minerAddress, BlockTxsSize: DefaultBlockTxsSize}
+	t.Cleanup(sim.Close)
+	genesis := block.CreateGenesisBlock([]*block.Transaction{block.NewCoinbaseTransaction(minerAddress)})
+	for i := 0; i < n; i++ {
+		nodeId := fmt.Sprintf("sim%d", i)
+		chain, err := block.NewChainWithGenesis(filepath.Join(dir, fmt.Sprintf("block-%s.db", nodeId)), genesis, simMaturity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := fmt.Sprintf("node%d:%d", i, port+i)
+		server := NewServer(nodeId, addr, chain, sim.Network.Transport(addr))
+		server.banList = NewBanListFile(filepath.Join(dir, fmt.Sprintf(banListFile, nodeId)))
+		server.Fees = NewFeeEstimatorFile(filepath.Join(dir, fmt.Sprintf(feeEstimatesFile, nodeId)))
+		server.KnownNodes = nil
+		server.resyncInterval = simResyncInterval
+		sim.Nodes = append(sim.Nodes, server)
+	}
+	return sim
+}
+
+// Start 启动所有节点
+func (sim *Simulation) Start() error {
+	for _, server := range append(sim.Nodes, sim.LightNodes...) {
+		if err := server.Listen(); err != nil {
+			return err
+		}
+		go server.Serve()
+	}
+	return nil
+}
+
+// Connect 节点i向节点j发起握手
+func (sim *Simulation) Connect(i, j int) {
+	sim.Nodes[i].SendVersion(sim.Nodes[j].Addr)
+}
+
+// ConnectAll 所有节点两两握手
+func (sim *Simulation) ConnectAll() {
+	for i := range sim.Nodes {
+		for j := i + 1; j < len(sim.Nodes); j++ {
+			sim.Connect(i, j)
+		}
+	}
+}
+
+// Mine 节点i从交易池中选择交易 与coinbase交易一起打包成区块并向其他节点展示
+func (sim *Simulation) Mine(i int) *block.Block {
+	server := sim.Nodes[i]
+	server.chainMu.Lock()
+	latest := server.Chain.GetLatestBlock()
+	txs := []*block.Transaction{block.NewCoinbaseTransaction(sim.Miner)}
+	txs = append(txs, server.Mempool.BlockTxs(sim.BlockTxsSize)...)
+	newBlock := block.NewBlock(latest.Height+1, latest.Hash, txs)
+	server.connectBlock(newBlock)
+	server.chainMu.Unlock()
+	server.AnnounceBlock(newBlock.Hash)
+	return newBlock
+}
+
+// Pay 使用钱包w花费交易prev的第一个输出 全部转给地址to 交易提交到节点i的交易池
+func (sim *Simulation) Pay(i int, w *wallet.Wallet, prev *block.Transaction, to string) (*block.Transaction, error) {
+	tx := &block.Transaction{
+		Vins:    []*block.TxInput{{TxHash: prev.TxHash, Vout: 0, PublicKey: w.PublicKey}},
+		Vouts:   []*block.TxOutput{block.NewTxOutput(prev.Vouts[0].Value, to)},
+		Version: block.TxVersion,
+	}
+	tx.HashTransaction()
+	tx.Sign(w.PrivateKey, map[string]block.Transaction{hex.EncodeToString(prev.TxHash): *prev})
+	return tx, sim.Nodes[i].SubmitTx(tx)
+}
+
+// ProveTx 节点i向节点j请求交易证明 消息可能丢失 超时前每秒重新请求
+func (sim *Simulation) ProveTx(i, j int, txHash []byte, timeout time.Duration) (*block.TxProof, error) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		wait := time.Until(deadline)
+		if wait > time.Second {
+			wait = time.Second
+		}
+		if proof, ok := sim.Nodes[i].RequestTxProof(sim.Nodes[j].Addr, txHash, wait); ok {
+			return proof, nil
+		}
+	}
+	return nil, fmt.Errorf("node %d received no proof of transaction[%x]", i, txHash)
+}
+
+// WaitMempool 等待所有节点的交易池都包含n笔交易
+func (sim *Simulation) WaitMempool(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		synced := true
+		for _, server := range sim.Nodes {
+			if server.Mempool.Size() < n {
+				synced = false
+				break
+			}
+		}
+		if synced {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return false
+}
+
+// CompactStats 汇总所有节点的紧凑区块统计
+func (sim *Simulation) CompactStats() CompactStats {
+	var total CompactStats
+	for _, server := range sim.Nodes {
+		st := server.CompactStats()
+		total.Sent += st.Sent
+		total.Received += st.Received
+		total.Reconstructed += st.Reconstructed
+		total.Fallbacks += st.Fallbacks
+		total.TxsRequested += st.TxsRequested
+		total.BytesSaved += st.BytesSaved
+	}
+	return total
+}
+
+// WaitHandshakes 等待所有节点两两完成握手
+func (sim *Simulation) WaitHandshakes(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var missing []string
+		for _, server := range sim.Nodes {
+			for _, other := range sim.Nodes {
+				if other == server {
+					continue
+				}
+				if peer, ok := testPeer(server, other.Addr); !ok || !peer.HandshakeDone() {
+					missing = append(missing, fmt.Sprintf("%s->%s", server.Addr, other.Addr))
+				}
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("handshakes not done: %s", strings.Join(missing, ", "))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// 获取节点的最新区块哈希和UTXO集摘要
+func (sim *Simulation) state(i int) (tip []byte, digest []byte) {
+	server := sim.Nodes[i]
+	server.chainMu.Lock()
+	defer server.chainMu.Unlock()
+	utxoSet := block.UTXOSet{Chain: server.Chain}
+	return append([]byte{}, server.Chain.Tip...), utxoSet.Digest()
+}
+
+// CheckConverged 检查所有节点的最新区块和UTXO集是否一致
+func (sim *Simulation) CheckConverged() error {
+	tip, digest := sim.state(0)
+	var diffs []string
+	for i := 1; i < len(sim.Nodes); i++ {
+		t, d := sim.state(i)
+		if !bytes.Equal(t, tip) {
+			diffs = append(diffs, fmt.Sprintf("node%d tip %x != node0 tip %x", i, t, tip))
+		} else if !bytes.Equal(d, digest) {
+			diffs = append(diffs, fmt.Sprintf("node%d utxo set %x != node0 utxo set %x", i, d, digest))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("nodes have not converged: %s", strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// WaitConverged 等待所有节点收敛 超时返回最后一次检查的错误
+func (sim *Simulation) WaitConverged(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := sim.CheckConverged()
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Close 关闭所有节点
+func (sim *Simulation) Close() {
+	for _, server := range sim.Nodes {
+		server.Close()
+		server.Chain.DB.Close()
+	}
+	for _, server := range sim.LightNodes {
+		server.Close()
+	}
+}
+
+// 丢包的网络中轮流挖矿 每个区块花费上一个区块的挖矿奖励
+// 丢失的握手、紧凑区块和缺失交易请求经重试补齐 各节点收敛后最后一个节点获得最新挖矿奖励的包含证明
+func TestSimulationConverges(t *testing.T) {
+	const nodes, blocks, drop = 4, 3, 0.2
+	const timeout = 10 * time.Second
+	minerWallet := wallet.NewWallet()
+	miner := string(minerWallet.GetAddress())
+	sim := newSimulation(t, nodes, miner)
+	for _, from := range sim.Nodes {
+		for _, to := range sim.Nodes {
+			sim.Network.SetDropRate(from.Addr, to.Addr, drop)
+		}
+	}
+	if err := sim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sim.ConnectAll()
+
+	var prev *block.Transaction
+	for i := 0; i < blocks; i++ {
+		if prev != nil {
+			if err := sim.WaitConverged(timeout); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sim.Pay(i%nodes, minerWallet, prev, miner); err != nil {
+				t.Fatal(err)
+			}
+		}
+		prev = sim.Mine(i % nodes).Txs[0]
+	}
+	if err := sim.WaitConverged(timeout); err != nil {
+		t.Fatal(err)
+	}
+	stats := sim.CompactStats()
+	t.Logf("delivered %d, dropped %d, %v", sim.Network.Delivered, sim.Network.Dropped, stats)
+	if stats.BytesSaved < 0 {
+		t.Fatalf("compact blocks saved %d bytes", stats.BytesSaved)
+	}
+
+	proof, err := sim.ProveTx(nodes-1, 0, prev.TxHash, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(proof.TxHash(), prev.TxHash) || proof.Header.Height != sim.Nodes[0].Chain.GetHeight() {
+		t.Fatalf("proof of transaction[%x] in block %d, want the latest coinbase", proof.TxHash(), proof.Header.Height)
+	}
+}
+
+// 网络分区期间两侧各自挖矿 分区恢复后所有节点切换到更长的一侧
+func TestSimulationPartitionHeal(t *testing.T) {
+	const timeout = 10 * time.Second
+	sim := newSimulation(t, 3, string(wallet.NewWallet().GetAddress()))
+	if err := sim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sim.ConnectAll()
+	if err := sim.WaitHandshakes(timeout); err != nil {
+		t.Fatal(err)
+	}
+
+	sim.Network.Partition([]string{sim.Nodes[0].Addr, sim.Nodes[1].Addr}, []string{sim.Nodes[2].Addr})
+	short := sim.Mine(0)
+	var long *block.Block
+	for i := 0; i < 2; i++ {
+		long = sim.Mine(2)
+	}
+	deadline := time.Now().Add(timeout)
+	for tip, _ := sim.state(1); !bytes.Equal(tip, short.Hash); tip, _ = sim.state(1) {
+		if time.Now().After(deadline) {
+			t.Fatalf("node1 did not receive block[%x] inside its partition", short.Hash)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := sim.CheckConverged(); err == nil {
+		t.Fatal("partitioned nodes converged")
+	}
+
+	sim.Network.Heal()
+	if err := sim.WaitConverged(timeout); err != nil {
+		t.Fatal(err)
+	}
+	if tip, _ := sim.state(0); !bytes.Equal(tip, long.Hash) {
+		t.Fatalf("nodes converged on block[%x], want the longer branch block[%x]", tip, long.Hash)
+	}
+}
+
+// 链路延迟各不相同时 两个节点在收到对方区块前各自挖出同一高度的区块
+// 之后的区块使所有节点收敛到同一分支
+func TestSimulationDelayedDelivery(t *testing.T) {
+	const nodes, timeout = 3, 10 * time.Second
+	sim := newSimulation(t, nodes, string(wallet.NewWallet().GetAddress()))
+	for i, from := range sim.Nodes {
+		for j, to := range sim.Nodes {
+			sim.Network.SetDelay(from.Addr, to.Addr, time.Duration(20*(i+2*j+1))*time.Millisecond)
+		}
+	}
+	if err := sim.Start(); err != nil {
+		t.Fatal(err)
+	}
+	sim.ConnectAll()
+	if err := sim.WaitHandshakes(timeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// 消息投递前两个节点同时挖矿
+	var first, competing *block.Block
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); first = sim.Mine(0) }()
+	go func() { defer wg.Done(); competing = sim.Mine(1) }()
+	wg.Wait()
+	if !bytes.Equal(first.PrevBlockHash, competing.PrevBlockHash) {
+		t.Fatal("node0 and node1 did not mine competing blocks")
+	}
+	last := sim.Mine(0)
+	if err := sim.WaitConverged(timeout); err != nil {
+		t.Fatal(err)
+	}
+	if tip, _ := sim.state(nodes - 1); !bytes.Equal(tip, last.Hash) {
+		t.Fatalf("nodes converged on block[%x], want block[%x]", tip, last.Hash)
+	}
+}
@@ -0,0 +1,120 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/utils"
+	"errors"
+)
+
+// 完整节点为轻节点提供的服务
+// getheaders按定位哈希返回主链区块头 getcfheaders返回过滤器哈希 getcfilters返回各区块的过滤器
+// 轻节点在本地匹配过滤器 只请求钱包相关的完整区块 完整节点不知道轻节点的地址
+
+const (
+	maxCFHeadersResult = 2000 // 一次请求的最大过滤器哈希数量
+	maxCFiltersResult  = 100  // 一次请求的最大过滤器数量
+)
+
+// SendGetHeaders 请求本节点最新区块头之后的区块头
+func (s *Server) SendGetHeaders(toAddress string) {
+	data := utils.GobEncoder(GetHeaders{AddrFrom: s.Addr, Locator: s.Light.Headers.Locator()})
+	req := append(utils.CommandToBytes(GETHEADERS), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendHeaders 发送区块头
+func (s *Server) SendHeaders(toAddress string, headers []*block.BlockHeader) {
+	data := utils.GobEncoder(Headers{AddrFrom: s.Addr, Headers: headers})
+	req := append(utils.CommandToBytes(CMDHEADERS), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendGetCFHeaders 请求以stopHash结束的分支上从startHeight开始的过滤器哈希
+func (s *Server) SendGetCFHeaders(toAddress string, startHeight int64, stopHash []byte) {
+	data := utils.GobEncoder(GetCFHeaders{AddrFrom: s.Addr, StartHeight: startHeight, StopHash: stopHash})
+	req := append(utils.CommandToBytes(GETCFHEADERS), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendGetCFilters 请求以stopHash结束的分支上从startHeight开始的区块过滤器
+func (s *Server) SendGetCFilters(toAddress string, startHeight int64, stopHash []byte) {
+	data := utils.GobEncoder(GetCFilters{AddrFrom: s.Addr, StartHeight: startHeight, StopHash: stopHash})
+	req := append(utils.CommandToBytes(GETCFILTERS), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendCFHeaders 发送过滤器哈希
+func (s *Server) SendCFHeaders(toAddress string, startHeight int64, stopHash []byte, prevHeader []byte, filterHashes [][]byte) {
+	data := utils.GobEncoder(CFHeaders{
+		AddrFrom:     s.Addr,
+		StartHeight:  startHeight,
+		StopHash:     stopHash,
+		PrevHeader:   prevHeader,
+		FilterHashes: filterHashes,
+	})
+	req := append(utils.CommandToBytes(CMDCFHEADERS), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// SendCFilter 发送区块过滤器
+func (s *Server) SendCFilter(toAddress string, blockHash []byte, filter []byte) {
+	data := utils.GobEncoder(CFilterData{AddrFrom: s.Addr, BlockHash: blockHash, Filter: filter})
+	req := append(utils.CommandToBytes(CMDCFILTER), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// HandleGetHeaders 处理区块头请求
+func (s *Server) HandleGetHeaders(req []byte) error {
+	var data GetHeaders
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	s.chainMu.Lock()
+	headers := s.Chain.HeadersAfter(data.Locator, maxHeadersResult)
+	s.chainMu.Unlock()
+	s.SendHeaders(data.AddrFrom, headers)
+	return nil
+}
+
+// HandleGetCFHeaders 处理过滤器哈希请求 超出范围的请求受到惩罚 区块未知时拒绝
+func (s *Server) HandleGetCFHeaders(req []byte) error {
+	var data GetCFHeaders
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	s.chainMu.Lock()
+	prevHeader, filterHashes, err := s.Chain.CFHeaders(data.StartHeight, data.StopHash, maxCFHeadersResult)
+	s.chainMu.Unlock()
+	if err != nil {
+		return s.rejectFilterRequest(data.AddrFrom, GETCFHEADERS, err)
+	}
+	s.SendCFHeaders(data.AddrFrom, data.StartHeight, data.StopHash, prevHeader, filterHashes)
+	return nil
+}
+
+// HandleGetCFilters 处理过滤器请求 每个区块发送一条cfilter
+func (s *Server) HandleGetCFilters(req []byte) error {
+	var data GetCFilters
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	s.chainMu.Lock()
+	hashes, filters, err := s.Chain.CFilters(data.StartHeight, data.StopHash, maxCFiltersResult)
+	s.chainMu.Unlock()
+	if err != nil {
+		return s.rejectFilterRequest(data.AddrFrom, GETCFILTERS, err)
+	}
+	for i, filter := range filters {
+		s.SendCFilter(data.AddrFrom, hashes[i], filter.Filter)
+	}
+	return nil
+}
+
+// 过滤器请求失败 范围无效时惩罚 区块不在本地(可能在本节点没有的分叉上)时拒绝
+func (s *Server) rejectFilterRequest(toAddress string, command string, err error) error {
+	if errors.Is(err, block.ErrFilterRange) {
+		return misbehave(ScoreMalformed, "%s: %v", command, err)
+	}
+	s.SendReject(toAddress, command, err.Error())
+	return nil
+}
@@ -0,0 +1,23 @@
+package node
+
+import "net"
+
+// Transport 节点间的网络传输
+// 每条消息使用一个独立连接 发送方写完数据后关闭连接
+type Transport interface {
+	Listen(addr string) (net.Listener, error) // 监听本节点地址
+	Dial(addr string) (net.Conn, error)       // 连接其他节点
+}
+
+// TCPTransport 基于TCP的传输
+type TCPTransport struct{}
+
+// Listen 监听TCP地址
+func (TCPTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen(PROTOCOL, addr)
+}
+
+// Dial 连接TCP地址
+func (TCPTransport) Dial(addr string) (net.Conn, error) {
+	return net.Dial(PROTOCOL, addr)
+}
@@ -0,0 +1,105 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/utils"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// 交易传播
+// 节点收到交易后验证签名并放入交易池 再通过inv向其他节点展示
+
+var ErrMissingInputs = errors.New("referenced transaction not found")
+
+// 验证交易并返回手续费 引用的交易可以位于区块链或交易池中
+// 引用链上交易的输出须在主链上未被花费 与交易池中交易的冲突由交易池检查
+func (s *Server) verifyTx(tx *block.Transaction) (int, error) {
+	if tx.IsCoinbaseTransaction() {
+		return 0, misbehave(ScoreInvalidTx, "coinbase transaction[%x] relayed outside a block", tx.TxHash)
+	}
+	if err := tx.CheckValues(); err != nil {
+		return 0, misbehave(ScoreInvalidTx, "transaction[%x]: %v", tx.TxHash, err)
+	}
+	prevTxs := make(map[string]block.Transaction)
+	for _, vin := range tx.Vins {
+		prevTx, ok := s.Mempool.Get(vin.TxHash)
+		if !ok {
+			prevTx, ok = s.Chain.LookupTransaction(vin.TxHash)
+		}
+		if !ok {
+			return 0, ErrMissingInputs
+		}
+		prevTxs[hex.EncodeToString(prevTx.TxHash)] = *prevTx
+	}
+	// 交易将被打包进下一个区块
+	if !tx.Verify(prevTxs, s.Chain.GetHeight()+1) {
+		return 0, misbehave(ScoreInvalidTx, "transaction[%x] failed verification", tx.TxHash)
+	}
+	fee, err := tx.Fee(prevTxs)
+	if err != nil || fee < 0 {
+		return 0, misbehave(ScoreInvalidTx, "transaction[%x] spends more than its inputs", tx.TxHash)
+	}
+	// 引用的输出可能刚被区块中的其他交易花费 不惩罚发送方
+	if err := s.Chain.CheckInputsUnspent(tx); err != nil {
+		return 0, fmt.Errorf("transaction[%x] double spends: %w", tx.TxHash, err)
+	}
+	// 时间锁未到的交易暂不接受 由发送方稍后重新广播
+	if err := s.Chain.CheckLocks(tx, s.Chain.NextBlock()); err != nil {
+		return 0, fmt.Errorf("transaction[%x] is not final: %w", tx.TxHash, err)
+	}
+	return fee, nil
+}
+
+// SubmitTx 验证交易并加入交易池 成功后向其他节点展示
+func (s *Server) SubmitTx(tx *block.Transaction) error {
+	if s.Mempool.Has(tx.TxHash) {
+		return nil
+	}
+	fee, err := s.verifyTx(tx)
+	if err != nil {
+		return err
+	}
+	replaced, err := s.Mempool.Add(tx, fee)
+	if err != nil {
+		return fmt.Errorf("transaction[%x] rejected: %w", tx.TxHash, err)
+	}
+	for _, old := range replaced {
+		fmt.Printf("transaction[%x] replaced by [%x]\n", old.TxHash, tx.TxHash)
+	}
+	fmt.Printf("transaction[%x] accepted into the mempool, fee: %d\n", tx.TxHash, fee)
+	s.Fees.Track(tx.TxHash, block.FeeRate(fee, len(tx.Serialize())), s.Chain.GetLatestBlock().Height)
+	s.addWalletTx(tx)
+	s.AnnounceTx(tx.TxHash)
+	return nil
+}
+
+// HandleTx 处理交易
+func (s *Server) HandleTx(req []byte) error {
+	var data TxData
+	if err := decodePayload(req, &data); err != nil {
+		return err
+	}
+	tx, err := block.DecodeTransaction(data.Tx)
+	if err != nil {
+		return misbehave(ScoreMalformed, "decode the transaction failed: %v", err)
+	}
+	return s.SubmitTx(tx)
+}
+
+// SendTx 发送交易
+func (s *Server) SendTx(toAddress string, tx *block.Transaction) {
+	data := utils.GobEncoder(TxData{AddrFrom: s.Addr, Tx: tx.Serialize()})
+	req := append(utils.CommandToBytes(CMDTX), data...)
+	s.SendMessage(toAddress, req)
+}
+
+// AnnounceTx 向握手完成的节点展示交易
+func (s *Server) AnnounceTx(hash []byte) {
+	for _, peer := range s.Peers() {
+		if peer.HandshakeDone() && peer.Addr != s.Addr {
+			s.SendInvType(peer.Addr, InvTx, [][]byte{hash})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/wallet"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// 由owner签名 花费链上交易prev的第一个输出
+func spendOnChain(s *Server, owner *wallet.Wallet, prev *block.Transaction, values ...int) *block.Transaction {
+	tx := &block.Transaction{
+		Vins:    []*block.TxInput{{TxHash: prev.TxHash, Vout: 0, PublicKey: owner.PublicKey}},
+		Version: block.TxVersion,
+	}
+	for _, value := range values {
+		tx.Vouts = append(tx.Vouts, block.NewTxOutput(value, string(owner.GetAddress())))
+	}
+	tx.HashTransaction()
+	tx.Sign(owner.PrivateKey, map[string]block.Transaction{hex.EncodeToString(prev.TxHash): *prev})
+	return tx
+}
+
+// 将交易打包进新区块并连接到s的区块链 挖矿奖励属于新钱包 与之前的coinbase交易不同
+func mineTxs(s *Server, txs ...*block.Transaction) *block.Block {
+	coinbase := block.NewCoinbaseTransaction(string(wallet.NewWallet().GetAddress()))
+	s.chainMu.Lock()
+	defer s.chainMu.Unlock()
+	latest := s.Chain.GetLatestBlock()
+	newBlock := block.NewBlock(latest.Height+1, latest.Hash, append([]*block.Transaction{coinbase}, txs...))
+	s.connectBlock(newBlock)
+	return newBlock
+}
+
+func TestSubmitTx(t *testing.T) {
+	owner := wallet.NewWallet()
+	s := newTestServerWithOwner(t, NewMemoryNetwork(), "node0:3000", owner)
+	coinbase := s.Chain.GetLatestBlock().Txs[0]
+
+	tests := []struct {
+		name       string
+		values     []int
+		misbehaved bool
+	}{
+		{"negative output balances a larger one", []int{block.BlockSubsidy + 5, -5}, true},
+		{"zero output", []int{block.BlockSubsidy, 0}, true},
+		{"outputs exceed inputs", []int{block.BlockSubsidy + 1}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.SubmitTx(spendOnChain(s, owner, coinbase, test.values...))
+			var m *Misbehavior
+			if err == nil || errors.As(err, &m) != test.misbehaved {
+				t.Fatalf("SubmitTx() = %v, misbehavior %v", err, test.misbehaved)
+			}
+		})
+	}
+
+	// 已被区块花费的输出不能再被交易池接受
+	confirmed := spendOnChain(s, owner, coinbase, block.BlockSubsidy)
+	mineTxs(s, confirmed)
+	err := s.SubmitTx(spendOnChain(s, owner, coinbase, block.BlockSubsidy-1))
+	var m *Misbehavior
+	if !errors.Is(err, block.ErrSpentOutput) || errors.As(err, &m) {
+		t.Fatalf("double spend of a confirmed output: %v", err)
+	}
+	if s.Mempool.Size() != 0 {
+		t.Fatalf("mempool has %d transactions, want 0", s.Mempool.Size())
+	}
+
+	// 花费未花费的输出
+	tx := spendOnChain(s, owner, confirmed, block.BlockSubsidy-1)
+	if err := s.SubmitTx(tx); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Mempool.Has(tx.TxHash) {
+		t.Fatal("valid transaction is not in the mempool")
+	}
+}
@@ -0,0 +1,135 @@
+package node
+
+import (
+	"blockchain/block"
+	"blockchain/wallet"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// 节点运行时维护本节点钱包的交易记录
+// 区块连接后将钱包同步到新的最新区块 交易进入交易池时记录为未确认交易
+// 命令行生成的替换交易和子交易记录为钱包的未确认交易 由运行中的节点提交到交易池
+// 节点没有钱包文件时不做处理
+
+var (
+	ErrNotReplaceable = errors.New("transaction does not signal replacement")
+	ErrNoChange       = errors.New("transaction has no change to pay a higher fee")
+)
+
+// 将钱包同步到最新区块 调用方须持有chainMu
+func (s *Server) syncWallet() {
+	if !wallet.IsWalletExists(s.NodeId) {
+		return
+	}
+	wallets := wallet.NewWallets(s.NodeId)
+	s.Chain.SyncWallet(wallets, s.NodeId)
+}
+
+// 记录交易池中与钱包相关的交易
+func (s *Server) addWalletTx(tx *block.Transaction) {
+	if !wallet.IsWalletExists(s.NodeId) {
+		return
+	}
+	wallets := wallet.NewWallets(s.NodeId)
+	view := block.WalletTxView(tx)
+	view.Raw = tx.Serialize() // 钱包可以据此提高手续费
+	if wallets.AddUnconfirmed(view) {
+		wallets.SaveWallets(s.NodeId)
+	}
+}
+
+// 钱包中尚未确认且保存了原始数据的交易
+func pendingTxs(wallets *wallet.Wallets) []*block.Transaction {
+	var pending []*block.Transaction
+	for _, rec := range wallets.Transactions() {
+		if rec.BlockHash != nil || rec.Raw == nil {
+			continue
+		}
+		tx, err := block.DecodeTransaction(rec.Raw)
+		if err != nil {
+			log.Printf("decode the pending transaction[%x] failed: %v\n", rec.TxHash, err)
+			continue
+		}
+		pending = append(pending, tx)
+	}
+	return pending
+}
+
+// 将钱包中不在交易池中的未确认交易提交到交易池 与池中交易的冲突按替换规则处理
+// 被拒绝的交易留在钱包中 下次重试
+func (s *Server) submitWalletTxs() {
+	if !wallet.IsWalletExists(s.NodeId) {
+		return
+	}
+	for _, tx := range pendingTxs(wallet.NewWallets(s.NodeId)) {
+		if s.Mempool.Has(tx.TxHash) {
+			continue
+		}
+		if err := s.SubmitTx(tx); err != nil {
+			fmt.Printf("submit the wallet transaction[%x] failed: %v\n", tx.TxHash, err)
+		}
+	}
+}
+
+// FeeBump 替换钱包中未确认交易的交易
+type FeeBump struct {
+	Tx          *block.Transaction
+	Fee         int // 替换交易的手续费
+	OriginalFee int // 被替换交易的手续费
+	Change      int // 替换交易的找零
+}
+
+// NewFeeBump 以费率feeRate生成并签名替换交易 花费原交易的全部输入 增加的手续费由找零支付
+// 原交易最后一个属于钱包的输出视为找零 feeRate为0时使用满足替换规则的最低费率
+func NewFeeBump(chain *block.Chain, wallets *wallet.Wallets, original *block.Transaction, feeRate int) (*FeeBump, error) {
+	if !original.SignalsReplacement() {
+		return nil, fmt.Errorf("%w: [%x]", ErrNotReplaceable, original.TxHash)
+	}
+	prevTxs := make(map[string]block.Transaction)
+	for _, vin := range original.Vins {
+		if prevTx, ok := chain.LookupTransaction(vin.TxHash); ok {
+			prevTxs[hex.EncodeToString(prevTx.TxHash)] = *prevTx
+		}
+	}
+	originalFee, err := original.Fee(prevTxs)
+	if err != nil {
+		return nil, fmt.Errorf("inputs of the transaction are not confirmed: %w", err)
+	}
+	change := -1
+	for index, vout := range original.Vouts {
+		if _, ok := wallets.Wallets[vout.Address()]; ok && !vout.IsUnspendable() {
+			change = index
+		}
+	}
+	if change < 0 {
+		return nil, ErrNoChange
+	}
+	if feeRate == 0 {
+		size := len(original.Serialize())
+		feeRate = block.FeeRate(block.MinReplacementFee(originalFee, size), size) + 1
+	}
+	opts := block.DefaultSendOptions()
+	opts.FeeRate = feeRate
+	builder := block.NewTxBuilder(chain, nil).Options(opts).Replace(original, change)
+	tx, selection, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	if err := builder.Sign(tx, wallets); err != nil {
+		return nil, err
+	}
+	return &FeeBump{Tx: tx, Fee: selection.Fee, OriginalFee: originalFee, Change: selection.Change}, nil
+}
+
+// CheckReplacement 按交易池的替换规则检查替换交易能否替换原交易
+func (b *FeeBump) CheckReplacement(original *block.Transaction) error {
+	mempool := NewMempool()
+	if _, err := mempool.Add(original, b.OriginalFee); err != nil {
+		return err
+	}
+	_, err := mempool.Add(b.Tx, b.Fee)
+	return err
+}
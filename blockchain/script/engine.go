@@ -0,0 +1,425 @@
+package script
+
+import (
+	"blockchain/crypto"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// 脚本虚拟机
+// 先执行输入的解锁脚本 得到的栈作为引用输出锁定脚本的初始栈
+// 锁定脚本执行完毕后栈中只剩一个元素且为真 输入才能花费该输出
+// 执行结果只由脚本和交易决定 不依赖节点的本地状态
+
+// 资源限制
+const (
+	MaxScriptSize         = 10000 // 脚本的最大字节数
+	MaxElementSize        = 520   // 栈中元素的最大字节数
+	MaxOps                = 201   // 每个脚本执行的非压栈操作的最大数量
+	MaxStackSize          = 1000  // 栈的最大深度
+	MaxPubKeysPerMultiSig = 20    // 多重签名的最大公钥数量
+)
+
+var (
+	ErrScriptTooLarge        = errors.New("script is too large")
+	ErrElementTooLarge       = errors.New("element pushed to the stack is too large")
+	ErrTooManyOps            = errors.New("script executes too many operations")
+	ErrStackOverflow         = errors.New("stack size limit exceeded")
+	ErrStackUnderflow        = errors.New("operation needs more elements on the stack")
+	ErrMalformedPush         = errors.New("push operation exceeds the script")
+	ErrInvalidOpcode         = errors.New("invalid opcode")
+	ErrUnbalancedConditional = errors.New("unbalanced conditional")
+	ErrEarlyReturn           = errors.New("script returned early")
+	ErrVerifyFailed          = errors.New("verify failed")
+	ErrEqualVerify           = errors.New("equal verify failed")
+	ErrCheckSigVerify        = errors.New("signature verify failed")
+	ErrCheckMultiSigVerify   = errors.New("multisig verify failed")
+	ErrInvalidPubKeyCount    = errors.New("invalid public key count")
+	ErrInvalidSigCount       = errors.New("invalid signature count")
+	ErrNumberTooBig          = errors.New("number is too big")
+	ErrNonMinimalNumber      = errors.New("number is not minimally encoded")
+	ErrNegativeLockTime      = errors.New("negative lock time")
+	ErrUnsatisfiedLockTime   = errors.New("lock time has not been reached")
+	ErrNotPushOnly           = errors.New("unlocking script must only push data")
+	ErrEvalFalse             = errors.New("script evaluated to false")
+	ErrCleanStack            = errors.New("stack must contain exactly one element after execution")
+)
+
+// Checker 脚本中依赖交易的检查 由交易验证时提供
+type Checker interface {
+	// CheckSig 验证签名 scriptCode为正在执行的锁定脚本(P2SH为赎回脚本) 用于计算签名数据
+	CheckSig(sig, pubKey, scriptCode []byte) bool
+	// CheckLockTime 交易是否已达到指定的时间锁
+	CheckLockTime(lockTime int64) bool
+	// CheckSequence 正在验证的输入是否已达到指定的相对时间锁
+	CheckSequence(sequence int64) bool
+}
+
+// 相对时间锁的禁用标志 与交易输入序号中的标志相同 设置后OP_CHECKSEQUENCEVERIFY不做检查
+const sequenceLockTimeDisabled = 1 << 31
+
+// Verify 执行解锁脚本和锁定脚本 检查输入能否花费输出
+// 锁定脚本为P2SH时 解锁脚本最后压入的数据作为赎回脚本 使用其余数据再执行一次
+func Verify(unlocking, locking []byte, checker Checker) error {
+	if !IsPushOnly(unlocking) {
+		return ErrNotPushOnly
+	}
+	vm := &engine{checker: checker}
+	if err := vm.execute(unlocking); err != nil {
+		return err
+	}
+	unlocked := append([][]byte(nil), vm.stack...) // 解锁脚本执行后的栈 P2SH使用
+	if err := vm.execute(locking); err != nil {
+		return err
+	}
+	if ExtractScriptHash(locking) != nil {
+		if err := vm.evalResult(false); err != nil {
+			return err
+		}
+		vm.stack = unlocked
+		redeemScript, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if err := vm.execute(redeemScript); err != nil {
+			return err
+		}
+	}
+	return vm.evalResult(true)
+}
+
+// 检查执行结果 栈顶须为真 clean为true时栈中只能剩一个元素
+func (vm *engine) evalResult(clean bool) error {
+	if len(vm.stack) == 0 || !asBool(vm.stack[len(vm.stack)-1]) {
+		return ErrEvalFalse
+	}
+	if clean && len(vm.stack) != 1 {
+		return ErrCleanStack
+	}
+	return nil
+}
+
+type engine struct {
+	checker Checker
+	stack   [][]byte
+}
+
+func (vm *engine) push(data []byte) error {
+	if len(data) > MaxElementSize {
+		return ErrElementTooLarge
+	}
+	if len(vm.stack) >= MaxStackSize {
+		return ErrStackOverflow
+	}
+	vm.stack = append(vm.stack, data)
+	return nil
+}
+
+func (vm *engine) pop() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	top := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return top, nil
+}
+
+// 栈顶往下第n个元素 n从0开始
+func (vm *engine) peek(n int) ([]byte, error) {
+	if n >= len(vm.stack) {
+		return nil, ErrStackUnderflow
+	}
+	return vm.stack[len(vm.stack)-1-n], nil
+}
+
+func (vm *engine) popNum(maxSize int) (int64, error) {
+	data, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	return parseNum(data, maxSize)
+}
+
+// 执行脚本 不执行的条件分支中的操作同样计入操作数量
+func (vm *engine) execute(script []byte) error {
+	if len(script) > MaxScriptSize {
+		return ErrScriptTooLarge
+	}
+	instructions, err := Parse(script)
+	if err != nil {
+		return err
+	}
+	var conditions []bool // 嵌套的条件分支是否执行
+	ops := 0
+	for _, in := range instructions {
+		executing := true
+		for _, cond := range conditions {
+			executing = executing && cond
+		}
+		if !in.IsPush() {
+			if ops++; ops > MaxOps {
+				return ErrTooManyOps
+			}
+		}
+		switch in.Op {
+		case OpIf, OpNotIf:
+			cond := false
+			if executing {
+				top, err := vm.pop()
+				if err != nil {
+					return err
+				}
+				cond = asBool(top) == (in.Op == OpIf)
+			}
+			conditions = append(conditions, cond)
+			continue
+		case OpElse:
+			if len(conditions) == 0 {
+				return ErrUnbalancedConditional
+			}
+			conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+			continue
+		case OpEndIf:
+			if len(conditions) == 0 {
+				return ErrUnbalancedConditional
+			}
+			conditions = conditions[:len(conditions)-1]
+			continue
+		}
+		if !executing {
+			continue
+		}
+		if in.Op == OpCheckMultiSig || in.Op == OpCheckMultiSigVerify {
+			// 每个公钥计入一次操作
+			if n, err := vm.peek(0); err == nil {
+				if count, err := parseNum(n, maxNumSize); err == nil && count > 0 {
+					ops += int(count)
+				}
+			}
+			if ops > MaxOps {
+				return ErrTooManyOps
+			}
+		}
+		if err := vm.step(in, script); err != nil {
+			return err
+		}
+	}
+	if len(conditions) != 0 {
+		return ErrUnbalancedConditional
+	}
+	return nil
+}
+
+// 执行一条指令
+func (vm *engine) step(in Instruction, script []byte) error {
+	if n, ok := smallInt(in.Op); ok {
+		return vm.push(encodeNum(n))
+	}
+	if in.IsPush() {
+		return vm.push(in.Data)
+	}
+	switch in.Op {
+	case OpNop:
+		return nil
+	case OpVerify:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if !asBool(top) {
+			return ErrVerifyFailed
+		}
+		return nil
+	case OpReturn:
+		return ErrEarlyReturn
+	case OpDrop:
+		_, err := vm.pop()
+		return err
+	case OpDup:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		return vm.push(top)
+	case OpNip:
+		if len(vm.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		vm.stack = append(vm.stack[:len(vm.stack)-2], vm.stack[len(vm.stack)-1])
+		return nil
+	case OpOver:
+		second, err := vm.peek(1)
+		if err != nil {
+			return err
+		}
+		return vm.push(second)
+	case OpSwap:
+		if len(vm.stack) < 2 {
+			return ErrStackUnderflow
+		}
+		n := len(vm.stack)
+		vm.stack[n-1], vm.stack[n-2] = vm.stack[n-2], vm.stack[n-1]
+		return nil
+	case OpSize:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		return vm.push(encodeNum(int64(len(top))))
+	case OpEqual, OpEqualVerify:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if in.Op == OpEqualVerify {
+			if !equal {
+				return ErrEqualVerify
+			}
+			return nil
+		}
+		return vm.push(fromBool(equal))
+	case OpRipemd160, OpSha256, OpHash160, OpHash256:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		return vm.push(hashData(in.Op, top))
+	case OpCheckSig, OpCheckSigVerify:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		ok := len(sig) > 0 && vm.checker.CheckSig(sig, pubKey, script)
+		if in.Op == OpCheckSigVerify {
+			if !ok {
+				return ErrCheckSigVerify
+			}
+			return nil
+		}
+		return vm.push(fromBool(ok))
+	case OpCheckMultiSig, OpCheckMultiSigVerify:
+		ok, err := vm.checkMultiSig(script)
+		if err != nil {
+			return err
+		}
+		if in.Op == OpCheckMultiSigVerify {
+			if !ok {
+				return ErrCheckMultiSigVerify
+			}
+			return nil
+		}
+		return vm.push(fromBool(ok))
+	case OpCheckLockTimeVerify:
+		// 数值保留在栈中 通常后跟OP_DROP
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		lockTime, err := parseNum(top, maxLockTimeSize)
+		if err != nil {
+			return err
+		}
+		if lockTime < 0 {
+			return ErrNegativeLockTime
+		}
+		if !vm.checker.CheckLockTime(lockTime) {
+			return ErrUnsatisfiedLockTime
+		}
+		return nil
+	case OpCheckSequenceVerify:
+		top, err := vm.peek(0)
+		if err != nil {
+			return err
+		}
+		sequence, err := parseNum(top, maxLockTimeSize)
+		if err != nil {
+			return err
+		}
+		if sequence < 0 {
+			return ErrNegativeLockTime
+		}
+		if sequence&sequenceLockTimeDisabled != 0 {
+			return nil
+		}
+		if !vm.checker.CheckSequence(sequence) {
+			return ErrUnsatisfiedLockTime
+		}
+		return nil
+	}
+	return ErrInvalidOpcode
+}
+
+// 多重签名 栈中依次为: 签名... 签名数量m 公钥... 公钥数量n
+// 签名须按对应公钥的顺序排列 每个公钥最多匹配一个签名
+func (vm *engine) checkMultiSig(script []byte) (bool, error) {
+	n, err := vm.popNum(maxNumSize)
+	if err != nil {
+		return false, err
+	}
+	if n < 0 || n > MaxPubKeysPerMultiSig {
+		return false, ErrInvalidPubKeyCount
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+	m, err := vm.popNum(maxNumSize)
+	if err != nil {
+		return false, err
+	}
+	if m < 0 || m > n {
+		return false, ErrInvalidSigCount
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+	key := 0
+	for _, sig := range sigs {
+		if len(sig) == 0 {
+			return false, nil
+		}
+		for key < len(pubKeys) && !vm.checker.CheckSig(sig, pubKeys[key], script) {
+			key++
+		}
+		if key == len(pubKeys) {
+			return false, nil
+		}
+		key++
+	}
+	return true, nil
+}
+
+func hashData(op byte, data []byte) []byte {
+	switch op {
+	case OpRipemd160:
+		h := ripemd160.New()
+		h.Write(data)
+		return h.Sum(nil)
+	case OpSha256:
+		hash := sha256.Sum256(data)
+		return hash[:]
+	case OpHash160:
+		return crypto.Ripemd160Hash(data)
+	default:
+		first := sha256.Sum256(data)
+		hash := sha256.Sum256(first[:])
+		return hash[:]
+	}
+}
@@ -0,0 +1,133 @@
+package script
+
+import (
+	"blockchain/crypto"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// 签名与公钥相同即为有效 时间锁不超过lockTime、相对时间锁不超过sequence时满足
+type testChecker struct {
+	lockTime int64
+	sequence int64
+}
+
+func (c testChecker) CheckSig(sig, pubKey, scriptCode []byte) bool {
+	return bytes.Equal(sig, pubKey)
+}
+
+func (c testChecker) CheckLockTime(lockTime int64) bool {
+	return lockTime <= c.lockTime
+}
+
+func (c testChecker) CheckSequence(sequence int64) bool {
+	return sequence <= c.sequence
+}
+
+// 构造脚本 测试中的脚本不会超过大小限制
+func build(b *Builder) []byte {
+	s, err := b.Script()
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	key, other := []byte("public key 1"), []byte("public key 2")
+	p2pkh := PayToPubKeyHash(crypto.Ripemd160Hash(key))
+	redeem, err := MultiSig(2, [][]byte{key, other, []byte("public key 3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh := PayToScriptHash(crypto.Ripemd160Hash(redeem))
+	multiSig := func(sigs ...[]byte) []byte {
+		s, err := MultiSigScript(sigs, redeem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	ifElse := build(NewBuilder().AddOp(OpIf, Op1, OpElse, OpReturn, OpEndIf))
+	tooManyOps := NewBuilder()
+	for i := 0; i <= MaxOps; i++ {
+		tooManyOps.AddOp(OpNop)
+	}
+	lockTime := func(op byte, n int64) []byte {
+		return build(NewBuilder().AddInt(n).AddOp(op, OpDrop, Op1))
+	}
+	checker := testChecker{lockTime: 100, sequence: 10}
+
+	tests := []struct {
+		name      string
+		unlocking []byte
+		locking   []byte
+		err       error
+	}{
+		{"pay to public key hash", SignatureScript(key, key), p2pkh, nil},
+		{"other public key", SignatureScript(other, other), p2pkh, ErrEqualVerify},
+		{"invalid signature", SignatureScript([]byte("signature"), key), p2pkh, ErrEvalFalse},
+		{"unlocking script with operations", build(NewBuilder().AddData(key).AddOp(OpDup)), p2pkh, ErrNotPushOnly},
+		{"if branch", []byte{Op1}, ifElse, nil},
+		{"else branch", []byte{Op0}, ifElse, ErrEarlyReturn},
+		{"unbalanced conditional", []byte{Op1}, []byte{OpIf, Op1}, ErrUnbalancedConditional},
+		{"else without if", nil, []byte{Op1, OpElse}, ErrUnbalancedConditional},
+		{"stack left with two elements", []byte{Op1, Op1}, []byte{OpNop}, ErrCleanStack},
+		{"stack underflow", nil, []byte{OpDrop}, ErrStackUnderflow},
+		{"too many operations", []byte{Op1}, build(tooManyOps), ErrTooManyOps},
+		{"element too large", build(NewBuilder().AddData(make([]byte, MaxElementSize+1))), []byte{OpDrop, Op1}, ErrElementTooLarge},
+		{"malformed push", nil, []byte{5, 1}, ErrMalformedPush},
+		{"invalid opcode", nil, []byte{0xff}, ErrInvalidOpcode},
+		{"hash lock", build(NewBuilder().AddData([]byte("secret"))), build(NewBuilder().AddOp(OpSha256).AddData(hashData(OpSha256, []byte("secret"))).AddOp(OpEqual)), nil},
+		{"lock time reached", nil, lockTime(OpCheckLockTimeVerify, 100), nil},
+		{"lock time not reached", nil, lockTime(OpCheckLockTimeVerify, 101), ErrUnsatisfiedLockTime},
+		{"negative lock time", nil, lockTime(OpCheckLockTimeVerify, -1), ErrNegativeLockTime},
+		{"non-minimal lock time", nil, build(NewBuilder().AddData([]byte{1, 0}).AddOp(OpCheckLockTimeVerify)), ErrNonMinimalNumber},
+		{"sequence reached", nil, lockTime(OpCheckSequenceVerify, 10), nil},
+		{"sequence not reached", nil, lockTime(OpCheckSequenceVerify, 11), ErrUnsatisfiedLockTime},
+		{"sequence lock disabled", nil, lockTime(OpCheckSequenceVerify, sequenceLockTimeDisabled|11), nil},
+		{"multisig", multiSig(key, []byte("public key 3")), p2sh, nil},
+		{"multisig out of order", multiSig([]byte("public key 3"), key), p2sh, ErrEvalFalse},
+		{"multisig with one signature", multiSig(key), p2sh, ErrStackUnderflow},
+		{"other redeem script", build(NewBuilder().AddData(key).AddData(key).AddData(p2pkh)), p2sh, ErrEvalFalse},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Verify(test.unlocking, test.locking, checker); !errors.Is(err, test.err) {
+				t.Fatalf("Verify(%s, %s) = %v, want %v", Disasm(test.unlocking), Disasm(test.locking), err, test.err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	data := bytes.Repeat([]byte{7}, 300)
+	s := build(NewBuilder().AddInt(-1).AddInt(16).AddInt(1000).AddData(data[:75]).AddData(data[:76]).AddData(data))
+	instructions, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []byte{Op1Negate, Op16, 2, 75, OpPushData1, OpPushData2}
+	sizes := []int{0, 0, 2, 75, 76, 300}
+	if len(instructions) != len(ops) {
+		t.Fatalf("%d instructions, want %d", len(instructions), len(ops))
+	}
+	for i, in := range instructions {
+		if in.Op != ops[i] || len(in.Data) != sizes[i] {
+			t.Fatalf("instruction %d = %s with %d bytes, want %s with %d bytes", i, OpcodeName(in.Op), len(in.Data), OpcodeName(ops[i]), sizes[i])
+		}
+	}
+	if !IsPushOnly(s) || IsPushOnly(append(s, OpDup)) {
+		t.Fatal("IsPushOnly() is wrong")
+	}
+	if pushed, err := PushedData(s); err != nil || len(pushed) != 4 {
+		t.Fatalf("PushedData() = %d items, %v, want 4 without small integers", len(pushed), err)
+	}
+	if _, err := Parse([]byte{OpPushData2, 1}); !errors.Is(err, ErrMalformedPush) {
+		t.Fatalf("Parse(truncated length) = %v, want %v", err, ErrMalformedPush)
+	}
+	if _, err := NewBuilder().AddData(make([]byte, MaxScriptSize)).Script(); !errors.Is(err, ErrScriptTooLarge) {
+		t.Fatalf("Script() = %v, want %v", err, ErrScriptTooLarge)
+	}
+}
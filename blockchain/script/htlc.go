@@ -0,0 +1,76 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+)
+
+// 哈希时间锁合约(HTLC)
+// 收款方在时间锁之前出示哈希匹配的秘密值即可花费 时间锁之后退款方可以取回
+// 两条链上使用同一个秘密哈希的合约可以实现原子交换: 一方取款时公开秘密值 另一方随之取款
+//
+// OP_IF
+//   OP_SIZE <32> OP_EQUALVERIFY OP_SHA256 <秘密哈希> OP_EQUALVERIFY OP_DUP OP_HASH160 <收款方公钥哈希>
+// OP_ELSE
+//   <时间锁> OP_CHECKLOCKTIMEVERIFY OP_DROP OP_DUP OP_HASH160 <退款方公钥哈希>
+// OP_ENDIF
+// OP_EQUALVERIFY OP_CHECKSIG
+
+// SecretSize 秘密值的字节数 限定长度避免两条链对数据长度的限制不同
+const SecretSize = 32
+
+var ErrInvalidHTLC = errors.New("invalid hash time-locked contract")
+
+// HTLC 哈希时间锁合约的参数
+type HTLC struct {
+	SecretHash []byte // 秘密值的sha256哈希
+	Recipient  []byte // 收款方公钥哈希
+	Refund     []byte // 退款方公钥哈希
+	LockTime   int64  // 退款时间锁 区块高度或Unix时间
+}
+
+// Script 合约脚本 作为P2SH的赎回脚本
+func (h *HTLC) Script() ([]byte, error) {
+	if len(h.SecretHash) != 32 || len(h.Recipient) != 20 || len(h.Refund) != 20 || h.LockTime <= 0 {
+		return nil, ErrInvalidHTLC
+	}
+	return NewBuilder().
+		AddOp(OpIf, OpSize).AddInt(SecretSize).AddOp(OpEqualVerify, OpSha256).AddData(h.SecretHash).
+		AddOp(OpEqualVerify, OpDup, OpHash160).AddData(h.Recipient).
+		AddOp(OpElse).AddInt(h.LockTime).AddOp(OpCheckLockTimeVerify, OpDrop, OpDup, OpHash160).AddData(h.Refund).
+		AddOp(OpEndIf, OpEqualVerify, OpCheckSig).Script()
+}
+
+// ParseHTLC 解析合约脚本 不是哈希时间锁合约时返回错误
+func ParseHTLC(script []byte) (*HTLC, error) {
+	instructions, err := Parse(script)
+	if err != nil || len(instructions) != 20 {
+		return nil, ErrInvalidHTLC
+	}
+	h := &HTLC{
+		SecretHash: instructions[5].Data,
+		Recipient:  instructions[9].Data,
+		Refund:     instructions[16].Data,
+	}
+	if n, ok := smallInt(instructions[11].Op); ok {
+		h.LockTime = n
+	} else if h.LockTime, err = parseNum(instructions[11].Data, maxLockTimeSize); err != nil {
+		return nil, ErrInvalidHTLC
+	}
+	// 重新生成脚本比较 确保模板和数据编码完全一致
+	expected, err := h.Script()
+	if err != nil || !bytes.Equal(expected, script) {
+		return nil, ErrInvalidHTLC
+	}
+	return h, nil
+}
+
+// HTLCRedeemScript 收款方的解锁脚本 <签名> <公钥> <秘密值> OP_TRUE <合约>
+func HTLCRedeemScript(sig, pubKey, secret, contract []byte) ([]byte, error) {
+	return NewBuilder().AddData(sig).AddData(pubKey).AddData(secret).AddOp(OpTrue).AddData(contract).Script()
+}
+
+// HTLCRefundScript 退款方的解锁脚本 <签名> <公钥> OP_FALSE <合约>
+func HTLCRefundScript(sig, pubKey, contract []byte) ([]byte, error) {
+	return NewBuilder().AddData(sig).AddData(pubKey).AddOp(OpFalse).AddData(contract).Script()
+}
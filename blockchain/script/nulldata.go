@@ -0,0 +1,51 @@
+package script
+
+import "errors"
+
+// 数据输出
+// 锁定脚本以OP_RETURN开头 执行时立即失败 任何解锁脚本都无法花费 节点不必将其放入UTXO集
+// OP_RETURN <数据>
+// 数据长度有上限 避免区块链被用作通用存储 通常只存放文档哈希等摘要
+
+// MaxDataCarrierSize 数据输出携带的最大字节数
+const MaxDataCarrierSize = 80
+
+var (
+	ErrDataTooLarge    = errors.New("data output is too large")
+	ErrInvalidNullData = errors.New("invalid data output script")
+)
+
+// NullData 携带数据的不可花费锁定脚本
+func NullData(data []byte) ([]byte, error) {
+	if len(data) > MaxDataCarrierSize {
+		return nil, ErrDataTooLarge
+	}
+	b := NewBuilder().AddOp(OpReturn)
+	if len(data) > 0 {
+		b.AddData(data)
+	}
+	return b.Script()
+}
+
+// IsUnspendable 以OP_RETURN开头的脚本不可花费
+func IsUnspendable(script []byte) bool {
+	return len(script) > 0 && script[0] == OpReturn
+}
+
+// ExtractNullData 数据输出脚本携带的数据 脚本不是OP_RETURN加一次压栈或数据超过上限时返回错误
+func ExtractNullData(script []byte) ([]byte, error) {
+	instructions, err := Parse(script)
+	if err != nil || len(instructions) == 0 || len(instructions) > 2 || instructions[0].Op != OpReturn {
+		return nil, ErrInvalidNullData
+	}
+	if len(instructions) == 1 {
+		return nil, nil
+	}
+	if instructions[1].Op > OpPushData2 {
+		return nil, ErrInvalidNullData
+	}
+	if len(instructions[1].Data) > MaxDataCarrierSize {
+		return nil, ErrDataTooLarge
+	}
+	return instructions[1].Data, nil
+}
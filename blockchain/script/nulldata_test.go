@@ -0,0 +1,48 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNullData(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("document hash"), bytes.Repeat([]byte{1}, MaxDataCarrierSize)} {
+		s, err := NullData(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsUnspendable(s) {
+			t.Fatalf("%s is spendable", Disasm(s))
+		}
+		if extracted, err := ExtractNullData(s); !bytes.Equal(extracted, data) || err != nil {
+			t.Fatalf("ExtractNullData(%s) = %x, %v, want %x", Disasm(s), extracted, err, data)
+		}
+		// 任何解锁脚本都无法花费
+		if err := Verify([]byte{Op1}, s, testChecker{}); !errors.Is(err, ErrEarlyReturn) {
+			t.Fatalf("Verify(%s) = %v, want %v", Disasm(s), err, ErrEarlyReturn)
+		}
+	}
+	if _, err := NullData(make([]byte, MaxDataCarrierSize+1)); !errors.Is(err, ErrDataTooLarge) {
+		t.Fatalf("NullData() = %v, want %v", err, ErrDataTooLarge)
+	}
+	if IsUnspendable(nil) || IsUnspendable(PayToPubKeyHash(make([]byte, 20))) {
+		t.Fatal("a spendable script is taken as unspendable")
+	}
+
+	errs := []struct {
+		script []byte
+		err    error
+	}{
+		{PayToPubKeyHash(make([]byte, 20)), ErrInvalidNullData},
+		{[]byte{OpReturn, Op1}, ErrInvalidNullData},
+		{build(NewBuilder().AddOp(OpReturn).AddData([]byte{1}).AddData([]byte{2})), ErrInvalidNullData},
+		{[]byte{OpReturn, 5, 1}, ErrInvalidNullData},
+		{build(NewBuilder().AddOp(OpReturn).AddData(make([]byte, MaxDataCarrierSize+1))), ErrDataTooLarge},
+	}
+	for _, test := range errs {
+		if _, err := ExtractNullData(test.script); !errors.Is(err, test.err) {
+			t.Fatalf("ExtractNullData(%s) = %v, want %v", Disasm(test.script), err, test.err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package script
+
+// 脚本中的数值
+// 小端序 最高字节的最高位为符号位 须为最短编码 空数据表示0
+
+const (
+	maxNumSize      = 4 // 一般数值的最大字节数
+	maxLockTimeSize = 5 // 时间锁数值的最大字节数
+)
+
+// 解析栈中的数值
+func parseNum(data []byte, maxSize int) (int64, error) {
+	if len(data) > maxSize {
+		return 0, ErrNumberTooBig
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	// 最高字节只有符号位时 次高字节的最高位须已被占用
+	last := data[len(data)-1]
+	if last&0x7f == 0 && (len(data) == 1 || data[len(data)-2]&0x80 == 0) {
+		return 0, ErrNonMinimalNumber
+	}
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << uint(8*i)
+	}
+	if last&0x80 != 0 {
+		n &^= int64(0x80) << uint(8*(len(data)-1))
+		return -n, nil
+	}
+	return n, nil
+}
+
+// 数值的最短编码
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return nil
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var data []byte
+	for n > 0 {
+		data = append(data, byte(n&0xff))
+		n >>= 8
+	}
+	// 最高位已被占用时增加一个字节存放符号位
+	if data[len(data)-1]&0x80 != 0 {
+		extra := byte(0)
+		if negative {
+			extra = 0x80
+		}
+		data = append(data, extra)
+	} else if negative {
+		data[len(data)-1] |= 0x80
+	}
+	return data
+}
+
+// 栈中数据作为布尔值 全零(包括负零)为假
+func asBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return i != len(data)-1 || b != 0x80
+		}
+	}
+	return false
+}
+
+func fromBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return nil
+}
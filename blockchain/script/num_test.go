@@ -0,0 +1,71 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNum(t *testing.T) {
+	tests := []struct {
+		n    int64
+		data []byte
+	}{
+		{0, nil},
+		{1, []byte{0x01}},
+		{-1, []byte{0x81}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x00}},
+		{-128, []byte{0x80, 0x80}},
+		{255, []byte{0xff, 0x00}},
+		{256, []byte{0x00, 0x01}},
+		{-32768, []byte{0x00, 0x80, 0x80}},
+		{2147483647, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, test := range tests {
+		if data := encodeNum(test.n); !bytes.Equal(data, test.data) {
+			t.Fatalf("encodeNum(%d) = %x, want %x", test.n, data, test.data)
+		}
+		if n, err := parseNum(test.data, maxNumSize); n != test.n || err != nil {
+			t.Fatalf("parseNum(%x) = %d, %v, want %d", test.data, n, err, test.n)
+		}
+	}
+
+	errs := []struct {
+		data []byte
+		err  error
+	}{
+		{[]byte{0x00}, ErrNonMinimalNumber},
+		{[]byte{0x80}, ErrNonMinimalNumber},
+		{[]byte{0x01, 0x00}, ErrNonMinimalNumber},
+		{[]byte{0x00, 0x00, 0x00, 0x80, 0x00}, ErrNumberTooBig},
+	}
+	for _, test := range errs {
+		if _, err := parseNum(test.data, maxNumSize); !errors.Is(err, test.err) {
+			t.Fatalf("parseNum(%x) = %v, want %v", test.data, err, test.err)
+		}
+	}
+	// 时间锁可以使用5字节
+	if n, err := parseNum(encodeNum(1<<32), maxLockTimeSize); n != 1<<32 || err != nil {
+		t.Fatalf("parseNum(lock time) = %d, %v", n, err)
+	}
+}
+
+func TestAsBool(t *testing.T) {
+	tests := []struct {
+		data []byte
+		v    bool
+	}{
+		{nil, false},
+		{[]byte{0x00, 0x00}, false},
+		{[]byte{0x80}, false}, // 负零
+		{[]byte{0x00, 0x80}, false},
+		{[]byte{0x80, 0x00}, true},
+		{[]byte{0x00, 0x01}, true},
+	}
+	for _, test := range tests {
+		if v := asBool(test.data); v != test.v {
+			t.Fatalf("asBool(%x) = %v, want %v", test.data, v, test.v)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// 脚本由操作码和数据组成 按顺序在栈上执行
+// 0x01-0x4b: 将其后对应字节数的数据压栈
+// OpPushData1/OpPushData2: 其后1或2字节(小端序)为数据长度
+// Op0/Op1Negate/Op1-Op16: 将小整数压栈
+
+// 操作码
+const (
+	Op0         byte = 0x00 // 压入空数据(假)
+	OpPushData1 byte = 0x4c
+	OpPushData2 byte = 0x4d
+	Op1Negate   byte = 0x4f
+	Op1         byte = 0x51 // 压入1(真)
+	Op16        byte = 0x60
+
+	OpNop    byte = 0x61
+	OpIf     byte = 0x63
+	OpNotIf  byte = 0x64
+	OpElse   byte = 0x67
+	OpEndIf  byte = 0x68
+	OpVerify byte = 0x69 // 栈顶为假时失败
+	OpReturn byte = 0x6a // 立即失败 用于标记不可花费的输出
+
+	OpDrop byte = 0x75
+	OpDup  byte = 0x76
+	OpNip  byte = 0x77
+	OpOver byte = 0x78
+	OpSwap byte = 0x7c
+	OpSize byte = 0x82 // 压入栈顶数据的长度
+
+	OpEqual       byte = 0x87
+	OpEqualVerify byte = 0x88
+
+	OpRipemd160 byte = 0xa6
+	OpSha256    byte = 0xa8
+	OpHash160   byte = 0xa9 // sha256后再ripemd160 与地址的公钥哈希相同
+	OpHash256   byte = 0xaa // 两次sha256
+
+	OpCheckSig            byte = 0xac
+	OpCheckSigVerify      byte = 0xad
+	OpCheckMultiSig       byte = 0xae
+	OpCheckMultiSigVerify byte = 0xaf
+
+	OpCheckLockTimeVerify byte = 0xb1 // 交易的时间锁须已达到栈顶的数值
+	OpCheckSequenceVerify byte = 0xb2 // 输入的相对时间锁须已达到栈顶的数值
+)
+
+const (
+	OpFalse = Op0
+	OpTrue  = Op1
+)
+
+var opcodeNames = map[byte]string{
+	Op0:                   "OP_0",
+	OpPushData1:           "OP_PUSHDATA1",
+	OpPushData2:           "OP_PUSHDATA2",
+	Op1Negate:             "OP_1NEGATE",
+	OpNop:                 "OP_NOP",
+	OpIf:                  "OP_IF",
+	OpNotIf:               "OP_NOTIF",
+	OpElse:                "OP_ELSE",
+	OpEndIf:               "OP_ENDIF",
+	OpVerify:              "OP_VERIFY",
+	OpReturn:              "OP_RETURN",
+	OpDrop:                "OP_DROP",
+	OpDup:                 "OP_DUP",
+	OpNip:                 "OP_NIP",
+	OpOver:                "OP_OVER",
+	OpSwap:                "OP_SWAP",
+	OpSize:                "OP_SIZE",
+	OpEqual:               "OP_EQUAL",
+	OpEqualVerify:         "OP_EQUALVERIFY",
+	OpRipemd160:           "OP_RIPEMD160",
+	OpSha256:              "OP_SHA256",
+	OpHash160:             "OP_HASH160",
+	OpHash256:             "OP_HASH256",
+	OpCheckSig:            "OP_CHECKSIG",
+	OpCheckSigVerify:      "OP_CHECKSIGVERIFY",
+	OpCheckMultiSig:       "OP_CHECKMULTISIG",
+	OpCheckMultiSigVerify: "OP_CHECKMULTISIGVERIFY",
+	OpCheckLockTimeVerify: "OP_CHECKLOCKTIMEVERIFY",
+	OpCheckSequenceVerify: "OP_CHECKSEQUENCEVERIFY",
+}
+
+// OpcodeName 操作码的名称
+func OpcodeName(op byte) string {
+	if op > Op1 && op <= Op16 {
+		return fmt.Sprintf("OP_%d", op-Op1+1)
+	}
+	if op == Op1 {
+		return "OP_1"
+	}
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP_UNKNOWN%d", op)
+}
+
+// 是否为小整数操作码 返回对应的数值
+func smallInt(op byte) (int64, bool) {
+	switch {
+	case op == Op0:
+		return 0, true
+	case op == Op1Negate:
+		return -1, true
+	case op >= Op1 && op <= Op16:
+		return int64(op-Op1) + 1, true
+	}
+	return 0, false
+}
+
+// Instruction 解析后的一条指令
+type Instruction struct {
+	Op   byte
+	Data []byte // 压栈操作的数据
+}
+
+// IsPush 是否为压栈操作
+func (in Instruction) IsPush() bool {
+	_, small := smallInt(in.Op)
+	return in.Op <= OpPushData2 || small
+}
+
+// Parse 将脚本解析为指令序列
+func Parse(script []byte) ([]Instruction, error) {
+	var instructions []Instruction
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+		size := 0
+		switch {
+		case op > Op0 && op < OpPushData1:
+			size = int(op)
+		case op == OpPushData1:
+			if i+1 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			size = int(script[i])
+			i++
+		case op == OpPushData2:
+			if i+2 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			size = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		}
+		if i+size > len(script) {
+			return nil, ErrMalformedPush
+		}
+		in := Instruction{Op: op}
+		if size > 0 {
+			in.Data = script[i : i+size]
+		}
+		i += size
+		instructions = append(instructions, in)
+	}
+	return instructions, nil
+}
+
+// IsPushOnly 脚本是否只包含压栈操作
+func IsPushOnly(script []byte) bool {
+	instructions, err := Parse(script)
+	if err != nil {
+		return false
+	}
+	for _, in := range instructions {
+		if !in.IsPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// PushedData 脚本中压栈的数据 不含小整数
+func PushedData(script []byte) ([][]byte, error) {
+	instructions, err := Parse(script)
+	if err != nil {
+		return nil, err
+	}
+	var data [][]byte
+	for _, in := range instructions {
+		if in.Op > Op0 && in.Op <= OpPushData2 {
+			data = append(data, in.Data)
+		}
+	}
+	return data, nil
+}
+
+// Disasm 脚本的文本形式 数据以十六进制显示
+func Disasm(script []byte) string {
+	instructions, err := Parse(script)
+	var parts []string
+	for _, in := range instructions {
+		if in.Op > Op0 && in.Op <= OpPushData2 {
+			parts = append(parts, hex.EncodeToString(in.Data))
+		} else {
+			parts = append(parts, OpcodeName(in.Op))
+		}
+	}
+	if err != nil {
+		parts = append(parts, "[error]")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,148 @@
+package script
+
+import "encoding/binary"
+
+// 脚本构造和标准模板
+
+// Builder 脚本构造器 数据使用最短的压栈操作
+type Builder struct {
+	script []byte
+}
+
+// NewBuilder 创建脚本构造器
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp 添加操作码
+func (b *Builder) AddOp(ops ...byte) *Builder {
+	b.script = append(b.script, ops...)
+	return b
+}
+
+// AddData 添加压栈数据
+func (b *Builder) AddData(data []byte) *Builder {
+	switch n := len(data); {
+	case n == 0:
+		b.script = append(b.script, Op0)
+	case n < int(OpPushData1):
+		b.script = append(b.script, byte(n))
+	case n <= 0xff:
+		b.script = append(b.script, OpPushData1, byte(n))
+	default:
+		b.script = append(b.script, OpPushData2, 0, 0)
+		binary.LittleEndian.PutUint16(b.script[len(b.script)-2:], uint16(n))
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt 添加数值 -1到16使用小整数操作码
+func (b *Builder) AddInt(n int64) *Builder {
+	switch {
+	case n == 0:
+		b.script = append(b.script, Op0)
+	case n == -1:
+		b.script = append(b.script, Op1Negate)
+	case n >= 1 && n <= 16:
+		b.script = append(b.script, Op1+byte(n-1))
+	default:
+		b.AddData(encodeNum(n))
+	}
+	return b
+}
+
+// Script 构造完成的脚本
+func (b *Builder) Script() ([]byte, error) {
+	if len(b.script) > MaxScriptSize {
+		return nil, ErrScriptTooLarge
+	}
+	return b.script, nil
+}
+
+// PayToPubKeyHash P2PKH锁定脚本
+// OP_DUP OP_HASH160 <公钥哈希> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(pubKeyHash []byte) []byte {
+	script, _ := NewBuilder().AddOp(OpDup, OpHash160).AddData(pubKeyHash).AddOp(OpEqualVerify, OpCheckSig).Script()
+	return script
+}
+
+// ExtractPubKeyHash P2PKH锁定脚本中的公钥哈希 不是P2PKH脚本时返回nil
+func ExtractPubKeyHash(script []byte) []byte {
+	if len(script) == 25 && script[0] == OpDup && script[1] == OpHash160 && script[2] == 20 &&
+		script[23] == OpEqualVerify && script[24] == OpCheckSig {
+		return script[3:23]
+	}
+	return nil
+}
+
+// SignatureScript P2PKH解锁脚本 <签名> <公钥>
+func SignatureScript(sig, pubKey []byte) []byte {
+	script, _ := NewBuilder().AddData(sig).AddData(pubKey).Script()
+	return script
+}
+
+// PayToScriptHash P2SH锁定脚本 花费时须提供哈希匹配的赎回脚本及其解锁数据
+// OP_HASH160 <脚本哈希> OP_EQUAL
+func PayToScriptHash(scriptHash []byte) []byte {
+	script, _ := NewBuilder().AddOp(OpHash160).AddData(scriptHash).AddOp(OpEqual).Script()
+	return script
+}
+
+// ExtractScriptHash P2SH锁定脚本中的脚本哈希 不是P2SH脚本时返回nil
+func ExtractScriptHash(script []byte) []byte {
+	if len(script) == 23 && script[0] == OpHash160 && script[1] == 20 && script[22] == OpEqual {
+		return script[2:22]
+	}
+	return nil
+}
+
+// MultiSig M-of-N多重签名脚本 需要pubKeys中m个公钥的签名
+// <m> <公钥>... <n> OP_CHECKMULTISIG
+func MultiSig(m int, pubKeys [][]byte) ([]byte, error) {
+	if len(pubKeys) == 0 || len(pubKeys) > MaxPubKeysPerMultiSig {
+		return nil, ErrInvalidPubKeyCount
+	}
+	if m <= 0 || m > len(pubKeys) {
+		return nil, ErrInvalidSigCount
+	}
+	b := NewBuilder().AddInt(int64(m))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+	return b.AddInt(int64(len(pubKeys))).AddOp(OpCheckMultiSig).Script()
+}
+
+// ParseMultiSig 解析多重签名脚本 返回需要的签名数量和公钥列表
+func ParseMultiSig(script []byte) (int, [][]byte, bool) {
+	instructions, err := Parse(script)
+	if err != nil || len(instructions) < 4 || instructions[len(instructions)-1].Op != OpCheckMultiSig {
+		return 0, nil, false
+	}
+	m, ok := smallInt(instructions[0].Op)
+	n, ok2 := smallInt(instructions[len(instructions)-2].Op)
+	pushes := instructions[1 : len(instructions)-2]
+	if !ok || !ok2 || m <= 0 || int(n) != len(pushes) || m > n {
+		return 0, nil, false
+	}
+	var pubKeys [][]byte
+	for _, in := range pushes {
+		if in.Op == Op0 || in.Op > OpPushData2 {
+			return 0, nil, false
+		}
+		pubKeys = append(pubKeys, in.Data)
+	}
+	return int(m), pubKeys, true
+}
+
+// MultiSigScript 多重签名的解锁脚本 签名须按公钥顺序排列 redeemScript非空时附加在最后(P2SH)
+func MultiSigScript(sigs [][]byte, redeemScript []byte) ([]byte, error) {
+	b := NewBuilder()
+	for _, sig := range sigs {
+		b.AddData(sig)
+	}
+	if redeemScript != nil {
+		b.AddData(redeemScript)
+	}
+	return b.Script()
+}
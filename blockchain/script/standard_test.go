@@ -0,0 +1,70 @@
+package script
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMultiSig(t *testing.T) {
+	pubKeys := [][]byte{[]byte("public key 1"), []byte("public key 2"), []byte("public key 3")}
+	redeem, err := MultiSig(2, pubKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, parsed, ok := ParseMultiSig(redeem)
+	if !ok || m != 2 || len(parsed) != len(pubKeys) {
+		t.Fatalf("ParseMultiSig(%s) = %d, %d public keys, %v", Disasm(redeem), m, len(parsed), ok)
+	}
+	for i := range pubKeys {
+		if !bytes.Equal(parsed[i], pubKeys[i]) {
+			t.Fatalf("public key %d = %q, want %q", i, parsed[i], pubKeys[i])
+		}
+	}
+
+	errs := []struct {
+		m       int
+		pubKeys [][]byte
+		err     error
+	}{
+		{1, nil, ErrInvalidPubKeyCount},
+		{1, make([][]byte, MaxPubKeysPerMultiSig+1), ErrInvalidPubKeyCount},
+		{0, pubKeys, ErrInvalidSigCount},
+		{4, pubKeys, ErrInvalidSigCount},
+	}
+	for _, test := range errs {
+		if _, err := MultiSig(test.m, test.pubKeys); !errors.Is(err, test.err) {
+			t.Fatalf("MultiSig(%d, %d public keys) = %v, want %v", test.m, len(test.pubKeys), err, test.err)
+		}
+	}
+
+	// 公钥数量与n不符或不是多重签名的脚本
+	invalid := [][]byte{
+		PayToPubKeyHash(make([]byte, 20)),
+		PayToScriptHash(make([]byte, 20)),
+		append([]byte{Op1 + 3}, redeem[1:len(redeem)-2]...),
+		append(append([]byte{}, redeem[:len(redeem)-2]...), Op1+1, OpCheckMultiSig),
+		{Op1, Op0, Op1, OpCheckMultiSig},
+	}
+	for _, s := range invalid {
+		if _, _, ok := ParseMultiSig(s); ok {
+			t.Fatalf("ParseMultiSig(%s) accepted an invalid script", Disasm(s))
+		}
+	}
+}
+
+func TestScriptHash(t *testing.T) {
+	hash := bytes.Repeat([]byte{1}, 20)
+	if h := ExtractScriptHash(PayToScriptHash(hash)); !bytes.Equal(h, hash) {
+		t.Fatalf("ExtractScriptHash() = %x, want %x", h, hash)
+	}
+	if h := ExtractScriptHash(PayToPubKeyHash(hash)); h != nil {
+		t.Fatalf("ExtractScriptHash(pay to public key hash) = %x", h)
+	}
+	if h := ExtractPubKeyHash(PayToPubKeyHash(hash)); !bytes.Equal(h, hash) {
+		t.Fatalf("ExtractPubKeyHash() = %x, want %x", h, hash)
+	}
+	if h := ExtractPubKeyHash(PayToScriptHash(hash)); h != nil {
+		t.Fatalf("ExtractPubKeyHash(pay to script hash) = %x", h)
+	}
+}
@@ -0,0 +1,164 @@
+package wallet
+
+import (
+	"blockchain/crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// 分层确定性钱包(BIP32)
+// 由种子派生主密钥 再按路径逐级派生子密钥 同一种子总是得到相同的密钥序列
+// 路径采用 m/44'/币种'/账户'/找零/索引 的格式 找零为0表示收款地址 为1表示找零地址
+
+const (
+	HardenedOffset uint32 = 0x80000000 // 强化派生的起始索引
+	CoinType       uint32 = 0          // 路径中的币种
+	ExternalChain  uint32 = 0          // 收款地址链
+	ChangeChain    uint32 = 1          // 找零地址链
+)
+
+// 主密钥的HMAC密钥 与签名方案的曲线对应(BIP32/SLIP-0010)
+var masterKeySalts = map[string]string{
+	"secp256k1": "Bitcoin seed",
+	"p256":      "Nist256p1 seed",
+}
+
+var ErrInvalidPath = errors.New("invalid derivation path")
+
+// ExtendedKey 扩展私钥 包含私钥和链码
+type ExtendedKey struct {
+	Key       []byte // 32字节私钥
+	ChainCode []byte // 32字节链码
+	Depth     uint8
+	Index     uint32
+	scheme    crypto.SignatureScheme // 派生使用的签名方案
+}
+
+// NewMasterKey 由种子生成指定签名方案的主密钥
+func NewMasterKey(seed []byte, scheme crypto.SignatureScheme) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errors.New("seed length must be between 128 and 512 bits")
+	}
+	salt, ok := masterKeySalts[scheme.Name()]
+	if !ok {
+		return nil, crypto.ErrUnknownScheme
+	}
+	mac := hmac.New(sha512.New, []byte(salt))
+	for {
+		mac.Write(seed)
+		sum := mac.Sum(nil)
+		key, chainCode := sum[:32], sum[32:]
+		if isValidScalar(scheme.Curve(), key) {
+			return &ExtendedKey{Key: key, ChainCode: chainCode, scheme: scheme}, nil
+		}
+		// 私钥无效时使用结果重新计算
+		seed = sum
+		mac.Reset()
+	}
+}
+
+// 私钥须在[1, n-1]范围内
+func isValidScalar(curve elliptic.Curve, key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() > 0 && k.Cmp(curve.Params().N) < 0
+}
+
+// Child 派生子私钥 index不小于HardenedOffset时为强化派生
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	curve := k.scheme.Curve()
+	n := curve.Params().N
+	data := make([]byte, 0, 37)
+	if index >= HardenedOffset {
+		data = append(data, 0)
+		data = append(data, k.Key...)
+	} else {
+		x, y := curve.ScalarBaseMult(k.Key)
+		data = append(data, elliptic.MarshalCompressed(curve, x, y)...)
+	}
+	indexBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(indexBytes, index)
+	data = append(data, indexBytes...)
+
+	for {
+		mac := hmac.New(sha512.New, k.ChainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		il := new(big.Int).SetBytes(sum[:32])
+		child := new(big.Int).Add(il, new(big.Int).SetBytes(k.Key))
+		child.Mod(child, n)
+		if il.Cmp(n) < 0 && child.Sign() != 0 {
+			key := make([]byte, 32)
+			child.FillBytes(key)
+			return &ExtendedKey{Key: key, ChainCode: sum[32:], Depth: k.Depth + 1, Index: index, scheme: k.scheme}, nil
+		}
+		// 结果无效时使用下一次计算的输入(SLIP-0010)
+		data = append(append([]byte{1}, sum[32:]...), indexBytes...)
+	}
+}
+
+// DerivePath 按路径派生私钥 例如 m/44'/0'/0'/0/1
+func (k *ExtendedKey) DerivePath(path string) (*ExtendedKey, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, ErrInvalidPath
+	}
+	key := k
+	for _, part := range parts[1:] {
+		offset := uint32(0)
+		if strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h") {
+			offset = HardenedOffset
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, ErrInvalidPath
+		}
+		if key, err = key.Child(uint32(index) + offset); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// PrivateKey 转换为ecdsa私钥
+func (k *ExtendedKey) PrivateKey() ecdsa.PrivateKey {
+	priKey, err := crypto.NewPrivateKey(k.scheme.Curve(), k.Key)
+	if err != nil {
+		log.Panicf("convert the extended key failed: %v\n", err)
+	}
+	return *priKey
+}
+
+// KeyPath 地址在账户中的位置
+type KeyPath struct {
+	Account uint32
+	Change  uint32
+	Index   uint32
+}
+
+// String 完整的派生路径
+func (p KeyPath) String() string {
+	return fmt.Sprintf("m/44'/%d'/%d'/%d/%d", CoinType, p.Account, p.Change, p.Index)
+}
+
+// 由种子派生指定路径的钱包
+func deriveWallet(seed []byte, scheme crypto.SignatureScheme, path KeyPath) (*Wallet, error) {
+	master, err := NewMasterKey(seed, scheme)
+	if err != nil {
+		return nil, err
+	}
+	key, err := master.DerivePath(path.String())
+	if err != nil {
+		return nil, err
+	}
+	return newWalletFromKey(key.PrivateKey()), nil
+}
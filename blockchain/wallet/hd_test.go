@@ -0,0 +1,110 @@
+package wallet
+
+import (
+	"blockchain/crypto"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// BIP32参考向量1
+func TestDerivePathVectors(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed, crypto.Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path      string
+		key       string
+		chainCode string
+	}{
+		{"m", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35", "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508"},
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141"},
+		{"m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19"},
+		{"m/0h/1/2h", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca", "04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f"},
+		{"m/0'/1/2'/2", "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4", "cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd"},
+		{"m/0'/1/2'/2/1000000000", "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8", "c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			key, err := master.DerivePath(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(key.Key) != test.key || hex.EncodeToString(key.ChainCode) != test.chainCode {
+				t.Fatalf("DerivePath() = %x, %x", key.Key, key.ChainCode)
+			}
+		})
+	}
+
+	for _, path := range []string{"", "0/1", "m/x", "m/2147483648", "m/1''"} {
+		if _, err := master.DerivePath(path); !errors.Is(err, ErrInvalidPath) {
+			t.Fatalf("DerivePath(%q) = %v, want %v", path, err, ErrInvalidPath)
+		}
+	}
+	// 不同签名方案由同一种子派生不同的主密钥
+	if other, err := NewMasterKey(seed, crypto.P256); err != nil || hex.EncodeToString(other.Key) == tests[0].key {
+		t.Fatalf("NewMasterKey(P256) = %x, %v", other.Key, err)
+	}
+	if _, err := NewMasterKey(seed[:8], crypto.Secp256k1); err == nil {
+		t.Fatal("NewMasterKey() accepted a 64-bit seed")
+	}
+}
+
+// 由助记词恢复的钱包派生相同的地址 扫描到最后一个使用过的地址为止
+func TestRestoreHDWallet(t *testing.T) {
+	inTempDir(t)
+	wallets := NewWallets("3000")
+	mnemonic, err := wallets.CreateHDWallet(DefaultEntropyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallets.CreateHDWallet(DefaultEntropyBits); !errors.Is(err, ErrHasSeed) {
+		t.Fatalf("CreateHDWallet() twice = %v, want %v", err, ErrHasSeed)
+	}
+	used := map[string]bool{wallets.Addresses()[0]: true}
+	var last string
+	for i := 0; i < 4; i++ {
+		if last, err = wallets.NewAddress(0, ExternalChain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	used[last] = true
+	change, err := wallets.NewAddress(0, ChangeChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	used[change] = true
+	if path, ok := wallets.Path(last); !ok || path.String() != "m/44'/0'/0'/0/4" {
+		t.Fatalf("Path() = %v, %v", path, ok)
+	}
+
+	restored := NewMemoryWallets()
+	if err := restored.Restore(mnemonic, 5, func(address string) bool { return used[address] }); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.Addresses()) != 6 {
+		t.Fatalf("restored %d addresses, want 5 receiving and 1 change", len(restored.Addresses()))
+	}
+	for address := range used {
+		if _, err := restored.GetWallet(address); err != nil {
+			t.Fatalf("address %s is not restored: %v", address, err)
+		}
+	}
+	// 恢复后继续派生下一个未使用的地址
+	next, err := restored.NewAddress(0, ExternalChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := restored.Path(next); path.Index != 5 {
+		t.Fatalf("next address index %d, want 5", path.Index)
+	}
+
+	if err := NewMemoryWallets().Restore("zoo zoo zoo", 5, nil); !errors.Is(err, ErrInvalidMnemonic) {
+		t.Fatalf("Restore() with an invalid mnemonic = %v, want %v", err, ErrInvalidMnemonic)
+	}
+	if _, err := NewMemoryWallets().NewAddress(0, ExternalChain); !errors.Is(err, ErrNoSeed) {
+		t.Fatalf("NewAddress() without a seed = %v, want %v", err, ErrNoSeed)
+	}
+}
@@ -0,0 +1,374 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 钱包交易记录
+// 区块连接到主链时记录其中与钱包地址相关的交易 区块从主链断开时其中的交易恢复为未确认
+// 交易池中的交易作为未确认交易记录 打包进区块后更新为已确认
+// 记录的修改须调用SaveWallets持久化
+
+// 交易记录中输出的类别
+const (
+	CategoryReceive  = "receive"  // 转入钱包地址
+	CategorySend     = "send"     // 由钱包转出到其他地址
+	CategoryChange   = "change"   // 转出时返回钱包的找零
+	CategoryGenerate = "generate" // 挖矿奖励
+)
+
+// OutPoint 交易输出的位置
+type OutPoint struct {
+	TxHash []byte
+	Index  int
+}
+
+// TxOut 交易输出的收款地址和金额
+type TxOut struct {
+	Address string
+	Value   int
+}
+
+// TxView 钱包关心的交易内容 由区块链模块转换得到
+type TxView struct {
+	Hash     []byte
+	Coinbase bool
+	Inputs   []OutPoint
+	Outputs  []TxOut
+	Raw      []byte // 序列化交易 只保存未确认交易的数据
+}
+
+// BlockRef 交易所在的区块
+type BlockRef struct {
+	Hash     []byte
+	PrevHash []byte
+	Height   int64
+	Time     int64
+}
+
+// OutputRecord 钱包地址的交易输出
+type OutputRecord struct {
+	TxHash   []byte
+	Index    int
+	Value    int
+	Address  string
+	Height   int64  // 所在区块高度 未确认时为0
+	Coinbase bool   // 是否为挖矿奖励
+	SpentBy  []byte // 花费该输出的交易 未花费时为nil
+}
+
+// TxEntry 交易中与钱包相关的一个输出
+type TxEntry struct {
+	Category string
+	Address  string
+	Value    int
+}
+
+// TxRecord 钱包交易记录
+type TxRecord struct {
+	TxHash    []byte
+	BlockHash []byte // 所在区块 未确认时为nil
+	Height    int64
+	Time      int64 // 区块时间 未确认时为加入钱包的时间
+	Coinbase  bool
+	Debit     int // 花费的钱包输出总额
+	Fee       int // 输入全部属于钱包时的手续费 否则为0
+	Entries   []TxEntry
+	Seq       int64  // 加入钱包的顺序
+	Raw       []byte // 未确认交易的序列化数据 用于提高手续费 确认后清除
+}
+
+// Amount 交易对钱包余额的影响
+func (rec *TxRecord) Amount() int {
+	amount := -rec.Debit
+	for _, entry := range rec.Entries {
+		if entry.Category != CategorySend {
+			amount += entry.Value
+		}
+	}
+	return amount
+}
+
+// Sum 指定类别的输出总额
+func (rec *TxRecord) Sum(category string) int {
+	sum := 0
+	for _, entry := range rec.Entries {
+		if entry.Category == category {
+			sum += entry.Value
+		}
+	}
+	return sum
+}
+
+// Balance 钱包余额
+type Balance struct {
+	Confirmed   int // 已确认且可花费
+	Unconfirmed int // 未确认交易的输出
+	Immature    int // 未成熟的挖矿奖励
+	WatchOnly   int // 只观察地址的未花费输出
+}
+
+// 输出的唯一标识
+func outpointKey(txHash []byte, index int) string {
+	return fmt.Sprintf("%x:%d", txHash, index)
+}
+
+// SyncedTip 钱包最后同步的区块及其高度 从未同步时哈希为nil
+func (wallets *Wallets) SyncedTip() ([]byte, int64) {
+	return wallets.tip, wallets.scanned
+}
+
+// ConnectBlock 记录连接到主链的区块中与钱包相关的交易
+func (wallets *Wallets) ConnectBlock(ref BlockRef, txs []*TxView) {
+	for _, tx := range txs {
+		wallets.connectTx(tx, &ref)
+	}
+	wallets.tip = ref.Hash
+	wallets.scanned = ref.Height
+}
+
+// DisconnectBlock 区块从主链断开 其中的交易恢复为未确认
+// 挖矿奖励交易无法再被打包 直接删除
+func (wallets *Wallets) DisconnectBlock(ref BlockRef) {
+	for key, rec := range wallets.txs {
+		if !bytes.Equal(rec.BlockHash, ref.Hash) {
+			continue
+		}
+		if rec.Coinbase {
+			wallets.removeTx(key)
+			continue
+		}
+		rec.BlockHash = nil
+		rec.Height = 0
+		for _, out := range wallets.outputs {
+			if bytes.Equal(out.TxHash, rec.TxHash) {
+				out.Height = 0
+			}
+		}
+	}
+	wallets.tip = ref.PrevHash
+	wallets.scanned = ref.Height - 1
+}
+
+// AddUnconfirmed 记录交易池中的交易 返回交易是否与钱包相关
+func (wallets *Wallets) AddUnconfirmed(tx *TxView) bool {
+	return wallets.connectTx(tx, nil)
+}
+
+// ResetHistory 清除所有交易记录 之后须从创世区块重新同步
+func (wallets *Wallets) ResetHistory() {
+	wallets.outputs = make(map[string]*OutputRecord)
+	wallets.txs = make(map[string]*TxRecord)
+	wallets.tip = nil
+	wallets.scanned = 0
+}
+
+// 记录交易 block为nil表示未确认
+func (wallets *Wallets) connectTx(tx *TxView, block *BlockRef) bool {
+	key := hex.EncodeToString(tx.Hash)
+	rec, known := wallets.txs[key]
+
+	// 花费的钱包输出
+	debit, ours := 0, 0
+	from := make(map[string]bool)
+	if !tx.Coinbase {
+		for _, in := range tx.Inputs {
+			out, ok := wallets.outputs[outpointKey(in.TxHash, in.Index)]
+			if !ok {
+				continue
+			}
+			if out.SpentBy != nil && !bytes.Equal(out.SpentBy, tx.Hash) {
+				// 与之冲突的未确认交易不会再被打包
+				wallets.abandon(out.SpentBy)
+			}
+			out.SpentBy = tx.Hash
+			debit += out.Value
+			ours++
+			from[out.Address] = true
+		}
+	}
+	mine := false
+	for _, out := range tx.Outputs {
+		mine = mine || wallets.IsMine(out.Address)
+	}
+	if !known && ours == 0 && !mine {
+		return false
+	}
+
+	if !known {
+		rec = &TxRecord{TxHash: tx.Hash, Coinbase: tx.Coinbase, Debit: debit, Time: time.Now().Unix(), Seq: wallets.seq}
+		wallets.seq++
+		total := 0
+		for _, out := range tx.Outputs {
+			total += out.Value
+			category := ""
+			switch {
+			case !wallets.IsMine(out.Address):
+				if ours > 0 {
+					category = CategorySend
+				}
+			case tx.Coinbase:
+				category = CategoryGenerate
+			case ours > 0 && (from[out.Address] || wallets.isChange(out.Address)):
+				category = CategoryChange
+			default:
+				category = CategoryReceive
+			}
+			if category != "" {
+				rec.Entries = append(rec.Entries, TxEntry{Category: category, Address: out.Address, Value: out.Value})
+			}
+		}
+		if ours > 0 && ours == len(tx.Inputs) {
+			rec.Fee = debit - total
+		}
+		wallets.txs[key] = rec
+	}
+	if block != nil {
+		rec.BlockHash = block.Hash
+		rec.Height = block.Height
+		rec.Time = block.Time
+		rec.Raw = nil
+	} else if tx.Raw != nil {
+		rec.Raw = tx.Raw
+	}
+
+	// 钱包地址的新输出
+	for index, out := range tx.Outputs {
+		if !wallets.IsMine(out.Address) {
+			continue
+		}
+		op := outpointKey(tx.Hash, index)
+		if record, ok := wallets.outputs[op]; ok {
+			record.Height = rec.Height
+			continue
+		}
+		wallets.outputs[op] = &OutputRecord{
+			TxHash:   tx.Hash,
+			Index:    index,
+			Value:    out.Value,
+			Address:  out.Address,
+			Height:   rec.Height,
+			Coinbase: tx.Coinbase,
+		}
+	}
+	return true
+}
+
+// 放弃未确认的交易 恢复其花费的输出
+func (wallets *Wallets) abandon(txHash []byte) {
+	key := hex.EncodeToString(txHash)
+	if rec, ok := wallets.txs[key]; ok && rec.BlockHash == nil {
+		wallets.removeTx(key)
+	}
+}
+
+// 删除交易记录及其输出
+func (wallets *Wallets) removeTx(key string) {
+	rec := wallets.txs[key]
+	for op, out := range wallets.outputs {
+		if bytes.Equal(out.TxHash, rec.TxHash) {
+			delete(wallets.outputs, op)
+		} else if bytes.Equal(out.SpentBy, rec.TxHash) {
+			out.SpentBy = nil
+		}
+	}
+	delete(wallets.txs, key)
+}
+
+// 是否为分层确定性钱包的找零地址
+func (wallets *Wallets) isChange(address string) bool {
+	path, ok := wallets.Path(address)
+	return ok && path.Change == ChangeChain
+}
+
+// Transactions 交易记录 按区块高度排序 未确认的交易在最后
+func (wallets *Wallets) Transactions() []*TxRecord {
+	var txs []*TxRecord
+	for _, rec := range wallets.txs {
+		txs = append(txs, rec)
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		a, b := txs[i], txs[j]
+		if (a.Height == 0) != (b.Height == 0) {
+			return b.Height == 0
+		}
+		if a.Height != b.Height {
+			return a.Height < b.Height
+		}
+		return a.Seq < b.Seq
+	})
+	return txs
+}
+
+// Transaction 查找交易记录
+func (wallets *Wallets) Transaction(txHash []byte) (*TxRecord, bool) {
+	rec, ok := wallets.txs[hex.EncodeToString(txHash)]
+	return rec, ok
+}
+
+// Confirmations 交易的确认数 未确认时为0
+func (wallets *Wallets) Confirmations(rec *TxRecord) int64 {
+	if rec.Height == 0 {
+		return 0
+	}
+	return wallets.scanned - rec.Height + 1
+}
+
+// Outputs 钱包地址的所有输出 按区块高度排序
+func (wallets *Wallets) Outputs() []*OutputRecord {
+	var outputs []*OutputRecord
+	for _, out := range wallets.outputs {
+		outputs = append(outputs, out)
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		if outputs[i].Height != outputs[j].Height {
+			return outputs[i].Height < outputs[j].Height
+		}
+		return outpointKey(outputs[i].TxHash, outputs[i].Index) < outpointKey(outputs[j].TxHash, outputs[j].Index)
+	})
+	return outputs
+}
+
+// GetBalance 统计未花费输出 挖矿奖励须经过maturity个确认才可花费
+func (wallets *Wallets) GetBalance(maturity int64) Balance {
+	var balance Balance
+	for _, out := range wallets.outputs {
+		if out.SpentBy != nil {
+			continue
+		}
+		switch {
+		case wallets.watchOnly[out.Address]:
+			balance.WatchOnly += out.Value
+		case out.Height == 0:
+			balance.Unconfirmed += out.Value
+		case out.Coinbase && wallets.scanned-out.Height+1 < maturity:
+			balance.Immature += out.Value
+		default:
+			balance.Confirmed += out.Value
+		}
+	}
+	return balance
+}
+
+// SetLabel 设置地址的标签 标签为空时删除
+func (wallets *Wallets) SetLabel(address string, label string) error {
+	if !IsValidAddress([]byte(address)) {
+		return ErrInvalidAddress
+	}
+	if label == "" {
+		delete(wallets.labels, address)
+	} else {
+		wallets.labels[address] = label
+	}
+	wallets.SaveWallets(wallets.nodeId)
+	return nil
+}
+
+// Label 地址的标签
+func (wallets *Wallets) Label(address string) string {
+	return wallets.labels[address]
+}
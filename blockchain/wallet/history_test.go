@@ -0,0 +1,113 @@
+package wallet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// 钱包关心的交易内容
+func txView(hash string, coinbase bool, inputs []OutPoint, outputs ...TxOut) *TxView {
+	return &TxView{Hash: []byte(hash), Coinbase: coinbase, Inputs: inputs, Outputs: outputs}
+}
+
+func blockRef(height int64) BlockRef {
+	return BlockRef{Hash: []byte{byte(height)}, PrevHash: []byte{byte(height - 1)}, Height: height, Time: height}
+}
+
+func checkBalance(t *testing.T, wallets *Wallets, maturity int64, want Balance) {
+	t.Helper()
+	if balance := wallets.GetBalance(maturity); balance != want {
+		t.Fatalf("GetBalance(%d) = %+v, want %+v", maturity, balance, want)
+	}
+}
+
+// 挖矿奖励成熟后可以花费 花费时找零返回钱包 与之冲突的交易被打包后原交易被放弃
+// 区块断开后其中的交易恢复为未确认 挖矿奖励被删除
+func TestWalletHistory(t *testing.T) {
+	inTempDir(t)
+	w := NewWallet()
+	me := string(w.GetAddress())
+	other := string(NewWallet().GetAddress())
+	watched := string(NewWallet().GetAddress())
+	wallets := NewMemoryWallets(w)
+	if err := wallets.ImportAddress(watched); err != nil {
+		t.Fatal(err)
+	}
+
+	coinbase := txView("coinbase", true, nil, TxOut{me, 100})
+	wallets.ConnectBlock(blockRef(1), []*TxView{coinbase, txView("unrelated", false, nil, TxOut{other, 7})})
+	checkBalance(t, wallets, 2, Balance{Immature: 100})
+	wallets.ConnectBlock(blockRef(2), nil)
+	checkBalance(t, wallets, 2, Balance{Confirmed: 100})
+	if tip, height := wallets.SyncedTip(); !bytes.Equal(tip, blockRef(2).Hash) || height != 2 {
+		t.Fatalf("SyncedTip() = %x, %d", tip, height)
+	}
+
+	spent := []OutPoint{{TxHash: coinbase.Hash, Index: 0}}
+	send := txView("send", false, spent, TxOut{other, 60}, TxOut{me, 30})
+	if !wallets.AddUnconfirmed(send) {
+		t.Fatal("the payment from the wallet is not recorded")
+	}
+	if wallets.AddUnconfirmed(txView("foreign", false, []OutPoint{{TxHash: []byte("x")}}, TxOut{other, 1})) {
+		t.Fatal("an unrelated transaction is recorded")
+	}
+	wallets.AddUnconfirmed(txView("receive", false, []OutPoint{{TxHash: []byte("x")}}, TxOut{me, 5}, TxOut{watched, 3}))
+	checkBalance(t, wallets, 2, Balance{Unconfirmed: 35, WatchOnly: 3})
+
+	tests := []struct {
+		hash     string
+		amount   int
+		fee      int
+		category string
+		value    int
+	}{
+		{"coinbase", 100, 0, CategoryGenerate, 100},
+		{"send", -70, 10, CategoryChange, 30},
+		{"receive", 8, 0, CategoryReceive, 8}, // 包括只观察地址
+	}
+	for _, test := range tests {
+		rec, ok := wallets.Transaction([]byte(test.hash))
+		if !ok {
+			t.Fatalf("transaction %s is not recorded", test.hash)
+		}
+		if rec.Amount() != test.amount || rec.Fee != test.fee || rec.Sum(test.category) != test.value {
+			t.Fatalf("transaction %s: amount %d, fee %d, %s %d", test.hash, rec.Amount(), rec.Fee, test.category, rec.Sum(test.category))
+		}
+	}
+	if rec, _ := wallets.Transaction(send.Hash); rec.Sum(CategorySend) != 60 {
+		t.Fatalf("sent %d, want 60", rec.Sum(CategorySend))
+	}
+
+	// 冲突交易被打包 原交易及其输出被删除
+	replacement := txView("replacement", false, spent, TxOut{other, 95})
+	wallets.ConnectBlock(blockRef(3), []*TxView{replacement})
+	if _, ok := wallets.Transaction(send.Hash); ok {
+		t.Fatal("the conflicting transaction is not abandoned")
+	}
+	checkBalance(t, wallets, 2, Balance{Unconfirmed: 5, WatchOnly: 3})
+	var order []string
+	for _, rec := range wallets.Transactions() {
+		order = append(order, string(rec.TxHash))
+	}
+	if got := strings.Join(order, " "); got != "coinbase replacement receive" {
+		t.Fatalf("Transactions() = %s, want the confirmed transactions by height and then the unconfirmed", got)
+	}
+	rec, _ := wallets.Transaction(replacement.Hash)
+	if confirmations := wallets.Confirmations(rec); confirmations != 1 {
+		t.Fatalf("%d confirmations, want 1", confirmations)
+	}
+
+	wallets.DisconnectBlock(blockRef(3))
+	if rec, _ := wallets.Transaction(replacement.Hash); rec.Height != 0 || wallets.Confirmations(rec) != 0 {
+		t.Fatal("the transaction of the disconnected block is still confirmed")
+	}
+	wallets.DisconnectBlock(blockRef(2))
+	wallets.DisconnectBlock(blockRef(1))
+	if _, ok := wallets.Transaction(coinbase.Hash); ok {
+		t.Fatal("the coinbase of the disconnected block is still recorded")
+	}
+	if tip, height := wallets.SyncedTip(); !bytes.Equal(tip, []byte{0}) || height != 0 {
+		t.Fatalf("SyncedTip() after disconnecting = %x, %d", tip, height)
+	}
+}
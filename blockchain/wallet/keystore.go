@@ -0,0 +1,111 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+	"log"
+	"sync"
+	"time"
+)
+
+// 钱包加密
+// 由口令通过scrypt派生密钥 私钥使用XChaCha20-Poly1305加密保存
+// 解锁后派生的密钥只保存在当前进程的内存中 不写入磁盘 超时、进程退出或锁定钱包后失效
+// 命令行每次运行都是独立的进程 签名时须重新输入口令
+
+var ErrWrongPassphrase = errors.New("the wallet passphrase is incorrect")
+
+// 口令派生密钥的参数
+type kdfParams struct {
+	Salt []byte
+	N    int
+	R    int
+	P    int
+}
+
+func newKDFParams() *kdfParams {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		log.Panicf("generate the salt failed: %v", err)
+	}
+	return &kdfParams{Salt: salt, N: 1 << 15, R: 8, P: 1}
+}
+
+// 由口令派生密钥
+func (k *kdfParams) deriveKey(passphrase string) []byte {
+	key, err := scrypt.Key([]byte(passphrase), k.Salt, k.N, k.R, k.P, chacha20poly1305.KeySize)
+	if err != nil {
+		log.Panicf("derive the key from passphrase failed: %v", err)
+	}
+	return key
+}
+
+// 加密数据 返回随机数和密文
+func seal(key []byte, plaintext []byte) ([]byte, []byte) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		log.Panicf("create the cipher failed: %v", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		log.Panicf("generate the nonce failed: %v", err)
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, nil)
+}
+
+// 解密数据 密钥错误时返回ErrWrongPassphrase
+func unseal(key []byte, nonce []byte, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plaintext, nil
+}
+
+// 解锁状态
+type unlockState struct {
+	key   []byte
+	until time.Time // 解锁截止时间
+}
+
+var (
+	unlockMu   sync.Mutex
+	unlockKeys = make(map[string]unlockState) // 节点->当前进程中解锁钱包的密钥
+)
+
+// 记录解锁密钥 同一进程中之后加载的钱包集合在截止时间前自动解锁
+func saveUnlockKey(nodeId string, key []byte, until time.Time) {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	unlockKeys[nodeId] = unlockState{key: key, until: until}
+}
+
+// 读取当前进程中未过期的解锁密钥 过期时删除
+func loadUnlockKey(nodeId string) []byte {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	state, ok := unlockKeys[nodeId]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(state.until) {
+		delete(unlockKeys, nodeId)
+		return nil
+	}
+	return state.key
+}
+
+func removeUnlockKey(nodeId string) {
+	unlockMu.Lock()
+	defer unlockMu.Unlock()
+	delete(unlockKeys, nodeId)
+}
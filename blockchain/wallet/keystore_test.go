@@ -0,0 +1,100 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// 在临时目录中运行 钱包文件保存在当前目录
+func inTempDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// 创建包含一个地址的加密钱包
+func newEncryptedWallets(t *testing.T, nodeId string, passphrase string) string {
+	t.Helper()
+	wallets := NewWallets(nodeId)
+	if err := wallets.CreateWallet(nodeId); err != nil {
+		t.Fatal(err)
+	}
+	address := wallets.Addresses()[0]
+	if err := wallets.Encrypt(passphrase); err != nil {
+		t.Fatal(err)
+	}
+	return address
+}
+
+func TestUnlockKeepsKeyInMemory(t *testing.T) {
+	inTempDir(t)
+	const nodeId = "3000"
+	address := newEncryptedWallets(t, nodeId, "secret")
+
+	wallets := NewWallets(nodeId)
+	if _, err := wallets.GetWallet(address); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("GetWallet() on a locked wallet = %v, want %v", err, ErrWalletLocked)
+	}
+	if err := wallets.Unlock("wrong", time.Minute); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("Unlock() with a wrong passphrase = %v", err)
+	}
+	if err := wallets.Unlock("secret", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if file.Name() != fmt.Sprintf(walletFile, nodeId) {
+			t.Fatalf("unlocking wrote file %s", file.Name())
+		}
+	}
+
+	// 同一进程中之后加载的钱包集合已解锁 锁定后失效
+	if _, err := NewWallets(nodeId).GetWallet(address); err != nil {
+		t.Fatalf("GetWallet() after unlock = %v", err)
+	}
+	wallets.Lock()
+	if _, err := NewWallets(nodeId).GetWallet(address); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("GetWallet() after lock = %v, want %v", err, ErrWalletLocked)
+	}
+}
+
+// 解锁超时后已加载和之后加载的钱包集合都处于锁定状态
+func TestUnlockExpires(t *testing.T) {
+	inTempDir(t)
+	const nodeId = "3000"
+	address := newEncryptedWallets(t, nodeId, "secret")
+
+	wallets := NewWallets(nodeId)
+	if err := wallets.Unlock("secret", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallets.GetWallet(address); err != nil {
+		t.Fatalf("GetWallet() after unlock = %v", err)
+	}
+	saveUnlockKey(nodeId, wallets.key, time.Now().Add(-time.Second))
+	if _, err := wallets.GetWallet(address); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("GetWallet() after the unlock expired = %v, want %v", err, ErrWalletLocked)
+	}
+	if !wallets.IsLocked() {
+		t.Fatal("the private keys are kept after the unlock expired")
+	}
+	if key := loadUnlockKey(nodeId); key != nil {
+		t.Fatal("the expired unlock key is kept in memory")
+	}
+	if _, err := NewWallets(nodeId).GetWallet(address); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("GetWallet() of reloaded wallets = %v, want %v", err, ErrWalletLocked)
+	}
+}
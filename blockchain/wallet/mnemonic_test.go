@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// BIP39参考向量 种子使用口令TREZOR
+var mnemonicVectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		"ffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+		"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+	},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	for _, vector := range mnemonicVectors {
+		entropy, _ := hex.DecodeString(vector.entropy)
+		mnemonic, err := EntropyToMnemonic(entropy)
+		if err != nil || mnemonic != vector.mnemonic {
+			t.Fatalf("EntropyToMnemonic(%s) = %q, %v", vector.entropy, mnemonic, err)
+		}
+		decoded, err := MnemonicToEntropy(vector.mnemonic)
+		if err != nil || !bytes.Equal(decoded, entropy) {
+			t.Fatalf("MnemonicToEntropy(%q) = %x, %v", vector.mnemonic, decoded, err)
+		}
+		if seed := hex.EncodeToString(MnemonicToSeed(vector.mnemonic, "TREZOR")); seed != vector.seed {
+			t.Fatalf("MnemonicToSeed(%q) = %s", vector.mnemonic, seed)
+		}
+	}
+	// 种子与单词的大小写和空白无关
+	mnemonic := mnemonicVectors[0].mnemonic
+	if !bytes.Equal(MnemonicToSeed("  "+strings.ToUpper(mnemonic), "x"), MnemonicToSeed(mnemonic, "x")) {
+		t.Fatal("the seed depends on case and spaces")
+	}
+}
+
+func TestInvalidMnemonic(t *testing.T) {
+	valid := strings.Fields(mnemonicVectors[1].mnemonic)
+	tests := []struct {
+		name  string
+		words []string
+	}{
+		{"wrong checksum", append(append([]string{}, valid[:11]...), "abandon")},
+		{"unknown word", append(append([]string{}, valid[:11]...), "bitcoin")},
+		{"too few words", valid[:9]},
+		{"not a multiple of three", valid[:11]},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := MnemonicToEntropy(strings.Join(test.words, " ")); !errors.Is(err, ErrInvalidMnemonic) {
+				t.Fatalf("MnemonicToEntropy() = %v, want %v", err, ErrInvalidMnemonic)
+			}
+		})
+	}
+	for _, bits := range []int{96, 136, 288} {
+		if _, err := NewMnemonic(bits); !errors.Is(err, ErrInvalidEntropy) {
+			t.Fatalf("NewMnemonic(%d) = %v, want %v", bits, err, ErrInvalidEntropy)
+		}
+	}
+	mnemonic, err := NewMnemonic(256)
+	if err != nil || len(strings.Fields(mnemonic)) != 24 || !IsValidMnemonic(mnemonic) {
+		t.Fatalf("NewMnemonic(256) = %q, %v", mnemonic, err)
+	}
+}
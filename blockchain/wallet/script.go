@@ -0,0 +1,30 @@
+package wallet
+
+import "blockchain/crypto"
+
+// 脚本哈希地址
+// 钱包保存赎回脚本 脚本地址作为只观察地址计入余额和交易记录
+// 签名时按赎回脚本中的公钥查找钱包中的私钥
+
+// AddRedeemScript 保存赎回脚本 返回脚本哈希地址 已保存的脚本直接返回地址
+func (wallets *Wallets) AddRedeemScript(redeemScript []byte) string {
+	address := string(ScriptHashToAddress(crypto.Ripemd160Hash(redeemScript)))
+	if _, ok := wallets.scripts[address]; ok {
+		return address
+	}
+	wallets.scripts[address] = redeemScript
+	wallets.watchOnly[address] = true
+	wallets.SaveWallets(wallets.nodeId)
+	return address
+}
+
+// RedeemScript 脚本哈希地址的赎回脚本
+func (wallets *Wallets) RedeemScript(address string) ([]byte, bool) {
+	redeemScript, ok := wallets.scripts[address]
+	return redeemScript, ok
+}
+
+// GetWalletByPublicKey 获取公钥对应的钱包
+func (wallets *Wallets) GetWalletByPublicKey(pubKey []byte) (*Wallet, error) {
+	return wallets.GetWallet(string(Hash160ToAddress(crypto.Ripemd160Hash(pubKey))))
+}
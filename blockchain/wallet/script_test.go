@@ -0,0 +1,50 @@
+package wallet
+
+import (
+	"blockchain/crypto"
+	"bytes"
+	"testing"
+)
+
+func TestScriptHashAddress(t *testing.T) {
+	hash := crypto.Ripemd160Hash([]byte("redeem script"))
+	address := string(ScriptHashToAddress(hash))
+	if !IsValidAddress([]byte(address)) || !IsScriptHashAddress(address) {
+		t.Fatalf("%s is not a valid script hash address", address)
+	}
+	if h := StringToHash160(address); !bytes.Equal(h, hash) {
+		t.Fatalf("StringToHash160(%s) = %x, want %x", address, h, hash)
+	}
+	// 公钥哈希地址与相同哈希的脚本哈希地址不同
+	pubKeyAddress := string(Hash160ToAddress(hash))
+	if IsScriptHashAddress(pubKeyAddress) || pubKeyAddress == address {
+		t.Fatalf("%s is taken as a script hash address", pubKeyAddress)
+	}
+	if h := StringToHash160(pubKeyAddress); !bytes.Equal(h, hash) {
+		t.Fatalf("StringToHash160(%s) = %x, want %x", pubKeyAddress, h, hash)
+	}
+}
+
+func TestAddRedeemScript(t *testing.T) {
+	inTempDir(t)
+	wallets := NewWallets("3000")
+	w := NewWallet()
+	wallets.Wallets[string(w.GetAddress())] = w
+	redeemScript := []byte("redeem script")
+	address := wallets.AddRedeemScript(redeemScript)
+	if again := wallets.AddRedeemScript(redeemScript); again != address {
+		t.Fatalf("AddRedeemScript() again = %s, want %s", again, address)
+	}
+
+	// 赎回脚本在重新加载后保留 脚本地址只观察
+	wallets = NewWallets("3000")
+	if s, ok := wallets.RedeemScript(address); !ok || !bytes.Equal(s, redeemScript) {
+		t.Fatalf("RedeemScript(%s) = %q, %v", address, s, ok)
+	}
+	if !wallets.IsWatchOnly(address) {
+		t.Fatalf("%s is not watch-only", address)
+	}
+	if found, err := wallets.GetWalletByPublicKey(w.PublicKey); err != nil || !bytes.Equal(found.PublicKey, w.PublicKey) {
+		t.Fatalf("GetWalletByPublicKey() = %v", err)
+	}
+}
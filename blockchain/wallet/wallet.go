@@ -4,8 +4,6 @@ import (
 	"blockchain/crypto"
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
 	"log"
 )
@@ -18,7 +16,8 @@ import (
 // 访问公钥和交易指纹的任何人都可以使用它们来验证签名
 
 const (
-	AddressCheckSumLen = 4 // 地址校验和长度
+	AddressCheckSumLen = 4    // 地址校验和长度
+	ScriptHashVersion  = 0x05 // 脚本哈希地址的版本字节 公钥哈希地址没有版本字节
 )
 
 // Wallet 钱包基本结构
@@ -34,19 +33,28 @@ func NewWallet() *Wallet {
 	return &Wallet{PrivateKey: privateKey, PublicKey: publicKey}
 }
 
+// 由已有私钥创建钱包 公钥按私钥曲线对应的签名方案序列化
+func newWalletFromKey(privateKey ecdsa.PrivateKey) *Wallet {
+	publicKey, err := crypto.PublicKeyBytes(&privateKey)
+	if err != nil {
+		log.Panicf("encode the public key failed: %v\n", err)
+	}
+	return &Wallet{PrivateKey: privateKey, PublicKey: publicKey}
+}
+
 // 椭圆曲加密法 一种基于离散对数问题的非对称加密法
 // 通过椭圆曲线乘法可以从私钥计算得到公钥 其反向运算(获取离散对数)是极其困难的
 // 维基百科: https://en.bitcoin.it/wiki/Secp256k1
 
-// 创建密钥对
+// 创建密钥对 使用默认签名方案 公钥为33字节压缩格式
 func newKeyPair() (ecdsa.PrivateKey, []byte) {
-	curve := elliptic.P256()                             // 获取到一个椭圆
-	priKey, err := ecdsa.GenerateKey(curve, rand.Reader) // 通过椭圆生成密钥对
+	scheme := crypto.DefaultScheme
+	priKey, err := scheme.GenerateKey() // 生成私钥
 	if err != nil {
 		log.Panicf("generate private key failed %v\n", err)
 	}
 	// 通过私钥生成公钥
-	pubKey := append(priKey.PublicKey.X.Bytes(), priKey.PublicKey.Y.Bytes()...)
+	pubKey := scheme.PublicKey(&priKey.PublicKey)
 
 	return *priKey, pubKey
 }
@@ -61,18 +69,49 @@ func CheckSum(input []byte) []byte {
 // GetAddress 通过钱包(公钥)生成地址
 func (w *Wallet) GetAddress() []byte {
 	ripemd160Hash := crypto.Ripemd160Hash(w.PublicKey) // 取公钥哈希值
-	checkSumBytes := CheckSum(ripemd160Hash)           // 计算上步哈希值校验和
+	return Hash160ToAddress(ripemd160Hash)
+}
+
+// Hash160ToAddress 公钥哈希转换为地址
+func Hash160ToAddress(ripemd160Hash []byte) []byte {
+	checkSumBytes := CheckSum(ripemd160Hash) // 计算公钥哈希的校验和
 
-	// 将校验和添加到哈希值尾部
-	addressBytes := append(ripemd160Hash, checkSumBytes...)
+	// 将校验和添加到哈希值尾部 哈希可能是脚本等数据的一部分 不能在原切片上追加
+	addressBytes := append(append([]byte(nil), ripemd160Hash...), checkSumBytes...)
 	base58Bytes := crypto.Base58Encode(addressBytes) // 将上步结果base58编码
 	return base58Bytes
 }
 
+// ScriptHashToAddress 脚本哈希转换为地址 版本字节和脚本哈希一起计算校验和
+func ScriptHashToAddress(scriptHash []byte) []byte {
+	payload := append([]byte{ScriptHashVersion}, scriptHash...)
+	return crypto.Base58Encode(append(payload, CheckSum(payload)...))
+}
+
+// IsScriptHashAddress 是否为脚本哈希地址
+func IsScriptHashAddress(address string) bool {
+	if !IsValidAddress([]byte(address)) {
+		return false
+	}
+	payload := crypto.Base58Decode([]byte(address))
+	return len(payload) == 1+20+AddressCheckSumLen && payload[0] == ScriptHashVersion
+}
+
 // IsValidAddress 校验钱包地址有效性
 func IsValidAddress(addressBytes []byte) bool {
+	if len(addressBytes) == 0 {
+		return false
+	}
+	for _, c := range addressBytes[1:] {
+		if !crypto.IsBase58(c) {
+			return false
+		}
+	}
 	// 将地址base58解码
 	pubkeyCheckSumByte := crypto.Base58Decode(addressBytes)
+	if len(pubkeyCheckSumByte) <= AddressCheckSumLen {
+		return false
+	}
 	checkSumBytes := pubkeyCheckSumByte[len(pubkeyCheckSumByte)-AddressCheckSumLen:] // 取出末端4字节数据
 	ripemd160Hash := pubkeyCheckSumByte[:len(pubkeyCheckSumByte)-AddressCheckSumLen] // 取出原哈希字符串
 
@@ -84,12 +123,15 @@ func IsValidAddress(addressBytes []byte) bool {
 	return false
 }
 
-// StringToHash160 地址字符串转换为哈希编码
+// StringToHash160 地址字符串转换为哈希编码 脚本哈希地址去除版本字节
 func StringToHash160(address string) []byte {
 	if !IsValidAddress([]byte(address)) {
 		log.Fatalln("\tinvalid address:", address)
 	}
 	pubKeyHash := crypto.Base58Decode([]byte(address))         // 对地址base58解码
 	hash160 := pubKeyHash[:len(pubKeyHash)-AddressCheckSumLen] // 除去校验和 提取哈希值
+	if IsScriptHashAddress(address) {
+		hash160 = hash160[1:]
+	}
 	return hash160
 }
@@ -1,72 +1,575 @@
 package wallet
 
 import (
+	"blockchain/crypto"
 	"bytes"
-	"crypto/elliptic"
+	"crypto/ecdsa"
 	"encoding/gob"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"time"
 )
 
 // 管理钱包集合
+// 钱包文件中公钥以明文保存 锁定时仍可以列出账户
+// 私钥可以使用口令加密 加密后须先解锁才能签名
+// 分层确定性钱包只保存种子和派生路径 私钥在加载时由种子重新派生
 
 const walletFile = "wallets-%s.dat"
 
+var (
+	ErrWalletNotFound   = errors.New("wallet of the address not found")
+	ErrWalletLocked     = errors.New("wallet is locked")
+	ErrNotEncrypted     = errors.New("wallet is not encrypted")
+	ErrAlreadyEncrypted = errors.New("wallet is already encrypted")
+	ErrHasSeed          = errors.New("wallet already has a mnemonic seed")
+	ErrNoSeed           = errors.New("wallet has no mnemonic seed, create one with createwallet -mnemonic")
+)
+
+// DefaultGapLimit 恢复钱包时连续未使用地址的上限
+const DefaultGapLimit = 20
+
+// HDChain 分层确定性钱包的派生信息
+type HDChain struct {
+	Scheme   string                // 派生使用的签名方案 为空表示早期版本使用的P-256
+	Accounts map[uint32]*HDAccount // 账户->下一个未使用的索引
+	Paths    map[string]KeyPath    // 地址->派生路径
+}
+
+// HDAccount 账户中收款链和找零链下一个未派生的索引
+type HDAccount struct {
+	Next [2]uint32
+}
+
+// 私钥数据 加密时整体加密
+type walletSecrets struct {
+	Seed []byte            // 分层确定性钱包的种子
+	Keys map[string][]byte // 随机生成的地址->私钥
+}
+
 // Wallets 钱包集合基本结构
 type Wallets struct {
 	Wallets map[string]*Wallet // 关联地址和钱包
+
+	nodeId    string
+	encrypted bool       // 私钥是否加密
+	locked    bool       // 私钥是否不可用
+	kdf       *kdfParams // 口令派生密钥的参数
+	key       []byte     // 解锁后的加密密钥
+	sealed    []byte     // 锁定时保留的私钥密文
+	nonce     []byte
+	hd        *HDChain                 // 派生信息 未使用助记词时为nil
+	seed      []byte                   // 解锁后的种子
+	watchOnly map[string]bool          // 只观察不签名的地址
+	scripts   map[string][]byte        // 脚本哈希地址->赎回脚本
+	labels    map[string]string        // 地址->标签
+	outputs   map[string]*OutputRecord // 输出(交易哈希:索引)->钱包地址的输出
+	txs       map[string]*TxRecord     // 交易哈希->钱包交易记录
+	tip       []byte                   // 交易记录最后同步的区块
+	scanned   int64                    // 最后同步的区块高度
+	seq       int64                    // 下一条交易记录的顺序
+}
+
+// 钱包文件内容
+type walletData struct {
+	Encrypted  bool
+	PublicKeys map[string][]byte // 地址->公钥
+	KDF        *kdfParams
+	Nonce      []byte
+	Keys       []byte // 私钥数据的gob编码 加密时为密文
+	HD         *HDChain
+	WatchOnly  []string
+	Scripts    map[string][]byte
+	Labels     map[string]string
+	Outputs    []*OutputRecord
+	Txs        []*TxRecord
+	Tip        []byte
+	Scanned    int64
+}
+
+// IsWalletExists 钱包文件是否存在
+func IsWalletExists(nodeId string) bool {
+	if _, err := os.Stat(fmt.Sprintf(walletFile, nodeId)); os.IsNotExist(err) {
+		return false
+	}
+	return true
 }
 
 // NewWallets 初始化钱包集合
+// 加密的钱包在当前进程已解锁时自动解密私钥 否则处于锁定状态
 func NewWallets(nodeId string) *Wallets {
+	wallets := newWallets(nodeId)
 	// 从钱包文件中获取钱包信息
 	name := fmt.Sprintf(walletFile, nodeId)
 	if _, err := os.Stat(name); os.IsNotExist(err) {
 		// 如果文件不存在 则返回空表
-		wallets := &Wallets{}
-		wallets.Wallets = make(map[string]*Wallet)
 		return wallets
 	}
 	content, err := ioutil.ReadFile(name) // 读取文件内容
 	if err != nil {
 		log.Panicf("read the file content failed: %v\n", err)
 	}
-	var wallets Wallets
-	gob.Register(elliptic.P256())
-	decoder := gob.NewDecoder(bytes.NewReader(content))
-	err = decoder.Decode(&wallets)
-	if err != nil {
+	var data walletData
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
 		log.Panicf("decode the file content failed: %v\n", err)
 	}
-	return &wallets
+	for address, publicKey := range data.PublicKeys {
+		wallets.Wallets[address] = &Wallet{PublicKey: publicKey}
+	}
+	wallets.encrypted = data.Encrypted
+	wallets.hd = data.HD
+	for _, address := range data.WatchOnly {
+		wallets.watchOnly[address] = true
+	}
+	for address, redeemScript := range data.Scripts {
+		wallets.scripts[address] = redeemScript
+	}
+	for address, label := range data.Labels {
+		wallets.labels[address] = label
+	}
+	for _, out := range data.Outputs {
+		wallets.outputs[outpointKey(out.TxHash, out.Index)] = out
+	}
+	for _, rec := range data.Txs {
+		wallets.txs[hex.EncodeToString(rec.TxHash)] = rec
+		if rec.Seq >= wallets.seq {
+			wallets.seq = rec.Seq + 1
+		}
+	}
+	wallets.tip = data.Tip
+	wallets.scanned = data.Scanned
+	if !data.Encrypted {
+		wallets.setSecrets(data.Keys)
+		return wallets
+	}
+	wallets.kdf = data.KDF
+	wallets.sealed = data.Keys
+	wallets.nonce = data.Nonce
+	wallets.locked = true
+	if key := loadUnlockKey(nodeId); key != nil {
+		if err := wallets.open(key); err != nil {
+			// 口令已修改 解锁状态失效
+			removeUnlockKey(nodeId)
+		}
+	}
+	return wallets
+}
+
+// NewMemoryWallets 由给定钱包组成的集合 不读取钱包文件
+func NewMemoryWallets(ws ...*Wallet) *Wallets {
+	wallets := newWallets("")
+	for _, w := range ws {
+		wallets.Wallets[string(w.GetAddress())] = w
+	}
+	return wallets
+}
+
+// 空的钱包集合
+func newWallets(nodeId string) *Wallets {
+	return &Wallets{
+		Wallets:   make(map[string]*Wallet),
+		nodeId:    nodeId,
+		watchOnly: make(map[string]bool),
+		scripts:   make(map[string][]byte),
+		labels:    make(map[string]string),
+		outputs:   make(map[string]*OutputRecord),
+		txs:       make(map[string]*TxRecord),
+	}
+}
+
+// IsEncrypted 钱包是否已加密
+func (wallets *Wallets) IsEncrypted() bool {
+	return wallets.encrypted
 }
 
-// CreateWallet 添加新钱包
-func (wallets *Wallets) CreateWallet(nodeId string) {
+// IsLocked 钱包是否处于锁定状态
+func (wallets *Wallets) IsLocked() bool {
+	return wallets.locked
+}
+
+// GetWallet 获取可用于签名的钱包
+func (wallets *Wallets) GetWallet(address string) (*Wallet, error) {
+	w, ok := wallets.Wallets[address]
+	if !ok {
+		return nil, ErrWalletNotFound
+	}
+	if err := wallets.requireUnlocked(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// HasSeed 钱包是否由助记词派生
+func (wallets *Wallets) HasSeed() bool {
+	return wallets.hd != nil
+}
+
+// Path 获取地址的派生路径
+func (wallets *Wallets) Path(address string) (KeyPath, bool) {
+	if wallets.hd == nil {
+		return KeyPath{}, false
+	}
+	path, ok := wallets.hd.Paths[address]
+	return path, ok
+}
+
+// CreateWallet 添加新钱包 加密的钱包须处于解锁状态
+// 由助记词派生的钱包生成账户0的下一个收款地址 否则随机生成密钥
+func (wallets *Wallets) CreateWallet(nodeId string) error {
+	if err := wallets.requireUnlocked(); err != nil {
+		return err
+	}
+	if wallets.hd != nil {
+		address, err := wallets.NewAddress(0, ExternalChain)
+		if err != nil {
+			return err
+		}
+		fmt.Println("[" + address + "]")
+		return nil
+	}
 	wallet := NewWallet()
 	wallets.Wallets[string(wallet.GetAddress())] = wallet
 	wallets.SaveWallets(nodeId) // 保存钱包
 	fmt.Println("[" + string(wallet.GetAddress()) + "]")
+	return nil
 }
 
 // SaveWallets 持久化钱包
 func (wallets *Wallets) SaveWallets(nodeId string) {
-	var content bytes.Buffer // 钱包内容
+	data := walletData{
+		Encrypted:  wallets.encrypted,
+		PublicKeys: make(map[string][]byte),
+		KDF:        wallets.kdf,
+		Nonce:      wallets.nonce,
+		Keys:       wallets.sealed,
+		HD:         wallets.hd,
+		Scripts:    wallets.scripts,
+		Labels:     wallets.labels,
+		Outputs:    wallets.Outputs(),
+		Txs:        wallets.Transactions(),
+		Tip:        wallets.tip,
+		Scanned:    wallets.scanned,
+	}
+	for address, w := range wallets.Wallets {
+		data.PublicKeys[address] = w.PublicKey
+	}
+	for address := range wallets.watchOnly {
+		data.WatchOnly = append(data.WatchOnly, address)
+	}
+	if !wallets.locked {
+		keys := wallets.secrets()
+		if wallets.encrypted {
+			data.Nonce, data.Keys = seal(wallets.key, keys)
+		} else {
+			data.Keys = keys
+		}
+	}
 
-	name := fmt.Sprintf(walletFile, nodeId)
-	// 注册椭圆 在内部调用接口
-	gob.Register(elliptic.P256())
+	var content bytes.Buffer // 钱包内容
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(&wallets) // 序列化
+	err := encoder.Encode(&data) // 序列化
 	if err != nil {
 		log.Panicf("encode the struct of wallets failed: %v", err)
 	}
 
-	// 将数据存入文件
-	err = ioutil.WriteFile(name, content.Bytes(), 0644)
+	// 将数据存入文件 私钥文件只允许所有者读写
+	name := fmt.Sprintf(walletFile, nodeId)
+	err = ioutil.WriteFile(name, content.Bytes(), 0600)
 	if err != nil {
 		log.Panicf("save content of wallet into file[%s] failed: %v", name, err)
 	}
+	if err := os.Chmod(name, 0600); err != nil {
+		log.Panicf("change mode of file[%s] failed: %v", name, err)
+	}
+}
+
+// Encrypt 使用口令加密钱包 加密后钱包处于锁定状态
+func (wallets *Wallets) Encrypt(passphrase string) error {
+	if wallets.encrypted {
+		return ErrAlreadyEncrypted
+	}
+	kdf := newKDFParams()
+	wallets.encrypted = true
+	wallets.kdf = kdf
+	wallets.key = kdf.deriveKey(passphrase)
+	wallets.SaveWallets(wallets.nodeId)
+	wallets.Lock()
+	return nil
+}
+
+// Unlock 使用口令解锁钱包 解锁只在当前进程内有效 超过timeout后自动锁定
+func (wallets *Wallets) Unlock(passphrase string, timeout time.Duration) error {
+	if !wallets.encrypted {
+		return ErrNotEncrypted
+	}
+	key := wallets.kdf.deriveKey(passphrase)
+	if err := wallets.open(key); err != nil {
+		return err
+	}
+	saveUnlockKey(wallets.nodeId, key, time.Now().Add(timeout))
+	return nil
+}
+
+// 需要私钥时检查钱包已解锁 加密的钱包使用当前进程中未过期的解锁密钥
+// 解锁超时后清除已解密的私钥 返回ErrWalletLocked
+func (wallets *Wallets) requireUnlocked() error {
+	if !wallets.encrypted {
+		return nil
+	}
+	key := loadUnlockKey(wallets.nodeId)
+	if key == nil {
+		if !wallets.locked {
+			wallets.Lock()
+		}
+		return ErrWalletLocked
+	}
+	if wallets.locked && wallets.open(key) != nil {
+		return ErrWalletLocked
+	}
+	return nil
+}
+
+// Lock 锁定钱包 清除内存中的解锁状态
+func (wallets *Wallets) Lock() {
+	removeUnlockKey(wallets.nodeId)
+	if !wallets.encrypted {
+		return
+	}
+	if !wallets.locked {
+		wallets.nonce, wallets.sealed = seal(wallets.key, wallets.secrets())
+	}
+	for _, w := range wallets.Wallets {
+		w.PrivateKey = ecdsa.PrivateKey{}
+	}
+	wallets.key = nil
+	wallets.seed = nil
+	wallets.locked = true
+}
+
+// ChangePassphrase 修改钱包口令 修改后钱包处于锁定状态
+func (wallets *Wallets) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if !wallets.encrypted {
+		return ErrNotEncrypted
+	}
+	if err := wallets.open(wallets.kdf.deriveKey(oldPassphrase)); err != nil {
+		return err
+	}
+	kdf := newKDFParams()
+	wallets.kdf = kdf
+	wallets.key = kdf.deriveKey(newPassphrase)
+	wallets.SaveWallets(wallets.nodeId)
+	wallets.Lock()
+	return nil
+}
+
+// 使用密钥解密私钥
+func (wallets *Wallets) open(key []byte) error {
+	keys, err := unseal(key, wallets.nonce, wallets.sealed)
+	if err != nil {
+		return err
+	}
+	wallets.setSecrets(keys)
+	wallets.key = key
+	wallets.locked = false
+	return nil
+}
+
+// CreateHDWallet 生成助记词并由其派生钱包 返回的助记词须由用户备份
+func (wallets *Wallets) CreateHDWallet(bits int) (string, error) {
+	mnemonic, err := NewMnemonic(bits)
+	if err != nil {
+		return "", err
+	}
+	if err := wallets.setSeed(mnemonic); err != nil {
+		return "", err
+	}
+	if _, err := wallets.NewAddress(0, ExternalChain); err != nil {
+		return "", err
+	}
+	return mnemonic, nil
+}
+
+// Restore 由助记词恢复钱包
+// 依次扫描各账户的收款链和找零链 连续gap个地址未被使用时停止 used判断地址是否在链上出现过
+func (wallets *Wallets) Restore(mnemonic string, gap int, used func(address string) bool) error {
+	if err := wallets.setSeed(mnemonic); err != nil {
+		return err
+	}
+	for account := uint32(0); ; account++ {
+		found := false
+		for _, change := range []uint32{ExternalChain, ChangeChain} {
+			ok, err := wallets.scan(account, change, gap, used)
+			if err != nil {
+				return err
+			}
+			found = found || ok
+		}
+		if !found && account > 0 {
+			delete(wallets.hd.Accounts, account)
+			break
+		}
+	}
+	if wallets.hd.Accounts[0].Next[ExternalChain] == 0 {
+		// 没有使用过的地址时生成第一个收款地址
+		if _, err := wallets.NewAddress(0, ExternalChain); err != nil {
+			return err
+		}
+	}
+	wallets.SaveWallets(wallets.nodeId)
+	return nil
+}
+
+// NewAddress 派生账户中收款链或找零链的下一个地址
+func (wallets *Wallets) NewAddress(account uint32, change uint32) (string, error) {
+	if wallets.hd == nil {
+		return "", ErrNoSeed
+	}
+	if err := wallets.requireUnlocked(); err != nil {
+		return "", err
+	}
+	if account >= HardenedOffset || change > ChangeChain {
+		return "", ErrInvalidPath
+	}
+	acct := wallets.account(account)
+	address, err := wallets.derive(KeyPath{Account: account, Change: change, Index: acct.Next[change]})
+	if err != nil {
+		return "", err
+	}
+	acct.Next[change]++
+	wallets.SaveWallets(wallets.nodeId)
+	return address, nil
+}
+
+// 使用助记词设置种子
+func (wallets *Wallets) setSeed(mnemonic string) error {
+	if wallets.hd != nil {
+		return ErrHasSeed
+	}
+	if err := wallets.requireUnlocked(); err != nil {
+		return err
+	}
+	if !IsValidMnemonic(mnemonic) {
+		return ErrInvalidMnemonic
+	}
+	wallets.seed = MnemonicToSeed(mnemonic, "")
+	wallets.hd = &HDChain{
+		Scheme:   crypto.DefaultScheme.Name(),
+		Accounts: make(map[uint32]*HDAccount),
+		Paths:    make(map[string]KeyPath),
+	}
+	return nil
+}
+
+// 派生使用的签名方案
+func (wallets *Wallets) hdScheme() crypto.SignatureScheme {
+	if wallets.hd.Scheme == "" {
+		return crypto.P256
+	}
+	scheme, err := crypto.SchemeByName(wallets.hd.Scheme)
+	if err != nil {
+		log.Panicf("unknown signature scheme[%s] of the wallet\n", wallets.hd.Scheme)
+	}
+	return scheme
+}
+
+func (wallets *Wallets) account(account uint32) *HDAccount {
+	acct, ok := wallets.hd.Accounts[account]
+	if !ok {
+		acct = &HDAccount{}
+		wallets.hd.Accounts[account] = acct
+	}
+	return acct
+}
+
+// 派生指定路径的地址并加入钱包集合
+func (wallets *Wallets) derive(path KeyPath) (string, error) {
+	w, err := deriveWallet(wallets.seed, wallets.hdScheme(), path)
+	if err != nil {
+		return "", err
+	}
+	address := string(w.GetAddress())
+	wallets.Wallets[address] = w
+	wallets.hd.Paths[address] = path
+	return address, nil
+}
+
+// 扫描一条地址链 返回是否发现使用过的地址
+func (wallets *Wallets) scan(account uint32, change uint32, gap int, used func(address string) bool) (bool, error) {
+	acct := wallets.account(account)
+	found := false
+	for index, unused := uint32(0), 0; unused < gap; index++ {
+		path := KeyPath{Account: account, Change: change, Index: index}
+		w, err := deriveWallet(wallets.seed, wallets.hdScheme(), path)
+		if err != nil {
+			return false, err
+		}
+		if !used(string(w.GetAddress())) {
+			unused++
+			continue
+		}
+		// 使用过的地址之前的地址也加入钱包 保持索引连续
+		for i := acct.Next[change]; i <= index; i++ {
+			if _, err := wallets.derive(KeyPath{Account: account, Change: change, Index: i}); err != nil {
+				return false, err
+			}
+		}
+		acct.Next[change] = index + 1
+		found = true
+		unused = 0
+	}
+	return found, nil
+}
+
+// 私钥数据 随机生成的私钥只保存标量D 公钥由D重新计算
+func (wallets *Wallets) secrets() []byte {
+	data := walletSecrets{Seed: wallets.seed, Keys: make(map[string][]byte)}
+	for address, w := range wallets.Wallets {
+		if _, ok := wallets.Path(address); ok {
+			continue
+		}
+		data.Keys[address] = w.PrivateKey.D.Bytes()
+	}
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(data); err != nil {
+		log.Panicf("encode the private keys failed: %v", err)
+	}
+	return content.Bytes()
+}
+
+func (wallets *Wallets) setSecrets(content []byte) {
+	var data walletSecrets
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data); err != nil {
+		// 旧版本钱包文件只保存私钥
+		data = walletSecrets{}
+		if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&data.Keys); err != nil {
+			log.Panicf("decode the private keys failed: %v", err)
+		}
+	}
+	for address, d := range data.Keys {
+		w, ok := wallets.Wallets[address]
+		if !ok {
+			continue
+		}
+		// 曲线由公钥格式确定 早期版本的钱包使用P-256
+		priKey, err := crypto.NewPrivateKey(crypto.SchemeOf(w.PublicKey).Curve(), d)
+		if err != nil {
+			log.Panicf("restore the private key of address[%s] failed: %v", address, err)
+		}
+		w.PrivateKey = *priKey
+	}
+	wallets.seed = data.Seed
+	if wallets.hd == nil {
+		return
+	}
+	for address, path := range wallets.hd.Paths {
+		w, err := deriveWallet(wallets.seed, wallets.hdScheme(), path)
+		if err != nil {
+			log.Panicf("derive the key of path[%s] failed: %v", path, err)
+		}
+		wallets.Wallets[address] = w
+	}
 }
@@ -0,0 +1,81 @@
+package wallet
+
+import (
+	"errors"
+	"sort"
+)
+
+// 私钥导入导出和只观察地址
+// 钱包只记录导入之后同步的交易 导入私钥或地址后须重新扫描区块链才能看到之前的交易
+
+var (
+	ErrAddressExists  = errors.New("address is already in the wallet")
+	ErrInvalidAddress = errors.New("invalid address")
+)
+
+// DumpPrivateKey 导出地址的私钥
+func (wallets *Wallets) DumpPrivateKey(address string) (string, error) {
+	w, err := wallets.GetWallet(address)
+	if err != nil {
+		return "", err
+	}
+	return EncodePrivateKey(&w.PrivateKey)
+}
+
+// ImportPrivateKey 导入私钥 返回对应的地址
+// 已作为只观察地址导入的地址会转为可签名地址
+func (wallets *Wallets) ImportPrivateKey(wif string) (string, error) {
+	if err := wallets.requireUnlocked(); err != nil {
+		return "", err
+	}
+	priv, err := DecodePrivateKey(wif)
+	if err != nil {
+		return "", err
+	}
+	w := newWalletFromKey(*priv)
+	address := string(w.GetAddress())
+	if _, ok := wallets.Wallets[address]; ok {
+		return "", ErrAddressExists
+	}
+	delete(wallets.watchOnly, address)
+	wallets.Wallets[address] = w
+	wallets.SaveWallets(wallets.nodeId)
+	return address, nil
+}
+
+// ImportAddress 导入只观察地址 计入余额和交易记录 但不能签名
+func (wallets *Wallets) ImportAddress(address string) error {
+	if !IsValidAddress([]byte(address)) {
+		return ErrInvalidAddress
+	}
+	if wallets.IsMine(address) {
+		return ErrAddressExists
+	}
+	wallets.watchOnly[address] = true
+	wallets.SaveWallets(wallets.nodeId)
+	return nil
+}
+
+// IsWatchOnly 是否为只观察地址
+func (wallets *Wallets) IsWatchOnly(address string) bool {
+	return wallets.watchOnly[address]
+}
+
+// IsMine 地址是否属于钱包 包括只观察地址
+func (wallets *Wallets) IsMine(address string) bool {
+	_, ok := wallets.Wallets[address]
+	return ok || wallets.watchOnly[address]
+}
+
+// Addresses 钱包中的所有地址 包括只观察地址
+func (wallets *Wallets) Addresses() []string {
+	var addresses []string
+	for address := range wallets.Wallets {
+		addresses = append(addresses, address)
+	}
+	for address := range wallets.watchOnly {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
@@ -0,0 +1,63 @@
+package wallet
+
+import (
+	"blockchain/crypto"
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+)
+
+// 私钥导入导出格式
+// 版本字节 + 32字节私钥 + 曲线标记 + 4字节校验和 再进行base58编码
+// 曲线标记0x01表示secp256k1(压缩公钥) 没有标记表示早期版本的P-256私钥
+
+const (
+	wifVersion    = 0x80
+	wifCompressed = 0x01
+)
+
+var ErrInvalidWIF = errors.New("invalid private key encoding")
+
+// EncodePrivateKey 编码私钥
+func EncodePrivateKey(priv *ecdsa.PrivateKey) (string, error) {
+	scheme, err := crypto.SchemeOfKey(priv)
+	if err != nil {
+		return "", err
+	}
+	payload := make([]byte, 33)
+	payload[0] = wifVersion
+	priv.D.FillBytes(payload[1:])
+	if scheme == crypto.Secp256k1 {
+		payload = append(payload, wifCompressed)
+	}
+	payload = append(payload, CheckSum(payload)...)
+	return string(crypto.Base58Encode(payload)), nil
+}
+
+// DecodePrivateKey 解码私钥 并检查校验和
+func DecodePrivateKey(wif string) (*ecdsa.PrivateKey, error) {
+	if len(wif) == 0 {
+		return nil, ErrInvalidWIF
+	}
+	for _, c := range []byte(wif[1:]) {
+		if !crypto.IsBase58(c) {
+			return nil, ErrInvalidWIF
+		}
+	}
+	data := crypto.Base58Decode([]byte(wif))
+	if len(data) != 37 && len(data) != 38 {
+		return nil, ErrInvalidWIF
+	}
+	payload, checksum := data[:len(data)-AddressCheckSumLen], data[len(data)-AddressCheckSumLen:]
+	if !bytes.Equal(CheckSum(payload), checksum) || payload[0] != wifVersion {
+		return nil, ErrInvalidWIF
+	}
+	scheme := crypto.P256
+	if len(payload) == 34 {
+		if payload[33] != wifCompressed {
+			return nil, ErrInvalidWIF
+		}
+		scheme = crypto.Secp256k1
+	}
+	return crypto.NewPrivateKey(scheme.Curve(), payload[1:33])
+}
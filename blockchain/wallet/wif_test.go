@@ -0,0 +1,110 @@
+package wallet
+
+import (
+	"blockchain/crypto"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// 同一私钥的两种编码 压缩标记表示secp256k1 没有标记表示P-256
+// 本项目的base58编码带有前缀1 其余与比特币的WIF相同
+func TestPrivateKeyEncoding(t *testing.T) {
+	const d = "0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d"
+	tests := []struct {
+		wif    string
+		scheme crypto.SignatureScheme
+	}{
+		{"1KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617", crypto.Secp256k1},
+		{"15HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ", crypto.P256},
+	}
+	for _, test := range tests {
+		t.Run(test.scheme.Name(), func(t *testing.T) {
+			priv, err := DecodePrivateKey(test.wif)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(priv.D.Bytes()) != d || priv.Curve != test.scheme.Curve() {
+				t.Fatalf("DecodePrivateKey() = %x on %s", priv.D, priv.Curve.Params().Name)
+			}
+			if wif, err := EncodePrivateKey(priv); err != nil || wif != test.wif {
+				t.Fatalf("EncodePrivateKey() = %s, %v", wif, err)
+			}
+		})
+	}
+
+	valid := tests[0].wif
+	invalid := []string{
+		"",
+		valid[:len(valid)-1] + "0", // 非base58字符
+		valid[:len(valid)-1] + "8", // 校验和错误
+		valid[:10],                 // 长度错误
+		string(crypto.Base58Encode(append(make([]byte, 33), CheckSum(make([]byte, 33))...))), // 版本错误
+	}
+	for _, wif := range invalid {
+		if _, err := DecodePrivateKey(wif); !errors.Is(err, ErrInvalidWIF) {
+			t.Fatalf("DecodePrivateKey(%q) = %v, want %v", wif, err, ErrInvalidWIF)
+		}
+	}
+}
+
+// 导出的私钥可以导入其他钱包 只观察地址导入私钥后可以签名
+func TestImportPrivateKey(t *testing.T) {
+	inTempDir(t)
+	w := NewWallet()
+	address := string(w.GetAddress())
+	wif, err := NewMemoryWallets(w).DumpPrivateKey(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallets := NewWallets("3000")
+	if err := wallets.ImportAddress(address); err != nil {
+		t.Fatal(err)
+	}
+	if !wallets.IsMine(address) || !wallets.IsWatchOnly(address) {
+		t.Fatal("the watch-only address is not in the wallet")
+	}
+	if _, err := wallets.GetWallet(address); !errors.Is(err, ErrWalletNotFound) {
+		t.Fatalf("GetWallet(watch-only) = %v, want %v", err, ErrWalletNotFound)
+	}
+	if err := wallets.ImportAddress(address); !errors.Is(err, ErrAddressExists) {
+		t.Fatalf("ImportAddress() twice = %v, want %v", err, ErrAddressExists)
+	}
+	if err := wallets.ImportAddress("not an address"); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("ImportAddress(invalid) = %v, want %v", err, ErrInvalidAddress)
+	}
+
+	imported, err := wallets.ImportPrivateKey(wif)
+	if err != nil || imported != address {
+		t.Fatalf("ImportPrivateKey() = %s, %v, want %s", imported, err, address)
+	}
+	if wallets.IsWatchOnly(address) {
+		t.Fatal("the address is still watch-only after importing its key")
+	}
+	if _, err := wallets.ImportPrivateKey(wif); !errors.Is(err, ErrAddressExists) {
+		t.Fatalf("ImportPrivateKey() twice = %v, want %v", err, ErrAddressExists)
+	}
+	// 导入的私钥和只观察状态保存到钱包文件
+	reloaded := NewWallets("3000")
+	if got, err := reloaded.GetWallet(address); err != nil || got.PrivateKey.D.Cmp(w.PrivateKey.D) != 0 {
+		t.Fatalf("GetWallet() after reload = %v", err)
+	}
+	if len(reloaded.Addresses()) != 1 {
+		t.Fatalf("%d addresses after reload, want 1", len(reloaded.Addresses()))
+	}
+}
+
+// 锁定的钱包不能导入私钥
+func TestImportPrivateKeyLocked(t *testing.T) {
+	inTempDir(t)
+	newEncryptedWallets(t, "3000", "secret")
+	wallets := NewWallets("3000")
+	wif, err := EncodePrivateKey(&NewWallet().PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wallets.ImportPrivateKey(wif); !errors.Is(err, ErrWalletLocked) {
+		t.Fatalf("ImportPrivateKey() on a locked wallet = %v, want %v", err, ErrWalletLocked)
+	}
+}